@@ -0,0 +1,361 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-estoria/estoria/aggregatestore"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/go-estoria/estoria/typeid"
+	"github.com/notnil/chess"
+)
+
+// Analysis is what can be read off a position without searching it: the
+// material, which pieces are attacked and which of them hang, the checks the
+// side to move has, and the static evaluation the computer opponent's search
+// scores its leaves with (see computer.go). A game's FEN is all it needs, so
+// a position at any version is one history load away, and every version of a
+// game is one pass over its stream.
+//
+// Attacks are worked out square by square, as a player counts them over the
+// board: a piece attacks the squares it could capture on, pinned or not, and
+// defends the pieces of its own it attacks the squares of. Kings are never
+// listed as attacked — an attacked king is a check — but do attack and
+// defend.
+
+// A positionAnalysis is the analysis of a game as it stood at one version.
+// Material, the balance and evaluations are in centipawns, and mobility is a
+// count of squares; the balance and the evaluation are from White's side, so
+// a positive number favours White.
+type positionAnalysis struct {
+	Version int64  `json:"version"`
+	FEN     string `json:"fen"`
+	Turn    string `json:"turn"`
+
+	Material bySide `json:"material"`
+	Balance  int    `json:"balance"`
+
+	// Mobility counts, piece by piece, the squares each side attacks that
+	// its own pieces don't stand on; LegalMoves is the side to move's moves.
+	Mobility   bySide `json:"mobility"`
+	LegalMoves int    `json:"legalMoves"`
+
+	// Attacked is every piece the other side attacks, and Hanging the ones
+	// among them that are undefended or attacked by something worth less.
+	Attacked []threatenedPiece `json:"attacked"`
+	Hanging  []threatenedPiece `json:"hanging"`
+
+	// Checks are the moves the side to move could give check with.
+	Checks []checkingMove `json:"checks"`
+
+	// Eval is the static evaluation. A checkmated position scores the
+	// computer's mate score, ±1000000, and a stalemate 0.
+	Eval int `json:"eval"`
+}
+
+// bySide is a number for each side.
+type bySide struct {
+	White int `json:"white"`
+	Black int `json:"black"`
+}
+
+// A threatenedPiece is a piece under attack, the squares it is attacked
+// from, and those it is defended from.
+type threatenedPiece struct {
+	Square    string   `json:"square"`
+	Piece     string   `json:"piece"` // "queen", "knight", ...
+	Color     string   `json:"color"`
+	Attackers []string `json:"attackers"`
+	Defenders []string `json:"defenders"`
+}
+
+// A checkingMove is a legal move that gives check, in UCI and SAN.
+type checkingMove struct {
+	UCI string `json:"uci"`
+	SAN string `json:"san"`
+}
+
+// An evaluationPoint is one version's place in a game's evaluation graph.
+type evaluationPoint struct {
+	Version int64 `json:"version"`
+	Ply     int   `json:"ply"` // the moves played by this version
+	Balance int   `json:"balance"`
+	Eval    int   `json:"eval"`
+}
+
+// handleAnalysis answers GET /api/games/{id}/analysis: the analysis of the
+// live position, or of the one at the "version" query parameter.
+func (s *server) handleAnalysis(w http.ResponseWriter, r *http.Request) {
+	gameID, ok := pathGameID(w, r)
+	if !ok {
+		return
+	}
+
+	agg, _, ok := s.loadVersion(w, r, gameID)
+	if !ok {
+		return
+	}
+
+	analysis, err := analyzeGame(agg.Entity(), agg.Version())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, analysis)
+}
+
+// handleEvaluations answers GET /api/games/{id}/evaluations: the material
+// balance and evaluation at every version of the game, from 1 to its latest.
+// Rather than a history load per version, it folds the stream once, as a
+// load does, and evaluates the game after each event.
+func (s *server) handleEvaluations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	gameID, ok := pathGameID(w, r)
+	if !ok {
+		return
+	}
+
+	iter, err := s.events.ReadStream(ctx, typeid.New("game", gameID), eventstore.ReadStreamOptions{})
+	if err != nil {
+		if errors.Is(err, eventstore.ErrStreamNotFound) {
+			err = aggregatestore.ErrAggregateNotFound
+		}
+		writeLoadError(w, err)
+		return
+	}
+	defer iter.Close(ctx)
+
+	points := []evaluationPoint{}
+	game := NewGame(gameID)
+	for {
+		evt, err := iter.Next(ctx)
+		if errors.Is(err, eventstore.ErrEndOfEventStream) {
+			break
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		event, err := decodeGameEvent(evt)
+		if err == nil {
+			game, err = event.ApplyTo(ctx, game)
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("version %d: %v", evt.StreamVersion, err))
+			return
+		}
+
+		analysis, err := analyzeGame(game, evt.StreamVersion)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		points = append(points, evaluationPoint{
+			Version: evt.StreamVersion,
+			Ply:     len(game.MovesUCI),
+			Balance: analysis.Balance,
+			Eval:    analysis.Eval,
+		})
+	}
+	if len(points) == 0 {
+		writeLoadError(w, aggregatestore.ErrAggregateNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"gameId":      gameID.String(),
+		"version":     points[len(points)-1].Version,
+		"evaluations": points,
+	})
+}
+
+// analyzeGame analyzes the game's position as of the given version.
+func analyzeGame(game Game, version int64) (positionAnalysis, error) {
+	pos := &chess.Position{}
+	if err := pos.UnmarshalText([]byte(game.FEN)); err != nil {
+		return positionAnalysis{}, fmt.Errorf("decoding position %q: %w", game.FEN, err)
+	}
+
+	analysis := positionAnalysis{
+		Version:  version,
+		FEN:      game.FEN,
+		Turn:     game.Turn,
+		Attacked: []threatenedPiece{},
+		Hanging:  []threatenedPiece{},
+		Checks:   []checkingMove{},
+	}
+
+	board := pos.Board()
+	attackers := map[chess.Color]map[chess.Square][]chess.Square{
+		chess.White: {},
+		chess.Black: {},
+	}
+	for from, piece := range board.SquareMap() {
+		color := piece.Color()
+		value := pieceValues[piece.Type()]
+		if color == chess.White {
+			analysis.Material.White += value
+		} else {
+			analysis.Material.Black += value
+		}
+
+		for _, to := range attackedSquares(board, from, piece) {
+			attackers[color][to] = append(attackers[color][to], from)
+			if target := board.Piece(to); target == chess.NoPiece || target.Color() != color {
+				if color == chess.White {
+					analysis.Mobility.White++
+				} else {
+					analysis.Mobility.Black++
+				}
+			}
+		}
+	}
+	analysis.Balance = analysis.Material.White - analysis.Material.Black
+
+	for sq := chess.A1; sq <= chess.H8; sq++ {
+		piece := board.Piece(sq)
+		if piece == chess.NoPiece || piece.Type() == chess.King {
+			continue
+		}
+		by := attackers[piece.Color().Other()][sq]
+		if len(by) == 0 {
+			continue
+		}
+
+		threat := threatenedPiece{
+			Square:    sq.String(),
+			Piece:     pieceNames[piece.Type()],
+			Color:     colorName(piece.Color()),
+			Attackers: squareNames(by),
+			Defenders: squareNames(attackers[piece.Color()][sq]),
+		}
+		analysis.Attacked = append(analysis.Attacked, threat)
+
+		// a king can only take what nothing defends, so it is never the
+		// cheaper attacker
+		cheapest := pieceValues[piece.Type()]
+		for _, from := range by {
+			if attacker := board.Piece(from).Type(); attacker != chess.King {
+				cheapest = min(cheapest, pieceValues[attacker])
+			}
+		}
+		if len(threat.Defenders) == 0 || cheapest < pieceValues[piece.Type()] {
+			analysis.Hanging = append(analysis.Hanging, threat)
+		}
+	}
+
+	moves := pos.ValidMoves()
+	if !game.Over() {
+		analysis.LegalMoves = len(moves)
+		for _, move := range moves {
+			if move.HasTag(chess.Check) {
+				analysis.Checks = append(analysis.Checks, checkingMove{
+					UCI: move.String(),
+					SAN: chess.AlgebraicNotation{}.Encode(pos, move),
+				})
+			}
+		}
+	}
+
+	switch {
+	case len(moves) == 0 && pos.Status() == chess.Checkmate:
+		analysis.Eval = -mateScore
+	case len(moves) == 0:
+		analysis.Eval = 0
+	default:
+		analysis.Eval = evaluate(pos)
+	}
+	if pos.Turn() == chess.Black {
+		analysis.Eval = -analysis.Eval
+	}
+	return analysis, nil
+}
+
+// pieceNames are the names analyses give the pieces.
+var pieceNames = map[chess.PieceType]string{
+	chess.King:   "king",
+	chess.Queen:  "queen",
+	chess.Rook:   "rook",
+	chess.Bishop: "bishop",
+	chess.Knight: "knight",
+	chess.Pawn:   "pawn",
+}
+
+// The directions the pieces move in, as file and rank steps.
+var (
+	orthogonals = [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	diagonals   = [][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+	kingSteps   = append(append([][2]int{}, orthogonals...), diagonals...)
+	knightJumps = [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+)
+
+// attackedSquares returns the squares the piece on from attacks: those it
+// could capture on if an enemy piece stood there, whoever stands there now.
+// A pawn attacks diagonally forward, and a sliding piece up to and including
+// the first square along each line that isn't empty.
+func attackedSquares(board *chess.Board, from chess.Square, piece chess.Piece) []chess.Square {
+	file, rank := int(from.File()), int(from.Rank())
+	var squares []chess.Square
+	at := func(f, r int) (chess.Square, bool) {
+		if f < 0 || f > 7 || r < 0 || r > 7 {
+			return 0, false
+		}
+		return chess.NewSquare(chess.File(f), chess.Rank(r)), true
+	}
+	steps := func(dirs [][2]int) {
+		for _, d := range dirs {
+			if sq, ok := at(file+d[0], rank+d[1]); ok {
+				squares = append(squares, sq)
+			}
+		}
+	}
+	slides := func(dirs [][2]int) {
+		for _, d := range dirs {
+			for f, r := file+d[0], rank+d[1]; ; f, r = f+d[0], r+d[1] {
+				sq, ok := at(f, r)
+				if !ok {
+					break
+				}
+				squares = append(squares, sq)
+				if board.Piece(sq) != chess.NoPiece {
+					break
+				}
+			}
+		}
+	}
+
+	switch piece.Type() {
+	case chess.Pawn:
+		forward := 1
+		if piece.Color() == chess.Black {
+			forward = -1
+		}
+		steps([][2]int{{-1, forward}, {1, forward}})
+	case chess.Knight:
+		steps(knightJumps)
+	case chess.King:
+		steps(kingSteps)
+	case chess.Bishop:
+		slides(diagonals)
+	case chess.Rook:
+		slides(orthogonals)
+	case chess.Queen:
+		slides(kingSteps)
+	}
+	return squares
+}
+
+// squareNames names squares in board order, from a1 to h8.
+func squareNames(squares []chess.Square) []string {
+	names := []string{}
+	for sq := chess.A1; sq <= chess.H8; sq++ {
+		for _, s := range squares {
+			if s == sq {
+				names = append(names, sq.String())
+				break
+			}
+		}
+	}
+	return names
+}
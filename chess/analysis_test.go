@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// TestAnalysis analyzes scholar's mate the move before it lands and after,
+// and evaluates every version of the game.
+func TestAnalysis(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	gameID := uuid.Must(uuid.NewV7())
+	agg := srv.live.New(gameID)
+	if err := agg.Append(
+		GameCreated{White: "Alice", Black: "Bob"},
+		MoveMade{UCI: "e2e4"}, MoveMade{UCI: "e7e5"},
+		MoveMade{UCI: "f1c4"}, MoveMade{UCI: "b8c6"},
+		MoveMade{UCI: "d1h5"}, MoveMade{UCI: "g8f6"},
+		MoveMade{UCI: "h5f7"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.live.Save(ctx, agg, nil); err != nil {
+		t.Fatal(err)
+	}
+	base := "/api/games/" + gameID.String()
+
+	// after 3...Nf6??, the knight attacks White's queen, and the e4 pawn,
+	// which nothing defends; f7 is attacked twice and defended by the king
+	var before positionAnalysis
+	if code := do(t, h, http.MethodGet, base+"/analysis?version=7", nil, &before); code != http.StatusOK {
+		t.Fatalf("analyzing version 7 = %d", code)
+	}
+	if before.Version != 7 || before.Turn != "white" || before.Balance != 0 || before.Material.White != 4000 {
+		t.Errorf("version %d has %s to move, material %+v, balance %d; want 7, white, 4000 each, 0",
+			before.Version, before.Turn, before.Material, before.Balance)
+	}
+
+	squares := func(pieces []threatenedPiece) []string {
+		var names []string
+		for _, p := range pieces {
+			names = append(names, p.Square)
+		}
+		slices.Sort(names)
+		return names
+	}
+	if got := squares(before.Attacked); !slices.Equal(got, []string{"e4", "e5", "f7", "h5", "h7"}) {
+		t.Errorf("attacked pieces are on %v, want e4, e5, f7, h5 and h7", got)
+	}
+	if got := squares(before.Hanging); !slices.Equal(got, []string{"e4", "h5"}) {
+		t.Errorf("hanging pieces are on %v, want e4 and h5", got)
+	}
+	for _, p := range before.Attacked {
+		if p.Square == "f7" && (!slices.Equal(p.Attackers, []string{"c4", "h5"}) || !slices.Equal(p.Defenders, []string{"e8"})) {
+			t.Errorf("f7 is attacked from %v and defended from %v, want c4 and h5, and e8", p.Attackers, p.Defenders)
+		}
+	}
+
+	var checks []string
+	for _, c := range before.Checks {
+		checks = append(checks, c.SAN)
+	}
+	for _, want := range []string{"Bxf7+", "Qxf7#"} {
+		if !slices.Contains(checks, want) {
+			t.Errorf("the checks are %v, missing %s", checks, want)
+		}
+	}
+
+	// the live game is mate: no moves, no checks, and White's win in full
+	var mated positionAnalysis
+	if code := do(t, h, http.MethodGet, base+"/analysis", nil, &mated); code != http.StatusOK {
+		t.Fatalf("analyzing the live game = %d", code)
+	}
+	if mated.Version != 8 || mated.LegalMoves != 0 || len(mated.Checks) != 0 || mated.Eval != mateScore || mated.Balance != 100 {
+		t.Errorf("the mate is version %d with %d moves, %d checks, eval %d and balance %d; want 8, 0, 0, %d and 100",
+			mated.Version, mated.LegalMoves, len(mated.Checks), mated.Eval, mated.Balance, mateScore)
+	}
+
+	var evaluations struct {
+		Version     int64             `json:"version"`
+		Evaluations []evaluationPoint `json:"evaluations"`
+	}
+	if code := do(t, h, http.MethodGet, base+"/evaluations", nil, &evaluations); code != http.StatusOK {
+		t.Fatalf("evaluating every version = %d", code)
+	}
+	if len(evaluations.Evaluations) != 8 || evaluations.Version != 8 {
+		t.Fatalf("%d evaluations up to version %d, want 8 up to 8", len(evaluations.Evaluations), evaluations.Version)
+	}
+	for i, point := range evaluations.Evaluations {
+		if point.Version != int64(i+1) || point.Ply != i {
+			t.Errorf("evaluation %d is of version %d at ply %d", i, point.Version, point.Ply)
+		}
+	}
+	if first, at7 := evaluations.Evaluations[0], evaluations.Evaluations[6]; first.Eval != 0 || at7.Eval != before.Eval {
+		t.Errorf("the start evaluates to %d and version 7 to %d, want 0 and %d", first.Eval, at7.Eval, before.Eval)
+	}
+	if last := evaluations.Evaluations[7]; last.Eval != mateScore {
+		t.Errorf("the mate evaluates to %d, want %d", last.Eval, mateScore)
+	}
+
+	for path, want := range map[string]int{
+		base + "/analysis?version=0":                                      http.StatusBadRequest,
+		"/api/games/" + uuid.Must(uuid.NewV7()).String() + "/analysis":    http.StatusNotFound,
+		"/api/games/" + uuid.Must(uuid.NewV7()).String() + "/evaluations": http.StatusNotFound,
+	} {
+		if code := do(t, h, http.MethodGet, path, nil, nil); code != want {
+			t.Errorf("GET %s = %d, want %d", path, code, want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-estoria/estoria"
+	"github.com/go-estoria/estoria/aggregatestore"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/gofrs/uuid/v5"
+)
+
+// A running clock has to be able to end a game when nobody does anything, so
+// the server keeps a timer per game whose clock is running, set for the
+// moment the side to move runs out of time. When it fires it appends a
+// FlagFell event like any other command, based on the version the timer was
+// set at. If a last-second move was saved first, the stream has moved past
+// that version and the flag's save fails the ExpectVersion check; the move's
+// own save has set a new timer by then. And if the flag was saved first, the
+// move fails the same way. Only one of them can win.
+//
+// Timers live in memory. On startup the server sets one for every game whose
+// clock is running, so a flag that fell while it was down falls right away.
+
+// flagTimers holds the pending timer for each game with a running clock.
+type flagTimers struct {
+	fall func(gameID uuid.UUID, version int64)
+	now  func() time.Time
+
+	mu     sync.Mutex
+	timers map[uuid.UUID]*time.Timer
+}
+
+func newFlagTimers(fall func(gameID uuid.UUID, version int64), now func() time.Time) *flagTimers {
+	return &flagTimers{fall: fall, now: now, timers: make(map[uuid.UUID]*time.Timer)}
+}
+
+// set replaces the game's timer with one for its state at this version, or
+// clears it when no clock is running. It is called after every save.
+func (f *flagTimers) set(agg *aggregatestore.Aggregate[Game]) {
+	game, version := agg.Entity(), agg.Version()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if timer, ok := f.timers[game.ID]; ok {
+		timer.Stop()
+		delete(f.timers, game.ID)
+	}
+
+	deadline, running := game.flagDeadline()
+	if !running {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(deadline.Sub(f.now()), func() {
+		f.mu.Lock()
+		if f.timers[game.ID] == timer {
+			delete(f.timers, game.ID)
+		}
+		f.mu.Unlock()
+
+		f.fall(game.ID, version)
+	})
+	f.timers[game.ID] = timer
+}
+
+// pending returns the number of games with a timer set.
+func (f *flagTimers) pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.timers)
+}
+
+// stopAll cancels every timer, for when every game has been deleted.
+func (f *flagTimers) stopAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, timer := range f.timers {
+		timer.Stop()
+		delete(f.timers, id)
+	}
+}
+
+// flagFall appends FlagFell to a game whose timer fired at the given version.
+func (s *server) flagFall(gameID uuid.UUID, version int64) {
+	ctx := context.Background()
+
+	_, err := s.execute(ctx, gameID, version, func(game Game) (estoria.EntityEvent[Game], error) {
+		return FlagFell{Color: game.Turn, At: s.now()}, nil
+	})
+
+	var rejected rejectedError
+	var mismatch eventstore.StreamVersionMismatchError
+	switch {
+	case err == nil:
+		estoria.GetLogger().Info("flag fell", "game_id", gameID, "version", version)
+	case errors.As(err, &mismatch):
+		// a move was saved first; its save set the next timer
+	case errors.Is(err, aggregatestore.ErrAggregateNotFound):
+		// the game was deleted by a demo reset
+	case errors.As(err, &rejected):
+		// the wall clock moved under the timer, so the flag isn't down yet;
+		// set the timer again from the game as it is now
+		estoria.GetLogger().Warn("flag timer fired early", "game_id", gameID, "error", err)
+		if agg, err := s.live.Load(ctx, gameID, nil); err == nil {
+			s.flags.set(agg)
+		}
+	default:
+		estoria.GetLogger().Error("appending flag fall", "game_id", gameID, "error", err)
+	}
+}
+
+// startClocks sets a flag timer for every game whose clock is running.
+func (s *server) startClocks(ctx context.Context) error {
+	return s.forEachGame(ctx, s.flags.set)
+}
+
+// forEachGame loads every game at its latest version and calls fn with it.
+func (s *server) forEachGame(ctx context.Context, fn func(agg *aggregatestore.Aggregate[Game])) error {
+	streams, err := s.events.ListStreams(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, stream := range streams {
+		if stream.StreamID.Type != "game" {
+			continue
+		}
+
+		agg, err := s.live.Load(ctx, stream.StreamID.UUID, nil)
+		if err != nil {
+			return err
+		}
+		fn(agg)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// TestClocks plays a timed game through the HTTP API: clock readings on
+// moves, a move after the flag fell, a flag timer that loses the race to a
+// move, and one that ends the game.
+func TestClocks(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	srv := newTestServer(t)
+	clock := &fakeClock{now: time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)}
+	srv.now = clock.Now
+	h := srv.routes()
+
+	for name, tc := range map[string]TimeControl{
+		"negative time":          {InitialSeconds: -1},
+		"a day":                  {InitialSeconds: 24 * 60 * 60},
+		"increment without time": {IncrementSeconds: 2},
+	} {
+		if code := do(t, h, http.MethodPost, "/api/games", map[string]any{"timeControl": tc}, nil); code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: creating a game = %d, want 422", name, code)
+		}
+	}
+
+	var created struct {
+		gameMessage
+		seatGrant
+	}
+	do(t, h, http.MethodPost, "/api/games", map[string]any{
+		"timeControl": TimeControl{InitialSeconds: 60, IncrementSeconds: 2},
+		"seat":        "both",
+	}, &created)
+	gameID := uuid.FromStringOrNil(created.GameID)
+	base := "/api/games/" + created.GameID
+	move := func(uci string) int {
+		t.Helper()
+		return doAs(t, h, created.Token, http.MethodPost, base+"/move", map[string]any{"uci": uci}, nil)
+	}
+	load := func() gameMessage {
+		t.Helper()
+		var msg gameMessage
+		do(t, h, http.MethodGet, base, nil, &msg)
+		return msg
+	}
+
+	// White's first move is free, and starts Black's clock
+	move("e2e4")
+	if srv.flags.pending() != 1 {
+		t.Errorf("%d flag timers after the first move, want 1", srv.flags.pending())
+	}
+	clock.Advance(5 * time.Second)
+	move("e7e5")
+	if game := load().Game; game.BlackClockMs != 57_000 || game.WhiteClockMs != 60_000 || len(game.MoveClocksMs) != 2 {
+		t.Fatalf("clocks = white %d, black %d, moves %v; want 60000, 57000 after two moves",
+			game.WhiteClockMs, game.BlackClockMs, game.MoveClocksMs)
+	}
+
+	// too late is too late, whether or not the timer has fired
+	clock.Advance(61 * time.Second)
+	if code := move("g1f3"); code != http.StatusUnprocessableEntity {
+		t.Fatalf("moving after the flag fell = %d, want 422", code)
+	}
+
+	// a timer that fires for a version the game has moved past loses the race
+	clock.Advance(-30 * time.Second)
+	before := load().Version
+	move("g1f3")
+	clock.Advance(time.Hour)
+	srv.flagFall(gameID, before)
+	if msg := load(); msg.Version != before+1 || msg.Game.Over() {
+		t.Fatalf("after a stale flag = v%d, over %v; want the move at v%d to stand", msg.Version, msg.Game.Over(), before+1)
+	}
+
+	// on startup, a flag that fell while the server was down falls at once
+	if err := srv.startClocks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var game Game
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if game = load().Game; game.Over() {
+			break
+		}
+	}
+	if game.Outcome != "1-0" || game.Method != "Timeout" || game.BlackClockMs != 0 {
+		t.Fatalf("game = %s by %q with black on %dms, want 1-0 by timeout", game.Outcome, game.Method, game.BlackClockMs)
+	}
+	if srv.flags.pending() != 0 {
+		t.Errorf("%d flag timers after the game ended, want 0", srv.flags.pending())
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base+"/pgn", nil))
+	pgn, _ := io.ReadAll(rec.Body)
+	flat := strings.Join(strings.Fields(string(pgn)), " ") // movetext wraps
+	for _, want := range []string{
+		`[TimeControl "60+2"]`,
+		`[Termination "time forfeit"]`,
+		"1. e4 { [%clk 0:01:00] } 1... e5 { [%clk 0:00:57] } 2. Nf3 { [%clk 0:00:31] } { White wins on time. } 1-0",
+	} {
+		if !strings.Contains(flat, want) {
+			t.Errorf("PGN is missing %q:\n%s", want, pgn)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/go-estoria/estoria"
+	"github.com/go-estoria/estoria/aggregatestore"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/notnil/chess"
+)
+
+// A game can be played against the computer, which holds one of its seats.
+// The computer is a player like any other as far as the stream goes: its
+// moves are MoveMade events, saved by execute from the version it searched,
+// with the same seat check before ApplyTo and the same ExpectVersion check
+// on save as a move over HTTP. A resignation, a takeback or a flag saved
+// while it was thinking moves the stream on, and its move fails the check
+// and is dropped; the save that beat it has started it again if it is still
+// the computer's turn.
+//
+// The AfterSave hook starts it whenever a save leaves it to move, the game's
+// creation included when it plays White. It searches in a goroutine of its
+// own, since the hook runs inside the save it follows. It answers no offers:
+// its move declines a draw offer or takeback request, as any move does.
+//
+// The search is a plain alpha-beta over the rules engine's positions, as
+// many plies deep as the game was created with, scoring material and a
+// little for central pieces. It knows nothing of repetitions or the
+// fifty-move rule, so it will walk into a draw it is winning.
+
+const (
+	// defaultComputerDepth is how deep the computer searches unless the game
+	// says otherwise, and maxComputerDepth how deep it can be asked to.
+	defaultComputerDepth = 2
+	maxComputerDepth     = 4
+
+	// mateScore is the score of being checkmated, less the plies it takes,
+	// so that a nearer mate scores higher for the side giving it.
+	mateScore = 1_000_000
+)
+
+// computerPlayer starts the computer's move in any game a save leaves it to
+// move in.
+type computerPlayer struct {
+	play func(game Game, version int64)
+
+	wg sync.WaitGroup
+}
+
+func newComputerPlayer(play func(game Game, version int64)) *computerPlayer {
+	return &computerPlayer{play: play}
+}
+
+// reply starts the computer thinking if it is to move in the game as saved
+// at this version. It is called after every save.
+func (c *computerPlayer) reply(agg *aggregatestore.Aggregate[Game]) {
+	game, version := agg.Entity(), agg.Version()
+	if game.Computer == "" || game.Computer != game.Turn || game.Over() {
+		return
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.play(game, version)
+	}()
+}
+
+// wait blocks until the computer has finished every move it has started.
+func (c *computerPlayer) wait() {
+	c.wg.Wait()
+}
+
+// computerMove searches the game as it stood at version for the computer's
+// move, and saves it from that version.
+func (s *server) computerMove(game Game, version int64) {
+	ctx := context.Background()
+
+	uci, err := bestMove(game, game.ComputerDepth)
+	if err != nil {
+		estoria.GetLogger().Error("searching for the computer's move", "game_id", game.ID, "error", err)
+		return
+	}
+
+	_, err = s.execute(ctx, game.ID, version, func(game Game) (estoria.EntityEvent[Game], error) {
+		move, err := s.newMove(game, uci)
+		if err != nil {
+			return nil, err
+		}
+		if err := authorizeComputer(game, move); err != nil {
+			return nil, err
+		}
+		return move, nil
+	})
+
+	var mismatch eventstore.StreamVersionMismatchError
+	switch {
+	case err == nil:
+	case errors.As(err, &mismatch):
+		// the game moved on while the computer thought; its save started
+		// the computer again if it is still to move
+	case errors.Is(err, aggregatestore.ErrAggregateNotFound):
+		// the game was deleted by a demo reset
+	default:
+		estoria.GetLogger().Error("saving the computer's move", "game_id", game.ID, "version", version, "error", err)
+	}
+}
+
+// startComputer starts the computer in every game it was left to move in
+// when the server last stopped.
+func (s *server) startComputer(ctx context.Context) error {
+	return s.forEachGame(ctx, s.computer.reply)
+}
+
+// bestMove returns, in UCI notation, the move the search scores best for the
+// side to move in the game, looking depth plies ahead.
+func bestMove(game Game, depth int) (string, error) {
+	if err := game.inProgress(); err != nil {
+		return "", err
+	}
+	engine, err := game.rebuild()
+	if err != nil {
+		return "", fmt.Errorf("rebuilding position: %w", err)
+	}
+
+	move := searchPosition(engine.Position(), max(depth, 1))
+	if move == nil {
+		return "", errors.New("there is no move to make")
+	}
+	return move.String(), nil
+}
+
+// searchPosition returns the best move in pos, or nil if there is none. Of
+// moves that score the same, it keeps the first in search order.
+func searchPosition(pos *chess.Position, depth int) *chess.Move {
+	var best *chess.Move
+	alpha := -mateScore - 1
+	for _, move := range orderMoves(pos, pos.ValidMoves()) {
+		score := -negamax(pos.Update(move), depth-1, 1, move.HasTag(chess.Check), -mateScore-1, -alpha)
+		if best == nil || score > alpha {
+			best, alpha = move, score
+		}
+	}
+	return best
+}
+
+// negamax scores pos for the side to move, searching depth plies more with
+// alpha-beta pruning. ply is how far pos is from the root, and check whether
+// the move into it gave check.
+//
+// Working out the moves is most of what a search costs, so a position at the
+// search's edge has them worked out only if it is in check, to see whether
+// it is mate. Anywhere else, a stalemate there scores as the material does.
+func negamax(pos *chess.Position, depth, ply int, check bool, alpha, beta int) int {
+	if depth == 0 && !check {
+		return evaluate(pos)
+	}
+	moves := pos.ValidMoves()
+	if len(moves) == 0 {
+		if check {
+			return -mateScore + ply
+		}
+		return 0 // stalemate
+	}
+	if depth == 0 {
+		return evaluate(pos)
+	}
+
+	for _, move := range orderMoves(pos, moves) {
+		score := -negamax(pos.Update(move), depth-1, ply+1, move.HasTag(chess.Check), -beta, -alpha)
+		if score >= beta {
+			return beta
+		}
+		alpha = max(alpha, score)
+	}
+	return alpha
+}
+
+// pieceValues are the pieces' worth in centipawns. The king's is never
+// counted, since both sides always have one.
+var pieceValues = map[chess.PieceType]int{
+	chess.Pawn:   100,
+	chess.Knight: 320,
+	chess.Bishop: 330,
+	chess.Rook:   500,
+	chess.Queen:  900,
+}
+
+// evaluate scores pos statically for the side to move: the material each
+// side has, plus a few centipawns for each pawn, knight and bishop near the
+// centre.
+func evaluate(pos *chess.Position) int {
+	score := 0
+	for sq, piece := range pos.Board().SquareMap() {
+		value := pieceValues[piece.Type()]
+		switch piece.Type() {
+		case chess.Pawn, chess.Knight, chess.Bishop:
+			value += 4 * centrality(sq)
+		}
+		if piece.Color() == pos.Turn() {
+			score += value
+		} else {
+			score -= value
+		}
+	}
+	return score
+}
+
+// centrality is 3 for the four centre squares, down to 0 on the edge.
+func centrality(sq chess.Square) int {
+	file, rank := int(sq.File()), int(sq.Rank())
+	return min(file, 7-file, rank, 7-rank)
+}
+
+// orderMoves sorts moves to search the likeliest best first, which is what
+// lets alpha-beta prune: promotions, then captures of the most valuable
+// piece by the least valuable one, then the rest in the engine's order.
+func orderMoves(pos *chess.Position, moves []*chess.Move) []*chess.Move {
+	board := pos.Board()
+	priority := func(move *chess.Move) int {
+		p := pieceValues[move.Promo()]
+		if move.HasTag(chess.Capture) {
+			victim := pieceValues[board.Piece(move.S2()).Type()]
+			if move.HasTag(chess.EnPassant) {
+				victim = pieceValues[chess.Pawn]
+			}
+			p += 10*victim - pieceValues[board.Piece(move.S1()).Type()]
+		}
+		return p
+	}
+	slices.SortStableFunc(moves, func(a, b *chess.Move) int {
+		return priority(b) - priority(a)
+	})
+	return moves
+}
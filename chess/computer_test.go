@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"testing"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/notnil/chess"
+)
+
+// TestBestMoveIsLegal searches positions from random games at every depth
+// up to three, and checks that every move the search returns, at every depth,
+// is legal in its position.
+func TestBestMoveIsLegal(t *testing.T) {
+	t.Parallel()
+	rng := rand.New(rand.NewPCG(3, 4))
+
+	for range 8 {
+		pos := chess.NewGame().Position()
+		for ply := 0; ply < 60; ply++ {
+			moves := pos.ValidMoves()
+			if len(moves) == 0 {
+				if searchPosition(pos, 2) != nil {
+					t.Errorf("the search found a move in %s, where the game is over", pos)
+				}
+				break
+			}
+			legal := map[string]bool{}
+			for _, move := range moves {
+				legal[move.String()] = true
+			}
+
+			if ply%6 == 5 {
+				for depth := 1; depth <= 3; depth++ {
+					move := searchPosition(pos, depth)
+					if move == nil || !legal[move.String()] {
+						t.Fatalf("at depth %d the search picked %v in %s, which isn't legal", depth, move, pos)
+					}
+				}
+			}
+
+			pos = pos.Update(moves[rng.IntN(len(moves))])
+		}
+	}
+}
+
+// TestBestMoveTakesMate checks the search mates in one when it can, and
+// stops a mate in one when it can't.
+func TestBestMoveTakesMate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		moves []string
+		want  string
+	}{
+		// 1. e4 e5 2. Bc4 Nc6 3. Qh5 Nf6?? 4. Qxf7#
+		{[]string{"e2e4", "e7e5", "f1c4", "b8c6", "d1h5", "g8f6"}, "h5f7"},
+		// 1. f3 e5 2. g4 Qh4#
+		{[]string{"f2f3", "e7e5", "g2g4"}, "d8h4"},
+		// 1. e4 e5 2. Bc4 Nc6 3. Qh5: only g6 or Qe7 and the like save f7
+		{[]string{"e2e4", "e7e5", "f1c4", "b8c6", "d1h5"}, ""},
+	} {
+		game, err := GameCreated{}.ApplyTo(ctx, NewGame(uuid.Nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, uci := range tc.moves {
+			if game, err = (MoveMade{UCI: uci}).ApplyTo(ctx, game); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for depth := 1; depth <= 3; depth++ {
+			uci, err := bestMove(game, depth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.want != "" {
+				if uci != tc.want {
+					t.Errorf("after %v at depth %d the search played %s, want %s", tc.moves, depth, uci, tc.want)
+				}
+				continue
+			}
+
+			// a defence is only needed two plies deep
+			if depth < 2 {
+				continue
+			}
+			next, err := (MoveMade{UCI: uci}).ApplyTo(ctx, game)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mated, _ := (MoveMade{UCI: "h5f7"}).ApplyTo(ctx, next); mated.Outcome == "1-0" {
+				t.Errorf("after %v at depth %d the search played %s, which allows Qxf7#", tc.moves, depth, uci)
+			}
+		}
+	}
+}
+
+// TestComputerOpponent plays Black against the computer over HTTP: it moves
+// first and answers every move, and its seat can be neither claimed nor
+// played from.
+func TestComputerOpponent(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	for name, body := range map[string]map[string]any{
+		"a seat on both sides": {"opponent": "computer", "seat": "both"},
+		"too deep a search":    {"opponent": "computer", "depth": maxComputerDepth + 1},
+		"an unknown opponent":  {"opponent": "robot"},
+	} {
+		if code := do(t, h, http.MethodPost, "/api/games", body, nil); code != http.StatusUnprocessableEntity {
+			t.Errorf("creating a game with %s = %d, want 422", name, code)
+		}
+	}
+
+	var created struct {
+		gameMessage
+		seatGrant
+	}
+	if code := do(t, h, http.MethodPost, "/api/games", map[string]any{"opponent": "computer", "seat": "black", "depth": 1}, &created); code != http.StatusCreated {
+		t.Fatalf("creating a game against the computer = %d, want 201", code)
+	}
+	if g := created.Game; g.White != "Computer" || g.Computer != "white" || g.ComputerDepth != 1 || len(created.OpenSeats) != 0 {
+		t.Fatalf("created %s vs %s with the computer playing %q at depth %d and %v open",
+			g.White, g.Black, g.Computer, g.ComputerDepth, created.OpenSeats)
+	}
+	base := "/api/games/" + created.GameID
+
+	if code := do(t, h, http.MethodPost, base+"/seats/white", nil, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("claiming the computer's seat = %d, want 422", code)
+	}
+
+	for turn := 1; turn <= 6; turn++ {
+		srv.computer.wait()
+
+		var msg gameMessage
+		do(t, h, http.MethodGet, base, nil, &msg)
+		if msg.Game.Over() {
+			break
+		}
+		if len(msg.Game.MovesUCI) != 2*turn-1 || msg.Game.Turn != "black" {
+			t.Fatalf("before Black's move %d the game has %d moves with %s to move, want %d with black to move",
+				turn, len(msg.Game.MovesUCI), msg.Game.Turn, 2*turn-1)
+		}
+
+		game := msg.Game
+		engine, err := game.rebuild()
+		if err != nil {
+			t.Fatal(err)
+		}
+		uci := engine.ValidMoves()[0].String()
+		if code := doAs(t, h, created.Token, http.MethodPost, base+"/move",
+			map[string]any{"baseVersion": msg.Version, "uci": uci}, nil); code != http.StatusOK {
+			t.Fatalf("Black playing %s = %d, want 200", uci, code)
+		}
+
+		// from the version after Black's move, the next move is White's,
+		// and the computer's seat turns Black's token away
+		if code := doAs(t, h, created.Token, http.MethodPost, base+"/move",
+			map[string]any{"baseVersion": msg.Version + 1, "uci": "a2a3"}, nil); code != http.StatusForbidden {
+			t.Errorf("Black moving for the computer = %d, want 403", code)
+		}
+	}
+}
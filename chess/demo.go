@@ -78,6 +78,12 @@ func (s *server) resetDemo(ctx context.Context) error {
 		}
 	}
 
+	// the lobby's read model goes with the games, checkpoint and all
+	if err := s.summaries.clear(ctx); err != nil {
+		return err
+	}
+
+	s.flags.stopAll()
 	s.hub.broadcast(resetMessage{Reset: true})
 
 	return nil
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -9,6 +10,7 @@ import (
 	"net/http/httptest"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -48,7 +50,7 @@ func newTestServer(t *testing.T) *server {
 		t.Fatal(err)
 	}
 
-	eventSourced, err := aggregatestore.New(eventStore, NewGame,
+	eventSourced, err := aggregatestore.New(tagStampingStore{eventStore}, NewGame,
 		aggregatestore.WithEventTypes(gameEventPrototypes()...))
 	if err != nil {
 		t.Fatal(err)
@@ -59,13 +61,83 @@ func newTestServer(t *testing.T) *server {
 		t.Fatal(err)
 	}
 
-	return &server{
-		live:    hookable,
-		history: eventSourced,
-		events:  eventStore,
-		db:      db,
-		hub:     newHub(0),
+	summaries, err := newSummaryProjection(ctx, db, eventStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &server{
+		live:      hookable,
+		history:   eventSourced,
+		events:    eventStore,
+		summaries: summaries,
+		db:        db,
+		hub:       newHub(0),
+		now:       time.Now,
 	}
+	srv.flags = newFlagTimers(srv.flagFall, func() time.Time { return srv.now() })
+	srv.computer = newComputerPlayer(srv.computerMove)
+	t.Cleanup(srv.computer.wait) // before the database closes
+	hookable.AfterSave(func(ctx context.Context, agg *aggregatestore.Aggregate[Game]) error {
+		srv.flags.set(agg)
+		if err := summaries.catchUp(ctx); err != nil {
+			return err
+		}
+		srv.computer.reply(agg)
+		return nil
+	})
+	return srv
+}
+
+// do sends a request through the server's routes and decodes the JSON
+// response into out (when out is non-nil), returning the status code.
+func do(t *testing.T, h http.Handler, method, path string, body, out any) int {
+	t.Helper()
+	return doAs(t, h, "", method, path, body, out)
+}
+
+// doAs is do with a seat token.
+func doAs(t *testing.T, h http.Handler, token, method, path string, body, out any) int {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if out != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decoding %s: %v", method, path, rec.Body, err)
+		}
+	}
+	return rec.Code
+}
+
+// A fakeClock is a server clock that only moves when told to.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
 }
 
 // TestResetDemo covers the hosted-demo reset: every game is gone afterwards,
@@ -117,6 +189,9 @@ func TestResetDemo(t *testing.T) {
 	if _, err := srv.live.Load(ctx, gameID, nil); err == nil {
 		t.Error("the game still loaded after the reset")
 	}
+	if page, err := srv.summaries.list(ctx, lobbyQuery{Sort: "created", Limit: 1}); err != nil || page.Total != 0 {
+		t.Errorf("the lobby lists %d games after the reset (err %v), want none", page.Total, err)
+	}
 
 	select {
 	case msg := <-watcher:
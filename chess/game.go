@@ -1,7 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-estoria/estoria/typeid"
 	"github.com/gofrs/uuid/v5"
@@ -19,8 +23,66 @@ type Game struct {
 	FEN      string    `json:"fen"`
 	Turn     string    `json:"turn"`    // "white" or "black"
 	Outcome  string    `json:"outcome"` // "*", "1-0", "0-1", or "1/2-1/2"
-	Method   string    `json:"method"`  // "Checkmate", "Stalemate", "Resignation", ...
+	Method   string    `json:"method"`  // "Checkmate", "Stalemate", "Resignation", "Timeout", "DrawOffer", ...
 	Check    bool      `json:"check"`   // the side to move is in check
+
+	// MoveVersions is the version each move in MovesUCI landed at. Moves and
+	// versions part ways as soon as anything else is appended: an offer, a
+	// resignation, or a takeback, which removes a move.
+	MoveVersions []int64 `json:"moveVersions"`
+
+	// The offers awaiting an answer: the color that has offered a draw, and
+	// the color that has asked to take back its last move.
+	DrawOfferedBy       string `json:"drawOfferedBy,omitempty"`
+	TakebackRequestedBy string `json:"takebackRequestedBy,omitempty"`
+
+	// The seats: a hash of the token that plays each side, or empty while
+	// the seat is open. They come from the stream like everything else, and
+	// stay out of the API.
+	WhiteTokenHash string `json:"-"`
+	BlackTokenHash string `json:"-"`
+
+	// The computer's seat, in a game against it: the side it plays, and how
+	// many plies ahead it searches (see computer.go). Nobody can claim it.
+	Computer      string `json:"computer,omitempty"`
+	ComputerDepth int    `json:"computerDepth,omitempty"`
+
+	// The clocks, in a timed game. Each side's remaining time is as of the
+	// start of its current turn; the side to move's clock has been running
+	// since ClockStartedAt, which is zero until White's first move starts
+	// Black's clock. MoveClocksMs is the mover's clock after each move.
+	TimeControl    TimeControl `json:"timeControl,omitzero"`
+	WhiteClockMs   int64       `json:"whiteClockMs,omitempty"`
+	BlackClockMs   int64       `json:"blackClockMs,omitempty"`
+	ClockStartedAt time.Time   `json:"clockStartedAt,omitzero"`
+	MoveClocksMs   []int64     `json:"moveClocksMs,omitempty"`
+
+	version int64 // the number of events applied
+}
+
+// A TimeControl is a game's clock setting: each side's starting time, and the
+// time added to a side's clock after each of its moves. The zero value is an
+// untimed game.
+type TimeControl struct {
+	InitialSeconds   int `json:"initialSeconds"`
+	IncrementSeconds int `json:"incrementSeconds,omitempty"`
+}
+
+// Timed reports whether games with this time control have clocks.
+func (tc TimeControl) Timed() bool {
+	return tc.InitialSeconds > 0
+}
+
+// String renders the time control the way PGN's TimeControl tag does:
+// "300+2", or "-" for an untimed game.
+func (tc TimeControl) String() string {
+	if !tc.Timed() {
+		return "-"
+	}
+	if tc.IncrementSeconds == 0 {
+		return fmt.Sprint(tc.InitialSeconds)
+	}
+	return fmt.Sprintf("%d+%d", tc.InitialSeconds, tc.IncrementSeconds)
 }
 
 // NewGame is the estoria.EntityFactory for Game aggregates.
@@ -44,16 +106,119 @@ func (g Game) Over() bool {
 	return g.Created() && g.Outcome != string(chess.NoOutcome)
 }
 
-// clone returns a copy of the game with its own moves slice, so that ApplyTo
-// implementations can return new state without mutating slices shared with
-// previous versions.
-func (g Game) clone() Game {
+// inProgress returns an error unless the game has been created and is not
+// over: the precondition for every event after GameCreated.
+func (g Game) inProgress() error {
+	if !g.Created() {
+		return errors.New("game does not exist")
+	}
+	if g.Over() {
+		return fmt.Errorf("game is over (%s by %s)", g.Outcome, strings.ToLower(g.Method))
+	}
+	return nil
+}
+
+// advance returns a copy of the game one event further on, with its own
+// slices, so that ApplyTo implementations can return new state without
+// mutating slices shared with previous versions.
+func (g Game) advance() Game {
 	c := g
 	c.MovesUCI = make([]string, len(g.MovesUCI))
 	copy(c.MovesUCI, g.MovesUCI)
+	c.MoveVersions = slices.Clone(g.MoveVersions)
+	c.MoveClocksMs = slices.Clone(g.MoveClocksMs)
+	c.version++
 	return c
 }
 
+// clockRunning reports whether the side to move's clock is running.
+func (g Game) clockRunning() bool {
+	return g.TimeControl.Timed() && !g.ClockStartedAt.IsZero() && !g.Over()
+}
+
+// clockMs returns a side's remaining time as of the start of its turn.
+func (g Game) clockMs(color string) int64 {
+	if color == "white" {
+		return g.WhiteClockMs
+	}
+	return g.BlackClockMs
+}
+
+func (g *Game) setClockMs(color string, ms int64) {
+	if color == "white" {
+		g.WhiteClockMs = ms
+	} else {
+		g.BlackClockMs = ms
+	}
+}
+
+// tokenHash returns the hash of the token holding a side's seat, or "" if
+// the seat is open.
+func (g Game) tokenHash(color string) string {
+	if color == "white" {
+		return g.WhiteTokenHash
+	}
+	return g.BlackTokenHash
+}
+
+// OpenSeats returns the sides nobody holds a seat token for, other than the
+// computer's.
+func (g Game) OpenSeats() []string {
+	open := []string{}
+	for _, color := range []string{"white", "black"} {
+		if g.tokenHash(color) == "" && color != g.Computer {
+			open = append(open, color)
+		}
+	}
+	return open
+}
+
+// flagDeadline returns when the side to move runs out of time, if its clock
+// is running.
+func (g Game) flagDeadline() (time.Time, bool) {
+	if !g.clockRunning() {
+		return time.Time{}, false
+	}
+	return g.ClockStartedAt.Add(time.Duration(g.clockMs(g.Turn)) * time.Millisecond), true
+}
+
+// clockAfterMove returns what the side to move's clock reads after a move
+// made at the given time: its remaining time less the time it took, plus the
+// increment. White's first move is free, since no clock runs before it. It
+// is an error to move after the flag has fallen.
+func (g Game) clockAfterMove(at time.Time) (int64, error) {
+	remaining := g.clockMs(g.Turn)
+	if !g.clockRunning() {
+		return remaining, nil
+	}
+
+	elapsed := at.Sub(g.ClockStartedAt).Milliseconds()
+	if elapsed < 0 {
+		return 0, fmt.Errorf("move made at %s, before %s's clock started", at.Format(time.RFC3339Nano), g.Turn)
+	}
+	if remaining -= elapsed; remaining <= 0 {
+		return 0, fmt.Errorf("%s's flag has fallen", g.Turn)
+	}
+	return remaining + int64(g.TimeControl.IncrementSeconds)*1000, nil
+}
+
+// flagStanding returns an error if the side to move's flag had fallen by at,
+// for the events other than moves that can end or rewind a timed game.
+func (g Game) flagStanding(at time.Time) error {
+	deadline, running := g.flagDeadline()
+	switch {
+	case !running:
+		return nil
+	case at.IsZero():
+		return errors.New("an event in a timed game must say when it happened")
+	case at.Before(g.ClockStartedAt):
+		return fmt.Errorf("event at %s, before %s's clock started", at.Format(time.RFC3339Nano), g.Turn)
+	case !at.Before(deadline):
+		return fmt.Errorf("%s's flag has fallen", g.Turn)
+	}
+	return nil
+}
+
 // rebuild reconstructs the full rules-engine state by replaying the game's
 // moves from the starting position. Rebuilding from scratch on every apply is
 // O(n) per event, which is fine: chess streams are short, and it keeps the
@@ -123,6 +288,22 @@ func (g *Game) syncFromEngine(game *chess.Game) {
 	}
 }
 
+// opponent returns the other color's name.
+func opponent(color string) string {
+	if color == "white" {
+		return "black"
+	}
+	return "white"
+}
+
+// checkColor returns an error unless color names a side.
+func checkColor(color string) error {
+	if color != "white" && color != "black" {
+		return fmt.Errorf("invalid color %q", color)
+	}
+	return nil
+}
+
 // colorName renders a chess color as the lowercase name used throughout the
 // API ("white" or "black").
 func colorName(c chess.Color) string {
@@ -131,3 +312,22 @@ func colorName(c chess.Color) string {
 	}
 	return "black"
 }
+
+// canMate reports whether a side has the material to checkmate with: a pawn,
+// a rook, or a queen, or two minor pieces. A side that can't mate doesn't win
+// when its opponent runs out of time; the game is drawn instead.
+func canMate(pos *chess.Position, color chess.Color) bool {
+	minors := 0
+	for _, piece := range pos.Board().SquareMap() {
+		if piece.Color() != color {
+			continue
+		}
+		switch piece.Type() {
+		case chess.Pawn, chess.Rook, chess.Queen:
+			return true
+		case chess.Bishop, chess.Knight:
+			minors++
+		}
+	}
+	return minors >= 2
+}
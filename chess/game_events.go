@@ -4,13 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
+	"time"
 
 	"github.com/go-estoria/estoria"
 	"github.com/notnil/chess"
 )
 
-// Each event below implements estoria.EntityEvent[Game]. The prototypes are
+// Each event below implements estoria.EntityEvent[Game], and each one a
+// player makes says which side is acting (see seats.go). The prototypes are
 // value-typed (New returns a value, not a pointer); estoria handles making
 // them addressable for unmarshaling. ApplyTo implementations are pure state
 // transitions — and in chess, they are also the rules engine's gate: an event
@@ -18,10 +19,19 @@ import (
 // state. Move legality lives here, in the domain, not in HTTP handlers.
 
 // GameCreated initializes a game with two named players at the standard
-// starting position.
+// starting position, with both clocks at the time control's initial time.
+// The creator's seats are taken from the start: each token hash is set for a
+// seat the creator plays, and the same hash for both in a game they play
+// against themselves. In a game against the computer, Computer is the side
+// it plays, which has no token, and ComputerDepth how deep it searches.
 type GameCreated struct {
-	White string `json:"white"`
-	Black string `json:"black"`
+	White          string      `json:"white"`
+	Black          string      `json:"black"`
+	TimeControl    TimeControl `json:"timeControl,omitzero"`
+	WhiteTokenHash string      `json:"whiteTokenHash,omitempty"`
+	BlackTokenHash string      `json:"blackTokenHash,omitempty"`
+	Computer       string      `json:"computer,omitempty"`
+	ComputerDepth  int         `json:"computerDepth,omitempty"`
 }
 
 func (GameCreated) EventType() string              { return "gamecreated" }
@@ -30,11 +40,30 @@ func (e GameCreated) ApplyTo(_ context.Context, g Game) (Game, error) {
 	if g.Created() {
 		return g, errors.New("game already created")
 	}
+	if e.Computer != "" {
+		if err := checkColor(e.Computer); err != nil {
+			return g, err
+		}
+		if e.ComputerDepth < 1 || e.ComputerDepth > maxComputerDepth {
+			return g, fmt.Errorf("the computer searches from 1 to %d plies deep, not %d", maxComputerDepth, e.ComputerDepth)
+		}
+		if (e.Computer == "white" && e.WhiteTokenHash != "") || (e.Computer == "black" && e.BlackTokenHash != "") {
+			return g, fmt.Errorf("the %s seat can't be both the computer's and a player's", e.Computer)
+		}
+	}
 
-	next := g.clone()
+	next := g.advance()
 	next.White = e.White
 	next.Black = e.Black
 	next.MovesUCI = []string{}
+	next.MoveVersions = []int64{}
+	next.TimeControl = e.TimeControl
+	next.WhiteClockMs = int64(e.TimeControl.InitialSeconds) * 1000
+	next.BlackClockMs = next.WhiteClockMs
+	next.WhiteTokenHash = e.WhiteTokenHash
+	next.BlackTokenHash = e.BlackTokenHash
+	next.Computer = e.Computer
+	next.ComputerDepth = e.ComputerDepth
 	next.syncFromEngine(chess.NewGame())
 	return next, nil
 }
@@ -42,19 +71,24 @@ func (e GameCreated) ApplyTo(_ context.Context, g Game) (Game, error) {
 // MoveMade applies one move, given in UCI notation ("e2e4", "e7e8q"). The
 // move is validated against the position reached by replaying every prior
 // move, so an illegal move — or any move after the game is over — is rejected
-// and the game state is unchanged.
+// and the game state is unchanged. A move declines any draw offer the
+// opponent made, and any takeback request.
+//
+// In a timed game a move also records when it was made and the mover's clock
+// reading after it. ApplyTo works the reading out again from At, so the two
+// can't disagree, and rejects a move made after the mover's flag fell.
 type MoveMade struct {
-	UCI string `json:"uci"`
+	UCI     string    `json:"uci"`
+	At      time.Time `json:"at,omitzero"`
+	ClockMs int64     `json:"clockMs,omitempty"`
 }
 
 func (MoveMade) EventType() string              { return "movemade" }
 func (MoveMade) New() estoria.EntityEvent[Game] { return MoveMade{} }
+func (MoveMade) actor(g Game) string            { return g.Turn }
 func (e MoveMade) ApplyTo(_ context.Context, g Game) (Game, error) {
-	if !g.Created() {
-		return g, errors.New("game does not exist")
-	}
-	if g.Over() {
-		return g, fmt.Errorf("game is over (%s by %s)", g.Outcome, strings.ToLower(g.Method))
+	if err := g.inProgress(); err != nil {
+		return g, err
 	}
 
 	game, err := g.rebuild()
@@ -70,49 +104,396 @@ func (e MoveMade) ApplyTo(_ context.Context, g Game) (Game, error) {
 		return g, fmt.Errorf("illegal move %q", e.UCI)
 	}
 
-	next := g.clone()
+	next := g.advance()
+	if g.TimeControl.Timed() {
+		if e.At.IsZero() {
+			return g, errors.New("a move in a timed game must say when it was made")
+		}
+		clock, err := g.clockAfterMove(e.At)
+		if err != nil {
+			return g, err
+		}
+		if e.ClockMs != clock {
+			return g, fmt.Errorf("clock reading %dms does not match the %dms left", e.ClockMs, clock)
+		}
+		next.setClockMs(g.Turn, clock)
+		next.MoveClocksMs = append(next.MoveClocksMs, clock)
+		next.ClockStartedAt = e.At
+	}
 	next.MovesUCI = append(next.MovesUCI, e.UCI)
+	next.MoveVersions = append(next.MoveVersions, next.version)
+
+	// playing on declines the opponent's draw offer, and any takeback request
+	// was about a position that's gone
+	if next.DrawOfferedBy != g.Turn {
+		next.DrawOfferedBy = ""
+	}
+	next.TakebackRequestedBy = ""
+
 	next.syncFromEngine(game)
 	return next, nil
 }
 
 // PlayerResigned ends the game in favor of the opponent. Resigning is only
-// possible while the game is in progress.
+// possible while the game is in progress. In a timed game At is when the
+// player resigned, which must be before the side to move's flag fell: a lost
+// flag is not a resignation.
 type PlayerResigned struct {
-	Color string `json:"color"` // "white" or "black"
+	Color string    `json:"color"` // "white" or "black"
+	At    time.Time `json:"at,omitzero"`
 }
 
 func (PlayerResigned) EventType() string              { return "playerresigned" }
 func (PlayerResigned) New() estoria.EntityEvent[Game] { return PlayerResigned{} }
+func (e PlayerResigned) actor(Game) string            { return e.Color }
 func (e PlayerResigned) ApplyTo(_ context.Context, g Game) (Game, error) {
-	if !g.Created() {
-		return g, errors.New("game does not exist")
+	if err := g.inProgress(); err != nil {
+		return g, err
+	}
+	if err := checkColor(e.Color); err != nil {
+		return g, err
 	}
-	if g.Over() {
-		return g, fmt.Errorf("game is over (%s by %s)", g.Outcome, strings.ToLower(g.Method))
+	if err := g.flagStanding(e.At); err != nil {
+		return g, err
 	}
 
-	var color chess.Color
-	switch e.Color {
-	case "white":
-		color = chess.White
-	case "black":
+	game, err := g.rebuild()
+	if err != nil {
+		return g, fmt.Errorf("rebuilding position: %w", err)
+	}
+	color := chess.White
+	if e.Color == "black" {
 		color = chess.Black
-	default:
-		return g, fmt.Errorf("invalid color %q", e.Color)
+	}
+	game.Resign(color)
+
+	next := g.advance()
+	next.syncFromEngine(game)
+	return next, nil
+}
+
+// FlagFell ends a timed game when the side to move runs out of time: its
+// opponent wins, or the game is drawn if the opponent has too little material
+// to mate. At is when the flag was seen to fall, which must be after the
+// clock ran out.
+type FlagFell struct {
+	Color string    `json:"color"` // "white" or "black"
+	At    time.Time `json:"at"`
+}
+
+func (FlagFell) EventType() string              { return "flagfell" }
+func (FlagFell) New() estoria.EntityEvent[Game] { return FlagFell{} }
+func (e FlagFell) ApplyTo(_ context.Context, g Game) (Game, error) {
+	if err := g.inProgress(); err != nil {
+		return g, err
+	}
+
+	deadline, running := g.flagDeadline()
+	if !running {
+		return g, errors.New("no clock is running")
+	}
+	if e.Color != g.Turn {
+		return g, fmt.Errorf("it is %s's clock that is running, not %s's", g.Turn, e.Color)
+	}
+	if e.At.Before(deadline) {
+		return g, fmt.Errorf("%s has %s left", e.Color, deadline.Sub(e.At).Round(time.Millisecond))
 	}
 
 	game, err := g.rebuild()
 	if err != nil {
 		return g, fmt.Errorf("rebuilding position: %w", err)
 	}
-	game.Resign(color)
 
-	next := g.clone()
+	next := g.advance()
+	next.setClockMs(e.Color, 0)
+	next.Check = false
+	winner, outcome := chess.White, chess.WhiteWon
+	if e.Color == "white" {
+		winner, outcome = chess.Black, chess.BlackWon
+	}
+	if canMate(game.Position(), winner) {
+		next.Outcome, next.Method = string(outcome), "Timeout"
+	} else {
+		next.Outcome, next.Method = string(chess.Draw), "TimeoutVsInsufficientMaterial"
+	}
+	return next, nil
+}
+
+// DrawOffered offers the opponent a draw. The offer stands until the opponent
+// accepts or declines it, or declines it by moving; a side can have only one
+// offer out, and can't offer while the opponent's is waiting.
+type DrawOffered struct {
+	Color string `json:"color"` // "white" or "black"
+}
+
+func (DrawOffered) EventType() string              { return "drawoffered" }
+func (DrawOffered) New() estoria.EntityEvent[Game] { return DrawOffered{} }
+func (e DrawOffered) actor(Game) string            { return e.Color }
+func (e DrawOffered) ApplyTo(_ context.Context, g Game) (Game, error) {
+	if err := g.inProgress(); err != nil {
+		return g, err
+	}
+	if err := checkColor(e.Color); err != nil {
+		return g, err
+	}
+	switch g.DrawOfferedBy {
+	case e.Color:
+		return g, fmt.Errorf("%s has already offered a draw", e.Color)
+	case opponent(e.Color):
+		return g, fmt.Errorf("%s has offered a draw; accept it instead", g.DrawOfferedBy)
+	}
+
+	next := g.advance()
+	next.DrawOfferedBy = e.Color
+	return next, nil
+}
+
+// DrawAccepted accepts the opponent's draw offer, ending the game drawn by
+// agreement. In a timed game At is when it was accepted, which must be before
+// the side to move's flag fell.
+type DrawAccepted struct {
+	Color string    `json:"color"` // the side accepting
+	At    time.Time `json:"at,omitzero"`
+}
+
+func (DrawAccepted) EventType() string              { return "drawaccepted" }
+func (DrawAccepted) New() estoria.EntityEvent[Game] { return DrawAccepted{} }
+func (e DrawAccepted) actor(Game) string            { return e.Color }
+func (e DrawAccepted) ApplyTo(_ context.Context, g Game) (Game, error) {
+	if err := g.answeringDraw(e.Color); err != nil {
+		return g, err
+	}
+	if err := g.flagStanding(e.At); err != nil {
+		return g, err
+	}
+
+	game, err := g.rebuild()
+	if err != nil {
+		return g, fmt.Errorf("rebuilding position: %w", err)
+	}
+	if err := game.Draw(chess.DrawOffer); err != nil {
+		return g, err
+	}
+
+	next := g.advance()
+	next.DrawOfferedBy = ""
+	next.TakebackRequestedBy = ""
 	next.syncFromEngine(game)
 	return next, nil
 }
 
+// DrawDeclined turns down the opponent's draw offer. The game goes on.
+type DrawDeclined struct {
+	Color string `json:"color"` // the side declining
+}
+
+func (DrawDeclined) EventType() string              { return "drawdeclined" }
+func (DrawDeclined) New() estoria.EntityEvent[Game] { return DrawDeclined{} }
+func (e DrawDeclined) actor(Game) string            { return e.Color }
+func (e DrawDeclined) ApplyTo(_ context.Context, g Game) (Game, error) {
+	if err := g.answeringDraw(e.Color); err != nil {
+		return g, err
+	}
+
+	next := g.advance()
+	next.DrawOfferedBy = ""
+	return next, nil
+}
+
+// answeringDraw returns an error unless color can answer a draw offer: the
+// game is in progress and the opponent has one out.
+func (g Game) answeringDraw(color string) error {
+	if err := g.inProgress(); err != nil {
+		return err
+	}
+	if err := checkColor(color); err != nil {
+		return err
+	}
+	if g.DrawOfferedBy != opponent(color) {
+		return fmt.Errorf("%s has no draw offer to answer", color)
+	}
+	return nil
+}
+
+// drawClaims are the draws a player has to claim, rather than the rules
+// ending the game by themselves (as they do at fivefold repetition or after
+// seventy-five moves), with why a claim was refused.
+var drawClaims = map[string]struct {
+	method  chess.Method
+	refusal string
+}{
+	chess.ThreefoldRepetition.String(): {chess.ThreefoldRepetition, "the position has not occurred three times"},
+	chess.FiftyMoveRule.String():       {chess.FiftyMoveRule, "there has been a capture or a pawn move in the last fifty moves"},
+}
+
+// DrawClaimed ends the game drawn by threefold repetition or the fifty-move
+// rule, which either side may claim once the position qualifies. ApplyTo asks
+// the rules engine, rebuilt from the moves, whether it does. In a timed game
+// At is when the claim was made, which must be before the side to move's flag
+// fell.
+type DrawClaimed struct {
+	Color  string    `json:"color"`  // the side claiming
+	Method string    `json:"method"` // "ThreefoldRepetition" or "FiftyMoveRule"
+	At     time.Time `json:"at,omitzero"`
+}
+
+func (DrawClaimed) EventType() string              { return "drawclaimed" }
+func (DrawClaimed) New() estoria.EntityEvent[Game] { return DrawClaimed{} }
+func (e DrawClaimed) actor(Game) string            { return e.Color }
+func (e DrawClaimed) ApplyTo(_ context.Context, g Game) (Game, error) {
+	if err := g.inProgress(); err != nil {
+		return g, err
+	}
+	if err := checkColor(e.Color); err != nil {
+		return g, err
+	}
+	claim, ok := drawClaims[e.Method]
+	if !ok {
+		return g, fmt.Errorf("a draw by %q can't be claimed", e.Method)
+	}
+	if err := g.flagStanding(e.At); err != nil {
+		return g, err
+	}
+
+	game, err := g.rebuild()
+	if err != nil {
+		return g, fmt.Errorf("rebuilding position: %w", err)
+	}
+	if err := game.Draw(claim.method); err != nil {
+		return g, fmt.Errorf("no draw to claim: %s", claim.refusal)
+	}
+
+	next := g.advance()
+	next.DrawOfferedBy = ""
+	next.TakebackRequestedBy = ""
+	next.syncFromEngine(game)
+	return next, nil
+}
+
+// TakebackRequested asks the opponent to let the requester take back the last
+// move, which must be the requester's own. The opponent accepts, or declines
+// by playing on.
+type TakebackRequested struct {
+	Color string `json:"color"` // "white" or "black"
+}
+
+func (TakebackRequested) EventType() string              { return "takebackrequested" }
+func (TakebackRequested) New() estoria.EntityEvent[Game] { return TakebackRequested{} }
+func (e TakebackRequested) actor(Game) string            { return e.Color }
+func (e TakebackRequested) ApplyTo(_ context.Context, g Game) (Game, error) {
+	if err := g.inProgress(); err != nil {
+		return g, err
+	}
+	if err := checkColor(e.Color); err != nil {
+		return g, err
+	}
+	if len(g.MovesUCI) == 0 || g.Turn == e.Color {
+		return g, fmt.Errorf("the last move isn't %s's to take back", e.Color)
+	}
+	if g.TakebackRequestedBy != "" {
+		return g, fmt.Errorf("%s has already asked for a takeback", g.TakebackRequestedBy)
+	}
+
+	next := g.advance()
+	next.TakebackRequestedBy = e.Color
+	return next, nil
+}
+
+// TakebackAccepted grants the opponent's takeback request, removing the last
+// move: it is the requester's turn again, in the position before it. A
+// takeback undoes the move, not the time it took. In a timed game the
+// requester's clock reads what the move left it, less the increment the move
+// earned, and the accepting side is charged for the time it ran until At.
+type TakebackAccepted struct {
+	Color string    `json:"color"` // the side accepting
+	At    time.Time `json:"at,omitzero"`
+}
+
+func (TakebackAccepted) EventType() string              { return "takebackaccepted" }
+func (TakebackAccepted) New() estoria.EntityEvent[Game] { return TakebackAccepted{} }
+func (e TakebackAccepted) actor(Game) string            { return e.Color }
+func (e TakebackAccepted) ApplyTo(_ context.Context, g Game) (Game, error) {
+	if err := g.inProgress(); err != nil {
+		return g, err
+	}
+	if err := checkColor(e.Color); err != nil {
+		return g, err
+	}
+	if g.TakebackRequestedBy != opponent(e.Color) {
+		return g, fmt.Errorf("%s has no takeback request to answer", e.Color)
+	}
+	if err := g.flagStanding(e.At); err != nil {
+		return g, err
+	}
+
+	next := g.advance()
+	last := len(g.MovesUCI) - 1
+	next.MovesUCI = next.MovesUCI[:last]
+	next.MoveVersions = next.MoveVersions[:last]
+	next.DrawOfferedBy = ""
+	next.TakebackRequestedBy = ""
+
+	if g.clockRunning() {
+		// the accepting side is the side to move, whose clock has been
+		// running since the move being taken back
+		next.setClockMs(e.Color, g.clockMs(e.Color)-e.At.Sub(g.ClockStartedAt).Milliseconds())
+		requesterMs := g.MoveClocksMs[last]
+		if last > 0 {
+			requesterMs -= int64(g.TimeControl.IncrementSeconds) * 1000
+		}
+		next.setClockMs(g.TakebackRequestedBy, requesterMs)
+		next.MoveClocksMs = next.MoveClocksMs[:last]
+		next.ClockStartedAt = e.At
+		if last == 0 {
+			// taking back White's first move stops the clocks until it's
+			// played again
+			next.ClockStartedAt = time.Time{}
+		}
+	}
+
+	game, err := next.rebuild()
+	if err != nil {
+		return g, fmt.Errorf("rebuilding position: %w", err)
+	}
+	next.syncFromEngine(game)
+	return next, nil
+}
+
+// SeatClaimed seats a player on an open side, by the hash of the token they
+// were given for it.
+type SeatClaimed struct {
+	Color     string `json:"color"` // "white" or "black"
+	TokenHash string `json:"tokenHash"`
+}
+
+func (SeatClaimed) EventType() string              { return "seatclaimed" }
+func (SeatClaimed) New() estoria.EntityEvent[Game] { return SeatClaimed{} }
+func (e SeatClaimed) ApplyTo(_ context.Context, g Game) (Game, error) {
+	if err := g.inProgress(); err != nil {
+		return g, err
+	}
+	if err := checkColor(e.Color); err != nil {
+		return g, err
+	}
+	if e.TokenHash == "" {
+		return g, errors.New("a seat needs a token")
+	}
+	if g.tokenHash(e.Color) != "" {
+		return g, fmt.Errorf("the %s seat is taken", e.Color)
+	}
+	if e.Color == g.Computer {
+		return g, fmt.Errorf("the %s seat is the computer's", e.Color)
+	}
+
+	next := g.advance()
+	if e.Color == "white" {
+		next.WhiteTokenHash = e.TokenHash
+	} else {
+		next.BlackTokenHash = e.TokenHash
+	}
+	return next, nil
+}
+
 // gameEventPrototypes lists every event type for registration with the
 // aggregate store.
 func gameEventPrototypes() []estoria.EntityEvent[Game] {
@@ -120,5 +501,13 @@ func gameEventPrototypes() []estoria.EntityEvent[Game] {
 		GameCreated{},
 		MoveMade{},
 		PlayerResigned{},
+		FlagFell{},
+		DrawOffered{},
+		DrawAccepted{},
+		DrawDeclined{},
+		DrawClaimed{},
+		TakebackRequested{},
+		TakebackAccepted{},
+		SeatClaimed{},
 	}
 }
@@ -3,14 +3,17 @@ package main
 import (
 	"context"
 	"errors"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-estoria/estoria"
 	"github.com/go-estoria/estoria/aggregatestore"
 	"github.com/go-estoria/estoria/eventstore"
 	"github.com/go-estoria/estoria/eventstore/memory"
 	"github.com/gofrs/uuid/v5"
+	"github.com/notnil/chess"
 )
 
 // Event-sourced domains are easy to test: given a game, apply an event,
@@ -145,6 +148,29 @@ func TestEventApplication(t *testing.T) {
 		}
 	})
 
+	t.Run("a fallen flag can't be turned into a resignation", func(t *testing.T) {
+		t.Parallel()
+		start := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+		game := apply(t, NewGame(uuid.Must(uuid.NewV4())),
+			GameCreated{White: "Alice", Black: "Bob", TimeControl: TimeControl{InitialSeconds: 60}},
+			MoveMade{UCI: "e2e4", At: start, ClockMs: 60_000},
+		)
+
+		for name, resigned := range map[string]PlayerResigned{
+			"after the flag": {Color: "black", At: start.Add(2 * time.Minute)},
+			"without a time": {Color: "black"},
+		} {
+			if _, err := resigned.ApplyTo(context.Background(), game); err == nil {
+				t.Errorf("resigning %s: expected an error", name)
+			}
+		}
+
+		game = apply(t, game, PlayerResigned{Color: "black", At: start.Add(30 * time.Second)})
+		if game.Outcome != "1-0" || game.Method != "Resignation" {
+			t.Errorf("in time = %s by %q, want 1-0 by Resignation", game.Outcome, game.Method)
+		}
+	})
+
 	t.Run("rejects invalid transitions", func(t *testing.T) {
 		t.Parallel()
 		uncreated := NewGame(uuid.Must(uuid.NewV4()))
@@ -164,6 +190,199 @@ func TestEventApplication(t *testing.T) {
 		}
 	})
 
+	t.Run("timed moves carry the clock reading ApplyTo works out", func(t *testing.T) {
+		t.Parallel()
+		start := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+		game := apply(t, NewGame(uuid.Must(uuid.NewV4())),
+			GameCreated{White: "Alice", Black: "Bob", TimeControl: TimeControl{InitialSeconds: 60, IncrementSeconds: 1}},
+			MoveMade{UCI: "e2e4", At: start, ClockMs: 60_000},
+		)
+
+		at := start.Add(10 * time.Second)
+		for name, event := range map[string]MoveMade{
+			"no time":          {UCI: "e7e5", ClockMs: 51_000},
+			"wrong reading":    {UCI: "e7e5", At: at, ClockMs: 60_000},
+			"before the clock": {UCI: "e7e5", At: start.Add(-time.Second), ClockMs: 61_000},
+			"after the flag":   {UCI: "e7e5", At: start.Add(time.Minute), ClockMs: 1_000},
+		} {
+			if _, err := event.ApplyTo(context.Background(), game); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+
+		game = apply(t, game, MoveMade{UCI: "e7e5", At: at, ClockMs: 51_000})
+		if game.BlackClockMs != 51_000 || !game.ClockStartedAt.Equal(at) {
+			t.Errorf("black clock = %dms started %v, want 51000ms started %v", game.BlackClockMs, game.ClockStartedAt, at)
+		}
+	})
+
+	t.Run("a flag falls only when the time is up", func(t *testing.T) {
+		t.Parallel()
+		start := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+		game := apply(t, NewGame(uuid.Must(uuid.NewV4())),
+			GameCreated{White: "Alice", Black: "Bob", TimeControl: TimeControl{InitialSeconds: 60}},
+			MoveMade{UCI: "e2e4", At: start, ClockMs: 60_000},
+		)
+
+		for name, event := range map[string]FlagFell{
+			"early":           {Color: "black", At: start.Add(59 * time.Second)},
+			"the wrong clock": {Color: "white", At: start.Add(time.Hour)},
+		} {
+			if _, err := event.ApplyTo(context.Background(), game); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+		if _, err := (FlagFell{Color: "white", At: start}).ApplyTo(context.Background(), newTestGame(t)); err == nil {
+			t.Error("untimed game: expected an error")
+		}
+
+		game = apply(t, game, FlagFell{Color: "black", At: start.Add(time.Minute)})
+		if game.Outcome != "1-0" || game.Method != "Timeout" || game.BlackClockMs != 0 {
+			t.Errorf("after the flag = %s by %q with %dms left, want 1-0 by Timeout", game.Outcome, game.Method, game.BlackClockMs)
+		}
+	})
+
+	t.Run("a side that can't mate doesn't win on time", func(t *testing.T) {
+		t.Parallel()
+		for fen, want := range map[string]bool{
+			"4k3/8/8/8/8/8/8/4K3 w - - 0 1":   false, // bare king
+			"4k3/8/8/8/8/8/8/3NK3 w - - 0 1":  false, // one knight
+			"4k3/8/8/8/8/8/8/2BNK3 w - - 0 1": true,  // bishop and knight
+			"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1": true,  // a pawn
+			"4k3/8/8/8/8/8/8/R3K3 w - - 0 1":  true,  // a rook
+		} {
+			opt, err := chess.FEN(fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := canMate(chess.NewGame(opt).Position(), chess.White); got != want {
+				t.Errorf("canMate(%s) = %v, want %v", fen, got, want)
+			}
+		}
+	})
+
+	t.Run("a draw offer stands until it's answered", func(t *testing.T) {
+		t.Parallel()
+		offered := apply(t, newTestGame(t), MoveMade{UCI: "e2e4"}, DrawOffered{Color: "white"})
+
+		for name, event := range map[string]estoria.EntityEvent[Game]{
+			"offering twice":        DrawOffered{Color: "white"},
+			"offering back":         DrawOffered{Color: "black"},
+			"accepting your own":    DrawAccepted{Color: "white"},
+			"declining your own":    DrawDeclined{Color: "white"},
+			"accepting a bad color": DrawAccepted{Color: "purple"},
+		} {
+			if _, err := event.ApplyTo(context.Background(), offered); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+		if _, err := (DrawAccepted{Color: "black"}).ApplyTo(context.Background(), newTestGame(t)); err == nil {
+			t.Error("accepting an offer nobody made: expected an error")
+		}
+
+		if game := apply(t, offered, DrawDeclined{Color: "black"}); game.DrawOfferedBy != "" || game.Over() {
+			t.Errorf("after declining: offer by %q, over %v; want no offer and the game on", game.DrawOfferedBy, game.Over())
+		}
+		if game := apply(t, offered, MoveMade{UCI: "e7e5"}); game.DrawOfferedBy != "" {
+			t.Errorf("after black played on: offer by %q, want none", game.DrawOfferedBy)
+		}
+		if game := apply(t, newTestGame(t), DrawOffered{Color: "white"}, MoveMade{UCI: "e2e4"}); game.DrawOfferedBy != "white" {
+			t.Errorf("after white moved: offer by %q, want white's to stand", game.DrawOfferedBy)
+		}
+
+		game := apply(t, offered, DrawAccepted{Color: "black"})
+		if game.Outcome != "1/2-1/2" || game.Method != "DrawOffer" {
+			t.Errorf("after accepting = %s by %q, want 1/2-1/2 by DrawOffer", game.Outcome, game.Method)
+		}
+	})
+
+	t.Run("claims are checked against the position", func(t *testing.T) {
+		t.Parallel()
+		game := newTestGame(t)
+		shuffle := []string{"g1f3", "g8f6", "f3g1", "f6g8"}
+		for _, uci := range shuffle {
+			game = apply(t, game, MoveMade{UCI: uci})
+		}
+
+		// the starting position has occurred twice
+		for name, claim := range map[string]DrawClaimed{
+			"threefold repetition": {Color: "white", Method: "ThreefoldRepetition"},
+			"fifty-move rule":      {Color: "white", Method: "FiftyMoveRule"},
+			"stalemate":            {Color: "white", Method: "Stalemate"},
+		} {
+			if _, err := claim.ApplyTo(context.Background(), game); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+
+		for _, uci := range shuffle {
+			game = apply(t, game, MoveMade{UCI: uci})
+		}
+		game = apply(t, game, DrawClaimed{Color: "black", Method: "ThreefoldRepetition"})
+		if game.Outcome != "1/2-1/2" || game.Method != "ThreefoldRepetition" {
+			t.Errorf("after the claim = %s by %q, want 1/2-1/2 by ThreefoldRepetition", game.Outcome, game.Method)
+		}
+	})
+
+	t.Run("a takeback removes the requester's last move", func(t *testing.T) {
+		t.Parallel()
+		game := apply(t, newTestGame(t), MoveMade{UCI: "e2e4"}, DrawOffered{Color: "black"}, MoveMade{UCI: "e7e5"})
+		if want := []int64{2, 4}; !slices.Equal(game.MoveVersions, want) {
+			t.Errorf("move versions = %v, want %v", game.MoveVersions, want)
+		}
+
+		for name, event := range map[string]estoria.EntityEvent[Game]{
+			"white asking for black's move": TakebackRequested{Color: "white"},
+			"accepting nobody's request":    TakebackAccepted{Color: "white"},
+		} {
+			if _, err := event.ApplyTo(context.Background(), game); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+
+		requested := apply(t, game, TakebackRequested{Color: "black"})
+		if _, err := (TakebackAccepted{Color: "black"}).ApplyTo(context.Background(), requested); err == nil {
+			t.Error("accepting your own request: expected an error")
+		}
+		if game := apply(t, requested, MoveMade{UCI: "g1f3"}); game.TakebackRequestedBy != "" {
+			t.Errorf("after white played on: request by %q, want none", game.TakebackRequestedBy)
+		}
+
+		game = apply(t, requested, TakebackAccepted{Color: "white"})
+		if !slices.Equal(game.MovesUCI, []string{"e2e4"}) || game.Turn != "black" || game.TakebackRequestedBy != "" {
+			t.Errorf("after the takeback: moves %v, %s to move, request by %q; want [e2e4], black, none",
+				game.MovesUCI, game.Turn, game.TakebackRequestedBy)
+		}
+		if !strings.HasPrefix(game.FEN, "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b") {
+			t.Errorf("FEN = %q, want the position after 1.e4", game.FEN)
+		}
+		if want := []int64{2}; !slices.Equal(game.MoveVersions, want) {
+			t.Errorf("move versions = %v, want %v", game.MoveVersions, want)
+		}
+	})
+
+	t.Run("a takeback gives back the move, not the time", func(t *testing.T) {
+		t.Parallel()
+		start := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+		game := apply(t, NewGame(uuid.Must(uuid.NewV4())),
+			GameCreated{White: "Alice", Black: "Bob", TimeControl: TimeControl{InitialSeconds: 60, IncrementSeconds: 2}},
+			MoveMade{UCI: "e2e4", At: start, ClockMs: 60_000},
+			MoveMade{UCI: "e7e5", At: start.Add(10 * time.Second), ClockMs: 52_000},
+			TakebackRequested{Color: "black"},
+		)
+
+		if _, err := (TakebackAccepted{Color: "white", At: start.Add(2 * time.Minute)}).ApplyTo(context.Background(), game); err == nil {
+			t.Error("accepting after the flag fell: expected an error")
+		}
+
+		at := start.Add(15 * time.Second)
+		game = apply(t, game, TakebackAccepted{Color: "white", At: at})
+		if game.BlackClockMs != 50_000 || game.WhiteClockMs != 55_000 || !game.ClockStartedAt.Equal(at) || len(game.MoveClocksMs) != 1 {
+			t.Errorf("clocks = white %d, black %d, started %v, moves %v; want 55000, 50000 from %v",
+				game.WhiteClockMs, game.BlackClockMs, game.ClockStartedAt, game.MoveClocksMs, at)
+		}
+	})
+
 	t.Run("does not mutate the input game", func(t *testing.T) {
 		t.Parallel()
 		before := apply(t, newTestGame(t), MoveMade{UCI: "e2e4"})
@@ -2,7 +2,7 @@
 //
 // Every game is an event stream of moves in a local SQLite database — which
 // means time travel is native to the domain: replaying the stream to version
-// N reproduces the exact position after N-1 moves. The app demonstrates,
+// N reproduces the game exactly as it stood then. The app demonstrates,
 // end to end:
 //
 //   - aggregate modeling where the rules engine lives in pure ApplyTo
@@ -10,8 +10,14 @@
 //   - one aggregate per game: many short streams in one event store
 //   - live play via an AfterSave hook broadcasting over SSE
 //   - full game replay with LoadOptions.ToVersion
-//   - optimistic concurrency as turn-race protection, surfaced as HTTP 409s
+//   - optimistic concurrency as turn-race protection, surfaced as HTTP 409s,
+//     and as the referee between a last-second move and a falling flag
 //   - deriving artifacts (SAN move lists, PGN exports) from the stream
+//   - seat tokens checked before ApplyTo, kept only as hashes in the stream
+//   - a lobby read model projected from ReadAll from a checkpoint
+//   - importing PGN records as streams, their tags kept in event metadata
+//   - a computer opponent whose moves take the same write path as a player's
+//   - analyzing a position at any version, and every version in one pass
 //
 // Run it with no arguments and open http://localhost:8084. No Docker required.
 package main
@@ -65,6 +71,8 @@ type demoConfig struct {
 func main() {
 	addr := flag.String("addr", defaultAddr(":8084"), "HTTP listen address")
 	dbPath := flag.String("db", "chess.db", "path to the SQLite database file")
+	rebuildSummaries := flag.Bool("rebuild-summaries", false,
+		"rebuild the lobby's read model from the event store at startup")
 
 	var demo demoConfig
 	flag.BoolVar(&demo.hourlyReset, "hourly-reset", false,
@@ -89,7 +97,7 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	if err := run(ctx, *addr, *dbPath, demo); err != nil {
+	if err := run(ctx, *addr, *dbPath, *rebuildSummaries, demo); err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
 		os.Exit(1)
 	}
@@ -105,7 +113,7 @@ func defaultAddr(fallback string) string {
 	return fallback
 }
 
-func run(ctx context.Context, addr, dbPath string, demo demoConfig) error {
+func run(ctx context.Context, addr, dbPath string, rebuildSummaries bool, demo demoConfig) error {
 	// SQLite via a pure-Go driver: persistent, transactional, and no server
 	// to run. WAL mode lets reads proceed while a write is in flight.
 	dsn := fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)", dbPath)
@@ -143,8 +151,10 @@ func run(ctx context.Context, addr, dbPath string, demo demoConfig) error {
 	// keeps version-pinned loads (the replay slider) trivially correct.
 
 	// 1. EventSourcedStore: hydrates by replaying events, saves with
-	//    optimistic concurrency (ExpectVersion).
-	eventSourced, err := aggregatestore.New(eventStore, NewGame,
+	//    optimistic concurrency (ExpectVersion). Under it, the event store is
+	//    decorated to keep an imported game's PGN tags in the metadata of its
+	//    GameCreated event (see pgn_import.go).
+	eventSourced, err := aggregatestore.New(tagStampingStore{eventStore}, NewGame,
 		aggregatestore.WithEventTypes(gameEventPrototypes()...))
 	if err != nil {
 		return fmt.Errorf("creating aggregate store: %w", err)
@@ -157,18 +167,55 @@ func run(ctx context.Context, addr, dbPath string, demo demoConfig) error {
 		return fmt.Errorf("creating hookable store: %w", err)
 	}
 
-	broadcasts := newHub(demo.maxClients)
-	hookable.AfterSave(func(_ context.Context, agg *aggregatestore.Aggregate[Game]) error {
-		broadcasts.broadcast(newGameMessage(agg, true))
-		return nil
-	})
+	// The lobby is a read model in the same database, projected from the
+	// global event feed. It is caught up after every save, and on startup,
+	// which also picks up anything a failed catch-up left behind; with
+	// -rebuild-summaries it is thrown away and projected again from the
+	// first event.
+	summaries, err := newSummaryProjection(ctx, db, eventStore)
+	if err != nil {
+		return err
+	}
+	if rebuildSummaries {
+		if err := summaries.clear(ctx); err != nil {
+			return fmt.Errorf("clearing game summaries: %w", err)
+		}
+	}
+	if err := summaries.catchUp(ctx); err != nil {
+		return fmt.Errorf("catching up game summaries: %w", err)
+	}
 
 	srv := &server{
-		live:    hookable,
-		history: eventSourced,
-		events:  eventStore,
-		db:      db,
-		hub:     broadcasts,
+		live:      hookable,
+		history:   eventSourced,
+		events:    eventStore,
+		summaries: summaries,
+		db:        db,
+		hub:       newHub(demo.maxClients),
+		now:       time.Now,
+	}
+	srv.flags = newFlagTimers(srv.flagFall, srv.now)
+	srv.computer = newComputerPlayer(srv.computerMove)
+
+	// The AfterSave hook also resets the game's flag timer — every save can
+	// start, stop, or hand over a running clock — brings the lobby up to
+	// date, and sets the computer thinking if the save left it to move. A
+	// failed catch-up is retried by the next one, which starts from the same
+	// checkpoint, so it is logged rather than failing the save.
+	hookable.AfterSave(func(ctx context.Context, agg *aggregatestore.Aggregate[Game]) error {
+		srv.hub.broadcast(newGameMessage(agg, true))
+		srv.flags.set(agg)
+		if err := summaries.catchUp(ctx); err != nil {
+			estoria.GetLogger().Error("catching up game summaries", "game_id", agg.ID(), "error", err)
+		}
+		srv.computer.reply(agg)
+		return nil
+	})
+	if err := srv.startClocks(ctx); err != nil {
+		return fmt.Errorf("starting clocks: %w", err)
+	}
+	if err := srv.startComputer(ctx); err != nil {
+		return fmt.Errorf("starting the computer: %w", err)
 	}
 
 	// Hosted-demo behavior, all off by default (see demoConfig).
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-estoria/estoria"
+)
+
+// Draws and takebacks are offers one side makes and the other answers. Each
+// step is an event of its own, so the stream records the whole exchange — an
+// offer turned down is as much a part of a game's history as a move — and
+// each has its own route, naming the side that acts the way /resign does.
+// Whether a side may act is the events' business, not the handlers'.
+
+// offerRequest is the body every offer route takes.
+type offerRequest struct {
+	BaseVersion int64  `json:"baseVersion"`
+	Color       string `json:"color"`
+	Method      string `json:"method"` // draw claims only
+}
+
+// offerCommand reads an offerRequest and runs the event build makes of it.
+func (s *server) offerCommand(w http.ResponseWriter, r *http.Request, build func(req offerRequest) estoria.EntityEvent[Game]) {
+	gameID, ok := pathGameID(w, r)
+	if !ok {
+		return
+	}
+
+	req, err := readJSON[offerRequest](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.Color = strings.ToLower(strings.TrimSpace(req.Color))
+
+	s.runCommand(w, r, gameID, req.BaseVersion, func(Game) (estoria.EntityEvent[Game], error) {
+		return build(req), nil
+	})
+}
+
+func (s *server) handleOfferDraw(w http.ResponseWriter, r *http.Request) {
+	s.offerCommand(w, r, func(req offerRequest) estoria.EntityEvent[Game] {
+		return DrawOffered{Color: req.Color}
+	})
+}
+
+func (s *server) handleAcceptDraw(w http.ResponseWriter, r *http.Request) {
+	s.offerCommand(w, r, func(req offerRequest) estoria.EntityEvent[Game] {
+		return DrawAccepted{Color: req.Color, At: s.now()}
+	})
+}
+
+func (s *server) handleDeclineDraw(w http.ResponseWriter, r *http.Request) {
+	s.offerCommand(w, r, func(req offerRequest) estoria.EntityEvent[Game] {
+		return DrawDeclined{Color: req.Color}
+	})
+}
+
+func (s *server) handleClaimDraw(w http.ResponseWriter, r *http.Request) {
+	s.offerCommand(w, r, func(req offerRequest) estoria.EntityEvent[Game] {
+		return DrawClaimed{Color: req.Color, Method: strings.TrimSpace(req.Method), At: s.now()}
+	})
+}
+
+func (s *server) handleRequestTakeback(w http.ResponseWriter, r *http.Request) {
+	s.offerCommand(w, r, func(req offerRequest) estoria.EntityEvent[Game] {
+		return TakebackRequested{Color: req.Color}
+	})
+}
+
+func (s *server) handleAcceptTakeback(w http.ResponseWriter, r *http.Request) {
+	s.offerCommand(w, r, func(req offerRequest) estoria.EntityEvent[Game] {
+		return TakebackAccepted{Color: req.Color, At: s.now()}
+	})
+}
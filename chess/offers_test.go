@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestOffers plays a game through the offer routes: a takeback, a draw
+// offered and declined, and a threefold repetition claimed once the legal
+// moves say it can be.
+func TestOffers(t *testing.T) {
+	t.Parallel()
+
+	h := newTestServer(t).routes()
+
+	var created struct {
+		gameMessage
+		seatGrant
+	}
+	do(t, h, http.MethodPost, "/api/games", map[string]any{"seat": "both"}, &created)
+	base := "/api/games/" + created.GameID
+	version := created.Version
+	post := func(path string, body map[string]any) int {
+		t.Helper()
+		body["baseVersion"] = version
+		var resp struct {
+			Version int64 `json:"version"`
+		}
+		code := doAs(t, h, created.Token, http.MethodPost, base+path, body, &resp)
+		if code == http.StatusOK {
+			version = resp.Version
+		}
+		return code
+	}
+	claims := func() []string {
+		t.Helper()
+		var legal struct {
+			Claims []string `json:"claims"`
+		}
+		do(t, h, http.MethodGet, base+"/legal-moves", nil, &legal)
+		return legal.Claims
+	}
+
+	post("/move", map[string]any{"uci": "g1f3"})
+	post("/move", map[string]any{"uci": "e7e5"})
+	if code := post("/takeback/request", map[string]any{"color": "white"}); code != http.StatusUnprocessableEntity {
+		t.Errorf("white asking to take back black's move = %d, want 422", code)
+	}
+	post("/takeback/request", map[string]any{"color": "black"})
+	if code := post("/takeback/accept", map[string]any{"color": "white"}); code != http.StatusOK {
+		t.Fatalf("accepting the takeback = %d, want 200", code)
+	}
+
+	post("/draw/offer", map[string]any{"color": "white"})
+	if code := post("/draw/accept", map[string]any{"color": "white"}); code != http.StatusUnprocessableEntity {
+		t.Errorf("accepting your own offer = %d, want 422", code)
+	}
+	post("/draw/decline", map[string]any{"color": "black"})
+	if code := post("/draw/claim", map[string]any{"color": "black", "method": "ThreefoldRepetition"}); code != http.StatusUnprocessableEntity {
+		t.Errorf("claiming a repetition too soon = %d, want 422", code)
+	}
+
+	// 1. Nf3 Nf6 2. Ng1 Ng8 3. Nf3 Nf6 4. Ng1 Ng8: the starting position, again
+	for _, uci := range []string{"g8f6", "f3g1", "f6g8", "g1f3", "g8f6", "f3g1"} {
+		if code := post("/move", map[string]any{"uci": uci}); code != http.StatusOK {
+			t.Fatalf("move %s = %d", uci, code)
+		}
+	}
+	if got := claims(); len(got) != 0 {
+		t.Errorf("claims before the third repetition = %v, want none", got)
+	}
+	post("/move", map[string]any{"uci": "f6g8"})
+	if got := claims(); !slices.Equal(got, []string{"ThreefoldRepetition"}) {
+		t.Errorf("claims = %v, want [ThreefoldRepetition]", got)
+	}
+	if code := post("/draw/claim", map[string]any{"color": "white", "method": "ThreefoldRepetition"}); code != http.StatusOK {
+		t.Fatalf("claiming the repetition = %d, want 200", code)
+	}
+
+	var msg gameMessage
+	do(t, h, http.MethodGet, base, nil, &msg)
+	if msg.Game.Outcome != "1/2-1/2" || msg.Game.Method != "ThreefoldRepetition" || len(msg.Game.MovesUCI) != 8 {
+		t.Fatalf("game = %s by %q after %d moves, want a draw by repetition after 8", msg.Game.Outcome, msg.Game.Method, len(msg.Game.MovesUCI))
+	}
+	// the takeback and the declined offer are in the stream, not the moves
+	if want := []int64{2, 8, 9, 10, 11, 12, 13, 14}; !slices.Equal(msg.Game.MoveVersions, want) {
+		t.Errorf("move versions = %v, want %v", msg.Game.MoveVersions, want)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base+"/pgn", nil))
+	pgn, _ := io.ReadAll(rec.Body)
+	flat := strings.Join(strings.Fields(string(pgn)), " ") // movetext wraps
+	if want := "4. Ng1 Ng8 { Draw claimed by threefold repetition. } 1/2-1/2"; !strings.Contains(flat, want) {
+		t.Errorf("PGN is missing %q:\n%s", want, pgn)
+	}
+}
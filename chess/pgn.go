@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The PGN export is written here rather than by notnil/chess, whose encoder
+// can't attach comments to moves or end a game by anything it doesn't model
+// itself, like a flag falling. Everything in it comes from the game's state,
+// which comes from its events.
+
+// pgnLineWidth is where movetext wraps, as the PGN standard recommends.
+const pgnLineWidth = 79
+
+// gamePGN renders a game as a PGN document dated date. In a timed game, each
+// move carries the mover's clock after it as a [%clk] comment, the way chess
+// servers export them. A game that was imported passes the tag pairs it was
+// imported with as imported: they stand in for the Event, Site, Date and
+// Round tags, and the rest follow the ones the game's state decides.
+func gamePGN(game Game, date time.Time, imported map[string]string) (string, error) {
+	san, err := sanHistory(game.MovesUCI)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	written := map[string]bool{}
+	tag := func(name, value string) {
+		fmt.Fprintf(&b, "[%s %q]\n", name, value)
+		written[name] = true
+	}
+	orImported := func(name, value string) string {
+		if v, ok := imported[name]; ok {
+			return v
+		}
+		return value
+	}
+	tag("Event", orImported("Event", "Estoria Chess"))
+	tag("Site", orImported("Site", "estoria-examples/chess"))
+	tag("Date", orImported("Date", date.Format("2006.01.02")))
+	if round, ok := imported["Round"]; ok {
+		tag("Round", round)
+	}
+	tag("White", game.White)
+	tag("Black", game.Black)
+	tag("Result", game.Outcome)
+	if game.TimeControl.Timed() {
+		tag("TimeControl", game.TimeControl.String())
+	}
+	if game.Over() {
+		tag("Termination", pgnTermination(game.Method))
+	}
+	for _, name := range slices.Sorted(maps.Keys(imported)) {
+		if !written[name] {
+			tag(name, imported[name])
+		}
+	}
+	b.WriteString("\n")
+
+	var tokens []string
+	timed := len(game.MoveClocksMs) == len(san) && len(san) > 0
+	for i, move := range san {
+		switch {
+		case i%2 == 0:
+			tokens = append(tokens, fmt.Sprintf("%d.", i/2+1))
+		case timed:
+			// a comment interrupts the move pair, so Black's move is numbered
+			tokens = append(tokens, fmt.Sprintf("%d...", i/2+1))
+		}
+		tokens = append(tokens, move)
+		if timed {
+			tokens = append(tokens, "{ [%clk "+pgnClock(game.MoveClocksMs[i])+"] }")
+		}
+	}
+	if ending := pgnEnding(game); ending != "" {
+		tokens = append(tokens, "{ "+ending+" }")
+	}
+	tokens = append(tokens, game.Outcome)
+
+	width := 0
+	for i, token := range tokens {
+		if i > 0 && width+1+len(token) > pgnLineWidth {
+			b.WriteString("\n")
+			width = 0
+		} else if i > 0 {
+			b.WriteString(" ")
+			width++
+		}
+		b.WriteString(token)
+		width += len(token)
+	}
+	b.WriteString("\n")
+	return b.String(), nil
+}
+
+// pgnClock renders a clock reading in milliseconds as [%clk] does: H:MM:SS,
+// rounded down to the second.
+func pgnClock(ms int64) string {
+	s := ms / 1000
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// pgnEnding describes how a game ended when the moves don't show it: a
+// resignation, a flag, or a draw agreed or claimed. Anything the final
+// position shows, like checkmate, needs no comment.
+func pgnEnding(game Game) string {
+	loser, winner := "Black", "White"
+	if game.Outcome == "0-1" {
+		loser, winner = winner, loser
+	}
+
+	switch game.Method {
+	case "Resignation":
+		return loser + " resigns."
+	case "Timeout":
+		return winner + " wins on time."
+	case "TimeoutVsInsufficientMaterial":
+		flagged, other := "Black", "White"
+		if game.WhiteClockMs == 0 {
+			flagged, other = other, flagged
+		}
+		return flagged + " ran out of time, but " + other + " can't mate."
+	case "DrawOffer":
+		return "Draw agreed."
+	case "ThreefoldRepetition":
+		return "Draw claimed by threefold repetition."
+	case "FiftyMoveRule":
+		return "Draw claimed under the fifty-move rule."
+	}
+	return ""
+}
+
+// pgnTermination names how a finished game ended, for PGN's Termination tag.
+// Result already says who won; this says whether the clock decided it.
+func pgnTermination(method string) string {
+	if strings.HasPrefix(method, "Timeout") {
+		return "time forfeit"
+	}
+	return "normal"
+}
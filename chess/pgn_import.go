@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-estoria/estoria"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/go-estoria/estoria/typeid"
+	"github.com/gofrs/uuid/v5"
+	"github.com/notnil/chess"
+)
+
+// A PGN import turns each game in an upload into a new stream: GameCreated,
+// a MoveMade per move, and for a finished game, the events that finish it.
+// Every event is run through its ApplyTo against the game built so far before
+// anything is written, so a record with an illegal move is reported and
+// skipped, and the games around it are imported all the same.
+//
+// PGN records how a game ended only as a result, and the stream has no event
+// for most of the ways a game ends outside the moves. A win the moves don't
+// show is imported as the loser resigning, and a draw they don't show as a
+// draw offered and accepted. The record's tag pairs — Event, Site, Date and
+// the rest — are kept in the metadata of its GameCreated event, which is
+// where the export finds them again. Imported games are untimed: the moves
+// carry no times for the clocks to be run from.
+
+const (
+	// maxImportSize caps an uploaded PGN file, and maxImportGames the games
+	// one upload can hold.
+	maxImportSize  = 4 << 20
+	maxImportGames = 200
+
+	// pgnTagMetadataPrefix prefixes the metadata keys an imported game's tag
+	// pairs are kept under: "pgn.Event", "pgn.Date", ...
+	pgnTagMetadataPrefix = "pgn."
+)
+
+// An importResult is what became of one game in an upload: the game it was
+// imported as, or why it wasn't.
+type importResult struct {
+	Index   int    `json:"index"` // the game's place in the upload, from 1
+	Line    int    `json:"line"`  // the line its record starts on
+	White   string `json:"white,omitempty"`
+	Black   string `json:"black,omitempty"`
+	GameID  string `json:"gameId,omitempty"`
+	Version int64  `json:"version,omitempty"`
+	Outcome string `json:"outcome,omitempty"`
+	Method  string `json:"method,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// handleImportGames answers POST /api/games/import, whose body is one or
+// more PGN games. The importer is seated on both sides of every game, with
+// one token for them all, so an unfinished game can be played on from where
+// the record stops.
+func (s *server) handleImportGames(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	records := splitPGN(string(body))
+	switch {
+	case len(records) == 0:
+		writeError(w, http.StatusUnprocessableEntity, "the upload has no PGN games in it")
+		return
+	case len(records) > maxImportGames:
+		writeError(w, http.StatusUnprocessableEntity,
+			fmt.Sprintf("the upload has %d games; at most %d can be imported at once", len(records), maxImportGames))
+		return
+	}
+
+	token, hash := newSeatToken()
+	report := struct {
+		seatGrant
+		Imported int            `json:"imported"`
+		Games    []importResult `json:"games"`
+	}{seatGrant: seatGrant{Token: token, Seats: []string{"white", "black"}}, Games: []importResult{}}
+
+	s.resetMu.RLock()
+	defer s.resetMu.RUnlock()
+
+	for i, record := range records {
+		result := importResult{Index: i + 1, Line: record.line}
+		if err := s.importGame(ctx, record.text, hash, &result); err != nil {
+			result.Error = err.Error()
+		} else {
+			report.Imported++
+		}
+		report.Games = append(report.Games, result)
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// importGame imports one PGN record as a new game seated for seatHash, and
+// fills in result with what it became.
+func (s *server) importGame(ctx context.Context, record, seatHash string, result *importResult) error {
+	events, tags, err := pgnGameEvents(ctx, record, seatHash, s.now())
+	if err != nil {
+		return err
+	}
+	created := events[0].(GameCreated)
+	result.White, result.Black = created.White, created.Black
+
+	gameID, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+	agg := s.live.New(gameID)
+	if err := agg.Append(events...); err != nil {
+		return err
+	}
+	if err := s.live.Save(withPGNTags(ctx, tags), agg, nil); err != nil {
+		return err
+	}
+
+	game := agg.Entity()
+	result.GameID, result.Version = game.ID.String(), agg.Version()
+	result.Outcome, result.Method = game.Outcome, game.Method
+	return nil
+}
+
+// pgnGameEvents returns the events that play out a PGN record, each checked
+// against the game the ones before it make, and the record's tag pairs. at is
+// when a draw the record ends in is agreed.
+func pgnGameEvents(ctx context.Context, record, seatHash string, at time.Time) ([]estoria.EntityEvent[Game], map[string]string, error) {
+	parsed, err := decodePGN(record)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tags := map[string]string{}
+	for _, pair := range parsed.TagPairs() {
+		if strings.EqualFold(pair.Key, "FEN") || strings.EqualFold(pair.Key, "SetUp") {
+			return nil, nil, errors.New("the game starts from a set-up position; only games from the initial position can be imported")
+		}
+		tags[pair.Key] = pair.Value
+	}
+
+	white, err := playerName(pgnPlayer(tags["White"]), "White")
+	if err != nil {
+		return nil, nil, fmt.Errorf("White: %w", err)
+	}
+	black, err := playerName(pgnPlayer(tags["Black"]), "Black")
+	if err != nil {
+		return nil, nil, fmt.Errorf("Black: %w", err)
+	}
+
+	var events []estoria.EntityEvent[Game]
+	game := NewGame(uuid.Nil)
+	apply := func(event estoria.EntityEvent[Game]) error {
+		next, err := event.ApplyTo(ctx, game)
+		if err != nil {
+			return err
+		}
+		game = next
+		events = append(events, event)
+		return nil
+	}
+
+	if err := apply(GameCreated{White: white, Black: black, WhiteTokenHash: seatHash, BlackTokenHash: seatHash}); err != nil {
+		return nil, nil, err
+	}
+	for i, move := range parsed.Moves() {
+		if err := apply(MoveMade{UCI: move.String()}); err != nil {
+			return nil, nil, fmt.Errorf("move %s: %w", pgnMoveNumber(i), err)
+		}
+	}
+
+	result := string(parsed.Outcome())
+	if result == "" {
+		result = tags["Result"]
+	}
+	switch result {
+	case "", "*":
+		return events, tags, nil
+	case "1-0", "0-1", "1/2-1/2":
+	default:
+		return nil, nil, fmt.Errorf("unknown result %q", result)
+	}
+
+	if game.Over() {
+		if game.Outcome != result {
+			return nil, nil, fmt.Errorf("the result is %s, but the moves end the game %s by %s",
+				result, game.Outcome, strings.ToLower(game.Method))
+		}
+		return events, tags, nil
+	}
+
+	switch result {
+	case "1-0":
+		err = apply(PlayerResigned{Color: "black", At: at})
+	case "0-1":
+		err = apply(PlayerResigned{Color: "white", At: at})
+	default:
+		// the side that moved last offers, and the side to move accepts
+		if err = apply(DrawOffered{Color: opponent(game.Turn)}); err == nil {
+			err = apply(DrawAccepted{Color: game.Turn, At: at})
+		}
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("ending the game %s: %w", result, err)
+	}
+	return events, tags, nil
+}
+
+// decodePGN parses one PGN record with the rules engine, which checks every
+// move as it goes. It recovers from the panics the engine's parser has been
+// seen to raise on malformed movetext, such as a comment before the first
+// move, and reports them as errors like any other bad record.
+func decodePGN(record string) (game *chess.Game, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			game, err = nil, fmt.Errorf("the record is corrupt: %v", r)
+		}
+	}()
+
+	opt, err := chess.PGN(strings.NewReader(record))
+	if err != nil {
+		return nil, err
+	}
+	return chess.NewGame(opt), nil
+}
+
+// pgnPlayer returns a player's name from a tag, or "" for PGN's "unknown".
+func pgnPlayer(name string) string {
+	if strings.TrimSpace(name) == "?" {
+		return ""
+	}
+	return name
+}
+
+// pgnMoveNumber numbers the ply at index i the way movetext does: "12." for
+// White's moves, "12..." for Black's.
+func pgnMoveNumber(i int) string {
+	if i%2 == 0 {
+		return fmt.Sprintf("%d.", i/2+1)
+	}
+	return fmt.Sprintf("%d...", i/2+1)
+}
+
+// A pgnRecord is one game's text in an upload, and the line it starts on.
+type pgnRecord struct {
+	line int
+	text string
+}
+
+// splitPGN splits an upload into games. A game is its tag pairs and the
+// movetext after them, so a tag pair after movetext starts the next game.
+// Lines starting with "%" are escaped, as the PGN standard has it, and
+// skipped.
+func splitPGN(text string) []pgnRecord {
+	var records []pgnRecord
+	var current strings.Builder
+	start, inMovetext := 0, false
+
+	flush := func() {
+		if strings.TrimSpace(current.String()) != "" {
+			records = append(records, pgnRecord{line: start, text: current.String()})
+		}
+		current.Reset()
+		inMovetext = false
+	}
+
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "%"):
+			continue
+		case strings.HasPrefix(trimmed, "["):
+			if inMovetext {
+				flush()
+			}
+		case trimmed != "":
+			inMovetext = true
+		}
+
+		if current.Len() == 0 {
+			if trimmed == "" {
+				continue
+			}
+			start = i + 1
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+	}
+	flush()
+
+	return records
+}
+
+// pgnTagsKey is the context key for the tag pairs of the game being imported.
+type pgnTagsKey struct{}
+
+// withPGNTags returns a context under which saving a game's GameCreated
+// event records tags in its metadata.
+func withPGNTags(ctx context.Context, tags map[string]string) context.Context {
+	return context.WithValue(ctx, pgnTagsKey{}, tags)
+}
+
+// A tagStampingStore is an event store decorator that writes an imported
+// game's tag pairs into the metadata of its GameCreated event. It sits below
+// the aggregate stores, which leave metadata to the layers under them.
+type tagStampingStore struct {
+	eventstore.Store
+}
+
+// AppendStream adds the tag pairs from ctx, if it has any, to the metadata of
+// any GameCreated event being appended.
+func (s tagStampingStore) AppendStream(ctx context.Context, streamID typeid.ID, events []*eventstore.WritableEvent, opts eventstore.AppendStreamOptions) error {
+	tags, _ := ctx.Value(pgnTagsKey{}).(map[string]string)
+	for _, event := range events {
+		if len(tags) == 0 || event.Type != (GameCreated{}).EventType() {
+			continue
+		}
+		if event.Metadata == nil {
+			event.Metadata = map[string]string{}
+		}
+		for name, value := range tags {
+			event.Metadata[pgnTagMetadataPrefix+name] = value
+		}
+	}
+	return s.Store.AppendStream(ctx, streamID, events, opts)
+}
+
+// importedTags returns the tag pairs a game was imported with, read from the
+// metadata of its first event, or nil if it wasn't imported.
+func (s *server) importedTags(ctx context.Context, gameID uuid.UUID) (map[string]string, error) {
+	iter, err := s.events.ReadStream(ctx, typeid.New("game", gameID), eventstore.ReadStreamOptions{Count: 1})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close(ctx)
+
+	created, err := iter.Next(ctx)
+	if errors.Is(err, eventstore.ErrEndOfEventStream) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var tags map[string]string
+	for key, value := range created.Metadata {
+		if name, ok := strings.CutPrefix(key, pgnTagMetadataPrefix); ok {
+			if tags == nil {
+				tags = map[string]string{}
+			}
+			tags[name] = value
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// importUpload is seven games: a mate, a resignation, an agreed draw, one
+// still being played, one with an illegal move, one with a comment the rules
+// engine's parser trips over, and one whose result its moves contradict.
+const importUpload = `[Event "Casual Game"]
+[Site "London"]
+[Date "1851.06.21"]
+[Round "1"]
+[White "Anderssen, Adolf"]
+[Black "Kieseritzky, Lionel"]
+[Result "1-0"]
+[ECO "C33"]
+
+1. e4 e5 2. Bc4 Nc6 3. Qh5 Nf6 4. Qxf7# 1-0
+
+[Event "Resigned"]
+[White "?"]
+[Black "Bob"]
+[Result "0-1"]
+
+1. f3 e5 2. g4 { White thinks better of it. } 0-1
+
+[Event "Drawn"]
+[Result "1/2-1/2"]
+
+1. e4 e5 2. Nf3 Nc6 1/2-1/2
+
+% a line the standard escapes
+[Event "Unfinished"]
+[Result "*"]
+
+1. d4 d5 *
+
+[Event "Illegal"]
+[Result "1-0"]
+
+1. e4 e5 2. Ke3 1-0
+
+[Event "Corrupt"]
+
+{ A comment before any move. } 1. e4 *
+
+[Event "Miscounted"]
+
+1. f3 e5 2. g4 Qh4# 1-0
+`
+
+// TestImportPGN imports an upload of several games, checks each became the
+// game its record describes or was reported, and exports one back with the
+// tags it came in with.
+func TestImportPGN(t *testing.T) {
+	t.Parallel()
+
+	h := newTestServer(t).routes()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/games/import", strings.NewReader(importUpload)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("importing = %d: %s", rec.Code, rec.Body)
+	}
+	var report struct {
+		seatGrant
+		Imported int            `json:"imported"`
+		Games    []importResult `json:"games"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 4 || len(report.Games) != 7 {
+		t.Fatalf("imported %d of %d games, want 4 of 7: %+v", report.Imported, len(report.Games), report.Games)
+	}
+
+	for i, want := range []struct {
+		line    int
+		outcome string
+		method  string
+		error   string
+	}{
+		{1, "1-0", "Checkmate", ""},
+		{12, "0-1", "Resignation", ""},
+		{19, "1/2-1/2", "DrawOffer", ""},
+		{25, "*", "", ""},
+		{30, "", "", `"Ke3"`},
+		{35, "", "", "the record is corrupt"},
+		{39, "", "", "the result is 1-0, but the moves end the game 0-1 by checkmate"},
+	} {
+		got := report.Games[i]
+		if got.Line != want.line || got.Outcome != want.outcome || got.Method != want.method || !strings.Contains(got.Error, want.error) ||
+			(want.error == "") != (got.GameID != "") {
+			t.Errorf("game %d = %+v, want %+v", i+1, got, want)
+		}
+	}
+	if got := report.Games[1]; got.White != "White" || got.Black != "Bob" {
+		t.Errorf("game 2 is %s vs %s, want White vs Bob", got.White, got.Black)
+	}
+
+	// the unfinished game plays on with the import's token
+	unfinished := report.Games[3]
+	if code := doAs(t, h, report.Token, http.MethodPost, "/api/games/"+unfinished.GameID+"/move",
+		map[string]any{"baseVersion": unfinished.Version, "uci": "c2c4"}, nil); code != http.StatusOK {
+		t.Errorf("playing on in the unfinished game = %d, want 200", code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/games/"+report.Games[0].GameID+"/pgn", nil))
+	pgn, _ := io.ReadAll(rec.Body)
+	for _, want := range []string{
+		`[Event "Casual Game"]`, `[Site "London"]`, `[Date "1851.06.21"]`, `[Round "1"]`,
+		`[White "Anderssen, Adolf"]`, `[ECO "C33"]`, "4. Qxf7# 1-0",
+	} {
+		if !strings.Contains(string(pgn), want) {
+			t.Errorf("the exported PGN is missing %s:\n%s", want, pgn)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/games/import", strings.NewReader("\n\n")))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("importing nothing = %d, want 422", rec.Code)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-estoria/estoria"
+)
+
+// A seat is the right to play one side of a game. Whoever creates a game is
+// given a token for the side (or both sides) they play, and anyone can claim
+// a seat that is still open for a token of their own. Every command a player
+// makes carries its token as a bearer token, and runCommand checks it against
+// the seat of the side the command acts for before the event goes anywhere
+// near ApplyTo. Without a seat, a viewer is a spectator: everything that
+// reads a game works for them, and nothing that writes to one does. In a
+// game against the computer, its seat has no token, and no token plays it.
+//
+// The server keeps no sessions and no side table. Each seat's token is
+// hashed into the game's own stream — in GameCreated, or in SeatClaimed —
+// so the seats are rebuilt with the rest of the game, and reading the stream
+// doesn't give anyone a token.
+
+// A seatGrant is a seat token, and the sides it plays.
+type seatGrant struct {
+	Token string   `json:"token"`
+	Seats []string `json:"seats"`
+}
+
+// newSeatToken returns a new random seat token and its hash.
+func newSeatToken() (token, hash string) {
+	b := make([]byte, 32)
+	rand.Read(b) // never returns an error
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashSeatToken(token)
+}
+
+// hashSeatToken returns the hash a seat token is stored as. The tokens are
+// random, so a plain SHA-256 is all it takes.
+func hashSeatToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerToken returns the request's bearer token, or "" if it has none.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// An actingEvent is an event a player makes for one side of the game.
+type actingEvent interface {
+	actor(g Game) string
+}
+
+// A seatError is a command refused because the caller doesn't hold the seat
+// of the side it acts for.
+type seatError struct {
+	color    string
+	missing  bool // no token was given at all
+	open     bool // nobody holds the seat
+	computer bool // the computer holds the seat
+}
+
+func (e seatError) Error() string {
+	switch {
+	case e.computer:
+		return fmt.Sprintf("the %s seat is played by the computer", e.color)
+	case e.open:
+		return fmt.Sprintf("the %s seat is open: claim it to play %s", e.color, e.color)
+	case e.missing:
+		return fmt.Sprintf("a seat token is required to play %s", e.color)
+	}
+	return fmt.Sprintf("this seat token doesn't play %s", e.color)
+}
+
+// status is the HTTP status a seatError is reported with.
+func (e seatError) status() int {
+	if e.missing {
+		return http.StatusUnauthorized
+	}
+	return http.StatusForbidden
+}
+
+// authorize returns a seatError unless token holds the seat of the side the
+// event acts for. Events no player makes need no seat.
+func authorize(game Game, event estoria.EntityEvent[Game], token string) error {
+	acting, ok := event.(actingEvent)
+	if !ok {
+		return nil
+	}
+
+	color := acting.actor(game)
+	want := game.tokenHash(color)
+	switch {
+	case color == game.Computer:
+		return seatError{color: color, computer: true}
+	case want == "":
+		return seatError{color: color, open: true}
+	case token == "":
+		return seatError{color: color, missing: true}
+	case subtle.ConstantTimeCompare([]byte(hashSeatToken(token)), []byte(want)) != 1:
+		return seatError{color: color}
+	}
+	return nil
+}
+
+// authorizeComputer is authorize for the computer, which holds no token: it
+// returns a seatError unless the event acts for the computer's own side.
+func authorizeComputer(game Game, event estoria.EntityEvent[Game]) error {
+	acting, ok := event.(actingEvent)
+	if !ok {
+		return nil
+	}
+	if color := acting.actor(game); color != game.Computer {
+		return seatError{color: color}
+	}
+	return nil
+}
+
+// handleClaimSeat seats the caller on an open side and returns their token.
+// Only the hash reaches the stream; the token is shown this once.
+func (s *server) handleClaimSeat(w http.ResponseWriter, r *http.Request) {
+	gameID, ok := pathGameID(w, r)
+	if !ok {
+		return
+	}
+	color := r.PathValue("color")
+
+	token, hash := newSeatToken()
+	agg, err := s.execute(r.Context(), gameID, 0, func(Game) (estoria.EntityEvent[Game], error) {
+		return SeatClaimed{Color: color, TokenHash: hash}, nil
+	})
+	if err != nil {
+		writeCommandError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Version int64 `json:"version"`
+		seatGrant
+	}{agg.Version(), seatGrant{Token: token, Seats: []string{color}}})
+}
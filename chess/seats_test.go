@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/go-estoria/estoria/typeid"
+	"github.com/gofrs/uuid/v5"
+)
+
+// TestSeats plays a game between two seat tokens: the creator's and one for
+// the seat claimed after, with spectators and the wrong token turned away.
+func TestSeats(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var white struct {
+		gameMessage
+		seatGrant
+	}
+	do(t, h, http.MethodPost, "/api/games", map[string]any{}, &white)
+	if !slices.Equal(white.Seats, []string{"white"}) || !slices.Equal(white.OpenSeats, []string{"black"}) {
+		t.Fatalf("creating a game seated %v with %v open, want white with black open", white.Seats, white.OpenSeats)
+	}
+	base := "/api/games/" + white.GameID
+	post := func(token, path string, body map[string]any) int {
+		t.Helper()
+		return doAs(t, h, token, http.MethodPost, base+path, body, nil)
+	}
+
+	for name, tc := range map[string]struct {
+		token string
+		want  int
+	}{
+		"a spectator":    {"", http.StatusUnauthorized},
+		"a forged token": {"not-a-seat-token", http.StatusForbidden},
+	} {
+		if code := post(tc.token, "/move", map[string]any{"uci": "e2e4"}); code != tc.want {
+			t.Errorf("%s moving = %d, want %d", name, code, tc.want)
+		}
+	}
+	if code := post(white.Token, "/move", map[string]any{"uci": "e2e4"}); code != http.StatusOK {
+		t.Fatalf("white moving = %d, want 200", code)
+	}
+
+	// the seat is checked before the move is: an illegal move for the wrong
+	// side is refused for the side, not the move
+	if code := post(white.Token, "/move", map[string]any{"uci": "zz99"}); code != http.StatusForbidden {
+		t.Errorf("white moving for black = %d, want 403", code)
+	}
+	if code := post("", "/move", map[string]any{"uci": "e7e5"}); code != http.StatusForbidden {
+		t.Errorf("moving for the open black seat = %d, want 403", code)
+	}
+
+	var black struct {
+		Version int64 `json:"version"`
+		seatGrant
+	}
+	if code := doAs(t, h, "", http.MethodPost, base+"/seats/black", nil, &black); code != http.StatusOK {
+		t.Fatalf("claiming the black seat = %d, want 200", code)
+	}
+	for _, color := range []string{"black", "white", "purple"} {
+		if code := post("", "/seats/"+color, nil); code != http.StatusUnprocessableEntity {
+			t.Errorf("claiming the %s seat = %d, want 422", color, code)
+		}
+	}
+
+	if code := post(black.Token, "/move", map[string]any{"uci": "e7e5"}); code != http.StatusOK {
+		t.Errorf("black moving = %d, want 200", code)
+	}
+	for path, body := range map[string]map[string]any{
+		"/resign":     {"color": "white"},
+		"/draw/offer": {"color": "white"},
+	} {
+		if code := post(black.Token, path, body); code != http.StatusForbidden {
+			t.Errorf("black posting %s for white = %d, want 403", path, code)
+		}
+	}
+	if code := post(black.Token, "/resign", map[string]any{"color": "black"}); code != http.StatusOK {
+		t.Errorf("black resigning = %d, want 200", code)
+	}
+
+	// spectators see everything but the tokens, which only the stream has,
+	// and only hashed
+	var msg gameMessage
+	if code := do(t, h, http.MethodGet, base, nil, &msg); code != http.StatusOK || len(msg.OpenSeats) != 0 || msg.Game.Outcome != "1-0" {
+		t.Errorf("spectating = %d with %v open, outcome %s; want 200 with none open, 1-0", code, msg.OpenSeats, msg.Game.Outcome)
+	}
+
+	stream, err := srv.events.ReadStream(ctx, typeid.New("game", uuid.FromStringOrNil(white.GameID)), eventstore.ReadStreamOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data strings.Builder
+	for {
+		event, err := stream.Next(ctx)
+		if errors.Is(err, eventstore.ErrEndOfEventStream) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		data.Write(event.Data)
+	}
+	for _, token := range []string{white.Token, black.Token} {
+		if strings.Contains(data.String(), token) {
+			t.Errorf("the stream holds the token %q", token)
+		}
+		if !strings.Contains(data.String(), hashSeatToken(token)) {
+			t.Errorf("the stream lacks the hash of token %q", token)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"database/sql"
 	"embed"
 	"encoding/json"
@@ -9,7 +11,6 @@ import (
 	"io"
 	"io/fs"
 	"net/http"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -35,9 +36,13 @@ type server struct {
 	// at a pinned historical version (the replay slider and stale-base loads).
 	history aggregatestore.Store[Game]
 
-	// events is the raw event store, used to list game streams for the lobby.
+	// events is the raw event store, which the lobby's read model is
+	// projected from.
 	events *sqlstore.EventStore
 
+	// summaries is the lobby's read model (see summaries.go).
+	summaries *summaryProjection
+
 	// db is the underlying database handle, used only by the demo reset
 	// (see demo.go) to clear storage directly.
 	db *sql.DB
@@ -48,6 +53,15 @@ type server struct {
 	resetMu sync.RWMutex
 
 	hub *hub
+
+	// flags holds a timer for each game whose clock is running (see
+	// clock.go), and now is the clock that moves and flags are timed by.
+	flags *flagTimers
+	now   func() time.Time
+
+	// computer makes the computer's moves in games against it (see
+	// computer.go).
+	computer *computerPlayer
 }
 
 func (s *server) routes() http.Handler {
@@ -55,10 +69,20 @@ func (s *server) routes() http.Handler {
 
 	mux.HandleFunc("GET /api/games", s.handleListGames)
 	mux.HandleFunc("POST /api/games", s.handleCreateGame)
+	mux.HandleFunc("POST /api/games/import", s.handleImportGames)
 	mux.HandleFunc("GET /api/games/{id}", s.handleGetGame)
 	mux.HandleFunc("GET /api/games/{id}/legal-moves", s.handleLegalMoves)
+	mux.HandleFunc("GET /api/games/{id}/analysis", s.handleAnalysis)
+	mux.HandleFunc("GET /api/games/{id}/evaluations", s.handleEvaluations)
 	mux.HandleFunc("POST /api/games/{id}/move", s.handleMove)
 	mux.HandleFunc("POST /api/games/{id}/resign", s.handleResign)
+	mux.HandleFunc("POST /api/games/{id}/draw/offer", s.handleOfferDraw)
+	mux.HandleFunc("POST /api/games/{id}/draw/accept", s.handleAcceptDraw)
+	mux.HandleFunc("POST /api/games/{id}/draw/decline", s.handleDeclineDraw)
+	mux.HandleFunc("POST /api/games/{id}/draw/claim", s.handleClaimDraw)
+	mux.HandleFunc("POST /api/games/{id}/takeback/request", s.handleRequestTakeback)
+	mux.HandleFunc("POST /api/games/{id}/takeback/accept", s.handleAcceptTakeback)
+	mux.HandleFunc("POST /api/games/{id}/seats/{color}", s.handleClaimSeat)
 	mux.HandleFunc("GET /api/games/{id}/pgn", s.handlePGN)
 	mux.HandleFunc("GET /api/watch", s.handleWatch)
 
@@ -80,6 +104,14 @@ type gameMessage struct {
 	Live    bool     `json:"live"`
 	Game    Game     `json:"game"`
 	SAN     []string `json:"san"`
+
+	// OpenSeats lists the sides a viewer could still claim a seat for.
+	OpenSeats []string `json:"openSeats"`
+
+	// ServerTime is when the message was built. Clients run the clocks from
+	// it and the game's ClockStartedAt, so their own clock's drift doesn't
+	// matter.
+	ServerTime time.Time `json:"serverTime"`
 }
 
 // newGameMessage assembles the standard game payload, including the move list
@@ -98,69 +130,11 @@ func newGameMessage(agg *aggregatestore.Aggregate[Game], live bool) gameMessage
 		Live:    live,
 		Game:    game,
 		SAN:     san,
-	}
-}
 
-// gameSummary is one row in the lobby list.
-type gameSummary struct {
-	GameID    string `json:"gameId"`
-	White     string `json:"white"`
-	Black     string `json:"black"`
-	MoveCount int    `json:"moveCount"`
-	Outcome   string `json:"outcome"`
-	Method    string `json:"method"`
-	Turn      string `json:"turn"`
-	Check     bool   `json:"check"`
-	Version   int64  `json:"version"`
-}
-
-// handleListGames builds the lobby by listing every "game" stream in the
-// event store and loading each aggregate. A load per game is fine at demo
-// scale; a production lobby would maintain a read model projected from the
-// streams instead (see the README).
-func (s *server) handleListGames(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+		OpenSeats: game.OpenSeats(),
 
-	s.resetMu.RLock()
-	defer s.resetMu.RUnlock()
-
-	streams, err := s.events.ListStreams(ctx)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
+		ServerTime: time.Now(),
 	}
-
-	summaries := []gameSummary{}
-	for _, stream := range streams {
-		if stream.StreamID.Type != "game" {
-			continue
-		}
-
-		agg, err := s.live.Load(ctx, stream.StreamID.UUID, nil)
-		if err != nil {
-			estoria.GetLogger().Error("loading game for lobby", "stream_id", stream.StreamID, "error", err)
-			continue
-		}
-
-		game := agg.Entity()
-		summaries = append(summaries, gameSummary{
-			GameID:    game.ID.String(),
-			White:     game.White,
-			Black:     game.Black,
-			MoveCount: len(game.MovesUCI),
-			Outcome:   game.Outcome,
-			Method:    game.Method,
-			Turn:      game.Turn,
-			Check:     game.Check,
-			Version:   agg.Version(),
-		})
-	}
-
-	// game IDs are UUIDv7 (time-ordered), so sorting descending puts the
-	// newest games first
-	sort.Slice(summaries, func(i, j int) bool { return summaries[i].GameID > summaries[j].GameID })
-
-	writeJSON(w, http.StatusOK, summaries)
 }
 
 func (s *server) handleCreateGame(w http.ResponseWriter, r *http.Request) {
@@ -168,24 +142,80 @@ func (s *server) handleCreateGame(w http.ResponseWriter, r *http.Request) {
 	defer s.resetMu.RUnlock()
 
 	req, err := readJSON[struct {
-		White string `json:"white"`
-		Black string `json:"black"`
+		White       string      `json:"white"`
+		Black       string      `json:"black"`
+		TimeControl TimeControl `json:"timeControl"`
+		Seat        string      `json:"seat"` // "white" (the default), "black", or "both"
+
+		// Opponent "computer" seats the computer on the side the creator
+		// doesn't play, searching Depth plies ahead.
+		Opponent string `json:"opponent"` // "human" (the default) or "computer"
+		Depth    int    `json:"depth"`
 	}](r)
 	if err != nil && !errors.Is(err, io.EOF) {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	white, err := playerName(req.White, "White")
+	seat := cmp.Or(strings.ToLower(strings.TrimSpace(req.Seat)), "white")
+	computer := ""
+	switch cmp.Or(strings.ToLower(strings.TrimSpace(req.Opponent)), "human") {
+	case "human":
+	case "computer":
+		if seat != "white" && seat != "black" {
+			writeError(w, http.StatusUnprocessableEntity, `against the computer, seat must be "white" or "black"`)
+			return
+		}
+		computer = opponent(seat)
+	default:
+		writeError(w, http.StatusUnprocessableEntity, `opponent must be "human" or "computer"`)
+		return
+	}
+
+	defaultWhite, defaultBlack := "White", "Black"
+	switch computer {
+	case "white":
+		defaultWhite = "Computer"
+	case "black":
+		defaultBlack = "Computer"
+	}
+	white, err := playerName(req.White, defaultWhite)
 	if err != nil {
 		writeError(w, http.StatusUnprocessableEntity, err.Error())
 		return
 	}
-	black, err := playerName(req.Black, "Black")
+	black, err := playerName(req.Black, defaultBlack)
 	if err != nil {
 		writeError(w, http.StatusUnprocessableEntity, err.Error())
 		return
 	}
+	if err := validateTimeControl(req.TimeControl); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	// the creator is seated from the first event
+	created := GameCreated{White: white, Black: black, TimeControl: req.TimeControl}
+	if computer != "" {
+		created.Computer, created.ComputerDepth = computer, cmp.Or(req.Depth, defaultComputerDepth)
+		if _, err := created.ApplyTo(r.Context(), NewGame(uuid.Nil)); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	}
+	token, hash := newSeatToken()
+	grant := seatGrant{Token: token}
+	switch seat {
+	case "white":
+		created.WhiteTokenHash, grant.Seats = hash, []string{"white"}
+	case "black":
+		created.BlackTokenHash, grant.Seats = hash, []string{"black"}
+	case "both":
+		created.WhiteTokenHash, created.BlackTokenHash, grant.Seats = hash, hash, []string{"white", "black"}
+	default:
+		writeError(w, http.StatusUnprocessableEntity, `seat must be "white", "black", or "both"`)
+		return
+	}
 
 	gameID, err := uuid.NewV7()
 	if err != nil {
@@ -194,7 +224,7 @@ func (s *server) handleCreateGame(w http.ResponseWriter, r *http.Request) {
 	}
 
 	agg := s.live.New(gameID)
-	if err := agg.Append(GameCreated{White: white, Black: black}); err != nil {
+	if err := agg.Append(created); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -203,27 +233,40 @@ func (s *server) handleCreateGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, newGameMessage(agg, true))
+	writeJSON(w, http.StatusCreated, struct {
+		gameMessage
+		seatGrant
+	}{newGameMessage(agg, true), grant})
 }
 
 // handleGetGame returns the game at its latest version, or, when the
 // "version" query parameter is provided, at that historical version. Version
-// 1 is the freshly created game; version k is the position after k-1 moves.
+// 1 is the freshly created game, and each event after it is one version more.
 func (s *server) handleGetGame(w http.ResponseWriter, r *http.Request) {
 	gameID, ok := pathGameID(w, r)
 	if !ok {
 		return
 	}
 
-	var agg *aggregatestore.Aggregate[Game]
+	agg, live, ok := s.loadVersion(w, r, gameID)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newGameMessage(agg, live))
+}
+
+// loadVersion loads the game at the version the "version" query parameter
+// asks for, or at its latest when there is none, and reports which. It
+// writes the error response itself when it fails.
+func (s *server) loadVersion(w http.ResponseWriter, r *http.Request, gameID uuid.UUID) (agg *aggregatestore.Aggregate[Game], live, ok bool) {
 	var err error
-	live := true
+	live = true
 
 	if v := r.URL.Query().Get("version"); v != "" {
 		version, parseErr := strconv.ParseInt(v, 10, 64)
 		if parseErr != nil || version < 1 {
 			writeError(w, http.StatusBadRequest, "version must be a positive integer")
-			return
+			return nil, false, false
 		}
 
 		// time travel: hydrate the aggregate only up to the requested version
@@ -235,10 +278,9 @@ func (s *server) handleGetGame(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		writeLoadError(w, err)
-		return
+		return nil, false, false
 	}
-
-	writeJSON(w, http.StatusOK, newGameMessage(agg, live))
+	return agg, live, true
 }
 
 // legalTarget is one destination square a piece can move to. Promotion
@@ -250,8 +292,9 @@ type legalTarget struct {
 }
 
 // handleLegalMoves returns every legal move in the game's live position,
-// grouped by origin square. The rules engine derives them from the position,
-// which is itself derived from the event stream.
+// grouped by origin square, and the draws either side could claim in it. The
+// rules engine derives them from the position, which is itself derived from
+// the event stream.
 func (s *server) handleLegalMoves(w http.ResponseWriter, r *http.Request) {
 	gameID, ok := pathGameID(w, r)
 	if !ok {
@@ -266,6 +309,7 @@ func (s *server) handleLegalMoves(w http.ResponseWriter, r *http.Request) {
 
 	game := agg.Entity()
 	moves := map[string][]legalTarget{}
+	claims := []string{}
 
 	if !game.Over() {
 		engine, err := game.rebuild()
@@ -285,12 +329,19 @@ func (s *server) handleLegalMoves(w http.ResponseWriter, r *http.Request) {
 			}
 			moves[from] = append(moves[from], legalTarget{To: to, Promotion: promotion})
 		}
+
+		for _, method := range engine.EligibleDraws() {
+			if _, ok := drawClaims[method.String()]; ok {
+				claims = append(claims, method.String())
+			}
+		}
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
 		"version": agg.Version(),
 		"turn":    game.Turn,
 		"moves":   moves,
+		"claims":  claims,
 	})
 }
 
@@ -307,6 +358,13 @@ func hasTarget(targets []legalTarget, to string) bool {
 // and returns the resulting event.
 type commandFunc func(game Game) (estoria.EntityEvent[Game], error)
 
+// A rejectedError is a command the domain refused: the command function or
+// the event's ApplyTo returned an error.
+type rejectedError struct{ err error }
+
+func (e rejectedError) Error() string { return e.err.Error() }
+func (e rejectedError) Unwrap() error { return e.err }
+
 // runCommand is the write path shared by all commands:
 //
 //  1. Load the game at the version the client last saw (baseVersion). When
@@ -319,9 +377,60 @@ type commandFunc func(game Game) (estoria.EntityEvent[Game], error)
 //  3. Append the event and save. On a version conflict, respond 409 so the
 //     client can refresh; in chess a conflict means the position changed
 //     under you — the other player moved first.
+//
+// Between 1 and 2, the caller's seat token must hold the seat of the side
+// the event acts for (see seats.go): 401 without one, 403 with the wrong one.
+//
+// The steps themselves are in execute, which the server's own writers (the
+// clock's flag timer, and the computer opponent) share.
 func (s *server) runCommand(w http.ResponseWriter, r *http.Request, gameID uuid.UUID, baseVersion int64, cmd commandFunc) {
-	ctx := r.Context()
+	token := bearerToken(r)
+	agg, err := s.execute(r.Context(), gameID, baseVersion, func(game Game) (estoria.EntityEvent[Game], error) {
+		event, err := cmd(game)
+		if err != nil {
+			return nil, err
+		}
+		if err := authorize(game, event, token); err != nil {
+			return nil, err
+		}
+		return event, nil
+	})
+	if err != nil {
+		writeCommandError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"version": agg.Version()})
+}
 
+// writeCommandError reports an error from execute.
+func writeCommandError(w http.ResponseWriter, err error) {
+	var seat seatError
+	var rejected rejectedError
+	var mismatch eventstore.StreamVersionMismatchError
+	switch {
+	case errors.As(err, &seat):
+		writeError(w, seat.status(), seat.Error())
+	case errors.As(err, &rejected):
+		writeError(w, http.StatusUnprocessableEntity, rejected.Error())
+	case errors.As(err, &mismatch):
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"error":           "version_conflict",
+			"expectedVersion": mismatch.ExpectedVersion,
+			"actualVersion":   mismatch.ActualVersion,
+			"message": fmt.Sprintf(
+				"the game has changed since version %d (it is now at version %d)",
+				mismatch.ExpectedVersion, mismatch.ActualVersion),
+		})
+	default:
+		writeLoadError(w, err)
+	}
+}
+
+// execute loads the game at baseVersion (or its latest, for 0), runs the
+// command against it, pre-flights the event, and saves it. It returns a
+// rejectedError when the domain refuses the command, and the event store's
+// StreamVersionMismatchError when the game moved on since baseVersion.
+func (s *server) execute(ctx context.Context, gameID uuid.UUID, baseVersion int64, cmd commandFunc) (*aggregatestore.Aggregate[Game], error) {
 	// Held for the whole load-validate-save cycle so a demo reset can't clear
 	// the stream out from under it. Uncontended unless -hourly-reset is on.
 	s.resetMu.RLock()
@@ -335,47 +444,27 @@ func (s *server) runCommand(w http.ResponseWriter, r *http.Request, gameID uuid.
 		agg, err = s.live.Load(ctx, gameID, nil)
 	}
 	if err != nil {
-		writeLoadError(w, err)
-		return
+		return nil, err
 	}
 
 	event, err := cmd(agg.Entity())
 	if err != nil {
-		writeError(w, http.StatusUnprocessableEntity, err.Error())
-		return
+		return nil, rejectedError{err}
 	}
 
 	// pre-flight: estoria applies events on save, after they are written, so
 	// an event the domain rejects must never reach the stream
 	if _, err := event.ApplyTo(ctx, agg.Entity()); err != nil {
-		writeError(w, http.StatusUnprocessableEntity, err.Error())
-		return
+		return nil, rejectedError{err}
 	}
 
 	if err := agg.Append(event); err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
+		return nil, err
 	}
-
 	if err := s.live.Save(ctx, agg, nil); err != nil {
-		var mismatch eventstore.StreamVersionMismatchError
-		if errors.As(err, &mismatch) {
-			writeJSON(w, http.StatusConflict, map[string]any{
-				"error":           "version_conflict",
-				"expectedVersion": mismatch.ExpectedVersion,
-				"actualVersion":   mismatch.ActualVersion,
-				"message": fmt.Sprintf(
-					"the game has changed since version %d (it is now at version %d)",
-					mismatch.ExpectedVersion, mismatch.ActualVersion),
-			})
-			return
-		}
-
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
+		return nil, err
 	}
-
-	writeJSON(w, http.StatusOK, map[string]any{"version": agg.Version()})
+	return agg, nil
 }
 
 func (s *server) handleMove(w http.ResponseWriter, r *http.Request) {
@@ -393,15 +482,34 @@ func (s *server) handleMove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.runCommand(w, r, gameID, req.BaseVersion, func(Game) (estoria.EntityEvent[Game], error) {
+	s.runCommand(w, r, gameID, req.BaseVersion, func(game Game) (estoria.EntityEvent[Game], error) {
 		uci := strings.ToLower(strings.TrimSpace(req.UCI))
 		if uci == "" {
 			return nil, errors.New("uci move is required")
 		}
-		return MoveMade{UCI: uci}, nil
+		move, err := s.newMove(game, uci)
+		if err != nil {
+			return nil, err
+		}
+		return move, nil
 	})
 }
 
+// newMove returns the MoveMade for a move in the game, timed by the server's
+// clock in a timed game: it is the only one that counts.
+func (s *server) newMove(game Game, uci string) (MoveMade, error) {
+	if !game.TimeControl.Timed() {
+		return MoveMade{UCI: uci}, nil
+	}
+
+	at := s.now()
+	clock, err := game.clockAfterMove(at)
+	if err != nil {
+		return MoveMade{}, err
+	}
+	return MoveMade{UCI: uci, At: at, ClockMs: clock}, nil
+}
+
 func (s *server) handleResign(w http.ResponseWriter, r *http.Request) {
 	gameID, ok := pathGameID(w, r)
 	if !ok {
@@ -418,7 +526,7 @@ func (s *server) handleResign(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.runCommand(w, r, gameID, req.BaseVersion, func(Game) (estoria.EntityEvent[Game], error) {
-		return PlayerResigned{Color: strings.ToLower(strings.TrimSpace(req.Color))}, nil
+		return PlayerResigned{Color: strings.ToLower(strings.TrimSpace(req.Color)), At: s.now()}, nil
 	})
 }
 
@@ -436,34 +544,22 @@ func (s *server) handlePGN(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	game := agg.Entity()
-	engine, err := game.rebuild()
+	tags, err := s.importedTags(r.Context(), gameID)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// replaying moves recovers on-board outcomes (checkmate, stalemate);
-	// resignation lives only in the event stream, so re-apply it here
-	if game.Method == chess.Resignation.String() {
-		switch game.Outcome {
-		case string(chess.BlackWon):
-			engine.Resign(chess.White)
-		case string(chess.WhiteWon):
-			engine.Resign(chess.Black)
-		}
+	game := agg.Entity()
+	pgn, err := gamePGN(game, time.Now(), tags)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	engine.AddTagPair("Event", "Estoria Chess")
-	engine.AddTagPair("Site", "estoria-examples/chess")
-	engine.AddTagPair("Date", time.Now().Format("2006.01.02"))
-	engine.AddTagPair("White", game.White)
-	engine.AddTagPair("Black", game.Black)
-	engine.AddTagPair("Result", game.Outcome)
-
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "chess-"+game.ID.String()+".pgn"))
-	fmt.Fprintln(w, strings.TrimSpace(engine.String()))
+	fmt.Fprint(w, pgn)
 }
 
 // handleWatch streams game updates to the client over server-sent events.
@@ -529,6 +625,20 @@ func writeLoadError(w http.ResponseWriter, err error) {
 	writeError(w, http.StatusInternalServerError, err.Error())
 }
 
+// validateTimeControl bounds a game's clock setting: up to three hours each,
+// and up to three minutes a move. The zero time control is an untimed game.
+func validateTimeControl(tc TimeControl) error {
+	switch {
+	case tc.InitialSeconds < 0 || tc.InitialSeconds > 3*60*60:
+		return errors.New("initial time must be between 0 and 3 hours")
+	case tc.IncrementSeconds < 0 || tc.IncrementSeconds > 3*60:
+		return errors.New("increment must be between 0 and 3 minutes")
+	case !tc.Timed() && tc.IncrementSeconds > 0:
+		return errors.New("an increment needs an initial time")
+	}
+	return nil
+}
+
 // playerName trims and bounds a player name, falling back to a default when
 // it is empty.
 func playerName(s, fallback string) (string, error) {
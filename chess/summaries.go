@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-estoria/estoria"
+	sqlstore "github.com/go-estoria/estoria-contrib/sqlite/eventstore"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/go-estoria/estoria/eventstore/projection"
+)
+
+// The lobby is a read model: a row per game in game_summaries, kept in the
+// same SQLite file as the streams and safe to throw away. It is written by a
+// projection of the global event feed (ReadAll), which folds each event into
+// its game's row in the order the store appended them, and records the global
+// position it has reached, so each pass reads only the events after it.
+//
+// A row keeps the folded game beside its columns, as the state the game's
+// next event applies to: the projection runs the same ApplyTo the aggregate
+// store does, and never loads an aggregate.
+const summarySchema = `
+CREATE TABLE IF NOT EXISTS game_summaries (
+	game_id           TEXT PRIMARY KEY,
+	white             TEXT NOT NULL,
+	black             TEXT NOT NULL,
+	move_count        INTEGER NOT NULL,
+	outcome           TEXT NOT NULL,
+	method            TEXT NOT NULL,
+	turn              TEXT NOT NULL,
+	in_check          INTEGER NOT NULL,
+	version           INTEGER NOT NULL,
+	initial_seconds   INTEGER NOT NULL,
+	increment_seconds INTEGER NOT NULL,
+	open_seats        TEXT NOT NULL,
+	created_at        INTEGER NOT NULL,
+	updated_at        INTEGER NOT NULL,
+	state             TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS game_summaries_by_created ON game_summaries (created_at, game_id);
+CREATE INDEX IF NOT EXISTS game_summaries_by_updated ON game_summaries (updated_at, game_id);
+CREATE TABLE IF NOT EXISTS game_summaries_position (
+	id       INTEGER PRIMARY KEY CHECK (id = 1),
+	position INTEGER NOT NULL
+);`
+
+const (
+	// summaryBatchSize caps the events projected in one transaction.
+	summaryBatchSize = 500
+
+	// The lobby's page size when none is asked for, and the most it will
+	// return at once.
+	defaultLobbyPageSize = 50
+	maxLobbyPageSize     = 200
+)
+
+// gameSummary is one row in the lobby list.
+type gameSummary struct {
+	GameID    string `json:"gameId"`
+	White     string `json:"white"`
+	Black     string `json:"black"`
+	MoveCount int    `json:"moveCount"`
+	Outcome   string `json:"outcome"`
+	Method    string `json:"method"`
+	Turn      string `json:"turn"`
+	Check     bool   `json:"check"`
+	Version   int64  `json:"version"`
+
+	TimeControl TimeControl `json:"timeControl,omitzero"`
+	OpenSeats   []string    `json:"openSeats"`
+
+	// When the game's first and latest events were appended.
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// summarize returns the lobby row for a game at a version, less the times,
+// which are the events' and not the game's.
+func summarize(game Game, version int64) gameSummary {
+	return gameSummary{
+		GameID:    game.ID.String(),
+		White:     game.White,
+		Black:     game.Black,
+		MoveCount: len(game.MovesUCI),
+		Outcome:   game.Outcome,
+		Method:    game.Method,
+		Turn:      game.Turn,
+		Check:     game.Check,
+		Version:   version,
+
+		TimeControl: game.TimeControl,
+		OpenSeats:   game.OpenSeats(),
+	}
+}
+
+// summaryState is the folded game a row keeps, with the version the next move
+// is recorded at, which the game's own JSON leaves out. The seats' token
+// hashes are left out too: they live only in the game's stream, the row's
+// open_seats is all the lobby needs, and anything that checks a seat loads
+// the game.
+type summaryState struct {
+	Game    Game  `json:"game"`
+	Version int64 `json:"version"`
+}
+
+// A summaryProjection maintains the lobby read model. It is caught up from
+// the AfterSave hook as games change, and on startup, which also covers any
+// events a failed hook left behind.
+type summaryProjection struct {
+	db     *sql.DB
+	events *sqlstore.EventStore
+
+	// mu serializes passes, so two saves racing can't project the same
+	// events twice.
+	mu sync.Mutex
+}
+
+func newSummaryProjection(ctx context.Context, db *sql.DB, events *sqlstore.EventStore) (*summaryProjection, error) {
+	if _, err := db.ExecContext(ctx, summarySchema); err != nil {
+		return nil, fmt.Errorf("creating summary schema: %w", err)
+	}
+	return &summaryProjection{db: db, events: events}, nil
+}
+
+// catchUp projects every event appended since the last pass.
+func (p *summaryProjection) catchUp(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		n, err := p.projectBatch(ctx)
+		if err != nil {
+			return err
+		}
+		if n < summaryBatchSize {
+			return nil
+		}
+	}
+}
+
+// projectBatch projects up to summaryBatchSize events after the checkpoint,
+// and moves the checkpoint past them, in one transaction. It returns how
+// many it projected.
+func (p *summaryProjection) projectBatch(ctx context.Context) (int64, error) {
+	var position int64
+	err := p.db.QueryRowContext(ctx, `SELECT position FROM game_summaries_position WHERE id = 1`).Scan(&position)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	// for ReadAll, AfterVersion is a global position, not a stream version
+	iter, err := p.events.ReadAll(ctx, eventstore.ReadStreamOptions{AfterVersion: position, Count: summaryBatchSize})
+	if err != nil {
+		return 0, fmt.Errorf("reading events after %d: %w", position, err)
+	}
+	defer iter.Close(ctx)
+
+	proj, err := projection.New(iter)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := proj.Project(ctx, projection.EventHandlerFunc(func(ctx context.Context, evt *eventstore.Event) error {
+		if evt.GlobalPosition == nil {
+			return fmt.Errorf("event %s has no global position", evt.ID)
+		}
+		if err := projectSummary(ctx, tx, evt); err != nil {
+			return fmt.Errorf("projecting %s at version %d: %w", evt.StreamID, evt.StreamVersion, err)
+		}
+		position = *evt.GlobalPosition
+		return nil
+	}))
+	if err != nil {
+		return 0, err
+	}
+	if result.NumProjectedEvents == 0 {
+		return 0, nil
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO game_summaries_position (id, position) VALUES (1, ?)
+		 ON CONFLICT (id) DO UPDATE SET position = excluded.position`, position); err != nil {
+		return 0, err
+	}
+
+	return result.NumProjectedEvents, tx.Commit()
+}
+
+// projectSummary folds one event into its game's row. Events from streams
+// other than games are passed over. A game whose stream doesn't fold is left
+// out of the lobby, as it was when the lobby hydrated every game: the store
+// wouldn't load it either.
+func projectSummary(ctx context.Context, tx *sql.Tx, evt *eventstore.Event) error {
+	if evt.StreamID.Type != "game" {
+		return nil
+	}
+	gameID := evt.StreamID.UUID.String()
+
+	state := summaryState{Game: NewGame(evt.StreamID.UUID)}
+	createdAt := evt.Timestamp
+	var openSeats []string
+	var data, seats []byte
+	var created int64
+	err := tx.QueryRowContext(ctx,
+		`SELECT state, open_seats, created_at FROM game_summaries WHERE game_id = ?`, gameID).Scan(&data, &seats, &created)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &state); err != nil {
+			return fmt.Errorf("decoding summary state: %w", err)
+		}
+		if err := json.Unmarshal(seats, &openSeats); err != nil {
+			return fmt.Errorf("decoding open seats: %w", err)
+		}
+		createdAt = time.UnixMilli(created)
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	event, err := decodeGameEvent(evt)
+	if err != nil {
+		return err
+	}
+
+	game := state.Game
+	game.version = state.Version
+	game, err = event.ApplyTo(ctx, game)
+	if err != nil {
+		estoria.GetLogger().Error("game stream doesn't fold, leaving it out of the lobby",
+			"stream_id", evt.StreamID, "stream_version", evt.StreamVersion, "error", err)
+		_, err := tx.ExecContext(ctx, `DELETE FROM game_summaries WHERE game_id = ?`, gameID)
+		return err
+	}
+
+	data, err = json.Marshal(summaryState{Game: game, Version: evt.StreamVersion})
+	if err != nil {
+		return err
+	}
+	summary := summarize(game, evt.StreamVersion)
+	summary.OpenSeats = openSeatsAfter(openSeats, event, game)
+	seats, err = json.Marshal(summary.OpenSeats)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO game_summaries (game_id, white, black, move_count, outcome, method, turn, in_check, version,
+			initial_seconds, increment_seconds, open_seats, created_at, updated_at, state)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (game_id) DO UPDATE SET
+			white = excluded.white, black = excluded.black, move_count = excluded.move_count,
+			outcome = excluded.outcome, method = excluded.method, turn = excluded.turn,
+			in_check = excluded.in_check, version = excluded.version,
+			initial_seconds = excluded.initial_seconds, increment_seconds = excluded.increment_seconds,
+			open_seats = excluded.open_seats, updated_at = excluded.updated_at, state = excluded.state`,
+		gameID, summary.White, summary.Black, summary.MoveCount, summary.Outcome, summary.Method, summary.Turn,
+		summary.Check, summary.Version, summary.TimeControl.InitialSeconds, summary.TimeControl.IncrementSeconds,
+		string(seats), createdAt.UnixMilli(), evt.Timestamp.UnixMilli(), string(data))
+	return err
+}
+
+// openSeatsAfter returns the seats open once event is folded into game, given
+// the seats open before it. The folded game holds no token hashes but the
+// ones the event itself carries (see summaryState), so only the creation can
+// be asked which seats it leaves open; a claim closes one.
+func openSeatsAfter(open []string, event estoria.EntityEvent[Game], game Game) []string {
+	switch e := event.(type) {
+	case GameCreated:
+		return game.OpenSeats()
+	case SeatClaimed:
+		return slices.DeleteFunc(slices.Clone(open), func(color string) bool { return color == e.Color })
+	}
+	return open
+}
+
+// decodeGameEvent decodes an event's data into the game event its type
+// names, as the aggregate store does when it hydrates a game.
+func decodeGameEvent(evt *eventstore.Event) (estoria.EntityEvent[Game], error) {
+	for _, prototype := range gameEventPrototypes() {
+		if prototype.EventType() != evt.ID.Type {
+			continue
+		}
+		// the events are values, so decode into a new pointer to one
+		ptr := reflect.New(reflect.TypeOf(prototype))
+		if err := json.Unmarshal(evt.Data, ptr.Interface()); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", evt.ID.Type, err)
+		}
+		return ptr.Elem().Interface().(estoria.EntityEvent[Game]), nil
+	}
+	return nil, fmt.Errorf("unknown game event type %q", evt.ID.Type)
+}
+
+// clear empties the read model and its checkpoint. Rebuilding it from
+// scratch is clear followed by catchUp: nothing is in the lobby that the
+// streams can't reproduce.
+func (p *summaryProjection) clear(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, table := range []string{"game_summaries", "game_summaries_position"} {
+		if _, err := p.db.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+			return fmt.Errorf("clearing table %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// A lobbyQuery is what the lobby lists: a page of the games that pass its
+// filters, in its order.
+type lobbyQuery struct {
+	Status string // "", "in-progress", or "finished"
+	Player string // a name either side plays under, in any case
+	Sort   string // "created", "updated", or "moves"
+	Asc    bool
+	Limit  int
+	Offset int
+}
+
+// lobbySortColumns maps each sort to its column. The game ID breaks ties, and
+// since game IDs are UUIDv7, it breaks them by age.
+var lobbySortColumns = map[string]string{
+	"created": "created_at",
+	"updated": "updated_at",
+	"moves":   "move_count",
+}
+
+// parseLobbyQuery reads a lobbyQuery from the request's query string.
+func parseLobbyQuery(r *http.Request) (lobbyQuery, error) {
+	q := r.URL.Query()
+	query := lobbyQuery{
+		Status: q.Get("status"),
+		Player: strings.TrimSpace(q.Get("player")),
+		Sort:   q.Get("sort"),
+		Limit:  defaultLobbyPageSize,
+	}
+
+	switch query.Status {
+	case "", "in-progress", "finished":
+	default:
+		return query, errors.New(`status must be "in-progress" or "finished"`)
+	}
+	if query.Sort == "" {
+		query.Sort = "created"
+	} else if _, ok := lobbySortColumns[query.Sort]; !ok {
+		return query, errors.New(`sort must be "created", "updated", or "moves"`)
+	}
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		query.Asc = true
+	default:
+		return query, errors.New(`order must be "asc" or "desc"`)
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLobbyPageSize {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxLobbyPageSize)
+		}
+		query.Limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return query, errors.New("offset must be a non-negative integer")
+		}
+		query.Offset = n
+	}
+
+	return query, nil
+}
+
+// A lobbyPage is one page of the lobby, and how many games pass its filters.
+type lobbyPage struct {
+	Games      []gameSummary `json:"games"`
+	Total      int           `json:"total"`
+	HasMore    bool          `json:"hasMore"`
+	NextOffset int           `json:"nextOffset,omitempty"`
+}
+
+// list reads a page of the lobby from the read model.
+func (p *summaryProjection) list(ctx context.Context, query lobbyQuery) (lobbyPage, error) {
+	var where []string
+	var args []any
+	switch query.Status {
+	case "in-progress":
+		where = append(where, `outcome = '*'`)
+	case "finished":
+		where = append(where, `outcome <> '*'`)
+	}
+	if query.Player != "" {
+		where = append(where, `(white = ? COLLATE NOCASE OR black = ? COLLATE NOCASE)`)
+		args = append(args, query.Player, query.Player)
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	page := lobbyPage{Games: []gameSummary{}}
+	if err := p.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM game_summaries`+filter, args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	order := " DESC"
+	if query.Asc {
+		order = " ASC"
+	}
+	rows, err := p.db.QueryContext(ctx,
+		`SELECT game_id, white, black, move_count, outcome, method, turn, in_check, version,
+			initial_seconds, increment_seconds, open_seats, created_at, updated_at
+		 FROM game_summaries`+filter+
+			` ORDER BY `+lobbySortColumns[query.Sort]+order+`, game_id`+order+
+			` LIMIT ? OFFSET ?`,
+		append(args, query.Limit, query.Offset)...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s gameSummary
+		var openSeats string
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&s.GameID, &s.White, &s.Black, &s.MoveCount, &s.Outcome, &s.Method, &s.Turn, &s.Check,
+			&s.Version, &s.TimeControl.InitialSeconds, &s.TimeControl.IncrementSeconds, &openSeats,
+			&createdAt, &updatedAt); err != nil {
+			return page, err
+		}
+		if err := json.Unmarshal([]byte(openSeats), &s.OpenSeats); err != nil {
+			return page, err
+		}
+		s.CreatedAt, s.UpdatedAt = time.UnixMilli(createdAt).UTC(), time.UnixMilli(updatedAt).UTC()
+		page.Games = append(page.Games, s)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if next := query.Offset + len(page.Games); next < page.Total {
+		page.HasMore, page.NextOffset = true, next
+	}
+	return page, nil
+}
+
+// handleListGames answers GET /api/games with a page of the lobby, read from
+// the read model rather than by loading every game. It takes "status",
+// "player", "sort" and "order" to filter and order the games, and "limit" and
+// "offset" to page through them.
+func (s *server) handleListGames(w http.ResponseWriter, r *http.Request) {
+	query, err := parseLobbyQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := s.summaries.list(r.Context(), query)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
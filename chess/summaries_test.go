@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-estoria/estoria"
+	"github.com/go-estoria/estoria/aggregatestore"
+	"github.com/gofrs/uuid/v5"
+)
+
+// TestSummaries plays a generated corpus of games, interleaved save by save
+// the way a busy server would, and checks the lobby's read model against a
+// full hydration of every game — as projected live, and again rebuilt from
+// scratch — then pages through it with filters and sorts.
+func TestSummaries(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	srv := newTestServer(t)
+	corpus := playCorpus(t, srv, rand.New(rand.NewPCG(1, 2)), 12, 100)
+
+	hydrated := map[string]gameSummary{}
+	for _, id := range corpus {
+		agg, err := srv.live.Load(ctx, id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hydrated[id.String()] = summarize(agg.Entity(), agg.Version())
+	}
+
+	all := func() map[string]gameSummary {
+		t.Helper()
+		page, err := srv.summaries.list(ctx, lobbyQuery{Sort: "created", Limit: maxLobbyPageSize})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := map[string]gameSummary{}
+		for _, s := range page.Games {
+			rows[s.GameID] = s
+		}
+		return rows
+	}
+
+	projected := all()
+	if len(projected) != len(hydrated) {
+		t.Fatalf("the lobby has %d games, want %d", len(projected), len(hydrated))
+	}
+	for id, want := range hydrated {
+		got := projected[id]
+		if got.CreatedAt.IsZero() || got.UpdatedAt.Before(got.CreatedAt) {
+			t.Errorf("game %s was created at %s and updated at %s", id, got.CreatedAt, got.UpdatedAt)
+		}
+		got.CreatedAt, got.UpdatedAt = time.Time{}, time.Time{}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("game %s:\nprojected %+v\nhydrated  %+v", id, got, want)
+		}
+	}
+
+	// seat tokens live only as hashes in the games' streams, not in the lobby
+	var leaked int
+	if err := srv.summaries.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM game_summaries WHERE state LIKE '%TokenHash%'`).Scan(&leaked); err != nil {
+		t.Fatal(err)
+	}
+	if leaked > 0 {
+		t.Errorf("%d lobby rows keep a seat token hash", leaked)
+	}
+
+	if err := srv.summaries.clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.summaries.catchUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt := all(); !reflect.DeepEqual(rebuilt, projected) {
+		t.Error("rebuilding the lobby from scratch gave a different lobby")
+	}
+
+	h := srv.routes()
+	for _, tc := range []struct {
+		query string
+		keep  func(gameSummary) bool
+	}{
+		{"status=finished&sort=moves", func(s gameSummary) bool { return s.Outcome != "*" }},
+		{"status=in-progress&sort=updated&order=asc", func(s gameSummary) bool { return s.Outcome == "*" }},
+		{"player=alice", func(s gameSummary) bool { return s.White == "Alice" || s.Black == "Alice" }},
+	} {
+		want := 0
+		for _, s := range hydrated {
+			if tc.keep(s) {
+				want++
+			}
+		}
+
+		var seen []gameSummary
+		for offset := 0; ; {
+			var page lobbyPage
+			path := fmt.Sprintf("/api/games?%s&limit=7&offset=%d", tc.query, offset)
+			if code := do(t, h, http.MethodGet, path, nil, &page); code != http.StatusOK {
+				t.Fatalf("GET %s = %d", path, code)
+			}
+			if page.Total != want {
+				t.Errorf("%s: total = %d, want %d", tc.query, page.Total, want)
+			}
+			seen = append(seen, page.Games...)
+			if !page.HasMore {
+				break
+			}
+			offset = page.NextOffset
+		}
+
+		if len(seen) != want {
+			t.Errorf("%s: paged through %d games, want %d", tc.query, len(seen), want)
+		}
+		for i, s := range seen {
+			if !tc.keep(s) {
+				t.Errorf("%s: listed %s, which it filters out", tc.query, s.GameID)
+			}
+			if i == 0 {
+				continue
+			}
+			prev := seen[i-1]
+			switch {
+			case strings.Contains(tc.query, "sort=moves") && s.MoveCount > prev.MoveCount,
+				strings.Contains(tc.query, "sort=updated") && s.UpdatedAt.Before(prev.UpdatedAt):
+				t.Errorf("%s: %s is listed after %s, out of order", tc.query, s.GameID, prev.GameID)
+			}
+		}
+	}
+
+	for _, query := range []string{"status=abandoned", "sort=rating", "order=up", "limit=0", "limit=1000", "offset=-1"} {
+		if code := do(t, h, http.MethodGet, "/api/games?"+query, nil, nil); code != http.StatusBadRequest {
+			t.Errorf("GET /api/games?%s = %d, want 400", query, code)
+		}
+	}
+}
+
+// playCorpus creates games, then saves a few random events to a random game,
+// saves times over, and returns the games' IDs. Only events the game accepts
+// are saved.
+func playCorpus(t *testing.T, srv *server, rng *rand.Rand, games, saves int) []uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+
+	players := []string{"Alice", "Bob", "Carol", "Dave"}
+	colors := []string{"white", "black"}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// each game's moves are timed by a clock of its own, ahead of the
+	// server's, so no flag ever falls in the middle of them
+	srv.now = func() time.Time { return start }
+
+	ids := make([]uuid.UUID, games)
+	aggs := map[uuid.UUID]*aggregatestore.Aggregate[Game]{}
+	clocks := map[uuid.UUID]time.Time{}
+	for i := range ids {
+		ids[i] = uuid.Must(uuid.NewV7())
+		created := GameCreated{
+			White:          players[rng.IntN(len(players))],
+			Black:          players[rng.IntN(len(players))],
+			WhiteTokenHash: hashSeatToken(fmt.Sprint("white", i)),
+		}
+		if rng.IntN(3) == 0 {
+			created.TimeControl = TimeControl{InitialSeconds: 600, IncrementSeconds: 5}
+		}
+		if rng.IntN(2) == 0 {
+			created.BlackTokenHash = created.WhiteTokenHash
+		}
+
+		agg := srv.live.New(ids[i])
+		if err := agg.Append(created); err != nil {
+			t.Fatal(err)
+		}
+		if err := srv.live.Save(ctx, agg, nil); err != nil {
+			t.Fatal(err)
+		}
+		aggs[ids[i]], clocks[ids[i]] = agg, start
+	}
+
+	for range saves {
+		id := ids[rng.IntN(len(ids))]
+		agg := aggs[id]
+		game, appended := agg.Entity(), false
+		for range 1 + rng.IntN(4) {
+			clocks[id] = clocks[id].Add(time.Duration(1+rng.IntN(5)) * time.Second)
+			at, color := clocks[id], colors[rng.IntN(2)]
+
+			var event estoria.EntityEvent[Game]
+			switch n := rng.IntN(100); {
+			case n < 75:
+				engine, err := game.rebuild()
+				if err != nil {
+					t.Fatal(err)
+				}
+				moves := engine.ValidMoves()
+				if len(moves) == 0 {
+					continue
+				}
+				move := MoveMade{UCI: moves[rng.IntN(len(moves))].String()}
+				if game.TimeControl.Timed() {
+					move.At = at
+					move.ClockMs, _ = game.clockAfterMove(at)
+				}
+				event = move
+			case n < 77:
+				event = PlayerResigned{Color: color, At: at}
+			case n < 82:
+				event = DrawOffered{Color: color}
+			case n < 84:
+				event = DrawAccepted{Color: color, At: at}
+			case n < 87:
+				event = DrawDeclined{Color: color}
+			case n < 92:
+				event = TakebackRequested{Color: color}
+			case n < 96:
+				event = TakebackAccepted{Color: color, At: at}
+			default:
+				event = SeatClaimed{Color: color, TokenHash: hashSeatToken(fmt.Sprint(id, at))}
+			}
+
+			next, err := event.ApplyTo(ctx, game)
+			if err != nil {
+				continue
+			}
+			if err := agg.Append(event); err != nil {
+				t.Fatal(err)
+			}
+			game, appended = next, true
+		}
+
+		if !appended {
+			continue
+		}
+		if err := srv.live.Save(ctx, agg, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return ids
+}
@@ -2,8 +2,9 @@
  *
  * The client is deliberately thin: all state lives in the event streams on
  * the server, one stream per game. The browser holds only the latest game
- * message (pushed over SSE), the legal moves for the live position, and an
- * optional "viewing" version when replaying history.
+ * message (pushed over SSE), the legal moves for the live position, an
+ * optional "viewing" version when replaying history, and the seat tokens it
+ * was given, which say which sides this browser plays.
  */
 
 "use strict";
@@ -17,19 +18,48 @@ const state = {
   view: "lobby",     // "lobby" | "game"
   gameId: null,      // UUID of the game being viewed
   games: [],         // lobby summaries
+  lobby: { total: 0, nextOffset: null }, // paging for the lobby's current filters
   latest: null,      // {gameId, version, game, san} — latest known state
   viewing: null,     // number | null — version being viewed in replay
   viewingMsg: null,  // game message pinned at state.viewing
   legal: null,       // {version, turn, moves} for the live position
   selected: null,    // origin square selected for a move, e.g. "e2"
   pendingPromo: null,// {from, to} awaiting a promotion piece choice
+  skewMs: 0,         // server clock minus ours, from the last serverTime seen
+  evals: null,       // {gameId, version, points} — the evaluation at every version
 };
 
+/* ============ seats ============ */
+
+// Seat tokens are kept in localStorage by game, so every tab of this browser
+// plays the seats it was given. A game with none of them is only watched.
+const SEATS_KEY = "estoria-chess-seats";
+
+function storedSeats() {
+  try {
+    return JSON.parse(localStorage.getItem(SEATS_KEY)) || {};
+  } catch {
+    return {};
+  }
+}
+
+function saveSeats(gameId, grant) {
+  const all = storedSeats();
+  const seats = all[gameId] || {};
+  for (const color of grant.seats) seats[color] = grant.token;
+  all[gameId] = seats;
+  localStorage.setItem(SEATS_KEY, JSON.stringify(all));
+}
+
+const seatToken = (color) => (storedSeats()[state.gameId] || {})[color] || null;
+const mySeats = () => ["white", "black"].filter(seatToken);
+
 /* ============ bootstrap & routing ============ */
 
 function init() {
   wireChrome();
   connect();
+  setInterval(renderClocks, 100);
   window.addEventListener("hashchange", route);
   route();
 }
@@ -50,6 +80,7 @@ function setView(view) {
   $("#timebar").classList.toggle("hidden", view !== "game");
   $("#lobby-link").classList.toggle("hidden", view !== "game");
   $("#new-game-btn").classList.toggle("hidden", view !== "lobby");
+  $("#import-btn").classList.toggle("hidden", view !== "lobby");
   if (view === "lobby") {
     document.body.classList.remove("time-traveling");
     $("#banner").classList.add("hidden");
@@ -62,15 +93,37 @@ async function enterLobby() {
   state.latest = null;
   goLiveState();
 
-  const res = await fetch("/api/games");
+  await loadLobby(0);
+}
+
+// The lobby filters for the bar's choices, and loads a page at a time: offset
+// 0 starts the list again, anything else adds to it.
+function lobbyQuery(offset) {
+  const q = new URLSearchParams({ sort: $("#lobby-sort").value, offset });
+  const status = $("#lobby-status").value;
+  const player = $("#lobby-player").value.trim();
+  if (status) q.set("status", status);
+  if (player) q.set("player", player);
+  return q;
+}
+
+async function loadLobby(offset) {
+  const res = await fetch("/api/games?" + lobbyQuery(offset));
   if (!res.ok) {
     toast("Failed to load games", "error");
     return;
   }
-  state.games = await res.json();
+  const page = await res.json();
+  state.games = offset === 0 ? page.games : state.games.concat(page.games);
+  state.lobby = { total: page.total, nextOffset: page.hasMore ? page.nextOffset : null };
   renderLobby();
 }
 
+// lobbyUnfiltered reports whether the lobby is listing every game newest
+// first, the only order a game that has just been created goes at the top of.
+const lobbyUnfiltered = () =>
+  !$("#lobby-status").value && !$("#lobby-player").value.trim() && $("#lobby-sort").value === "created";
+
 async function enterGame(id) {
   setView("game");
   state.gameId = id;
@@ -84,7 +137,7 @@ async function enterGame(id) {
     location.hash = "#/";
     return;
   }
-  state.latest = await res.json();
+  state.latest = received(await res.json());
   renderGame();
   refreshLegalMoves();
 }
@@ -99,7 +152,7 @@ function connect() {
   // every message is a full game payload tagged with its gameId: the lobby
   // uses each one to refresh its list, the game view filters for its own game
   es.onmessage = (e) => {
-    const msg = JSON.parse(e.data);
+    const msg = received(JSON.parse(e.data));
 
     // the hosted demo clears every game on the hour; whatever this tab was
     // looking at is gone, so start over from the lobby
@@ -117,8 +170,10 @@ function connect() {
     if (msg.gameId !== state.gameId) return;
     if (state.latest && msg.version <= state.latest.version) return; // stale
 
-    const moved = state.latest !== null;
+    const prev = state.latest;
+    const moved = prev !== null && (msg.game.movesUci || []).length > (prev.game.movesUci || []).length;
     state.latest = msg;
+    if (prev) announce(prev.game, msg.game);
 
     if (state.viewing === null) {
       renderGame(moved);
@@ -134,6 +189,29 @@ function connect() {
   es.onerror = () => setPill("reconnecting…", "warn"); // EventSource retries itself
 }
 
+// received notes how far the server's clock is from ours, so a running game
+// clock counts down from the server's time rather than the browser's.
+function received(msg) {
+  if (msg.serverTime) state.skewMs = Date.parse(msg.serverTime) - Date.now();
+  return msg;
+}
+
+// announce toasts the answers to offers, which otherwise only show as a
+// prompt going away.
+function announce(before, after) {
+  if (after.outcome !== "*") return;
+  const moves = (g) => (g.movesUci || []).length;
+
+  if (before.drawOfferedBy && !after.drawOfferedBy && moves(after) === moves(before)) {
+    toast("Draw declined", "", `${cap(opponentOf(before.drawOfferedBy))} wants to play on.`);
+  }
+  if (before.takebackRequestedBy && moves(after) < moves(before)) {
+    toast("Move taken back", "", `${cap(before.takebackRequestedBy)} is to move again.`);
+  }
+}
+
+const opponentOf = (color) => (color === "white" ? "black" : "white");
+
 function setPill(text, cls) {
   const pill = $("#conn-pill");
   pill.textContent = text;
@@ -151,31 +229,77 @@ function upsertSummary(msg) {
     turn: msg.game.turn,
     check: msg.game.check,
     version: msg.version,
+    timeControl: msg.game.timeControl,
+    openSeats: msg.openSeats,
   };
+  // a game already listed is updated where it is; a new one only shows up
+  // unasked when the lobby is in creation order, and the rest wait for the
+  // next load
   const idx = state.games.findIndex((g) => g.gameId === msg.gameId);
   if (idx >= 0) {
-    state.games[idx] = summary;
-  } else {
+    state.games[idx] = { ...state.games[idx], ...summary };
+  } else if (msg.version === 1 && lobbyUnfiltered()) {
     state.games.unshift(summary);
+    state.lobby.total++;
+    if (state.lobby.nextOffset !== null) state.lobby.nextOffset++;
   }
 }
 
+/* ============ PGN import ============ */
+
+// Import every game in a PGN file. The games the server takes are this
+// browser's to play, both sides; the ones it turns down are reported by the
+// first of them.
+async function importPGN(file) {
+  const res = await fetch("/api/games/import", {
+    method: "POST",
+    headers: { "Content-Type": "application/x-chess-pgn" },
+    body: await file.text(),
+  });
+  const report = await res.json().catch(() => ({}));
+  if (!res.ok) {
+    toast(report.error || "Import failed", "error");
+    return;
+  }
+
+  for (const g of report.games) {
+    if (g.gameId) saveSeats(g.gameId, report);
+  }
+  const failed = report.games.filter((g) => g.error);
+  const plural = report.games.length === 1 ? "game" : "games";
+  if (failed.length === 0) {
+    toast(`Imported ${report.imported} ${plural}`);
+  } else {
+    const first = document.createElement("span");
+    first.textContent = `Game ${failed[0].index} (line ${failed[0].line}): ${failed[0].error}`;
+    toast(`Imported ${report.imported} of ${report.games.length} ${plural}`, "error", first.outerHTML);
+  }
+  await loadLobby(0);
+}
+
 /* ============ commands ============ */
 
 // Send a command based on the latest version we know about. A 409 means the
 // stream advanced past that version — in chess: the other player moved first.
-async function command(path, body) {
+// The command acts for one side, and carries that seat's token.
+async function command(path, body, color) {
   body.baseVersion = state.latest.version;
 
-  const res = await fetch(path, {
-    method: "POST",
-    headers: { "Content-Type": "application/json" },
-    body: JSON.stringify(body),
-  });
+  const headers = { "Content-Type": "application/json" };
+  const token = seatToken(color);
+  if (token) headers.Authorization = "Bearer " + token;
+
+  const res = await fetch(path, { method: "POST", headers, body: JSON.stringify(body) });
   if (res.ok) return res.json();
 
   const err = await res.json().catch(() => ({}));
 
+  if (res.status === 401 || res.status === 403) {
+    toast("Not your seat", "error", err.error || "");
+    renderGame();
+    throw err;
+  }
+
   if (res.status === 409) {
     toast("Position changed", "conflict",
       "The other player moved first: the stream advanced past " +
@@ -186,7 +310,7 @@ async function command(path, body) {
   }
 
   if (res.status === 422) {
-    toast("Illegal move", "error", err.error || "");
+    toast(path.endsWith("/move") ? "Illegal move" : "Not allowed", "error", err.error || "");
     renderGame();
     throw err;
   }
@@ -199,7 +323,7 @@ async function command(path, body) {
 async function refreshGame() {
   const res = await fetch("/api/games/" + state.gameId);
   if (res.ok) {
-    state.latest = await res.json();
+    state.latest = received(await res.json());
     if (state.viewing === null) renderGame();
     updateTimebar();
     refreshLegalMoves();
@@ -217,7 +341,10 @@ async function refreshLegalMoves() {
   // ignore a slow response for a position that has since changed
   if (state.latest && legal.version === state.latest.version) {
     state.legal = legal;
-    if (state.viewing === null) renderBoard();
+    if (state.viewing === null) {
+      renderBoard();
+      renderActions();
+    }
   }
 }
 
@@ -227,7 +354,11 @@ function renderLobby() {
   const list = $("#game-list");
   list.innerHTML = "";
 
-  $("#lobby-empty").classList.toggle("hidden", state.games.length > 0);
+  $("#lobby-empty").classList.toggle("hidden", state.games.length > 0 || !lobbyUnfiltered());
+  $("#lobby-more").classList.toggle("hidden", state.lobby.nextOffset === null);
+  $("#lobby-count").textContent = state.games.length > 0 || !lobbyUnfiltered()
+    ? `${state.games.length} of ${state.lobby.total} ${state.lobby.total === 1 ? "game" : "games"}`
+    : "";
 
   for (const g of state.games) {
     const card = document.createElement("div");
@@ -256,7 +387,20 @@ function renderLobby() {
     const count = document.createElement("span");
     count.className = "move-count";
     count.textContent = g.moveCount + (g.moveCount === 1 ? " move" : " moves");
-    meta.append(status, count);
+    meta.append(status);
+    if (g.outcome === "*" && (g.openSeats || []).length > 0) {
+      const open = document.createElement("span");
+      open.className = "open-seat";
+      open.textContent = (g.openSeats.length === 2 ? "both seats" : g.openSeats[0]) + " open";
+      meta.append(open);
+    }
+    if (g.timeControl) {
+      const tc = document.createElement("span");
+      tc.className = "time-control";
+      tc.textContent = "⏱ " + timeControlText(g.timeControl);
+      meta.append(tc);
+    }
+    meta.append(count);
 
     card.append(matchup, meta);
     card.addEventListener("click", () => { location.hash = "#/g/" + g.gameId; });
@@ -274,16 +418,36 @@ function summaryStatus(g) {
 function outcomeText(g) {
   switch (g.outcome) {
     case "1-0":
+      if (g.method === "Timeout") return "Black ran out of time — White wins";
       return g.method === "Resignation" ? "Black resigned — White wins" : "Checkmate — White wins";
     case "0-1":
+      if (g.method === "Timeout") return "White ran out of time — Black wins";
       return g.method === "Resignation" ? "White resigned — Black wins" : "Checkmate — Black wins";
     case "1/2-1/2":
-      return "Draw — " + (g.method || "agreed").toLowerCase();
+      if (g.method === "TimeoutVsInsufficientMaterial") {
+        return "Draw — " + (g.whiteClockMs ? "Black" : "White") + " ran out of time, but can't be mated";
+      }
+      return "Draw — " + (DRAW_TEXT[g.method] || (g.method || "agreed").toLowerCase());
     default:
       return g.outcome;
   }
 }
 
+const DRAW_TEXT = {
+  DrawOffer: "agreed",
+  ThreefoldRepetition: "threefold repetition",
+  FiftyMoveRule: "fifty-move rule",
+  FivefoldRepetition: "fivefold repetition",
+  SeventyFiveMoveRule: "seventy-five-move rule",
+  InsufficientMaterial: "insufficient material",
+};
+
+// timeControlText renders a time control as "5 min" or "3 min + 2 s".
+function timeControlText(tc) {
+  const base = tc.initialSeconds % 60 === 0 ? tc.initialSeconds / 60 + " min" : tc.initialSeconds + " s";
+  return tc.incrementSeconds ? `${base} + ${tc.incrementSeconds} s` : base;
+}
+
 const cap = (s) => s.charAt(0).toUpperCase() + s.slice(1);
 
 /* ============ game rendering ============ */
@@ -299,12 +463,15 @@ function renderGame(animate = false) {
   if (!msg) return;
 
   document.body.classList.toggle("time-traveling", state.viewing !== null);
+  document.body.classList.toggle("spectating", mySeats().length === 0);
 
   $("#white-name").textContent = state.latest.game.white;
   $("#black-name").textContent = state.latest.game.black;
   $("#pgn-btn").href = `/api/games/${state.gameId}/pgn`;
 
   renderStatus(msg.game);
+  renderSeat();
+  renderClocks();
   renderBoard(animate);
   renderMoveList();
   renderActions();
@@ -330,6 +497,86 @@ function renderStatus(game) {
   }
 }
 
+// renderSeat says which sides this browser plays, and offers the open seats
+// to a spectator.
+function renderSeat() {
+  const panel = $("#seat-panel");
+  panel.innerHTML = "";
+
+  const mine = mySeats();
+  const label = document.createElement("span");
+  if (mine.length === 2) {
+    label.innerHTML = "You play <strong>both sides</strong>";
+  } else if (mine.length === 1) {
+    label.innerHTML = `You play <strong>${cap(mine[0])}</strong>`;
+  } else {
+    label.innerHTML = "<strong>Spectating</strong>";
+  }
+  panel.appendChild(label);
+
+  const computer = state.latest.game.computer;
+  if (computer) {
+    const note = document.createElement("span");
+    note.textContent = `${cap(computer)} is the computer, ${state.latest.game.computerDepth}-ply`;
+    panel.appendChild(note);
+  }
+
+  if (state.latest.game.outcome !== "*") return;
+  for (const color of state.latest.openSeats || []) {
+    const btn = document.createElement("button");
+    btn.className = "btn primary";
+    btn.textContent = `Play ${cap(color)}`;
+    btn.addEventListener("click", () => claimSeat(color));
+    panel.appendChild(btn);
+  }
+}
+
+async function claimSeat(color) {
+  const res = await fetch(`/api/games/${state.gameId}/seats/${color}`, { method: "POST" });
+  const body = await res.json().catch(() => ({}));
+  if (!res.ok) {
+    toast("Couldn't take the seat", "error", body.error || "");
+    return;
+  }
+  saveSeats(state.gameId, body);
+  toast(`You play ${cap(color)}`);
+  await refreshGame();
+}
+
+// renderClocks shows each side's remaining time. While the game is live the
+// side to move's clock runs from clockStartedAt; it is run again every tick,
+// and the server, not this countdown, decides when a flag falls. Replayed
+// versions show the clocks as they stood.
+function renderClocks() {
+  const msg = state.view === "game" ? messageToRender() : null;
+  const game = msg && msg.game;
+  const timed = !!(game && game.timeControl);
+
+  for (const color of ["white", "black"]) {
+    const el = $(`#${color}-clock`);
+    el.classList.toggle("hidden", !timed);
+    if (!timed) continue;
+
+    let ms = game[color + "ClockMs"] || 0;
+    const running = game.outcome === "*" && game.turn === color && !!game.clockStartedAt;
+    if (running && state.viewing === null) {
+      ms -= Date.now() + state.skewMs - Date.parse(game.clockStartedAt);
+    }
+    ms = Math.max(0, ms);
+
+    el.textContent = clockText(ms);
+    el.classList.toggle("running", running);
+    el.classList.toggle("low", running && ms < 10000);
+  }
+}
+
+// clockText renders milliseconds as "4:59", or "0:09.4" under ten seconds.
+function clockText(ms) {
+  if (ms < 10000) return "0:0" + (Math.floor(ms / 100) / 10).toFixed(1);
+  const s = Math.floor(ms / 1000);
+  return Math.floor(s / 60) + ":" + String(s % 60).padStart(2, "0");
+}
+
 function renderBoard(animate = false) {
   const msg = messageToRender();
   if (!msg) return;
@@ -337,7 +584,7 @@ function renderBoard(animate = false) {
   const pieces = parseFEN(msg.game.fen);
   const moves = msg.game.movesUci || [];
   const lastMove = moves.length > 0 ? moves[moves.length - 1] : null;
-  const interactive = state.viewing === null && msg.game.outcome === "*";
+  const interactive = state.viewing === null && msg.game.outcome === "*" && !!seatToken(msg.game.turn);
   const legal = interactive && state.legal && state.legal.version === msg.version
     ? state.legal.moves : {};
   const targets = state.selected && legal[state.selected] ? legal[state.selected] : [];
@@ -460,7 +707,7 @@ function wireBoard() {
 async function sendMove(uci) {
   renderBoard(); // clear selection highlights immediately
   try {
-    await command(`/api/games/${state.gameId}/move`, { uci });
+    await command(`/api/games/${state.gameId}/move`, { uci }, state.latest.game.turn);
   } catch { /* command() already toasted */ }
 }
 
@@ -498,13 +745,16 @@ function wirePromoPicker() {
 
 /* ============ move list ============ */
 
-// Version numbering: v1 is the freshly created game, and each ply k lands at
-// version k+1. The SAN list is paired into full moves ("1. e4 e5").
+// Version numbering: v1 is the freshly created game, and every event after it
+// (a move, an offer, a takeback) is one version more, so the game says which
+// version each of its moves landed at. The SAN list is paired into full moves
+// ("1. e4 e5").
 function renderMoveList() {
   const list = $("#move-list");
   list.innerHTML = "";
 
   const san = state.latest.san || [];
+  const versions = state.latest.game.moveVersions || [];
   const viewingVersion = state.viewing === null ? state.latest.version : state.viewing;
 
   if (san.length === 0) {
@@ -524,8 +774,10 @@ function renderMoveList() {
     for (const ply of [i, i + 1]) {
       const cell = document.createElement("li");
       if (ply < san.length) {
-        const version = ply + 2; // ply k (0-based) lands at version k+2
-        cell.className = "ply" + (version === viewingVersion ? " current" : "");
+        const version = versions[ply];
+        const next = ply + 1 < versions.length ? versions[ply + 1] : Infinity;
+        const current = viewingVersion >= version && viewingVersion < next;
+        cell.className = "ply" + (current ? " current" : "");
         cell.textContent = san[ply];
         cell.title = `Jump to move ${ply + 1}`;
         cell.addEventListener("click", () => travelTo(version));
@@ -540,11 +792,74 @@ function renderMoveList() {
   if (current) current.scrollIntoView({ block: "nearest" });
 }
 
+// renderActions enables the buttons each side can use in the live game, and
+// shows the offers waiting for an answer. The events decide what's allowed;
+// this only spares a click the server would refuse.
 function renderActions() {
-  const over = state.latest.game.outcome !== "*";
-  const replaying = state.viewing !== null;
-  $("#resign-white").disabled = over || replaying;
-  $("#resign-black").disabled = over || replaying;
+  const game = state.latest.game;
+  const idle = game.outcome !== "*" || state.viewing !== null;
+  const moves = (game.movesUci || []).length;
+  const mine = mySeats();
+
+  for (const color of ["white", "black"]) {
+    for (const action of ["resign", "draw", "takeback"]) {
+      $(`#${action}-${color}`).classList.toggle("hidden", !mine.includes(color));
+    }
+    $(`#resign-${color}`).disabled = idle;
+    $(`#draw-${color}`).disabled = idle || !!game.drawOfferedBy;
+    $(`#takeback-${color}`).disabled = idle || moves === 0 || game.turn === color || !!game.takebackRequestedBy;
+  }
+
+  const offers = $("#offers");
+  offers.innerHTML = "";
+  if (!idle && game.drawOfferedBy) {
+    offers.appendChild(offerPrompt(
+      `${cap(game.drawOfferedBy)} offers a draw`, opponentOf(game.drawOfferedBy), "draw"));
+  }
+  if (!idle && game.takebackRequestedBy) {
+    const san = state.latest.san[moves - 1];
+    offers.appendChild(offerPrompt(
+      `${cap(game.takebackRequestedBy)} asks to take back ${san}`, opponentOf(game.takebackRequestedBy), "takeback"));
+  }
+
+  // either side may claim; this browser claims as the side to move if it
+  // plays it
+  const claim = $("#claim-btn");
+  const claimant = mine.includes(game.turn) ? game.turn : mine[0];
+  const claims = !idle && state.legal && state.legal.version === state.latest.version ? state.legal.claims || [] : [];
+  claim.classList.toggle("hidden", claims.length === 0 || !claimant);
+  if (claims.length > 0 && claimant) {
+    claim.dataset.method = claims[0];
+    claim.dataset.color = claimant;
+    claim.textContent = `½ ${cap(claimant)} claims a draw by ${DRAW_TEXT[claims[0]]}`;
+  }
+}
+
+// offerPrompt builds the answer buttons for an offer, acting as the side
+// it's put to, if this browser plays it. Takebacks have no decline: the
+// answer is playing on.
+function offerPrompt(text, color, kind) {
+  const el = document.createElement("div");
+  el.className = "offer";
+  const label = document.createElement("span");
+  label.textContent = text;
+  el.appendChild(label);
+  if (!seatToken(color)) return el;
+
+  const answer = (verb, cls) => {
+    const btn = document.createElement("button");
+    btn.className = "btn " + cls;
+    btn.textContent = cap(verb);
+    btn.addEventListener("click", async () => {
+      try {
+        await command(`/api/games/${state.gameId}/${kind}/${verb}`, { color }, color);
+      } catch { /* handled */ }
+    });
+    el.appendChild(btn);
+  };
+  answer("accept", "primary");
+  if (kind === "draw") answer("decline", "ghost");
+  return el;
 }
 
 /* ============ replay (time travel) ============ */
@@ -555,16 +870,64 @@ function updateTimebar() {
   slider.max = state.latest.version;
   if (state.viewing === null) slider.value = state.latest.version;
   updateTimeLabel();
+
+  const evals = state.evals;
+  if (!evals || evals.gameId !== state.gameId || evals.version < state.latest.version) {
+    refreshEvaluations();
+  }
+  renderEvalGraph();
 }
 
 function updateTimeLabel() {
-  const v = state.viewing === null ? state.latest.version : state.viewing;
-  const total = state.latest.version - 1; // moves played so far
-  const move = v - 1;                     // moves shown at version v
+  const total = state.latest.version;
+  const v = state.viewing === null ? total : state.viewing;
+  const score = evalAt(v);
   $("#time-label").textContent =
-    state.viewing === null
-      ? `live · move ${total} of ${total}`
-      : `move ${move} of ${total}`;
+    (state.viewing === null ? `live · v${total} of ${total}` : `v${v} of ${total}`) +
+    (score === null ? "" : ` · ${formatEval(score)}`);
+}
+
+// The evaluation graph behind the slider shows how the advantage moved over
+// the game: one point per version, above the line when White stands better.
+const refreshEvaluations = debounce(async () => {
+  const gameId = state.gameId;
+  const res = await fetch(`/api/games/${gameId}/evaluations`);
+  if (!res.ok || gameId !== state.gameId) return;
+  const body = await res.json();
+  state.evals = { gameId, version: body.version, points: body.evaluations };
+  updateTimeLabel();
+  renderEvalGraph();
+}, 250);
+
+function evalAt(version) {
+  const evals = state.evals;
+  if (!evals || evals.gameId !== state.gameId) return null;
+  const point = evals.points[version - 1];
+  return point ? point.eval : null;
+}
+
+// formatEval shows centipawns in pawns from White's side, or who mates.
+function formatEval(cp) {
+  if (Math.abs(cp) >= 100000) return cp > 0 ? "1-0 mate" : "0-1 mate";
+  return (cp > 0 ? "+" : "") + (cp / 100).toFixed(1);
+}
+
+function renderEvalGraph() {
+  const svg = $("#eval-graph");
+  const evals = state.evals;
+  if (!evals || evals.gameId !== state.gameId || evals.points.length < 2) {
+    svg.innerHTML = "";
+    return;
+  }
+
+  // ten pawns either way fills the height; a mate is off the scale
+  const n = evals.points.length;
+  const y = (cp) => 50 - Math.max(-10, Math.min(10, cp / 100)) * 5;
+  const points = evals.points.map((p, i) => `${(i / (n - 1)) * 100},${y(p.eval)}`);
+  svg.innerHTML =
+    `<line x1="0" y1="50" x2="100" y2="50" class="eval-zero"/>` +
+    `<polygon points="0,50 ${points.join(" ")} 100,50" class="eval-area"/>` +
+    `<polyline points="${points.join(" ")}" class="eval-line"/>`;
 }
 
 const debouncedTravel = debounce(async (v) => {
@@ -614,17 +977,17 @@ function travelTo(v) {
 }
 
 function showBanner() {
-  if (state.viewing === null) return;
+  if (state.viewing === null || !state.viewingMsg) return;
   const banner = $("#banner");
-  const move = state.viewing - 1;
-  const total = state.latest.version - 1;
-  const san = move > 0 ? state.latest.san[move - 1] : null;
+  const total = state.latest.version;
+  const san = state.viewingMsg ? state.viewingMsg.san || [] : [];
+  const ply = san.length;
 
   banner.innerHTML = "";
   const text = document.createElement("span");
-  text.textContent = move === 0
-    ? `Viewing the starting position (move 0 of ${total})`
-    : `Viewing move ${move} of ${total} — ${san}`;
+  text.textContent = ply === 0
+    ? `Viewing the starting position (v${state.viewing} of ${total})`
+    : `Viewing v${state.viewing} of ${total} — after ${Math.ceil(ply / 2)}.${ply % 2 ? "" : ".."} ${san[ply - 1]}`;
   const btn = document.createElement("button");
   btn.textContent = "Return to live";
   btn.addEventListener("click", goLive);
@@ -639,26 +1002,68 @@ function wireChrome() {
   wirePromoPicker();
   wireTimebar();
 
+  for (const id of ["#lobby-status", "#lobby-sort"]) {
+    $(id).addEventListener("change", () => loadLobby(0));
+  }
+  let typing = null;
+  $("#lobby-player").addEventListener("input", () => {
+    clearTimeout(typing);
+    typing = setTimeout(() => loadLobby(0), 250);
+  });
+  $("#lobby-more").addEventListener("click", () => loadLobby(state.lobby.nextOffset));
+
+  $("#import-btn").addEventListener("click", () => $("#import-input").click());
+  $("#import-input").addEventListener("change", async (e) => {
+    const file = e.target.files[0];
+    e.target.value = "";
+    if (file) await importPGN(file);
+  });
+
   const modal = $("#new-game-modal");
 
   $("#new-game-btn").addEventListener("click", () => {
     $("#white-input").value = "";
     $("#black-input").value = "";
+    $("#seat-input").value = "white";
+    $("#opponent-input").value = "human";
+    $("#depth-input").value = "2";
+    $("#time-control-input").value = "";
+    syncOpponent();
     modal.showModal();
   });
 
+  // against the computer there is one seat to play, and a strength to pick
+  function syncOpponent() {
+    const computer = $("#opponent-input").value === "computer";
+    $("#depth-field").classList.toggle("hidden", !computer);
+    $("#seat-input option[value=both]").disabled = computer;
+    if (computer && $("#seat-input").value === "both") $("#seat-input").value = "white";
+  }
+  $("#opponent-input").addEventListener("change", syncOpponent);
+
   $("#new-game-cancel").addEventListener("click", () => modal.close());
 
   $("#new-game-form").addEventListener("submit", async (e) => {
     e.preventDefault();
     modal.close();
+    const body = {
+      white: $("#white-input").value.trim(),
+      black: $("#black-input").value.trim(),
+      seat: $("#seat-input").value,
+    };
+    if ($("#opponent-input").value === "computer") {
+      body.opponent = "computer";
+      body.depth = Number($("#depth-input").value);
+    }
+    const tc = $("#time-control-input").value;
+    if (tc) {
+      const [initial, increment] = tc.split("+").map(Number);
+      body.timeControl = { initialSeconds: initial, incrementSeconds: increment };
+    }
     const res = await fetch("/api/games", {
       method: "POST",
       headers: { "Content-Type": "application/json" },
-      body: JSON.stringify({
-        white: $("#white-input").value.trim(),
-        black: $("#black-input").value.trim(),
-      }),
+      body: JSON.stringify(body),
     });
     if (!res.ok) {
       const err = await res.json().catch(() => ({}));
@@ -666,6 +1071,7 @@ function wireChrome() {
       return;
     }
     const msg = await res.json();
+    saveSeats(msg.gameId, msg);
     location.hash = "#/g/" + msg.gameId;
   });
 
@@ -673,10 +1079,27 @@ function wireChrome() {
     $(`#resign-${color}`).addEventListener("click", async () => {
       if (!confirm(`Resign as ${color}? This ends the game.`)) return;
       try {
-        await command(`/api/games/${state.gameId}/resign`, { color });
+        await command(`/api/games/${state.gameId}/resign`, { color }, color);
+      } catch { /* handled */ }
+    });
+    $(`#draw-${color}`).addEventListener("click", async () => {
+      try {
+        await command(`/api/games/${state.gameId}/draw/offer`, { color }, color);
+      } catch { /* handled */ }
+    });
+    $(`#takeback-${color}`).addEventListener("click", async () => {
+      try {
+        await command(`/api/games/${state.gameId}/takeback/request`, { color }, color);
       } catch { /* handled */ }
     });
   }
+
+  $("#claim-btn").addEventListener("click", async (e) => {
+    const { color, method } = e.currentTarget.dataset;
+    try {
+      await command(`/api/games/${state.gameId}/draw/claim`, { color, method }, color);
+    } catch { /* handled */ }
+  });
 }
 
 /* ============ toasts & helpers ============ */
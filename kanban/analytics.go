@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/gofrs/uuid/v5"
+)
+
+// Flow metrics are projections like any other: replay the board's events in
+// order, applying each to the board as the aggregate would, and note what the
+// board looked like at each moment. The stream already has everything needed —
+// every event is timestamped — so nothing extra is recorded to compute them.
+
+// maxAnalyticsDays caps the date range of one analytics request.
+const maxAnalyticsDays = 366
+
+// A flowDay is the board's column sizes at the end of one (UTC) day.
+type flowDay struct {
+	Date    string       `json:"date"`
+	Columns []flowColumn `json:"columns"`
+}
+
+type flowColumn struct {
+	ColumnID string `json:"columnId"`
+	Title    string `json:"title"`
+	Cards    int    `json:"cards"`
+}
+
+// handleFlow returns cards per column at the end of each day, the data for a
+// cumulative flow diagram. Days before the board existed are left out.
+func (s *server) handleFlow(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	events, from, to, ok := s.analyticsInput(w, r, boardID)
+	if !ok {
+		return
+	}
+
+	days, err := flowByDay(r.Context(), boardID, events, from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, days)
+}
+
+// flowByDay replays events, recording the column sizes at the end of each day
+// from the board's first day through to, and keeping those from from onward.
+func flowByDay(ctx context.Context, boardID uuid.UUID, events []versionedEvent, from, to time.Time) ([]flowDay, error) {
+	days := []flowDay{}
+	record := func(day time.Time, board Board) {
+		if day.Before(from) || day.After(to) {
+			return
+		}
+		entry := flowDay{Date: day.Format(dueDateLayout), Columns: []flowColumn{}}
+		for _, col := range board.Columns {
+			entry.Columns = append(entry.Columns, flowColumn{ColumnID: col.ID, Title: col.Title, Cards: len(col.Cards)})
+		}
+		days = append(days, entry)
+	}
+
+	board := NewBoard(boardID)
+	day := dayOf(events[0].timestamp)
+	for _, e := range events {
+		// close out every day that ended before this event
+		for ; day.Before(dayOf(e.timestamp)); day = day.AddDate(0, 0, 1) {
+			record(day, board)
+		}
+
+		var err error
+		if board, err = e.event.ApplyTo(ctx, board); err != nil {
+			return nil, fmt.Errorf("replaying v%d: %w", e.version, err)
+		}
+	}
+	for ; !day.After(to); day = day.AddDate(0, 0, 1) {
+		record(day, board)
+	}
+
+	return days, nil
+}
+
+// A cardCycle is how long one card took to reach the last column.
+type cardCycle struct {
+	CardID      string    `json:"cardId"`
+	Title       string    `json:"title"`
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+	Hours       float64   `json:"hours"`
+}
+
+// handleCycleTime returns, for each card that reached the board's last column
+// within the date range, the time from first entering a column to first
+// arriving in the last one, with percentiles across those cards.
+func (s *server) handleCycleTime(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	events, from, to, ok := s.analyticsInput(w, r, boardID)
+	if !ok {
+		return
+	}
+
+	cycles, err := cycleTimes(r.Context(), boardID, events, from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	hours := make([]float64, len(cycles))
+	for i, c := range cycles {
+		hours[i] = c.Hours
+	}
+	slices.Sort(hours)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"cards": cycles,
+		"percentiles": map[string]float64{
+			"p50": percentile(hours, 50),
+			"p85": percentile(hours, 85),
+			"p95": percentile(hours, 95),
+		},
+	})
+}
+
+// cycleTimes replays events, timing each card from the event that first put
+// it on the board to the first event after which it sat in the last column.
+// Only cards completed between from and to are returned.
+func cycleTimes(ctx context.Context, boardID uuid.UUID, events []versionedEvent, from, to time.Time) ([]cardCycle, error) {
+	started := map[string]time.Time{}
+	completed := map[string]bool{}
+	cycles := []cardCycle{}
+
+	board := NewBoard(boardID)
+	for _, e := range events {
+		var err error
+		if board, err = e.event.ApplyTo(ctx, board); err != nil {
+			return nil, fmt.Errorf("replaying v%d: %w", e.version, err)
+		}
+
+		if cardID := touchedCard(e.event); cardID != "" {
+			if _, ok := started[cardID]; !ok && board.HasCard(cardID) {
+				started[cardID] = e.timestamp
+			}
+		}
+		if len(board.Columns) == 0 {
+			continue
+		}
+
+		// Any event can put a card in the last column: a move, a column
+		// removal that hands its cards over, or a reorder. So after each one,
+		// look at who is there now.
+		for _, card := range board.Columns[len(board.Columns)-1].Cards {
+			if completed[card.ID] {
+				continue
+			}
+			completed[card.ID] = true
+
+			day := dayOf(e.timestamp)
+			if day.Before(from) || day.After(to) {
+				continue
+			}
+			cycles = append(cycles, cardCycle{
+				CardID:      card.ID,
+				Title:       card.Title,
+				StartedAt:   started[card.ID],
+				CompletedAt: e.timestamp,
+				Hours:       e.timestamp.Sub(started[card.ID]).Hours(),
+			})
+		}
+	}
+
+	return cycles, nil
+}
+
+// analyticsInput reads the board's whole stream and the from/to query
+// parameters (YYYY-MM-DD, inclusive, UTC). Left out, the range runs from the
+// board's first day to today. It writes the error response itself and
+// returns false when the request can't be served.
+func (s *server) analyticsInput(w http.ResponseWriter, r *http.Request, boardID uuid.UUID) (events []versionedEvent, from, to time.Time, ok bool) {
+	events, err := readBoardEvents(r.Context(), s.events, boardID, eventstore.ReadStreamOptions{})
+	if err != nil && !errors.Is(err, eventstore.ErrStreamNotFound) {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, from, to, false
+	}
+	if len(events) == 0 {
+		writeError(w, http.StatusNotFound, "board not found")
+		return nil, from, to, false
+	}
+
+	from, to = dayOf(events[0].timestamp), dayOf(time.Now())
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := r.URL.Query().Get(name); v != "" {
+			if *dst, err = time.Parse(dueDateLayout, v); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("%s must be a date like 2006-01-02", name))
+				return nil, from, to, false
+			}
+		}
+	}
+
+	if to.Before(from) {
+		writeError(w, http.StatusBadRequest, "from must not be after to")
+		return nil, from, to, false
+	}
+	if to.Sub(from) >= maxAnalyticsDays*24*time.Hour {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("the date range is limited to %d days", maxAnalyticsDays))
+		return nil, from, to, false
+	}
+
+	return events, from, to, true
+}
+
+// dayOf truncates t to the start of its UTC day.
+func dayOf(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// percentile returns the nearest-rank percentile p of sorted values, or 0 for
+// none.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-estoria/estoria"
+	"github.com/gofrs/uuid/v5"
+)
+
+// The analytics are projections over timestamped events, so they are tested
+// the same way as the domain: feed in a history, check what comes out.
+
+func TestFlowAndCycleTime(t *testing.T) {
+	t.Parallel()
+
+	day := func(d, hour int) time.Time { return time.Date(2026, 3, d, hour, 0, 0, 0, time.UTC) }
+
+	var events []versionedEvent
+	at := func(ts time.Time, e estoria.EntityEvent[Board]) {
+		events = append(events, versionedEvent{version: int64(len(events) + 1), timestamp: ts, event: e})
+	}
+
+	at(day(2, 9), BoardCreated{Name: "Flow"})
+	at(day(2, 9), ColumnAdded{ColumnID: "todo", Title: "To Do"})
+	at(day(2, 9), ColumnAdded{ColumnID: "done", Title: "Done"})
+	at(day(2, 10), CardAdded{CardID: "a", ColumnID: "todo", Title: "a"})
+	at(day(2, 11), CardAdded{CardID: "b", ColumnID: "todo", Title: "b"})
+	at(day(3, 10), CardMoved{CardID: "a", ToColumn: "done"}) // a: 24h
+	at(day(5, 11), CardMoved{CardID: "b", ToColumn: "done"}) // b: 72h
+	at(day(5, 12), CardMoved{CardID: "b", ToColumn: "todo"}) // leaving again doesn't reset it
+	at(day(6, 12), CardMoved{CardID: "b", ToColumn: "done"})
+
+	boardID := uuid.Must(uuid.NewV4())
+	ctx := context.Background()
+
+	t.Run("counts cards per column at the end of each day", func(t *testing.T) {
+		t.Parallel()
+		days, err := flowByDay(ctx, boardID, events, day(2, 0), day(6, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string][2]int{ // date -> [to do, done]
+			"2026-03-02": {2, 0},
+			"2026-03-03": {1, 1},
+			"2026-03-04": {1, 1}, // a quiet day still gets a row
+			"2026-03-05": {1, 1},
+			"2026-03-06": {0, 2},
+		}
+		if len(days) != len(want) {
+			t.Fatalf("got %d days, want %d: %+v", len(days), len(want), days)
+		}
+		for _, d := range days {
+			got := [2]int{d.Columns[0].Cards, d.Columns[1].Cards}
+			if got != want[d.Date] {
+				t.Errorf("%s: got %v, want %v", d.Date, got, want[d.Date])
+			}
+		}
+	})
+
+	t.Run("filters days to the range", func(t *testing.T) {
+		t.Parallel()
+		days, err := flowByDay(ctx, boardID, events, day(4, 0), day(5, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(days) != 2 || days[0].Date != "2026-03-04" || days[1].Date != "2026-03-05" {
+			t.Errorf("days = %+v, want March 4 and 5 only", days)
+		}
+	})
+
+	t.Run("times cards from first column to first arrival in the last", func(t *testing.T) {
+		t.Parallel()
+		cycles, err := cycleTimes(ctx, boardID, events, day(1, 0), day(30, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]float64{"a": 24, "b": 72}
+		if len(cycles) != len(want) {
+			t.Fatalf("cycles = %+v, want one per completed card", cycles)
+		}
+		for _, c := range cycles {
+			if c.Hours != want[c.CardID] {
+				t.Errorf("card %s took %vh, want %vh", c.CardID, c.Hours, want[c.CardID])
+			}
+		}
+	})
+
+	t.Run("filters cycles by completion date", func(t *testing.T) {
+		t.Parallel()
+		cycles, err := cycleTimes(ctx, boardID, events, day(4, 0), day(30, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cycles) != 1 || cycles[0].CardID != "b" {
+			t.Errorf("cycles = %+v, want only b, completed on March 5", cycles)
+		}
+	})
+
+	t.Run("computes nearest-rank percentiles", func(t *testing.T) {
+		t.Parallel()
+		hours := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+		for p, want := range map[float64]float64{50: 5, 85: 9, 95: 10} {
+			if got := percentile(hours, p); got != want {
+				t.Errorf("p%v = %v, want %v", p, got, want)
+			}
+		}
+		if got := percentile(nil, 50); got != 0 {
+			t.Errorf("p50 of nothing = %v, want 0", got)
+		}
+	})
+}
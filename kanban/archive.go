@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-estoria/estoria"
+)
+
+// Taking a card off the board archives it: the card and everything on it
+// stay in the board's state, with the column it came from, until it is
+// restored or deleted. Deleting (CardRemoved) is a purge, and only archived
+// cards can be purged, so nothing leaves a board by accident. The archive is
+// part of the aggregate rather than a projection because restore has to check
+// it in the same load that saves the restore.
+
+// An archiveEntry is an archived card as GET /api/boards/{id}/archive lists
+// it.
+type archiveEntry struct {
+	ArchivedCard
+
+	// ColumnExists reports whether the card's column is still on the board,
+	// which is where a restore puts it back.
+	ColumnExists bool `json:"columnExists"`
+}
+
+// handleListArchive answers GET /api/boards/{id}/archive with the board's
+// archived cards, oldest first.
+func (s *server) handleListArchive(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	agg, err := s.live.Load(r.Context(), boardID, nil)
+	if err != nil {
+		s.writeLoadError(w, err)
+		return
+	}
+
+	board := agg.Entity().rendered()
+	entries := make([]archiveEntry, len(board.Archived))
+	for i, archived := range board.Archived {
+		entries[i] = archiveEntry{ArchivedCard: archived, ColumnExists: board.HasColumn(archived.ColumnID)}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"boardId": boardID,
+		"version": agg.Version(),
+		"cards":   entries,
+	})
+}
+
+// handleRestoreCard answers POST /api/boards/{id}/cards/{cardId}/restore by
+// putting an archived card back at the bottom of the column it was archived
+// from. If that column has been removed since, the request must name another
+// with columnId; while it exists, columnId is ignored.
+func (s *server) handleRestoreCard(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	cardID := r.PathValue("cardId")
+	req, err := readJSON[struct {
+		BaseVersion int64  `json:"baseVersion"`
+		ColumnID    string `json:"columnId"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+		i := board.archivedIndex(cardID)
+		if i < 0 {
+			return nil, fmt.Errorf("card %s is not in the archive", cardID)
+		}
+		archived := board.Archived[i]
+
+		columnID := archived.ColumnID
+		if !board.HasColumn(columnID) {
+			if req.ColumnID == "" {
+				return nil, fmt.Errorf("column %q no longer exists; choose a column to restore the card to", archived.ColumnTitle)
+			}
+			if !board.HasColumn(req.ColumnID) {
+				return nil, fmt.Errorf("column %s does not exist", req.ColumnID)
+			}
+			columnID = req.ColumnID
+		}
+
+		return CardRestored{
+			Card:     archived.Card,
+			ColumnID: columnID,
+			Index:    len(board.column(columnID).Cards),
+		}, nil
+	})
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"slices"
+
 	"github.com/go-estoria/estoria/typeid"
 	"github.com/gofrs/uuid/v5"
 )
@@ -11,6 +13,10 @@ type Board struct {
 	ID      uuid.UUID `json:"id"`
 	Name    string    `json:"name"`
 	Columns []Column  `json:"columns"`
+
+	// Archived holds the cards taken off the board but kept, in the order
+	// they were archived.
+	Archived []ArchivedCard `json:"archived,omitempty"`
 }
 
 // A Column is an ordered lane of cards on a board.
@@ -18,16 +24,59 @@ type Column struct {
 	ID    string `json:"id"`
 	Title string `json:"title"`
 	Cards []Card `json:"cards"`
+
+	// WIPLimit caps how many cards the column may hold; 0 means no limit.
+	WIPLimit int `json:"wipLimit,omitempty"`
+}
+
+// hasRoomFor reports whether n more cards fit under the column's WIP limit.
+func (c *Column) hasRoomFor(n int) bool {
+	return c.WIPLimit == 0 || len(c.Cards)+n <= c.WIPLimit
 }
 
 // A Card is a single work item on a board.
 type Card struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description,omitempty"`
-	Color       string `json:"color,omitempty"`
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"` // Markdown
+	Color       CardColor `json:"color,omitzero"`
+
+	// DescriptionHTML is the description rendered to sanitized HTML. It is
+	// derived, so it is never stored: events and snapshots leave it empty,
+	// and Board.rendered fills it in for the boards the API sends.
+	DescriptionHTML string `json:"descriptionHtml,omitempty"`
+
+	Assignees []string        `json:"assignees,omitempty"`
+	Labels    []string        `json:"labels,omitempty"`
+	DueDate   string          `json:"dueDate,omitempty"` // YYYY-MM-DD
+	Checklist []ChecklistItem `json:"checklist,omitempty"`
+}
+
+// A CardColor is a card's color, and optionally what that color means on the
+// board ("blocked", "customer request").
+type CardColor struct {
+	Name  string `json:"name"` // a palette color: "blue", "red", …
+	Label string `json:"label,omitempty"`
+}
+
+// An ArchivedCard is a card in a board's archive, with the column it was
+// archived from. The column may since have been removed.
+type ArchivedCard struct {
+	Card        Card   `json:"card"`
+	ColumnID    string `json:"columnId"`
+	ColumnTitle string `json:"columnTitle"` // as it was when the card was archived
 }
 
+// A ChecklistItem is one step on a card's checklist.
+type ChecklistItem struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+	Done bool   `json:"done"`
+}
+
+// dueDateLayout is the format of Card.DueDate: a calendar day, no time zone.
+const dueDateLayout = "2006-01-02"
+
 // NewBoard is the estoria.EntityFactory for Board aggregates.
 func NewBoard(id uuid.UUID) Board {
 	return Board{ID: id}
@@ -46,8 +95,42 @@ func (b Board) clone() Board {
 	for i, col := range b.Columns {
 		c.Columns[i] = col
 		c.Columns[i].Cards = make([]Card, len(col.Cards))
-		copy(c.Columns[i].Cards, col.Cards)
+		for j, card := range col.Cards {
+			c.Columns[i].Cards[j] = card.clone()
+		}
+	}
+	c.Archived = slices.Clone(b.Archived)
+	for i := range c.Archived {
+		c.Archived[i].Card = c.Archived[i].Card.clone()
+	}
+	return c
+}
+
+// rendered returns a copy of the board with every card's description rendered
+// to HTML, for sending to clients.
+func (b Board) rendered() Board {
+	r := b.clone()
+	for i := range r.Columns {
+		for j := range r.Columns[i].Cards {
+			r.Columns[i].Cards[j].render()
+		}
+	}
+	for i := range r.Archived {
+		r.Archived[i].Card.render()
 	}
+	return r
+}
+
+// render fills in the card's DescriptionHTML from its description.
+func (c *Card) render() {
+	c.DescriptionHTML, _ = renderMarkdown(c.Description)
+}
+
+// clone returns a copy of the card that shares no slices with the original.
+func (c Card) clone() Card {
+	c.Assignees = slices.Clone(c.Assignees)
+	c.Labels = slices.Clone(c.Labels)
+	c.Checklist = slices.Clone(c.Checklist)
 	return c
 }
 
@@ -61,6 +144,35 @@ func (b *Board) column(id string) *Column {
 	return nil
 }
 
+// columnIndex returns the index of the column with the given ID, or -1.
+func (b *Board) columnIndex(id string) int {
+	for i := range b.Columns {
+		if b.Columns[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// card returns a pointer to the card with the given ID, or nil.
+func (b *Board) card(id string) *Card {
+	colIdx, cardIdx := b.findCard(id)
+	if colIdx < 0 {
+		return nil
+	}
+	return &b.Columns[colIdx].Cards[cardIdx]
+}
+
+// checklistItem returns a pointer to the checklist item with the given ID, or nil.
+func (c *Card) checklistItem(id string) *ChecklistItem {
+	for i := range c.Checklist {
+		if c.Checklist[i].ID == id {
+			return &c.Checklist[i]
+		}
+	}
+	return nil
+}
+
 // findCard returns the column index and card index of the card with the given
 // ID, or (-1, -1) if the card does not exist on the board.
 func (b *Board) findCard(id string) (colIdx, cardIdx int) {
@@ -80,6 +192,18 @@ func (b Board) HasCard(id string) bool {
 	return colIdx >= 0
 }
 
+// archivedIndex returns the index in the archive of the card with the given
+// ID, or -1 if the card is not archived.
+func (b *Board) archivedIndex(id string) int {
+	return slices.IndexFunc(b.Archived, func(a ArchivedCard) bool { return a.Card.ID == id })
+}
+
+// IsArchived reports whether a card with the given ID is in the board's
+// archive.
+func (b Board) IsArchived(id string) bool {
+	return b.archivedIndex(id) >= 0
+}
+
 // HasColumn reports whether a column with the given ID exists on the board.
 func (b Board) HasColumn(id string) bool {
 	return b.column(id) != nil
@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/go-estoria/estoria"
 )
@@ -75,13 +78,106 @@ func (e ColumnRenamed) ApplyTo(_ context.Context, b Board) (Board, error) {
 	return next, nil
 }
 
+// ColumnRemoved deletes a column. A column that still holds cards can only be
+// removed by naming another column to receive them; they are appended there in
+// their current order.
+type ColumnRemoved struct {
+	ColumnID    string `json:"columnId"`
+	MoveCardsTo string `json:"moveCardsToColumnId,omitempty"`
+}
+
+func (ColumnRemoved) EventType() string               { return "columnremoved" }
+func (ColumnRemoved) New() estoria.EntityEvent[Board] { return ColumnRemoved{} }
+func (e ColumnRemoved) ApplyTo(_ context.Context, b Board) (Board, error) {
+	next := b.clone()
+	idx := next.columnIndex(e.ColumnID)
+	if idx < 0 {
+		return b, fmt.Errorf("column %s does not exist", e.ColumnID)
+	}
+
+	if cards := next.Columns[idx].Cards; len(cards) > 0 {
+		if e.MoveCardsTo == "" {
+			return b, fmt.Errorf("column %q still has %d cards; choose a column to move them to",
+				next.Columns[idx].Title, len(cards))
+		}
+		if e.MoveCardsTo == e.ColumnID {
+			return b, errors.New("cannot move a removed column's cards into itself")
+		}
+
+		dest := next.column(e.MoveCardsTo)
+		if dest == nil {
+			return b, fmt.Errorf("column %s does not exist", e.MoveCardsTo)
+		}
+		if !dest.hasRoomFor(len(cards)) {
+			return b, fmt.Errorf("moving %d cards would exceed the WIP limit of %q (%d)",
+				len(cards), dest.Title, dest.WIPLimit)
+		}
+		dest.Cards = append(dest.Cards, cards...)
+	}
+
+	next.Columns = append(next.Columns[:idx], next.Columns[idx+1:]...)
+	return next, nil
+}
+
+// ColumnMoved relocates a column to a position among the board's columns.
+type ColumnMoved struct {
+	ColumnID string `json:"columnId"`
+	ToIndex  int    `json:"toIndex"`
+}
+
+func (ColumnMoved) EventType() string               { return "columnmoved" }
+func (ColumnMoved) New() estoria.EntityEvent[Board] { return ColumnMoved{} }
+func (e ColumnMoved) ApplyTo(_ context.Context, b Board) (Board, error) {
+	next := b.clone()
+	idx := next.columnIndex(e.ColumnID)
+	if idx < 0 {
+		return b, fmt.Errorf("column %s does not exist", e.ColumnID)
+	}
+
+	col := next.Columns[idx]
+	next.Columns = append(next.Columns[:idx], next.Columns[idx+1:]...)
+
+	to := min(max(e.ToIndex, 0), len(next.Columns))
+	next.Columns = append(next.Columns[:to], append([]Column{col}, next.Columns[to:]...)...)
+	return next, nil
+}
+
+// ColumnWIPLimitSet sets the maximum number of cards a column may hold. A limit
+// of 0 removes it. The limit can't be set below the column's current card count:
+// a column is never over its limit.
+type ColumnWIPLimitSet struct {
+	ColumnID string `json:"columnId"`
+	Limit    int    `json:"limit"`
+}
+
+func (ColumnWIPLimitSet) EventType() string               { return "columnwiplimitset" }
+func (ColumnWIPLimitSet) New() estoria.EntityEvent[Board] { return ColumnWIPLimitSet{} }
+func (e ColumnWIPLimitSet) ApplyTo(_ context.Context, b Board) (Board, error) {
+	if e.Limit < 0 {
+		return b, errors.New("WIP limit cannot be negative")
+	}
+
+	next := b.clone()
+	col := next.column(e.ColumnID)
+	if col == nil {
+		return b, fmt.Errorf("column %s does not exist", e.ColumnID)
+	}
+	if e.Limit > 0 && len(col.Cards) > e.Limit {
+		return b, fmt.Errorf("column %q already has %d cards, more than a limit of %d",
+			col.Title, len(col.Cards), e.Limit)
+	}
+
+	col.WIPLimit = e.Limit
+	return next, nil
+}
+
 // CardAdded places a new card at the end of a column.
 type CardAdded struct {
-	CardID      string `json:"cardId"`
-	ColumnID    string `json:"columnId"`
-	Title       string `json:"title"`
-	Description string `json:"description,omitempty"`
-	Color       string `json:"color,omitempty"`
+	CardID      string    `json:"cardId"`
+	ColumnID    string    `json:"columnId"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	Color       CardColor `json:"color,omitzero"` // a bare name until schema version 2
 }
 
 func (CardAdded) EventType() string               { return "cardadded" }
@@ -96,6 +192,9 @@ func (e CardAdded) ApplyTo(_ context.Context, b Board) (Board, error) {
 	if col == nil {
 		return b, fmt.Errorf("column %s does not exist", e.ColumnID)
 	}
+	if !col.hasRoomFor(1) {
+		return b, fmt.Errorf("column %q is at its WIP limit of %d", col.Title, col.WIPLimit)
+	}
 
 	col.Cards = append(col.Cards, Card{
 		ID:          e.CardID,
@@ -108,10 +207,14 @@ func (e CardAdded) ApplyTo(_ context.Context, b Board) (Board, error) {
 
 // CardEdited replaces a card's title, description, and color.
 type CardEdited struct {
-	CardID      string `json:"cardId"`
-	Title       string `json:"title"`
-	Description string `json:"description,omitempty"`
-	Color       string `json:"color,omitempty"`
+	CardID      string    `json:"cardId"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	Color       CardColor `json:"color,omitzero"` // a bare name until schema version 2
+
+	// Reverts is the version this event compensates for, when it was
+	// appended by undo or redo (see undo.go).
+	Reverts int64 `json:"reverts,omitempty"`
 }
 
 func (CardEdited) EventType() string               { return "cardedited" }
@@ -135,6 +238,7 @@ type CardMoved struct {
 	CardID   string `json:"cardId"`
 	ToColumn string `json:"toColumnId"`
 	ToIndex  int    `json:"toIndex"`
+	Reverts  int64  `json:"reverts,omitempty"` // see CardEdited.Reverts
 }
 
 func (CardMoved) EventType() string               { return "cardmoved" }
@@ -153,6 +257,10 @@ func (e CardMoved) ApplyTo(_ context.Context, b Board) (Board, error) {
 	}
 
 	src := &next.Columns[colIdx]
+	if src.ID != dest.ID && !dest.hasRoomFor(1) {
+		return b, fmt.Errorf("column %q is at its WIP limit of %d", dest.Title, dest.WIPLimit)
+	}
+
 	card := src.Cards[cardIdx]
 	src.Cards = append(src.Cards[:cardIdx], src.Cards[cardIdx+1:]...)
 
@@ -161,22 +269,238 @@ func (e CardMoved) ApplyTo(_ context.Context, b Board) (Board, error) {
 	return next, nil
 }
 
-// CardRemoved deletes a card from the board.
+// CardArchived takes a card off the board and into its archive, remembering
+// the column it came from.
+type CardArchived struct {
+	CardID  string `json:"cardId"`
+	Reverts int64  `json:"reverts,omitempty"` // see CardEdited.Reverts
+}
+
+func (CardArchived) EventType() string               { return "cardarchived" }
+func (CardArchived) New() estoria.EntityEvent[Board] { return CardArchived{} }
+func (e CardArchived) ApplyTo(_ context.Context, b Board) (Board, error) {
+	next := b.clone()
+	colIdx, cardIdx := next.findCard(e.CardID)
+	if colIdx < 0 {
+		return b, fmt.Errorf("card %s does not exist", e.CardID)
+	}
+
+	col := &next.Columns[colIdx]
+	next.Archived = append(next.Archived, ArchivedCard{Card: col.Cards[cardIdx], ColumnID: col.ID, ColumnTitle: col.Title})
+	col.Cards = slices.Delete(col.Cards, cardIdx, cardIdx+1)
+	return next, nil
+}
+
+// CardRemoved purges an archived card for good.
+//
+// Before the archive existed, removing a card took it straight off the board.
+// Those events are read back with FromBoard set (see upcastCardRemovedV1) and
+// still do that, so old boards replay as they were.
 type CardRemoved struct {
-	CardID string `json:"cardId"`
+	CardID    string `json:"cardId"`
+	FromBoard bool   `json:"fromBoard,omitempty"`
+	Reverts   int64  `json:"reverts,omitempty"` // see CardEdited.Reverts
 }
 
 func (CardRemoved) EventType() string               { return "cardremoved" }
 func (CardRemoved) New() estoria.EntityEvent[Board] { return CardRemoved{} }
 func (e CardRemoved) ApplyTo(_ context.Context, b Board) (Board, error) {
 	next := b.clone()
-	colIdx, cardIdx := next.findCard(e.CardID)
-	if colIdx < 0 {
+	if e.FromBoard {
+		colIdx, cardIdx := next.findCard(e.CardID)
+		if colIdx < 0 {
+			return b, fmt.Errorf("card %s does not exist", e.CardID)
+		}
+
+		col := &next.Columns[colIdx]
+		col.Cards = slices.Delete(col.Cards, cardIdx, cardIdx+1)
+		return next, nil
+	}
+
+	i := next.archivedIndex(e.CardID)
+	if i < 0 {
+		if b.HasCard(e.CardID) {
+			return b, fmt.Errorf("card %s must be archived before it is removed", e.CardID)
+		}
+		return b, fmt.Errorf("card %s is not in the archive", e.CardID)
+	}
+
+	next.Archived = slices.Delete(next.Archived, i, i+1)
+	return next, nil
+}
+
+// CardRestored puts a card back, with all of its details, at a position in a
+// column. The card comes out of the archive; a card removed before the
+// archive existed has no archive entry and is put back as the event carries
+// it. It is the compensating event for CardArchived.
+type CardRestored struct {
+	Card     Card   `json:"card"`
+	ColumnID string `json:"columnId"`
+	Index    int    `json:"index"`
+	Reverts  int64  `json:"reverts,omitempty"` // see CardEdited.Reverts
+}
+
+func (CardRestored) EventType() string               { return "cardrestored" }
+func (CardRestored) New() estoria.EntityEvent[Board] { return CardRestored{} }
+func (e CardRestored) ApplyTo(_ context.Context, b Board) (Board, error) {
+	if b.HasCard(e.Card.ID) {
+		return b, fmt.Errorf("card %s already exists", e.Card.ID)
+	}
+
+	next := b.clone()
+	col := next.column(e.ColumnID)
+	if col == nil {
+		return b, fmt.Errorf("column %s does not exist", e.ColumnID)
+	}
+	if !col.hasRoomFor(1) {
+		return b, fmt.Errorf("column %q is at its WIP limit of %d", col.Title, col.WIPLimit)
+	}
+
+	if i := next.archivedIndex(e.Card.ID); i >= 0 {
+		next.Archived = slices.Delete(next.Archived, i, i+1)
+	}
+	idx := min(max(e.Index, 0), len(col.Cards))
+	col.Cards = slices.Insert(col.Cards, idx, e.Card.clone())
+	return next, nil
+}
+
+// CardAssigned adds a person to a card's assignees.
+type CardAssigned struct {
+	CardID   string `json:"cardId"`
+	Assignee string `json:"assignee"`
+}
+
+func (CardAssigned) EventType() string               { return "cardassigned" }
+func (CardAssigned) New() estoria.EntityEvent[Board] { return CardAssigned{} }
+func (e CardAssigned) ApplyTo(_ context.Context, b Board) (Board, error) {
+	next := b.clone()
+	card := next.card(e.CardID)
+	if card == nil {
 		return b, fmt.Errorf("card %s does not exist", e.CardID)
 	}
+	if slices.Contains(card.Assignees, e.Assignee) {
+		return b, fmt.Errorf("%s is already assigned to %q", e.Assignee, card.Title)
+	}
 
-	col := &next.Columns[colIdx]
-	col.Cards = append(col.Cards[:cardIdx], col.Cards[cardIdx+1:]...)
+	card.Assignees = append(card.Assignees, e.Assignee)
+	return next, nil
+}
+
+// CardUnassigned removes a person from a card's assignees.
+type CardUnassigned struct {
+	CardID   string `json:"cardId"`
+	Assignee string `json:"assignee"`
+}
+
+func (CardUnassigned) EventType() string               { return "cardunassigned" }
+func (CardUnassigned) New() estoria.EntityEvent[Board] { return CardUnassigned{} }
+func (e CardUnassigned) ApplyTo(_ context.Context, b Board) (Board, error) {
+	next := b.clone()
+	card := next.card(e.CardID)
+	if card == nil {
+		return b, fmt.Errorf("card %s does not exist", e.CardID)
+	}
+
+	idx := slices.Index(card.Assignees, e.Assignee)
+	if idx < 0 {
+		return b, fmt.Errorf("%s is not assigned to %q", e.Assignee, card.Title)
+	}
+
+	card.Assignees = slices.Delete(card.Assignees, idx, idx+1)
+	return next, nil
+}
+
+// CardLabeled replaces a card's labels. Labels are free-form; an empty list
+// clears them.
+type CardLabeled struct {
+	CardID string   `json:"cardId"`
+	Labels []string `json:"labels"`
+}
+
+func (CardLabeled) EventType() string               { return "cardlabeled" }
+func (CardLabeled) New() estoria.EntityEvent[Board] { return CardLabeled{} }
+func (e CardLabeled) ApplyTo(_ context.Context, b Board) (Board, error) {
+	next := b.clone()
+	card := next.card(e.CardID)
+	if card == nil {
+		return b, fmt.Errorf("card %s does not exist", e.CardID)
+	}
+
+	card.Labels = slices.Clone(e.Labels)
+	return next, nil
+}
+
+// CardDueDateSet sets the day a card is due. An empty date clears it.
+type CardDueDateSet struct {
+	CardID  string `json:"cardId"`
+	DueDate string `json:"dueDate,omitempty"`
+}
+
+func (CardDueDateSet) EventType() string               { return "cardduedateset" }
+func (CardDueDateSet) New() estoria.EntityEvent[Board] { return CardDueDateSet{} }
+func (e CardDueDateSet) ApplyTo(_ context.Context, b Board) (Board, error) {
+	if e.DueDate != "" {
+		if _, err := time.Parse(dueDateLayout, e.DueDate); err != nil {
+			return b, fmt.Errorf("due date %q is not a YYYY-MM-DD date", e.DueDate)
+		}
+	}
+
+	next := b.clone()
+	card := next.card(e.CardID)
+	if card == nil {
+		return b, fmt.Errorf("card %s does not exist", e.CardID)
+	}
+
+	card.DueDate = e.DueDate
+	return next, nil
+}
+
+// ChecklistItemAdded appends an unchecked item to a card's checklist.
+type ChecklistItemAdded struct {
+	CardID string `json:"cardId"`
+	ItemID string `json:"itemId"`
+	Text   string `json:"text"`
+}
+
+func (ChecklistItemAdded) EventType() string               { return "checklistitemadded" }
+func (ChecklistItemAdded) New() estoria.EntityEvent[Board] { return ChecklistItemAdded{} }
+func (e ChecklistItemAdded) ApplyTo(_ context.Context, b Board) (Board, error) {
+	next := b.clone()
+	card := next.card(e.CardID)
+	if card == nil {
+		return b, fmt.Errorf("card %s does not exist", e.CardID)
+	}
+	if card.checklistItem(e.ItemID) != nil {
+		return b, fmt.Errorf("checklist item %s already exists", e.ItemID)
+	}
+
+	card.Checklist = append(card.Checklist, ChecklistItem{ID: e.ItemID, Text: e.Text})
+	return next, nil
+}
+
+// ChecklistItemToggled checks or unchecks a checklist item. It records the
+// resulting state rather than a flip, so replaying it is unambiguous.
+type ChecklistItemToggled struct {
+	CardID string `json:"cardId"`
+	ItemID string `json:"itemId"`
+	Done   bool   `json:"done"`
+}
+
+func (ChecklistItemToggled) EventType() string               { return "checklistitemtoggled" }
+func (ChecklistItemToggled) New() estoria.EntityEvent[Board] { return ChecklistItemToggled{} }
+func (e ChecklistItemToggled) ApplyTo(_ context.Context, b Board) (Board, error) {
+	next := b.clone()
+	card := next.card(e.CardID)
+	if card == nil {
+		return b, fmt.Errorf("card %s does not exist", e.CardID)
+	}
+
+	item := card.checklistItem(e.ItemID)
+	if item == nil {
+		return b, fmt.Errorf("checklist item %s does not exist", e.ItemID)
+	}
+
+	item.Done = e.Done
 	return next, nil
 }
 
@@ -188,9 +512,20 @@ func boardEventPrototypes() []estoria.EntityEvent[Board] {
 		BoardRenamed{},
 		ColumnAdded{},
 		ColumnRenamed{},
+		ColumnRemoved{},
+		ColumnMoved{},
+		ColumnWIPLimitSet{},
 		CardAdded{},
 		CardEdited{},
 		CardMoved{},
+		CardArchived{},
 		CardRemoved{},
+		CardRestored{},
+		CardAssigned{},
+		CardUnassigned{},
+		CardLabeled{},
+		CardDueDateSet{},
+		ChecklistItemAdded{},
+		ChecklistItemToggled{},
 	}
 }
@@ -64,40 +64,247 @@ func TestEventApplication(t *testing.T) {
 
 	t.Run("edits a card in place", func(t *testing.T) {
 		t.Parallel()
-		board, err := CardEdited{CardID: "c2", Title: "renamed", Color: "teal"}.ApplyTo(context.Background(), base())
+		board, err := CardEdited{CardID: "c2", Title: "renamed", Color: CardColor{Name: "teal", Label: "docs"}}.ApplyTo(context.Background(), base())
 		if err != nil {
 			t.Fatal(err)
 		}
 
 		card := board.column("todo").Cards[1]
-		if card.Title != "renamed" || card.Color != "teal" {
-			t.Errorf("card = %+v, want title 'renamed' and color 'teal'", card)
+		if card.Title != "renamed" || card.Color != (CardColor{Name: "teal", Label: "docs"}) {
+			t.Errorf("card = %+v, want title 'renamed' and color 'teal' labelled 'docs'", card)
 		}
 	})
 
-	t.Run("removes a card", func(t *testing.T) {
+	t.Run("archives a card", func(t *testing.T) {
 		t.Parallel()
-		board, err := CardRemoved{CardID: "c1"}.ApplyTo(context.Background(), base())
+		board, err := CardArchived{CardID: "c1"}.ApplyTo(context.Background(), base())
 		if err != nil {
 			t.Fatal(err)
 		}
 
 		if board.HasCard("c1") {
+			t.Error("card c1 still on the board after archiving")
+		}
+		if len(board.Archived) != 1 || board.Archived[0].Card.ID != "c1" || board.Archived[0].ColumnID != "todo" {
+			t.Errorf("archive = %+v, want c1 from todo", board.Archived)
+		}
+	})
+
+	t.Run("removes only archived cards", func(t *testing.T) {
+		t.Parallel()
+		if _, err := (CardRemoved{CardID: "c1"}).ApplyTo(context.Background(), base()); err == nil {
+			t.Error("removing a card on the board succeeded")
+		}
+
+		board, err := CardArchived{CardID: "c1"}.ApplyTo(context.Background(), base())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if board, err = (CardRemoved{CardID: "c1"}).ApplyTo(context.Background(), board); err != nil {
+			t.Fatal(err)
+		}
+		if board.HasCard("c1") || board.IsArchived("c1") {
+			t.Error("card c1 survived being removed from the archive")
+		}
+	})
+
+	t.Run("removes a card straight off the board, as before the archive", func(t *testing.T) {
+		t.Parallel()
+		board, err := CardRemoved{CardID: "c1", FromBoard: true}.ApplyTo(context.Background(), base())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if board.HasCard("c1") || board.IsArchived("c1") {
 			t.Error("card c1 still present after removal")
 		}
 	})
 
+	t.Run("restores an archived card where it was", func(t *testing.T) {
+		t.Parallel()
+		before := base()
+		before.column("todo").Cards[0].Labels = []string{"kept"}
+		archived := before.column("todo").Cards[0]
+
+		board, err := CardArchived{CardID: "c1"}.ApplyTo(context.Background(), before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if board, err = (CardRestored{Card: archived, ColumnID: "todo", Index: 0}).ApplyTo(context.Background(), board); err != nil {
+			t.Fatal(err)
+		}
+
+		cards := board.column("todo").Cards
+		if len(cards) != 2 || cards[0].ID != "c1" || cards[0].Labels[0] != "kept" {
+			t.Errorf("todo cards = %+v, want c1 back first with its labels", cards)
+		}
+		if len(board.Archived) != 0 {
+			t.Errorf("archive = %+v, want it empty again", board.Archived)
+		}
+	})
+
+	t.Run("removes a column, moving its cards", func(t *testing.T) {
+		t.Parallel()
+		board, err := ColumnRemoved{ColumnID: "todo", MoveCardsTo: "done"}.ApplyTo(context.Background(), base())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if board.HasColumn("todo") {
+			t.Error("column todo still present after removal")
+		}
+		if got := board.column("done").Cards; len(got) != 2 || got[0].ID != "c1" || got[1].ID != "c2" {
+			t.Errorf("done column = %+v, want c1 then c2", got)
+		}
+	})
+
+	t.Run("removes an empty column without a target", func(t *testing.T) {
+		t.Parallel()
+		board, err := ColumnRemoved{ColumnID: "done"}.ApplyTo(context.Background(), base())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(board.Columns) != 1 || board.Columns[0].ID != "todo" {
+			t.Errorf("columns = %+v, want only todo", board.Columns)
+		}
+	})
+
+	t.Run("reorders columns", func(t *testing.T) {
+		t.Parallel()
+		board, err := ColumnMoved{ColumnID: "done", ToIndex: 0}.ApplyTo(context.Background(), base())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if board.Columns[0].ID != "done" || board.Columns[1].ID != "todo" {
+			t.Errorf("columns = %+v, want done before todo", board.Columns)
+		}
+	})
+
+	t.Run("enforces WIP limits", func(t *testing.T) {
+		t.Parallel()
+		board, err := ColumnWIPLimitSet{ColumnID: "done", Limit: 1}.ApplyTo(context.Background(), base())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if board, err = (CardMoved{CardID: "c1", ToColumn: "done"}).ApplyTo(context.Background(), board); err != nil {
+			t.Fatalf("moving into a column with room: %v", err)
+		}
+
+		// the column is now full
+		if _, err := (CardMoved{CardID: "c2", ToColumn: "done"}).ApplyTo(context.Background(), board); err == nil {
+			t.Error("moved a card into a column at its WIP limit")
+		}
+		if _, err := (CardAdded{CardID: "c3", ColumnID: "done", Title: "x"}).ApplyTo(context.Background(), board); err == nil {
+			t.Error("added a card to a column at its WIP limit")
+		}
+		if _, err := (ColumnRemoved{ColumnID: "todo", MoveCardsTo: "done"}).ApplyTo(context.Background(), board); err == nil {
+			t.Error("removing a column overflowed its target's WIP limit")
+		}
+
+		// reordering within a full column is not growth
+		if _, err := (CardMoved{CardID: "c1", ToColumn: "done", ToIndex: 0}).ApplyTo(context.Background(), board); err != nil {
+			t.Errorf("reordering within a full column: %v", err)
+		}
+
+		// lifting the limit makes room again
+		if board, err = (ColumnWIPLimitSet{ColumnID: "done", Limit: 0}).ApplyTo(context.Background(), board); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := (CardMoved{CardID: "c2", ToColumn: "done"}).ApplyTo(context.Background(), board); err != nil {
+			t.Errorf("moving after the limit was lifted: %v", err)
+		}
+	})
+
+	t.Run("tracks card details through their own events", func(t *testing.T) {
+		t.Parallel()
+		board := base()
+		for _, event := range []estoria.EntityEvent[Board]{
+			CardAssigned{CardID: "c1", Assignee: "ana"},
+			CardAssigned{CardID: "c1", Assignee: "bo"},
+			CardUnassigned{CardID: "c1", Assignee: "ana"},
+			CardLabeled{CardID: "c1", Labels: []string{"bug", "p1"}},
+			CardDueDateSet{CardID: "c1", DueDate: "2026-11-02"},
+			ChecklistItemAdded{CardID: "c1", ItemID: "i1", Text: "write it"},
+			ChecklistItemAdded{CardID: "c1", ItemID: "i2", Text: "ship it"},
+			ChecklistItemToggled{CardID: "c1", ItemID: "i1", Done: true},
+		} {
+			var err error
+			if board, err = event.ApplyTo(context.Background(), board); err != nil {
+				t.Fatalf("applying %s: %v", event.EventType(), err)
+			}
+		}
+
+		card := board.column("todo").Cards[0]
+		if len(card.Assignees) != 1 || card.Assignees[0] != "bo" {
+			t.Errorf("assignees = %v, want [bo]", card.Assignees)
+		}
+		if len(card.Labels) != 2 || card.Labels[0] != "bug" {
+			t.Errorf("labels = %v, want [bug p1]", card.Labels)
+		}
+		if card.DueDate != "2026-11-02" {
+			t.Errorf("due date = %q, want 2026-11-02", card.DueDate)
+		}
+		if len(card.Checklist) != 2 || !card.Checklist[0].Done || card.Checklist[1].Done {
+			t.Errorf("checklist = %+v, want i1 done and i2 open", card.Checklist)
+		}
+
+		// clearing goes through the same events
+		board, err := CardDueDateSet{CardID: "c1"}.ApplyTo(context.Background(), board)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if board, err = (CardLabeled{CardID: "c1"}).ApplyTo(context.Background(), board); err != nil {
+			t.Fatal(err)
+		}
+		if card := board.column("todo").Cards[0]; card.DueDate != "" || len(card.Labels) != 0 {
+			t.Errorf("card = %+v, want no due date and no labels", card)
+		}
+	})
+
+	t.Run("does not share card details between versions", func(t *testing.T) {
+		t.Parallel()
+		before, err := ChecklistItemAdded{CardID: "c1", ItemID: "i1", Text: "x"}.ApplyTo(context.Background(), base())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := (ChecklistItemToggled{CardID: "c1", ItemID: "i1", Done: true}).ApplyTo(context.Background(), before); err != nil {
+			t.Fatal(err)
+		}
+
+		if before.column("todo").Cards[0].Checklist[0].Done {
+			t.Error("toggling an item mutated the checklist of the previous version")
+		}
+	})
+
 	t.Run("rejects invalid transitions", func(t *testing.T) {
 		t.Parallel()
 		for name, event := range map[string]estoria.EntityEvent[Board]{
-			"add to unknown column":  CardAdded{CardID: "c9", ColumnID: "nope", Title: "x"},
-			"add duplicate card":     CardAdded{CardID: "c1", ColumnID: "todo", Title: "x"},
-			"move unknown card":      CardMoved{CardID: "nope", ToColumn: "done"},
-			"move to unknown column": CardMoved{CardID: "c1", ToColumn: "nope"},
-			"edit unknown card":      CardEdited{CardID: "nope", Title: "x"},
-			"remove unknown card":    CardRemoved{CardID: "nope"},
-			"add duplicate column":   ColumnAdded{ColumnID: "todo", Title: "x"},
-			"rename unknown column":  ColumnRenamed{ColumnID: "nope", Title: "x"},
+			"add to unknown column":   CardAdded{CardID: "c9", ColumnID: "nope", Title: "x"},
+			"add duplicate card":      CardAdded{CardID: "c1", ColumnID: "todo", Title: "x"},
+			"move unknown card":       CardMoved{CardID: "nope", ToColumn: "done"},
+			"move to unknown column":  CardMoved{CardID: "c1", ToColumn: "nope"},
+			"edit unknown card":       CardEdited{CardID: "nope", Title: "x"},
+			"archive unknown card":    CardArchived{CardID: "nope"},
+			"remove unknown card":     CardRemoved{CardID: "nope"},
+			"remove unarchived card":  CardRemoved{CardID: "c1"},
+			"restore existing card":   CardRestored{Card: Card{ID: "c1"}, ColumnID: "todo"},
+			"restore to unknown":      CardRestored{Card: Card{ID: "c9"}, ColumnID: "nope"},
+			"add duplicate column":    ColumnAdded{ColumnID: "todo", Title: "x"},
+			"rename unknown column":   ColumnRenamed{ColumnID: "nope", Title: "x"},
+			"remove unknown column":   ColumnRemoved{ColumnID: "nope"},
+			"remove non-empty column": ColumnRemoved{ColumnID: "todo"},
+			"remove into itself":      ColumnRemoved{ColumnID: "todo", MoveCardsTo: "todo"},
+			"remove into unknown":     ColumnRemoved{ColumnID: "todo", MoveCardsTo: "nope"},
+			"move unknown column":     ColumnMoved{ColumnID: "nope"},
+			"negative WIP limit":      ColumnWIPLimitSet{ColumnID: "todo", Limit: -1},
+			"WIP limit below count":   ColumnWIPLimitSet{ColumnID: "todo", Limit: 1},
+			"assign unknown card":     CardAssigned{CardID: "nope", Assignee: "ana"},
+			"unassign nobody":         CardUnassigned{CardID: "c1", Assignee: "ana"},
+			"label unknown card":      CardLabeled{CardID: "nope", Labels: []string{"x"}},
+			"malformed due date":      CardDueDateSet{CardID: "c1", DueDate: "next tuesday"},
+			"toggle unknown item":     ChecklistItemToggled{CardID: "c1", ItemID: "nope", Done: true},
+			"checklist unknown card":  ChecklistItemAdded{CardID: "nope", ItemID: "i1", Text: "x"},
 		} {
 			if _, err := event.ApplyTo(context.Background(), base()); err == nil {
 				t.Errorf("%s: expected an error", name)
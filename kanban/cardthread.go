@@ -0,0 +1,71 @@
+package main
+
+import (
+	"time"
+
+	"github.com/go-estoria/estoria/typeid"
+	"github.com/gofrs/uuid/v5"
+)
+
+// A CardThread is the discussion on one card. It is an aggregate of its own,
+// stored in a "cardthread" stream, so comments never lengthen the board
+// stream that every board load replays. The stream is keyed by the board and
+// the card together (see threadID): an imported or cloned board keeps its
+// cards' IDs, and each copy of a card has a discussion of its own.
+//
+// The thread refers to its card and board by ID only. Nothing ties the two
+// streams together transactionally: a comment is checked against the board
+// when it is posted, and a card deleted in the meantime simply leaves a
+// thread that nothing links to.
+type CardThread struct {
+	ID       uuid.UUID `json:"id"`
+	CardID   uuid.UUID `json:"cardId"`
+	BoardID  uuid.UUID `json:"boardId"`
+	Comments []Comment `json:"comments"`
+}
+
+// A Comment is one message in a card thread.
+type Comment struct {
+	ID       string    `json:"id"`
+	Author   string    `json:"author"`
+	Body     string    `json:"body"`
+	PostedAt time.Time `json:"postedAt"`
+	EditedAt time.Time `json:"editedAt,omitzero"`
+}
+
+// NewCardThread is the estoria.EntityFactory for CardThread aggregates. The
+// ID is the thread's own, from threadID; the first comment records the card
+// and board it is about.
+func NewCardThread(id uuid.UUID) CardThread {
+	return CardThread{ID: id, Comments: []Comment{}}
+}
+
+// threadID is the ID of the thread on a card on a board: a UUIDv5 of the
+// card's UUID in the board's namespace.
+func threadID(boardID, cardID uuid.UUID) uuid.UUID {
+	return uuid.NewV5(boardID, cardID.String())
+}
+
+// EntityID implements estoria.Entity.
+func (t CardThread) EntityID() typeid.ID {
+	return typeid.New("cardthread", t.ID)
+}
+
+// clone returns a copy of the thread whose comment slice is not shared with
+// the original.
+func (t CardThread) clone() CardThread {
+	c := t
+	c.Comments = make([]Comment, len(t.Comments))
+	copy(c.Comments, t.Comments)
+	return c
+}
+
+// commentIndex returns the index of the comment with the given ID, or -1.
+func (t *CardThread) commentIndex(id string) int {
+	for i := range t.Comments {
+		if t.Comments[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
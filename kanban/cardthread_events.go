@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-estoria/estoria"
+	"github.com/gofrs/uuid/v5"
+)
+
+// Each event below implements estoria.EntityEvent[CardThread], following the
+// same conventions as the board events: value-typed prototypes and pure
+// ApplyTo transitions over a cloned thread.
+
+// CommentPosted adds a comment to the end of a card's thread. The first one
+// also records the card and the board it is on, so thread updates can be sent
+// to that board's live clients.
+type CommentPosted struct {
+	CommentID string    `json:"commentId"`
+	CardID    uuid.UUID `json:"cardId"`
+	BoardID   uuid.UUID `json:"boardId"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	At        time.Time `json:"at"`
+}
+
+func (CommentPosted) EventType() string                    { return "commentposted" }
+func (CommentPosted) New() estoria.EntityEvent[CardThread] { return CommentPosted{} }
+func (e CommentPosted) ApplyTo(_ context.Context, t CardThread) (CardThread, error) {
+	if !t.BoardID.IsNil() && t.BoardID != e.BoardID {
+		return t, fmt.Errorf("card thread belongs to board %s, not %s", t.BoardID, e.BoardID)
+	}
+	if !t.CardID.IsNil() && t.CardID != e.CardID {
+		return t, fmt.Errorf("card thread belongs to card %s, not %s", t.CardID, e.CardID)
+	}
+	if t.commentIndex(e.CommentID) >= 0 {
+		return t, fmt.Errorf("comment %s already exists", e.CommentID)
+	}
+
+	next := t.clone()
+	next.CardID = e.CardID
+	next.BoardID = e.BoardID
+	next.Comments = append(next.Comments, Comment{
+		ID:       e.CommentID,
+		Author:   e.Author,
+		Body:     e.Body,
+		PostedAt: e.At,
+	})
+	return next, nil
+}
+
+// CommentEdited replaces the body of a comment.
+type CommentEdited struct {
+	CommentID string    `json:"commentId"`
+	Body      string    `json:"body"`
+	At        time.Time `json:"at"`
+}
+
+func (CommentEdited) EventType() string                    { return "commentedited" }
+func (CommentEdited) New() estoria.EntityEvent[CardThread] { return CommentEdited{} }
+func (e CommentEdited) ApplyTo(_ context.Context, t CardThread) (CardThread, error) {
+	i := t.commentIndex(e.CommentID)
+	if i < 0 {
+		return t, fmt.Errorf("comment %s does not exist", e.CommentID)
+	}
+
+	next := t.clone()
+	next.Comments[i].Body = e.Body
+	next.Comments[i].EditedAt = e.At
+	return next, nil
+}
+
+// CommentDeleted removes a comment from the thread. Like every other change,
+// the comment itself remains in the stream's history.
+type CommentDeleted struct {
+	CommentID string `json:"commentId"`
+}
+
+func (CommentDeleted) EventType() string                    { return "commentdeleted" }
+func (CommentDeleted) New() estoria.EntityEvent[CardThread] { return CommentDeleted{} }
+func (e CommentDeleted) ApplyTo(_ context.Context, t CardThread) (CardThread, error) {
+	i := t.commentIndex(e.CommentID)
+	if i < 0 {
+		return t, fmt.Errorf("comment %s does not exist", e.CommentID)
+	}
+
+	next := t.clone()
+	next.Comments = append(next.Comments[:i], next.Comments[i+1:]...)
+	return next, nil
+}
+
+// threadEventPrototypes lists every card thread event type for registration
+// with the thread's aggregate store.
+func threadEventPrototypes() []estoria.EntityEvent[CardThread] {
+	return []estoria.EntityEvent[CardThread]{
+		CommentPosted{},
+		CommentEdited{},
+		CommentDeleted{},
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-estoria/estoria"
+	"github.com/go-estoria/estoria/aggregatestore"
+	"github.com/go-estoria/estoria/typeid"
+	"github.com/gofrs/uuid/v5"
+)
+
+// A board's history is its own. Cloning copies the state of a board at some
+// version into a new stream, not the events that led there: the new board
+// starts with the fewest events that build the same columns and cards, under
+// new IDs, so nothing in it can be mistaken for the original. Templates are
+// boards written down in code and created the same way.
+
+// rebuildEvents returns the events that build a new board named name with the
+// columns and cards of board, all under fresh IDs. WIP limits are set once a
+// column's cards are in, and checklist items are checked off after they are
+// added, since no event does either in one step. Archived cards are left out.
+func rebuildEvents(board Board, name string) []estoria.EntityEvent[Board] {
+	events := []estoria.EntityEvent[Board]{BoardCreated{Name: name}}
+
+	for _, col := range board.Columns {
+		columnID := typeid.NewV7("column").String()
+		events = append(events, ColumnAdded{ColumnID: columnID, Title: col.Title})
+
+		for _, card := range col.Cards {
+			cardID := typeid.NewV7("card").String()
+			events = append(events, CardAdded{
+				CardID:      cardID,
+				ColumnID:    columnID,
+				Title:       card.Title,
+				Description: card.Description,
+				Color:       card.Color,
+			})
+			for _, person := range card.Assignees {
+				events = append(events, CardAssigned{CardID: cardID, Assignee: person})
+			}
+			if len(card.Labels) > 0 {
+				events = append(events, CardLabeled{CardID: cardID, Labels: card.Labels})
+			}
+			if card.DueDate != "" {
+				events = append(events, CardDueDateSet{CardID: cardID, DueDate: card.DueDate})
+			}
+			for _, item := range card.Checklist {
+				itemID := typeid.NewV7("item").String()
+				events = append(events, ChecklistItemAdded{CardID: cardID, ItemID: itemID, Text: item.Text})
+				if item.Done {
+					events = append(events, ChecklistItemToggled{CardID: cardID, ItemID: itemID, Done: true})
+				}
+			}
+		}
+
+		if col.WIPLimit > 0 {
+			events = append(events, ColumnWIPLimitSet{ColumnID: columnID, Limit: col.WIPLimit})
+		}
+	}
+
+	return events
+}
+
+// createBoard saves events as the stream of a new board.
+func (s *server) createBoard(ctx context.Context, events []estoria.EntityEvent[Board]) (*aggregatestore.Aggregate[Board], error) {
+	boardID, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	agg := s.live.New(boardID)
+	if err := agg.Append(events...); err != nil {
+		return nil, err
+	}
+	if err := s.live.Save(ctx, agg, nil); err != nil {
+		return nil, err
+	}
+	return agg, nil
+}
+
+// handleClone answers POST /api/boards/{id}/clone?version=N by creating a new
+// board with the board's columns and cards as they were at version N (a
+// version or a timestamp, as for reads; left out, the latest). The body may
+// name the new board; by default it is named after the original.
+func (s *server) handleClone(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	req, err := readJSON[struct {
+		Name string `json:"name"`
+	}](r)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.resetMu.RLock()
+	defer s.resetMu.RUnlock()
+
+	var source *aggregatestore.Aggregate[Board]
+	if value := r.URL.Query().Get("version"); value != "" {
+		version, ok := s.boardPoint(w, r, boardID, "version", value)
+		if !ok {
+			return
+		}
+		source, err = s.history.Load(ctx, boardID, &aggregatestore.LoadOptions{ToVersion: version})
+	} else {
+		source, err = s.live.Load(ctx, boardID, nil)
+	}
+	if err != nil {
+		s.writeLoadError(w, err)
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		// a source name near the limit is cut short so the suffix still fits
+		suffix := fmt.Sprintf(" (copy of v%d)", source.Version())
+		name = strings.TrimSpace(truncateUTF8(source.Entity().Name, maxTitleLength-len(suffix))) + suffix
+	}
+	if name, err = requireTitle(name, "board name"); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	events := rebuildEvents(source.Entity(), name)
+	for _, event := range events {
+		if err := checkDescription(event); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	}
+
+	agg, err := s.createBoard(ctx, events)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, boardMessage{Version: agg.Version(), Live: true, Board: agg.Entity().rendered()})
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// A boardTemplate is a board to start from. Its columns and cards are written
+// down without IDs; a board made from it gets new ones, like a clone.
+type boardTemplate struct {
+	ID          string
+	Name        string
+	Description string
+	Board       Board
+}
+
+// boardTemplates is the built-in template catalog.
+var boardTemplates = []boardTemplate{
+	{
+		ID:          "scrum",
+		Name:        "Scrum",
+		Description: "A sprint board: backlog to done, with room for review.",
+		Board: Board{Columns: []Column{
+			{Title: "Product Backlog", Cards: []Card{
+				{Title: "Write the sprint goal", Description: "One sentence the whole team can repeat.", Color: CardColor{Name: "purple", Label: "ceremony"}},
+			}},
+			{Title: "Sprint Backlog"},
+			{Title: "In Progress", WIPLimit: 3},
+			{Title: "Review", WIPLimit: 2},
+			{Title: "Done", Cards: []Card{
+				{Title: "Agree on a definition of done", Checklist: []ChecklistItem{
+					{Text: "Code reviewed"}, {Text: "Tests pass"}, {Text: "Deployed to staging"},
+				}},
+			}},
+		}},
+	},
+	{
+		ID:          "bug-triage",
+		Name:        "Bug triage",
+		Description: "Reports come in, get confirmed and prioritized, then fixed.",
+		Board: Board{Columns: []Column{
+			{Title: "Reported", Cards: []Card{
+				{Title: "How to report a bug", Description: "Steps to reproduce, what you expected, what happened instead.", Color: CardColor{Name: "blue"}},
+			}},
+			{Title: "Confirmed"},
+			{Title: "Prioritized", Cards: []Card{
+				{Title: "Colors are severities", Description: "Red is a customer-facing outage; amber is a workaround exists.",
+					Color: CardColor{Name: "red", Label: "sev 1"}, Labels: []string{"triage"}},
+			}},
+			{Title: "Fixing", WIPLimit: 4},
+			{Title: "Verified"},
+		}},
+	},
+	{
+		ID:          "personal",
+		Name:        "Personal",
+		Description: "Three columns and a nudge to keep the middle one short.",
+		Board: Board{Columns: []Column{
+			{Title: "To Do", Cards: []Card{
+				{Title: "Plan the week", Color: CardColor{Name: "teal"}, Checklist: []ChecklistItem{
+					{Text: "Look at the calendar"}, {Text: "Pick three things that matter"},
+				}},
+			}},
+			{Title: "Doing", WIPLimit: 2},
+			{Title: "Done"},
+		}},
+	},
+}
+
+// templateByID returns the catalog entry with the given ID.
+func templateByID(id string) (boardTemplate, bool) {
+	for _, t := range boardTemplates {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return boardTemplate{}, false
+}
+
+// handleListTemplates returns the template catalog, each with its columns.
+func (s *server) handleListTemplates(w http.ResponseWriter, r *http.Request) {
+	type templateInfo struct {
+		ID          string   `json:"id"`
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Columns     []string `json:"columns"`
+		Cards       int      `json:"cards"`
+	}
+
+	templates := make([]templateInfo, len(boardTemplates))
+	for i, t := range boardTemplates {
+		info := templateInfo{ID: t.ID, Name: t.Name, Description: t.Description, Columns: []string{}}
+		for _, col := range t.Board.Columns {
+			info.Columns = append(info.Columns, col.Title)
+			info.Cards += len(col.Cards)
+		}
+		templates[i] = info
+	}
+	writeJSON(w, http.StatusOK, templates)
+}
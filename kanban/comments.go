@@ -0,0 +1,287 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-estoria/estoria"
+	"github.com/go-estoria/estoria/aggregatestore"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/go-estoria/estoria/typeid"
+	"github.com/gofrs/uuid/v5"
+)
+
+// maxCommentLength caps the size of one comment body, in bytes.
+const maxCommentLength = 4000
+
+// errNotAuthor is returned, wrapped, by a command on a comment the caller
+// didn't post.
+var errNotAuthor = errors.New("only the comment's author can change it")
+
+// threadMessage is the payload for comment reads and SSE updates. On the
+// board's SSE stream it is told apart from board updates by its type, and
+// carries the card ID so clients can tell which card's thread changed.
+type threadMessage struct {
+	Type     string    `json:"type"` // always "comments"
+	CardID   string    `json:"cardId"`
+	Version  int64     `json:"version"`
+	Comments []Comment `json:"comments"`
+	Actor    string    `json:"actor,omitempty"` // on SSE updates only
+}
+
+// newThreadMessage renders the thread on the card. The card is passed in
+// because a thread no one has commented on yet doesn't know it.
+func newThreadMessage(cardID uuid.UUID, agg *aggregatestore.Aggregate[CardThread]) threadMessage {
+	return threadMessage{
+		Type:     "comments",
+		CardID:   typeid.New("card", cardID).String(),
+		Version:  agg.Version(),
+		Comments: agg.Entity().Comments,
+	}
+}
+
+// newThreadStore builds the aggregate store for card threads over the same
+// event store the boards use. Threads are short, so it skips the snapshotting
+// layer; its AfterSave hook sends each saved thread to the live clients of the
+// board the card is on.
+func newThreadStore(events eventstore.Store, broadcasts *hub) (aggregatestore.Store[CardThread], error) {
+	eventSourced, err := aggregatestore.New(events, NewCardThread,
+		aggregatestore.WithEventTypes(threadEventPrototypes()...))
+	if err != nil {
+		return nil, fmt.Errorf("creating aggregate store: %w", err)
+	}
+
+	hookable, err := aggregatestore.NewHookableStore[CardThread](eventSourced)
+	if err != nil {
+		return nil, fmt.Errorf("creating hookable store: %w", err)
+	}
+
+	hookable.AfterSave(func(ctx context.Context, agg *aggregatestore.Aggregate[CardThread]) error {
+		msg := newThreadMessage(agg.Entity().CardID, agg)
+		msg.Actor = identityFrom(ctx).Actor
+		broadcasts.broadcast(agg.Entity().BoardID, msg)
+		return nil
+	})
+
+	return hookable, nil
+}
+
+func (s *server) handleListComments(w http.ResponseWriter, r *http.Request) {
+	boardID, cardID, ok := pathThread(w, r)
+	if !ok {
+		return
+	}
+
+	id := threadID(boardID, cardID)
+	agg, err := s.threads.Load(r.Context(), id, nil)
+	if errors.Is(err, aggregatestore.ErrAggregateNotFound) {
+		// no one has commented yet: an empty thread, not a missing one
+		agg = s.threads.New(id)
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newThreadMessage(cardID, agg))
+}
+
+// handlePostComment checks that the card exists on the given board, then
+// appends to the card's thread. The check and the write touch two different
+// aggregates and are not atomic; see CardThread for why that is acceptable.
+func (s *server) handlePostComment(w http.ResponseWriter, r *http.Request) {
+	boardID, cardID, ok := pathThread(w, r)
+	if !ok {
+		return
+	}
+
+	req, err := readJSON[struct {
+		Body string `json:"body"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	agg, err := s.live.Load(r.Context(), boardID, nil)
+	if err != nil {
+		s.writeLoadError(w, err)
+		return
+	}
+	if board := agg.Entity(); board.card(typeid.New("card", cardID).String()) == nil {
+		writeError(w, http.StatusNotFound, "card not found on this board")
+		return
+	}
+
+	s.runThreadCommand(w, r, boardID, cardID, func(CardThread) (estoria.EntityEvent[CardThread], error) {
+		body, err := requireCommentBody(req.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return CommentPosted{
+			CommentID: typeid.NewV7("comment").String(),
+			CardID:    cardID,
+			BoardID:   boardID,
+			Author:    cmp.Or(identityFrom(r.Context()).Actor, anonymousActor),
+			Body:      body,
+			At:        time.Now().UTC(),
+		}, nil
+	})
+}
+
+func (s *server) handleEditComment(w http.ResponseWriter, r *http.Request) {
+	boardID, cardID, ok := pathThread(w, r)
+	if !ok {
+		return
+	}
+
+	req, err := readJSON[struct {
+		Body string `json:"body"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	commentID := r.PathValue("commentId")
+	s.runThreadCommand(w, r, boardID, cardID, func(thread CardThread) (estoria.EntityEvent[CardThread], error) {
+		if err := requireAuthor(r.Context(), thread, commentID); err != nil {
+			return nil, err
+		}
+		body, err := requireCommentBody(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		return CommentEdited{CommentID: commentID, Body: body, At: time.Now().UTC()}, nil
+	})
+}
+
+func (s *server) handleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	boardID, cardID, ok := pathThread(w, r)
+	if !ok {
+		return
+	}
+
+	commentID := r.PathValue("commentId")
+	s.runThreadCommand(w, r, boardID, cardID, func(thread CardThread) (estoria.EntityEvent[CardThread], error) {
+		if err := requireAuthor(r.Context(), thread, commentID); err != nil {
+			return nil, err
+		}
+		return CommentDeleted{CommentID: commentID}, nil
+	})
+}
+
+// requireAuthor checks the caller posted the comment, going by display name.
+// A comment that doesn't exist is left for ApplyTo to turn away.
+func requireAuthor(ctx context.Context, thread CardThread, commentID string) error {
+	i := thread.commentIndex(commentID)
+	if i < 0 {
+		return nil
+	}
+	if author := thread.Comments[i].Author; author != cmp.Or(identityFrom(ctx).Actor, anonymousActor) {
+		return fmt.Errorf("comment %s was posted by %s: %w", commentID, author, errNotAuthor)
+	}
+	return nil
+}
+
+// runThreadCommand is runCommand for card threads: load the latest thread on
+// the card on the board (or start one), derive and pre-flight the event, then save. Comments carry no
+// base version — posting one doesn't depend on having read the others — so a
+// conflict only arises when two writes race for the same thread version.
+func (s *server) runThreadCommand(w http.ResponseWriter, r *http.Request, boardID, cardID uuid.UUID, cmd func(CardThread) (estoria.EntityEvent[CardThread], error)) {
+	ctx := r.Context()
+
+	s.resetMu.RLock()
+	defer s.resetMu.RUnlock()
+
+	id := threadID(boardID, cardID)
+	agg, err := s.threads.Load(ctx, id, nil)
+	if errors.Is(err, aggregatestore.ErrAggregateNotFound) {
+		agg = s.threads.New(id)
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	event, err := cmd(agg.Entity())
+	if errors.Is(err, errNotAuthor) {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if _, err := event.ApplyTo(ctx, agg.Entity()); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if err := agg.Append(event); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := s.threads.Save(ctx, agg, nil); err != nil {
+		var mismatch eventstore.StreamVersionMismatchError
+		if errors.As(err, &mismatch) {
+			writeJSON(w, http.StatusConflict, map[string]any{
+				"error":           "version_conflict",
+				"expectedVersion": mismatch.ExpectedVersion,
+				"actualVersion":   mismatch.ActualVersion,
+				"message":         "the thread changed while this comment was being saved; try again",
+			})
+			return
+		}
+
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newThreadMessage(cardID, agg))
+}
+
+// pathThread parses the {id} and {cardId} path segments of a comment route
+// as the board and card whose thread it is.
+func pathThread(w http.ResponseWriter, r *http.Request) (boardID, cardID uuid.UUID, ok bool) {
+	if boardID, ok = pathBoardID(w, r); !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	if cardID, ok = pathCardID(w, r); !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	return boardID, cardID, true
+}
+
+// pathCardID parses the {cardId} path segment as a card ID ("card_<uuid>", as
+// the board assigns them) and returns its UUID.
+func pathCardID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	raw, ok := strings.CutPrefix(r.PathValue("cardId"), "card_")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid card ID")
+		return uuid.Nil, false
+	}
+
+	id, err := uuid.FromString(raw)
+	if err != nil || id.IsNil() {
+		writeError(w, http.StatusBadRequest, "invalid card ID")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func requireCommentBody(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", errors.New("comment is required")
+	}
+	if len(s) > maxCommentLength {
+		return "", errors.New("comment is too long")
+	}
+	return s, nil
+}
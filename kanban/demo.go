@@ -11,7 +11,7 @@ import (
 // This file exists only for the hosted demo. Running the example locally, none
 // of it is active: the reset scheduler is off unless -hourly-reset is passed.
 
-// runHourlyReset resets the demo board at the top of every hour until ctx is
+// runHourlyReset resets the demo at the top of every hour until ctx is
 // done. The wall clock is deliberate — "the board resets on the hour" is
 // something a visitor can predict, unlike an interval counted from boot.
 func (s *server) runHourlyReset(ctx context.Context) {
@@ -49,7 +49,8 @@ func nextHour(t time.Time) time.Time {
 	return t.Truncate(time.Hour).Add(time.Hour)
 }
 
-// resetDemo clears the event store and reseeds the starting board.
+// resetDemo clears the event store — every board, not just the tour — and
+// reseeds the starting board.
 //
 // Note what this does *not* do: it doesn't ask estoria to delete anything. An
 // event store is append-only — that's the whole premise, and the core
@@ -58,7 +59,7 @@ func nextHour(t time.Time) time.Time {
 // about what it is: a demo affordance, not an event sourcing operation.
 //
 // The reseed saves through the hookable store, so the AfterSave hook
-// broadcasts the fresh board to every connected browser — open tabs return to
+// announces the fresh board to every connected browser — open tabs return to
 // the starting state on their own, with no client-side handling.
 func (s *server) resetDemo(ctx context.Context) error {
 	// Block command handling for the duration: without this, a command that
@@ -73,10 +74,27 @@ func (s *server) resetDemo(ctx context.Context) error {
 		}
 	}
 
+	// the search index is derived from the streams just cleared; the reseed
+	// below repopulates it through the AfterSave hook
+	if err := s.search.clear(ctx); err != nil {
+		return err
+	}
+
+	// so are the webhook delivery positions, and the webhooks went with
+	// the streams
+	if err := s.webhookWorker.clear(ctx); err != nil {
+		return err
+	}
+
+	// Watchers track the last version they sent, which now means nothing:
+	// the reseeded stream reuses the same versions for different events.
+	// Told of the reset, they send the reseeded board whole.
+	s.hub.reset()
+
 	// This save fires the AfterSave hook, which broadcasts while resetMu is
 	// held for writing. That is safe because the hub takes only its own lock
 	// and no handler broadcasts while holding resetMu — keep it that way.
-	if err := seedBoard(ctx, s.live, s.boardID); err != nil {
+	if err := seedBoard(ctx, s.live, demoBoardUUID); err != nil {
 		return fmt.Errorf("reseeding board: %w", err)
 	}
 
@@ -48,17 +48,16 @@ func newTestServer(t *testing.T) *server {
 		t.Fatal(err)
 	}
 
-	eventSourced, err := aggregatestore.New(eventStore, NewBoard,
+	upcasting := newUpcastingStore(eventStore, boardUpcasters())
+	eventSourced, err := aggregatestore.New(actorStampingStore{upcasting}, NewBoard,
 		aggregatestore.WithEventTypes(boardEventPrototypes()...))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	snapshotting, err := aggregatestore.NewSnapshottingStore[Board](
-		eventSourced,
-		streamsnapshots.NewEventStreamStore(eventStore),
-		snapshotstore.EventCountSnapshotPolicy{N: 10},
-	)
+	snapshots := streamsnapshots.NewEventStreamStore(eventStore)
+	policy := countSnapshotPolicy{snapshotstore.EventCountSnapshotPolicy{N: 10}}
+	snapshotting, err := aggregatestore.NewSnapshottingStore[Board](eventSourced, snapshots, policy)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -70,20 +69,52 @@ func newTestServer(t *testing.T) *server {
 
 	// the same AfterSave broadcast main.go registers — without it the store
 	// would behave differently under test than in the app
+	search, err := newSearchIndex(context.Background(), db, upcasting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	search.boards = hookable
+
+	webhooks, err := newWebhookStore(actorStampingStore{upcasting})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the worker isn't run; tests make its passes themselves
+	deliveries, err := newWebhookWorker(ctx, db, upcasting, webhooks, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	broadcasts := newHub(0)
-	hookable.AfterSave(func(_ context.Context, agg *aggregatestore.Aggregate[Board]) error {
-		broadcasts.broadcast(boardMessage{Version: agg.Version(), Live: true, Board: agg.Entity()})
+	hookable.AfterSave(func(ctx context.Context, agg *aggregatestore.Aggregate[Board]) error {
+		board := agg.Entity()
+		broadcasts.advance(board.ID)
+		// a save whose context is cancelled mid-hook (a reset loop stopping
+		// at the end of its test) is no failure of the index
+		if err := search.update(ctx, board, agg.Version()); err != nil && ctx.Err() == nil {
+			t.Errorf("updating search index: %v", err)
+		}
+		deliveries.notify()
 		return nil
 	})
 
+	threads, err := newThreadStore(actorStampingStore{upcasting}, broadcasts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	return &server{
-		boardID:       uuid.Must(uuid.NewV4()),
-		live:          hookable,
-		history:       eventSourced,
-		events:        eventStore,
-		db:            db,
-		hub:           broadcasts,
-		snapshotEvery: 10,
+		live:           hookable,
+		history:        eventSourced,
+		threads:        threads,
+		search:         search,
+		webhooks:       webhooks,
+		webhookWorker:  deliveries,
+		events:         upcasting,
+		db:             db,
+		hub:            broadcasts,
+		snapshots:      snapshots,
+		snapshotPolicy: policy,
 	}
 }
 
@@ -105,11 +136,11 @@ func TestResetDemo(t *testing.T) {
 
 	srv := newTestServer(t)
 
-	if err := seedBoard(ctx, srv.live, srv.boardID); err != nil {
+	if err := seedBoard(ctx, srv.live, demoBoardUUID); err != nil {
 		t.Fatal(err)
 	}
 
-	seeded, err := srv.live.Load(ctx, srv.boardID, nil)
+	seeded, err := srv.live.Load(ctx, demoBoardUUID, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -119,7 +150,7 @@ func TestResetDemo(t *testing.T) {
 	seededEvents, seededStreams := srv.rowCount(t, eventsTable), srv.rowCount(t, streamsTable)
 
 	// dirty the board the way a visitor would
-	agg, err := srv.live.Load(ctx, srv.boardID, nil)
+	agg, err := srv.live.Load(ctx, demoBoardUUID, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -138,7 +169,7 @@ func TestResetDemo(t *testing.T) {
 		t.Fatalf("resetting demo: %v", err)
 	}
 
-	reset, err := srv.live.Load(ctx, srv.boardID, nil)
+	reset, err := srv.live.Load(ctx, demoBoardUUID, nil)
 	if err != nil {
 		t.Fatalf("loading board after reset: %v", err)
 	}
@@ -272,25 +303,86 @@ func TestHubCapacity(t *testing.T) {
 	t.Parallel()
 
 	h := newHub(2)
+	boardID := uuid.Must(uuid.NewV4())
 
-	first, ok := h.subscribe()
+	first, ok := h.subscribe(boardID)
 	if !ok {
 		t.Fatal("first subscriber was rejected")
 	}
-	if _, ok := h.subscribe(); !ok {
+	if _, ok := h.subscribe(boardID); !ok {
 		t.Fatal("second subscriber was rejected")
 	}
-	if _, ok := h.subscribe(); ok {
+	if _, ok := h.subscribe(boardID); ok {
 		t.Error("a third subscriber was accepted past the cap of 2")
 	}
 
 	// a departing client frees its slot
 	h.unsubscribe(first)
-	if _, ok := h.subscribe(); !ok {
+	if _, ok := h.subscribe(boardID); !ok {
 		t.Error("a slot was not freed when a client disconnected")
 	}
 }
 
+func TestHubFiltersByBoard(t *testing.T) {
+	t.Parallel()
+
+	h := newHub(0)
+	mine, other := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+
+	watcher, ok := h.subscribe(mine)
+	if !ok {
+		t.Fatal("subscribing to the hub failed")
+	}
+
+	h.broadcast(other, "not for you")
+	h.broadcast(mine, "for you")
+
+	select {
+	case msg := <-watcher:
+		if string(msg.Data) != `"for you"` {
+			t.Errorf("received %s, want only the update for the watched board", msg.Data)
+		}
+	default:
+		t.Fatal("the watched board's update was not delivered")
+	}
+
+	if len(watcher) > 0 {
+		t.Error("an update for another board was delivered")
+	}
+}
+
+// TestHubOverflowResyncs checks that a client too slow to keep up is marked
+// for a resync rather than losing messages unnoticed.
+func TestHubOverflowResyncs(t *testing.T) {
+	t.Parallel()
+
+	h := newHub(0)
+	boardID := uuid.Must(uuid.NewV4())
+
+	watcher, ok := h.subscribe(boardID)
+	if !ok {
+		t.Fatal("subscribing to the hub failed")
+	}
+
+	if h.resynced(watcher) {
+		t.Error("a client that has missed nothing was marked for a resync")
+	}
+	for i := 0; i <= cap(watcher); i++ {
+		h.broadcast(boardID, i)
+	}
+	h.reset()
+
+	if len(watcher) != cap(watcher) {
+		t.Fatalf("the client's buffer holds %d messages, want it full at %d", len(watcher), cap(watcher))
+	}
+	if !h.resynced(watcher) {
+		t.Error("a client whose buffer overflowed was not marked for a resync")
+	}
+	if h.resynced(watcher) {
+		t.Error("the resync mark was not cleared once seen")
+	}
+}
+
 // TestRunResets drives the scheduler loop itself — the one piece of demo-only
 // code that otherwise runs unattended, on a timer, and would fail silently.
 func TestRunResets(t *testing.T) {
@@ -298,12 +390,12 @@ func TestRunResets(t *testing.T) {
 	ctx := context.Background()
 
 	srv := newTestServer(t)
-	if err := seedBoard(ctx, srv.live, srv.boardID); err != nil {
+	if err := seedBoard(ctx, srv.live, demoBoardUUID); err != nil {
 		t.Fatal(err)
 	}
 
 	// each reset reseeds, and the seed's save broadcasts through the hook
-	watcher, ok := srv.hub.subscribe()
+	watcher, ok := srv.hub.subscribe(demoBoardUUID)
 	if !ok {
 		t.Fatal("subscribing to the hub failed")
 	}
@@ -314,17 +406,21 @@ func TestRunResets(t *testing.T) {
 	// fire every 20ms instead of on the hour
 	go srv.runResets(loopCtx, func(now time.Time) time.Time { return now.Add(20 * time.Millisecond) })
 
-	// the loop must keep going, not reset once and stop
-	for i := range 3 {
+	// the loop must keep going, not reset once and stop; each reset sends a
+	// reset notice when it clears the streams, then the reseed's save
+	for i := 0; i < 3; {
 		select {
-		case <-watcher:
+		case msg := <-watcher:
+			if !msg.Reset {
+				i++
+			}
 		case <-time.After(2 * time.Second):
 			t.Fatalf("scheduler stopped after %d resets", i)
 		}
 	}
 
 	// the board is still the seeded one after all that resetting
-	agg, err := srv.live.Load(ctx, srv.boardID, nil)
+	agg, err := srv.live.Load(ctx, demoBoardUUID, nil)
 	if err != nil {
 		t.Fatalf("loading board after repeated resets: %v", err)
 	}
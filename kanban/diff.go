@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-estoria/estoria/aggregatestore"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/go-estoria/estoria/typeid"
+	"github.com/gofrs/uuid/v5"
+)
+
+// Every version of a board is still in its stream, so asking what a board
+// looked like at a moment, or what changed between two moments, is a matter
+// of loading it twice and comparing. Nothing is stored to answer either.
+
+// errBeforeBoard is returned by versionAt for an instant before the board's
+// first event.
+var errBeforeBoard = errors.New("the board did not exist yet at that time")
+
+// versionAt returns the version of the last event in a board's stream at or
+// before t. The stream is read backwards from its end, so recent instants —
+// the common case — read only a few events.
+func versionAt(ctx context.Context, events eventstore.StreamReader, boardID uuid.UUID, t time.Time) (int64, error) {
+	iter, err := events.ReadStream(ctx, typeid.New("board", boardID), eventstore.ReadStreamOptions{
+		Direction: eventstore.Reverse,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close(ctx)
+
+	for {
+		evt, err := iter.Next(ctx)
+		if errors.Is(err, eventstore.ErrEndOfEventStream) {
+			return 0, errBeforeBoard
+		} else if err != nil {
+			return 0, err
+		}
+		if !evt.Timestamp.After(t) {
+			return evt.StreamVersion, nil
+		}
+	}
+}
+
+// boardPoint resolves a point in a board's history given as either a version
+// number or an RFC 3339 timestamp. It writes the error response itself and
+// returns false when the value doesn't name a version of the board.
+func (s *server) boardPoint(w http.ResponseWriter, r *http.Request, boardID uuid.UUID, name, value string) (int64, bool) {
+	if version, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if version < 1 {
+			writeError(w, http.StatusBadRequest, name+" must be a positive version or a timestamp")
+			return 0, false
+		}
+		return version, true
+	}
+
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, name+" must be a positive version or a timestamp like 2006-01-02T15:04:05Z")
+		return 0, false
+	}
+
+	version, err := versionAt(r.Context(), s.events, boardID, at)
+	if errors.Is(err, eventstore.ErrStreamNotFound) {
+		writeError(w, http.StatusNotFound, "board not found")
+		return 0, false
+	} else if errors.Is(err, errBeforeBoard) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return 0, false
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return 0, false
+	}
+	return version, true
+}
+
+// A boardDiff is what changed on a board between two versions. Cards and
+// columns are matched by ID, so a card that moved and was edited shows up in
+// both lists. The archive is part of the board, so a card taken off it is
+// archived, not removed, and one put back is restored, not added; removed is
+// for cards gone from the board and the archive both.
+type boardDiff struct {
+	From    int64       `json:"from"`
+	To      int64       `json:"to"`
+	Renamed *valueDiff  `json:"renamed,omitempty"`
+	Cards   cardDiffs   `json:"cards"`
+	Columns columnDiffs `json:"columns"`
+}
+
+// A valueDiff is one field's value before and after.
+type valueDiff struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+type cardDiffs struct {
+	Added    []cardRef  `json:"added"`
+	Removed  []cardRef  `json:"removed"`
+	Archived []cardRef  `json:"archived"`
+	Restored []cardRef  `json:"restored"`
+	Moved    []cardMove `json:"moved"`
+	Edited   []cardEdit `json:"edited"`
+}
+
+// A cardRef names a card and where it sits, on whichever side of the diff it
+// is on the board. For a card removed from the archive, that is the column it
+// was archived from.
+type cardRef struct {
+	CardID   string `json:"cardId"`
+	Title    string `json:"title"`
+	ColumnID string `json:"columnId"`
+}
+
+// A cardMove is a card that ended up in a different column. Reordering within
+// a column is not reported: positions shift whenever a neighbour comes or
+// goes, so they would drown out the moves anyone made on purpose.
+type cardMove struct {
+	CardID       string `json:"cardId"`
+	Title        string `json:"title"`
+	FromColumnID string `json:"fromColumnId"`
+	ToColumnID   string `json:"toColumnId"`
+}
+
+// A cardEdit is a card whose fields changed, keyed by JSON field name.
+type cardEdit struct {
+	CardID  string               `json:"cardId"`
+	Title   string               `json:"title"`
+	Changes map[string]valueDiff `json:"changes"`
+}
+
+type columnDiffs struct {
+	Added   []columnRef  `json:"added"`
+	Removed []columnRef  `json:"removed"`
+	Changed []columnEdit `json:"changed"`
+}
+
+type columnRef struct {
+	ColumnID string `json:"columnId"`
+	Title    string `json:"title"`
+}
+
+// A columnEdit is a column that was renamed, moved, or given a different WIP
+// limit. A position change is reported only when the column's order relative
+// to the columns on both sides of the diff changed, not when another column
+// was added or removed in front of it.
+type columnEdit struct {
+	ColumnID string               `json:"columnId"`
+	Title    string               `json:"title"`
+	Changes  map[string]valueDiff `json:"changes"`
+}
+
+// handleDiff answers GET /api/boards/{id}/diff?from=…&to=…, where each end is
+// a version or a timestamp. Left out, to is the latest version.
+func (s *server) handleDiff(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	s.resetMu.RLock()
+	defer s.resetMu.RUnlock()
+
+	fromValue := r.URL.Query().Get("from")
+	if fromValue == "" {
+		writeError(w, http.StatusBadRequest, "from is required")
+		return
+	}
+	from, ok := s.boardPoint(w, r, boardID, "from", fromValue)
+	if !ok {
+		return
+	}
+
+	var to *aggregatestore.Aggregate[Board]
+	var err error
+	if toValue := r.URL.Query().Get("to"); toValue != "" {
+		version, ok := s.boardPoint(w, r, boardID, "to", toValue)
+		if !ok {
+			return
+		}
+		to, err = s.history.Load(ctx, boardID, &aggregatestore.LoadOptions{ToVersion: version})
+	} else {
+		to, err = s.live.Load(ctx, boardID, nil)
+	}
+	if err != nil {
+		s.writeLoadError(w, err)
+		return
+	}
+
+	before, err := s.history.Load(ctx, boardID, &aggregatestore.LoadOptions{ToVersion: from})
+	if err != nil {
+		s.writeLoadError(w, err)
+		return
+	}
+
+	diff := diffBoards(before.Entity(), to.Entity())
+	diff.From, diff.To = before.Version(), to.Version()
+	writeJSON(w, http.StatusOK, diff)
+}
+
+// diffBoards compares two states of the same board.
+func diffBoards(before, after Board) boardDiff {
+	diff := boardDiff{
+		Cards: cardDiffs{
+			Added: []cardRef{}, Removed: []cardRef{}, Archived: []cardRef{}, Restored: []cardRef{},
+			Moved: []cardMove{}, Edited: []cardEdit{},
+		},
+		Columns: columnDiffs{
+			Added: []columnRef{}, Removed: []columnRef{}, Changed: []columnEdit{},
+		},
+	}
+	if before.Name != after.Name {
+		diff.Renamed = &valueDiff{From: before.Name, To: after.Name}
+	}
+
+	type placedCard struct {
+		card     Card
+		columnID string
+	}
+	cardsOf := func(board Board) map[string]placedCard {
+		cards := map[string]placedCard{}
+		for _, col := range board.Columns {
+			for _, card := range col.Cards {
+				cards[card.ID] = placedCard{card: card, columnID: col.ID}
+			}
+		}
+		return cards
+	}
+	archiveOf := func(board Board) map[string]Card {
+		cards := map[string]Card{}
+		for _, archived := range board.Archived {
+			cards[archived.Card.ID] = archived.Card
+		}
+		return cards
+	}
+	oldCards, newCards := cardsOf(before), cardsOf(after)
+	oldArchive, newArchive := archiveOf(before), archiveOf(after)
+
+	// walk each board in display order, so the lists read top-left to
+	// bottom-right rather than in map order
+	for _, col := range after.Columns {
+		for _, card := range col.Cards {
+			old, existed := oldCards[card.ID]
+			if !existed {
+				ref := cardRef{CardID: card.ID, Title: card.Title, ColumnID: col.ID}
+				archived, wasArchived := oldArchive[card.ID]
+				if !wasArchived {
+					diff.Cards.Added = append(diff.Cards.Added, ref)
+					continue
+				}
+				diff.Cards.Restored = append(diff.Cards.Restored, ref)
+				old = placedCard{card: archived, columnID: col.ID}
+			}
+			if old.columnID != col.ID {
+				diff.Cards.Moved = append(diff.Cards.Moved, cardMove{
+					CardID: card.ID, Title: card.Title, FromColumnID: old.columnID, ToColumnID: col.ID,
+				})
+			}
+			if changes := cardChanges(old.card, card); len(changes) > 0 {
+				diff.Cards.Edited = append(diff.Cards.Edited, cardEdit{CardID: card.ID, Title: card.Title, Changes: changes})
+			}
+		}
+	}
+	for _, col := range before.Columns {
+		for _, card := range col.Cards {
+			if _, kept := newCards[card.ID]; kept {
+				continue
+			}
+			ref := cardRef{CardID: card.ID, Title: card.Title, ColumnID: col.ID}
+			if _, archived := newArchive[card.ID]; archived {
+				diff.Cards.Archived = append(diff.Cards.Archived, ref)
+			} else {
+				diff.Cards.Removed = append(diff.Cards.Removed, ref)
+			}
+		}
+	}
+	for _, archived := range before.Archived {
+		card := archived.Card
+		if _, restored := newCards[card.ID]; restored {
+			continue
+		}
+		if _, kept := newArchive[card.ID]; !kept {
+			diff.Cards.Removed = append(diff.Cards.Removed, cardRef{CardID: card.ID, Title: card.Title, ColumnID: archived.ColumnID})
+		}
+	}
+
+	// Positions are compared among the columns on both sides only, so adding
+	// a column at the front doesn't report every other one as moved.
+	var oldOrder, newOrder []string
+	for _, col := range before.Columns {
+		if after.HasColumn(col.ID) {
+			oldOrder = append(oldOrder, col.ID)
+		} else {
+			diff.Columns.Removed = append(diff.Columns.Removed, columnRef{ColumnID: col.ID, Title: col.Title})
+		}
+	}
+	for _, col := range after.Columns {
+		if before.HasColumn(col.ID) {
+			newOrder = append(newOrder, col.ID)
+		} else {
+			diff.Columns.Added = append(diff.Columns.Added, columnRef{ColumnID: col.ID, Title: col.Title})
+		}
+	}
+	for newPos, id := range newOrder {
+		old, col := before.column(id), after.column(id)
+
+		changes := map[string]valueDiff{}
+		if old.Title != col.Title {
+			changes["title"] = valueDiff{From: old.Title, To: col.Title}
+		}
+		if old.WIPLimit != col.WIPLimit {
+			changes["wipLimit"] = valueDiff{From: old.WIPLimit, To: col.WIPLimit}
+		}
+		if slices.Index(oldOrder, id) != newPos {
+			changes["position"] = valueDiff{From: before.columnIndex(id), To: after.columnIndex(id)}
+		}
+		if len(changes) > 0 {
+			diff.Columns.Changed = append(diff.Columns.Changed, columnEdit{ColumnID: id, Title: col.Title, Changes: changes})
+		}
+	}
+
+	return diff
+}
+
+// cardChanges returns the fields that differ between two versions of a card.
+func cardChanges(before, after Card) map[string]valueDiff {
+	changes := map[string]valueDiff{}
+	note := func(field string, from, to any, same bool) {
+		if !same {
+			changes[field] = valueDiff{From: from, To: to}
+		}
+	}
+
+	note("title", before.Title, after.Title, before.Title == after.Title)
+	note("description", before.Description, after.Description, before.Description == after.Description)
+	note("color", before.Color, after.Color, before.Color == after.Color)
+	note("assignees", before.Assignees, after.Assignees, slices.Equal(before.Assignees, after.Assignees))
+	note("labels", before.Labels, after.Labels, slices.Equal(before.Labels, after.Labels))
+	note("dueDate", before.DueDate, after.DueDate, before.DueDate == after.DueDate)
+	note("checklist", before.Checklist, after.Checklist, slices.Equal(before.Checklist, after.Checklist))
+
+	return changes
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-estoria/estoria"
+	"github.com/gofrs/uuid/v5"
+)
+
+// TestDiffArchive checks that diffBoards tells the archive apart from the
+// board: archiving and restoring a card are their own changes, and only a
+// card gone from both is removed.
+func TestDiffArchive(t *testing.T) {
+	t.Parallel()
+
+	apply := func(board Board, events ...estoria.EntityEvent[Board]) Board {
+		t.Helper()
+		for _, event := range events {
+			var err error
+			if board, err = event.ApplyTo(context.Background(), board); err != nil {
+				t.Fatalf("applying %s: %v", event.EventType(), err)
+			}
+		}
+		return board
+	}
+	base := apply(NewBoard(uuid.Must(uuid.NewV4())),
+		BoardCreated{Name: "Test"},
+		ColumnAdded{ColumnID: "todo", Title: "To Do"},
+		ColumnAdded{ColumnID: "done", Title: "Done"},
+		CardAdded{CardID: "c1", ColumnID: "todo", Title: "first"},
+		CardAdded{CardID: "c2", ColumnID: "todo", Title: "second"},
+	)
+
+	t.Run("an archived card is archived, not removed", func(t *testing.T) {
+		t.Parallel()
+		diff := diffBoards(base, apply(base, CardArchived{CardID: "c1"}))
+
+		if len(diff.Cards.Archived) != 1 || diff.Cards.Archived[0] != (cardRef{CardID: "c1", Title: "first", ColumnID: "todo"}) {
+			t.Errorf("archived = %+v, want c1 from To Do", diff.Cards.Archived)
+		}
+		if len(diff.Cards.Removed) != 0 || len(diff.Cards.Added) != 0 || len(diff.Cards.Restored) != 0 {
+			t.Errorf("diff = %+v, want nothing but the archived card", diff.Cards)
+		}
+	})
+
+	t.Run("a restored card is restored, not added", func(t *testing.T) {
+		t.Parallel()
+		archived := apply(base, CardArchived{CardID: "c1"})
+		card := *base.card("c1")
+		diff := diffBoards(archived, apply(archived, CardRestored{Card: card, ColumnID: "done", Index: 0}))
+
+		if len(diff.Cards.Restored) != 1 || diff.Cards.Restored[0] != (cardRef{CardID: "c1", Title: "first", ColumnID: "done"}) {
+			t.Errorf("restored = %+v, want c1 in Done", diff.Cards.Restored)
+		}
+		if len(diff.Cards.Added) != 0 || len(diff.Cards.Removed) != 0 || len(diff.Cards.Edited) != 0 {
+			t.Errorf("diff = %+v, want nothing but the restored card", diff.Cards)
+		}
+	})
+
+	t.Run("a card purged from the archive is removed", func(t *testing.T) {
+		t.Parallel()
+		archived := apply(base, CardArchived{CardID: "c2"})
+		diff := diffBoards(archived, apply(archived, CardRemoved{CardID: "c2"}))
+
+		if len(diff.Cards.Removed) != 1 || diff.Cards.Removed[0] != (cardRef{CardID: "c2", Title: "second", ColumnID: "todo"}) {
+			t.Errorf("removed = %+v, want c2, archived from To Do", diff.Cards.Removed)
+		}
+		if len(diff.Cards.Archived) != 0 {
+			t.Errorf("archived = %+v, want none", diff.Cards.Archived)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-estoria/estoria"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/go-estoria/estoria/eventstore/projection"
+	"github.com/go-estoria/estoria/typeid"
+	"github.com/gofrs/uuid/v5"
+)
+
+// A board's portable form is its event log: one JSON object per line, in
+// stream order. Card, column, and checklist item IDs live in the event data,
+// so they survive the round trip; only the board ID is new on import.
+//
+// Events are exported in their current schema, and each line says which
+// schema version that is. Logs exported before versioning say nothing and
+// are version 1, and an import upcasts them like the event store would.
+
+// maxImportSize caps an uploaded event log.
+const maxImportSize = 16 << 20
+
+// An exportedEvent is one line of an exported event log.
+type exportedEvent struct {
+	Type      string          `json:"type"`
+	Version   int64           `json:"version"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+}
+
+// handleExport streams a board's raw events as NDJSON, straight from the
+// event store. The log is written as the stream is read, so exporting a long
+// history never holds all of it in memory.
+func (s *server) handleExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	iter, err := s.events.ReadStream(ctx, typeid.New("board", boardID), eventstore.ReadStreamOptions{})
+	if errors.Is(err, eventstore.ErrStreamNotFound) {
+		writeError(w, http.StatusNotFound, "board not found")
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer iter.Close(ctx)
+
+	proj, err := projection.New(iter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="board-%s.ndjson"`, boardID))
+
+	enc := json.NewEncoder(w)
+	if _, err := proj.Project(ctx, projection.EventHandlerFunc(func(_ context.Context, evt *eventstore.Event) error {
+		schemaVersion, err := schemaVersionOf(evt.Metadata)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(exportedEvent{
+			Type:          evt.ID.Type,
+			Version:       evt.StreamVersion,
+			Timestamp:     evt.Timestamp,
+			Data:          evt.Data,
+			SchemaVersion: schemaVersion,
+		})
+	})); err != nil {
+		// the status line is already sent; all we can do is cut the log short
+		estoria.GetLogger().Error("exporting board", "board_id", boardID, "error", err)
+	}
+}
+
+// handleImport creates a new board from an uploaded event log. Every event is
+// decoded and run through its ApplyTo against the board built so far, so a
+// log that doesn't apply cleanly — out of order, truncated, or hand-edited
+// into an impossible state — is rejected with the offending line before
+// anything is written, as is a card description over the limits commands
+// enforce. The events are then saved to a fresh stream in one
+// append. The event store stamps them with the time of the import; the
+// original timestamps are not kept.
+func (s *server) handleImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	boardID, err := uuid.NewV7()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	board := NewBoard(boardID)
+	var events []estoria.EntityEvent[Board]
+
+	scanner := bufio.NewScanner(http.MaxBytesReader(w, r.Body, maxImportSize))
+	scanner.Buffer(make([]byte, 0, 64<<10), maxImportSize)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var exported exportedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &exported); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("line %d: %v", line, err))
+			return
+		}
+
+		if want := int64(len(events) + 1); exported.Version != want {
+			writeError(w, http.StatusUnprocessableEntity,
+				fmt.Sprintf("line %d: event is version %d, want %d", line, exported.Version, want))
+			return
+		}
+		if len(events) == 0 && exported.Type != (BoardCreated{}).EventType() {
+			writeError(w, http.StatusUnprocessableEntity,
+				fmt.Sprintf("line %d: a board log must start with a %s event", line, BoardCreated{}.EventType()))
+			return
+		}
+
+		data, _, err := s.events.upcasters.upcast(exported.Type, cmp.Or(exported.SchemaVersion, 1), exported.Data)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("line %d: %v", line, err))
+			return
+		}
+		event, err := decodeBoardEvent(exported.Type, data)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("line %d: %v", line, err))
+			return
+		}
+
+		if err := checkDescription(event); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("line %d: %v", line, err))
+			return
+		}
+
+		if board, err = event.ApplyTo(ctx, board); err != nil {
+			writeError(w, http.StatusUnprocessableEntity,
+				fmt.Sprintf("line %d: %s does not apply: %v", line, exported.Type, err))
+			return
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(events) == 0 {
+		writeError(w, http.StatusUnprocessableEntity, "the event log is empty")
+		return
+	}
+
+	s.resetMu.RLock()
+	defer s.resetMu.RUnlock()
+
+	agg := s.live.New(boardID)
+	if err := agg.Append(events...); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := s.live.Save(ctx, agg, nil); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, boardMessage{Version: agg.Version(), Live: true, Board: agg.Entity().rendered()})
+}
@@ -5,27 +5,51 @@ import (
 	"sync"
 
 	"github.com/go-estoria/estoria"
+	"github.com/gofrs/uuid/v5"
 )
 
 // A hub fans out board updates to connected SSE clients. It is fed by an
 // AfterSave hook on the aggregate store, so every successfully saved change
-// reaches every connected browser.
+// reaches every browser that has that board open. Each subscriber watches one
+// board, and the hub only delivers that board's updates to it.
+//
+// Board changes themselves don't travel through the hub: it only says that a
+// board's stream has moved on, and each watcher reads the events it hasn't
+// sent yet from the event store. Comment threads and resets do travel through
+// it, so a message is never silently dropped: a client whose buffer is full
+// is marked for a resync instead, and its watcher starts it over from the
+// whole board and its comment threads once it has drained the buffer (see
+// resynced).
 type hub struct {
 	// maxClients caps concurrent subscribers. Each one holds an open request
 	// and a goroutine, so on a public demo it's worth bounding; 0 means no cap.
 	maxClients int
 
 	mu      sync.Mutex
-	clients map[chan []byte]struct{}
+	clients map[chan hubMessage]*hubClient
+}
+
+// A hubClient is a subscriber's board, and whether it has missed a message.
+type hubClient struct {
+	boardID uuid.UUID
+	resync  bool
+}
+
+// A hubMessage wakes a watcher. With Data, it is a message to send the client
+// as-is; without, the board's stream has new events. Reset says the stream was
+// cleared and rewritten (see resetDemo), so the client's board is void.
+type hubMessage struct {
+	Data  []byte
+	Reset bool
 }
 
 func newHub(maxClients int) *hub {
-	return &hub{maxClients: maxClients, clients: make(map[chan []byte]struct{})}
+	return &hub{maxClients: maxClients, clients: make(map[chan hubMessage]*hubClient)}
 }
 
-// subscribe registers a new client and returns its message channel. It returns
-// false when the hub is already at capacity.
-func (h *hub) subscribe() (chan []byte, bool) {
+// subscribe registers a new client for updates to one board and returns its
+// message channel. It returns false when the hub is already at capacity.
+func (h *hub) subscribe(boardID uuid.UUID) (chan hubMessage, bool) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
@@ -33,34 +57,77 @@ func (h *hub) subscribe() (chan []byte, bool) {
 		return nil, false
 	}
 
-	ch := make(chan []byte, 8)
-	h.clients[ch] = struct{}{}
+	ch := make(chan hubMessage, 8)
+	h.clients[ch] = &hubClient{boardID: boardID}
 
 	return ch, true
 }
 
 // unsubscribe removes a client registered via subscribe.
-func (h *hub) unsubscribe(ch chan []byte) {
+func (h *hub) unsubscribe(ch chan hubMessage) {
 	h.mu.Lock()
 	delete(h.clients, ch)
 	h.mu.Unlock()
 }
 
-// broadcast marshals v and sends it to every connected client. A client whose
-// buffer is full skips the update; it will catch up on the next one.
-func (h *hub) broadcast(v any) {
+// advance tells every client watching boardID that its stream has new events.
+func (h *hub) advance(boardID uuid.UUID) {
+	h.send(boardID, hubMessage{})
+}
+
+// reset tells every client, whatever board it watches, that the streams were
+// cleared.
+func (h *hub) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch, client := range h.clients {
+		h.deliver(ch, client, hubMessage{Reset: true})
+	}
+}
+
+// broadcast marshals v and sends it as-is to every client watching boardID.
+func (h *hub) broadcast(boardID uuid.UUID, v any) {
 	data, err := json.Marshal(v)
 	if err != nil {
 		estoria.GetLogger().Error("marshaling broadcast message", "error", err)
 		return
 	}
+	h.send(boardID, hubMessage{Data: data})
+}
 
+// send delivers a message to every client watching boardID.
+func (h *hub) send(boardID uuid.UUID, msg hubMessage) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	for ch := range h.clients {
-		select {
-		case ch <- data:
-		default:
+	for ch, client := range h.clients {
+		if client.boardID == boardID {
+			h.deliver(ch, client, msg)
 		}
 	}
 }
+
+// deliver puts msg in the client's buffer, or marks the client for a resync
+// if the buffer is full. The full buffer is what wakes its watcher to see
+// the mark. h.mu must be held.
+func (h *hub) deliver(ch chan hubMessage, client *hubClient, msg hubMessage) {
+	select {
+	case ch <- msg:
+	default:
+		client.resync = true
+	}
+}
+
+// resynced reports whether the client has missed a message since it last
+// asked, and clears the mark. A watcher asks on every message it receives,
+// and on true sends the client the whole board and its threads in place of
+// that message.
+func (h *hub) resynced(ch chan hubMessage) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	client, ok := h.clients[ch]
+	if !ok || !client.resync {
+		return false
+	}
+	client.resync = false
+	return true
+}
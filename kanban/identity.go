@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/go-estoria/estoria/typeid"
+	"github.com/gofrs/uuid/v5"
+)
+
+// Identity here is deliberately lightweight: a display name, chosen by the
+// person using the app and sent with every request, either as a cookie (set by
+// POST /api/identity) or as a header for scripts. Nothing is authenticated:
+// the name goes in the activity feed, and only the caller going by it can
+// undo what it did or edit its comments, but anyone can go by any name.
+
+const (
+	actorCookie     = "kanban_actor"
+	actorHeader     = "X-Kanban-Actor"
+	requestIDHeader = "X-Request-ID"
+	anonymousActor  = "anonymous"
+	maxActorLength  = 40
+)
+
+// The metadata keys stamped on every event appended during a request.
+const (
+	actorMetadataKey     = "actor"
+	requestIDMetadataKey = "request_id"
+)
+
+// An identity is who made a request, and the ID that ties the request to the
+// events it appended.
+type identity struct {
+	Actor     string
+	RequestID string
+}
+
+type identityKey struct{}
+
+// withIdentity resolves the caller's display name and a request ID and puts
+// them in the request context. An X-Request-ID sent by the client (or a proxy)
+// is kept, so a request can be followed from the edge into the event stream;
+// otherwise one is generated. Either way it is echoed in the response.
+func withIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := identity{Actor: anonymousActor, RequestID: r.Header.Get(requestIDHeader)}
+
+		if name := normalizeActor(r.Header.Get(actorHeader)); name != "" {
+			id.Actor = name
+		} else if cookie, err := r.Cookie(actorCookie); err == nil {
+			if value, err := url.QueryUnescape(cookie.Value); err == nil && normalizeActor(value) != "" {
+				id.Actor = normalizeActor(value)
+			}
+		}
+
+		if id.RequestID == "" || len(id.RequestID) > 64 || strings.ContainsFunc(id.RequestID, unicode.IsControl) {
+			id.RequestID = uuid.Must(uuid.NewV4()).String()
+		}
+		w.Header().Set(requestIDHeader, id.RequestID)
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	})
+}
+
+// identityFrom returns the identity withIdentity stored in ctx. Outside a
+// request — seeding the tour board, say — it is the zero identity.
+func identityFrom(ctx context.Context) identity {
+	id, _ := ctx.Value(identityKey{}).(identity)
+	return id
+}
+
+// normalizeActor trims a display name, drops control characters, and caps its
+// length. It returns "" for a name with nothing left.
+func normalizeActor(name string) string {
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name))
+	if runes := []rune(name); len(runes) > maxActorLength {
+		name = strings.TrimSpace(string(runes[:maxActorLength]))
+	}
+	return name
+}
+
+// handleGetIdentity returns the display name the server sees for the caller.
+func (s *server) handleGetIdentity(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"actor": identityFrom(r.Context()).Actor})
+}
+
+// handleSetIdentity sets the caller's display name in a cookie. An empty name
+// clears it, going back to anonymous.
+func (s *server) handleSetIdentity(w http.ResponseWriter, r *http.Request) {
+	req, err := readJSON[struct {
+		Name string `json:"name"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := normalizeActor(req.Name)
+	cookie := &http.Cookie{
+		Name:     actorCookie,
+		Value:    url.QueryEscape(name),
+		Path:     "/",
+		MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if name == "" {
+		name, cookie.MaxAge = anonymousActor, -1
+	}
+	http.SetCookie(w, cookie)
+
+	writeJSON(w, http.StatusOK, map[string]string{"actor": name})
+}
+
+// An actorStampingStore is an event store decorator that records who appended
+// each event. It sits below the aggregate stores, so every write path — board
+// commands, comments, imports — is covered without any of them knowing.
+type actorStampingStore struct {
+	eventstore.Store
+}
+
+// AppendStream adds the actor and request ID from ctx to each event's
+// metadata, leaving any keys the event already has alone.
+func (s actorStampingStore) AppendStream(ctx context.Context, streamID typeid.ID, events []*eventstore.WritableEvent, opts eventstore.AppendStreamOptions) error {
+	id := identityFrom(ctx)
+	if id.Actor == "" && id.RequestID == "" {
+		return s.Store.AppendStream(ctx, streamID, events, opts)
+	}
+
+	for _, event := range events {
+		if event.Metadata == nil {
+			event.Metadata = map[string]string{}
+		}
+		for key, value := range map[string]string{actorMetadataKey: id.Actor, requestIDMetadataKey: id.RequestID} {
+			if _, ok := event.Metadata[key]; !ok && value != "" {
+				event.Metadata[key] = value
+			}
+		}
+	}
+	return s.Store.AppendStream(ctx, streamID, events, opts)
+}
@@ -1,7 +1,8 @@
 // Command kanban is a collaborative kanban board backed by estoria.
 //
-// Every change to the board is an event appended to a single event stream in
-// a local SQLite database. The app demonstrates, end to end:
+// Every change to a board is an event appended to that board's event stream
+// in a local SQLite database, which holds any number of boards. The app
+// demonstrates, end to end:
 //
 //   - aggregate modeling with pure ApplyTo event transitions
 //   - the aggregate store decorator stack: hooks -> snapshotting -> event-sourced
@@ -10,6 +11,12 @@
 //   - optimistic concurrency surfaced as HTTP 409s
 //   - stream projections (the activity feed)
 //   - snapshots stored as events in a parallel stream (no extra infrastructure)
+//   - count, time, combined, and on-demand snapshot policies
+//   - a second aggregate type (card comment threads) in the same event store
+//   - a full-text search read model projected from the streams (SQLite FTS5)
+//   - per-event actor metadata stamped by an event store decorator
+//   - event schema versions and upcasters for reading old event shapes
+//   - webhooks: a third aggregate, and a worker tailing the board streams
 //
 // Run it with no arguments and open http://localhost:8080. No Docker required.
 package main
@@ -31,15 +38,15 @@ import (
 	sqlstore "github.com/go-estoria/estoria-contrib/sqlite/eventstore"
 	sqlstrategy "github.com/go-estoria/estoria-contrib/sqlite/eventstore/strategy"
 	"github.com/go-estoria/estoria/aggregatestore"
-	"github.com/go-estoria/estoria/snapshotstore"
 	streamsnapshots "github.com/go-estoria/estoria/snapshotstore/eventstream"
 	"github.com/go-estoria/estoria/typeid"
 	"github.com/gofrs/uuid/v5"
 	_ "modernc.org/sqlite"
 )
 
-// A fixed board ID so the same board is loaded across restarts.
-var boardUUID = uuid.Must(uuid.FromString("e5701a1a-b0a2-4d00-8000-000000000001"))
+// The tour board seeded on first run has a fixed ID, so links to it survive
+// restarts and demo resets. Boards created from the lobby get fresh IDs.
+var demoBoardUUID = uuid.Must(uuid.FromString("e5701a1a-b0a2-4d00-8000-000000000001"))
 
 // The storage strategy's table names. They match its defaults, but are named
 // here because the demo reset deletes from them directly (see demo.go), and
@@ -53,7 +60,8 @@ const (
 // publicly. Every one of them is inert by default: run the example locally and
 // it behaves exactly as it did before any of this existed.
 type demoConfig struct {
-	// hourlyReset clears and reseeds the board at the top of every hour.
+	// hourlyReset clears every board and reseeds the tour board at the top of
+	// every hour.
 	hourlyReset bool
 
 	// writesPerMinute caps state-changing requests per client IP (0 disables).
@@ -65,22 +73,34 @@ type demoConfig struct {
 
 	// maxClients caps concurrent SSE connections (0 disables).
 	maxClients int
+
+	// publicWebhooks only delivers webhooks to public addresses, so anyone
+	// creating one can't reach into the network the server runs in.
+	publicWebhooks bool
 }
 
 func main() {
 	addr := flag.String("addr", defaultAddr(":8080"), "HTTP listen address")
 	dbPath := flag.String("db", "kanban.db", "path to the SQLite database file")
-	snapshotEvery := flag.Int64("snapshot-every", 10, "take an aggregate snapshot every N events")
+	snapshotPolicyName := flag.String("snapshot-policy", countPolicyName,
+		"when to take aggregate snapshots: count, time, count-or-time, or on-demand")
+	snapshotEvery := flag.Int64("snapshot-every", 10, "take an aggregate snapshot every N events (count policies)")
+	snapshotInterval := flag.Duration("snapshot-interval", 5*time.Minute,
+		"take an aggregate snapshot once the latest is this old (time policies)")
+	rebuildSearch := flag.Bool("rebuild-search", false,
+		"rebuild the search read model from the event store at startup")
 
 	var demo demoConfig
 	flag.BoolVar(&demo.hourlyReset, "hourly-reset", false,
-		"clear and reseed the board at the top of every hour (for public demos)")
+		"clear all boards and reseed the tour board at the top of every hour (for public demos)")
 	flag.IntVar(&demo.writesPerMinute, "writes-per-minute", 0,
 		"per-IP limit on state-changing requests (0 disables)")
 	flag.BoolVar(&demo.trustProxy, "trust-proxy", false,
 		"read the client IP from X-Forwarded-For (only behind a trusted proxy)")
 	flag.IntVar(&demo.maxClients, "max-clients", 0,
 		"maximum concurrent live (SSE) connections (0 disables)")
+	flag.BoolVar(&demo.publicWebhooks, "public-webhooks-only", false,
+		"refuse to deliver webhooks to loopback, private, link-local, and metadata addresses")
 
 	flag.Parse()
 
@@ -92,10 +112,16 @@ func main() {
 
 	estoria.SetLogger(estoria.DefaultLogger())
 
+	policy, err := newSnapshotPolicy(*snapshotPolicyName, *snapshotEvery, *snapshotInterval)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(2)
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	if err := run(ctx, *addr, *dbPath, *snapshotEvery, demo); err != nil {
+	if err := run(ctx, *addr, *dbPath, policy, *rebuildSearch, demo); err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
 		os.Exit(1)
 	}
@@ -111,7 +137,7 @@ func defaultAddr(fallback string) string {
 	return fallback
 }
 
-func run(ctx context.Context, addr, dbPath string, snapshotEvery int64, demo demoConfig) error {
+func run(ctx context.Context, addr, dbPath string, policy snapshotPolicy, rebuildSearch bool, demo demoConfig) error {
 	// SQLite via a pure-Go driver: persistent, transactional, and no server
 	// to run. WAL mode lets reads proceed while a write is in flight.
 	dsn := fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)", dbPath)
@@ -142,26 +168,32 @@ func run(ctx context.Context, addr, dbPath string, snapshotEvery int64, demo dem
 		return fmt.Errorf("creating event store: %w", err)
 	}
 
+	// Every read and write goes through the upcasting store, which versions
+	// each event's schema and brings old events up to date as they are read
+	// (see upcast.go). Writes also go through a decorator that records who
+	// made each request in the event metadata (see identity.go). Snapshots
+	// are the aggregate's JSON rather than events, and use the store directly.
+	upcasting := newUpcastingStore(eventStore, boardUpcasters())
+	stamped := actorStampingStore{upcasting}
+
 	// The aggregate store stack, innermost first. Each layer implements
 	// aggregatestore.Store[Board], so they compose freely.
 
 	// 1. EventSourcedStore: hydrates by replaying events, saves with
 	//    optimistic concurrency (ExpectVersion).
-	eventSourced, err := aggregatestore.New(eventStore, NewBoard,
+	eventSourced, err := aggregatestore.New(stamped, NewBoard,
 		aggregatestore.WithEventTypes(boardEventPrototypes()...))
 	if err != nil {
 		return fmt.Errorf("creating aggregate store: %w", err)
 	}
 
-	// 2. SnapshottingStore: after every N events, writes a snapshot; loads
-	//    start from the latest snapshot instead of replaying from scratch.
-	//    Snapshots are stored as events in a parallel "boardsnapshot" stream
-	//    in the same SQLite database — no separate snapshot storage needed.
-	snapshotting, err := aggregatestore.NewSnapshottingStore[Board](
-		eventSourced,
-		streamsnapshots.NewEventStreamStore(eventStore),
-		snapshotstore.EventCountSnapshotPolicy{N: snapshotEvery},
-	)
+	// 2. SnapshottingStore: writes a snapshot whenever the policy says so
+	//    (every N events by default; see snapshots.go); loads start from the
+	//    latest snapshot instead of replaying from scratch. Snapshots are
+	//    stored as events in a parallel "boardsnapshot" stream in the same
+	//    SQLite database — no separate snapshot storage needed.
+	snapshots := streamsnapshots.NewEventStreamStore(eventStore)
+	snapshotting, err := aggregatestore.NewSnapshottingStore[Board](eventSourced, snapshots, policy)
 	if err != nil {
 		return fmt.Errorf("creating snapshotting store: %w", err)
 	}
@@ -173,30 +205,78 @@ func run(ctx context.Context, addr, dbPath string, snapshotEvery int64, demo dem
 		return fmt.Errorf("creating hookable store: %w", err)
 	}
 
+	// The search read model lives in the same database and is fed by the
+	// same hook. A failed index update is logged rather than failing the
+	// save — the event is already stored, and the next update catches up.
+	search, err := newSearchIndex(ctx, db, upcasting)
+	if err != nil {
+		return err
+	}
+	search.boards = hookable
+
+	// Webhook subscriptions are a third aggregate type; the delivery worker
+	// reads the board streams on its own schedule, and the hook only wakes
+	// it (see webhook_delivery.go).
+	webhooks, err := newWebhookStore(stamped)
+	if err != nil {
+		return fmt.Errorf("creating webhook store: %w", err)
+	}
+	deliveries, err := newWebhookWorker(ctx, db, upcasting, webhooks, demo.publicWebhooks)
+	if err != nil {
+		return err
+	}
+
 	broadcasts := newHub(demo.maxClients)
-	hookable.AfterSave(func(_ context.Context, agg *aggregatestore.Aggregate[Board]) error {
-		broadcasts.broadcast(boardMessage{Version: agg.Version(), Live: true, Board: agg.Entity()})
+	hookable.AfterSave(func(ctx context.Context, agg *aggregatestore.Aggregate[Board]) error {
+		board := agg.Entity()
+		broadcasts.advance(board.ID)
+		if err := search.update(ctx, board, agg.Version()); err != nil {
+			estoria.GetLogger().Error("updating search index", "board_id", board.ID, "error", err)
+		}
+		deliveries.notify()
 		return nil
 	})
 
-	// seed a demo board on first run
-	if _, err := eventSourced.Load(ctx, boardUUID, nil); errors.Is(err, aggregatestore.ErrAggregateNotFound) {
-		if err := seedBoard(ctx, hookable, boardUUID); err != nil {
+	// Card comment threads are a second aggregate type in the same event
+	// store, each thread in its own stream (see cardthread.go).
+	threads, err := newThreadStore(stamped, broadcasts)
+	if err != nil {
+		return fmt.Errorf("creating thread store: %w", err)
+	}
+
+	// seed the tour board on first run
+	if _, err := eventSourced.Load(ctx, demoBoardUUID, nil); errors.Is(err, aggregatestore.ErrAggregateNotFound) {
+		if err := seedBoard(ctx, hookable, demoBoardUUID); err != nil {
 			return fmt.Errorf("seeding board: %w", err)
 		}
-		estoria.GetLogger().Info("seeded demo board", "board_id", typeid.New("board", boardUUID))
+		estoria.GetLogger().Info("seeded demo board", "board_id", typeid.New("board", demoBoardUUID))
 	} else if err != nil {
 		return fmt.Errorf("loading board: %w", err)
 	}
 
+	// index anything saved while the index didn't exist or wasn't listening;
+	// with -rebuild-search, throw the index away and index every board again
+	if rebuildSearch {
+		if err := search.clear(ctx); err != nil {
+			return fmt.Errorf("clearing search index: %w", err)
+		}
+	}
+	if err := search.catchUp(ctx); err != nil {
+		return fmt.Errorf("catching up search index: %w", err)
+	}
+
 	srv := &server{
-		boardID:       boardUUID,
-		live:          hookable,
-		history:       eventSourced,
-		events:        eventStore,
-		db:            db,
-		hub:           broadcasts,
-		snapshotEvery: snapshotEvery,
+		live:           hookable,
+		history:        eventSourced,
+		threads:        threads,
+		search:         search,
+		webhooks:       webhooks,
+		webhookWorker:  deliveries,
+		events:         upcasting,
+		db:             db,
+		hub:            broadcasts,
+		snapshots:      snapshots,
+		snapshotPolicy: policy,
 	}
 
 	// Hosted-demo behavior, all off by default (see demoConfig).
@@ -209,6 +289,7 @@ func run(ctx context.Context, addr, dbPath string, snapshotEvery int64, demo dem
 	if demo.hourlyReset {
 		go srv.runHourlyReset(ctx)
 	}
+	go deliveries.run(ctx)
 
 	httpServer := &http.Server{Addr: addr, Handler: handler}
 
@@ -252,21 +333,21 @@ func seedBoard(ctx context.Context, store aggregatestore.Store[Board], id uuid.U
 		ColumnAdded{ColumnID: doing, Title: "In Progress"},
 		ColumnAdded{ColumnID: done, Title: "Done"},
 		CardAdded{CardID: dragCard, ColumnID: todo, Title: "Drag a card to another column",
-			Description: "Every drop appends a CardMoved event to the board's event stream. Nothing is ever updated in place.", Color: "blue"},
+			Description: "Every drop appends a `CardMoved` event to the board's event stream. Nothing is ever **updated in place**.", Color: CardColor{Name: "blue"}},
 		CardAdded{CardID: tabsCard, ColumnID: todo, Title: "Open this app in a second tab",
-			Description: "An AfterSave hook on the aggregate store broadcasts every change over SSE, so all tabs stay in sync.", Color: "purple"},
+			Description: "An `AfterSave` hook on the aggregate store broadcasts every change over [server-sent events](https://developer.mozilla.org/en-US/docs/Web/API/Server-sent_events), so all tabs stay in sync.", Color: CardColor{Name: "purple"}},
 		CardAdded{CardID: editCard, ColumnID: todo, Title: "Click a card to edit it",
-			Description: "Edits append CardEdited events. The old state isn't lost — scrub the timeline to see it again.", Color: "teal"},
+			Description: "Edits append `CardEdited` events. The old state isn't lost — scrub the timeline to see it again.\n\nDescriptions are *Markdown*: try a list, a [link](https://github.com/go-estoria/estoria), or a code block.", Color: CardColor{Name: "teal"}},
 		CardAdded{CardID: sliderCard, ColumnID: todo, Title: "Scrub the timeline below",
-			Description: "The server rebuilds the board at any version using LoadOptions.ToVersion. This is just a replay — no special storage.", Color: "amber"},
+			Description: "The server rebuilds the board at any version using `LoadOptions.ToVersion`. This is just a replay — no special storage.", Color: CardColor{Name: "amber"}},
 		CardAdded{CardID: snapshotCard, ColumnID: todo, Title: "Watch a snapshot happen",
-			Description: "Open Under the Hood and make some changes: every 10 events, the SnapshottingStore writes a snapshot to a parallel event stream.", Color: "pink"},
+			Description: "Open **Under the Hood** and make some changes:\n\n- every 10 events, the `SnapshottingStore` writes a snapshot\n- snapshots go to a parallel event stream\n- loads start from the latest one", Color: CardColor{Name: "pink"}},
 		CardAdded{CardID: conflictCard, ColumnID: todo, Title: "Trigger a version conflict",
-			Description: "The ⚡ button in Under the Hood sends a command based on a stale version. Estoria's optimistic concurrency rejects it with a version mismatch.", Color: "red"},
+			Description: "The ⚡ button in **Under the Hood** sends a command based on a stale version. Estoria's optimistic concurrency rejects it with a version mismatch.", Color: CardColor{Name: "red", Label: "on purpose"}},
 		CardMoved{CardID: sliderCard, ToColumn: doing, ToIndex: 0},
 		CardMoved{CardID: snapshotCard, ToColumn: doing, ToIndex: 1},
 		CardEdited{CardID: dragCard, Title: "Drag a card to another column",
-			Description: "Every drop appends a CardMoved event to the board's event stream. Nothing is ever updated in place. (This description was itself a CardEdited event — check the activity feed.)", Color: "blue"},
+			Description: "Every drop appends a `CardMoved` event to the board's event stream. Nothing is ever **updated in place**.\n\n> This description was itself a `CardEdited` event — check the activity feed.", Color: CardColor{Name: "blue"}},
 	); err != nil {
 		return err
 	}
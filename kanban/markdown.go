@@ -0,0 +1,549 @@
+package main
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Card descriptions are Markdown. The server renders them, so every client
+// shows the same thing and none of them has to be trusted to sanitize.
+//
+// The renderer handles the subset teams write in cards: paragraphs, headings,
+// emphasis, strikethrough, code spans and fenced code blocks, lists, block
+// quotes, rules, and links. It is sanitizing by construction rather than by
+// filtering: every character of the source is escaped, raw HTML included, and
+// the only markup in the output is what the renderer writes itself. Links
+// must be absolute http, https, or mailto URLs; any other link is shown as its
+// text.
+
+// markdownRenderer renders one description, counting the links it writes.
+type markdownRenderer struct {
+	b     strings.Builder
+	links int
+}
+
+// renderMarkdown renders a card description to sanitized HTML, and returns
+// how many links it contains.
+func renderMarkdown(src string) (string, int) {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\t", "    ")
+
+	var m markdownRenderer
+	m.blocks(strings.Split(src, "\n"), false)
+	return m.b.String(), m.links
+}
+
+var (
+	mdHeading   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ ]+(.*?))?(?:[ ]+#+)?[ ]*$`)
+	mdRule      = regexp.MustCompile(`^ {0,3}(?:(?:\*[ ]*){3,}|(?:-[ ]*){3,}|(?:_[ ]*){3,})$`)
+	mdFence     = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ ]*([^`\\s]*)")
+	mdQuote     = regexp.MustCompile(`^ {0,3}> ?`)
+	mdBullet    = regexp.MustCompile(`^( {0,3})([-*+])( +|$)`)
+	mdOrdered   = regexp.MustCompile(`^( {0,3})(\d{1,9})([.)])( +|$)`)
+	mdLanguage  = regexp.MustCompile(`^[A-Za-z0-9_+#.-]+$`)
+	mdSchemeSep = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*:`)
+)
+
+// blocks renders lines as a sequence of blocks. In a tight list item,
+// paragraphs are written without <p> tags.
+func (m *markdownRenderer) blocks(lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+
+		case isFence(line):
+			i = m.codeBlock(lines, i)
+
+		case mdHeading.MatchString(line):
+			match := mdHeading.FindStringSubmatch(line)
+			level := strconv.Itoa(len(match[1]))
+			m.b.WriteString("<h" + level + ">")
+			m.inline(match[2], true)
+			m.b.WriteString("</h" + level + ">\n")
+			i++
+
+		case mdRule.MatchString(line):
+			m.b.WriteString("<hr>\n")
+			i++
+
+		case mdQuote.MatchString(line):
+			var quoted []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+				quoted = append(quoted, mdQuote.ReplaceAllString(lines[i], ""))
+			}
+			m.b.WriteString("<blockquote>\n")
+			m.blocks(quoted, false)
+			m.b.WriteString("</blockquote>\n")
+
+		case listMarker(line) != nil:
+			i = m.list(lines, i)
+
+		default:
+			var para []string
+			for ; i < len(lines) && !startsBlock(lines[i]); i++ {
+				para = append(para, strings.TrimSpace(lines[i]))
+			}
+			if !tight {
+				m.b.WriteString("<p>")
+			}
+			m.inline(strings.Join(para, "\n"), true)
+			if !tight {
+				m.b.WriteString("</p>")
+			}
+			m.b.WriteString("\n")
+		}
+	}
+}
+
+// startsBlock reports whether a line ends the paragraph before it.
+func startsBlock(line string) bool {
+	return strings.TrimSpace(line) == "" ||
+		isFence(line) ||
+		mdHeading.MatchString(line) ||
+		mdRule.MatchString(line) ||
+		mdQuote.MatchString(line) ||
+		listMarker(line) != nil
+}
+
+// isFence reports whether a line opens a fenced code block. A backtick fence
+// can't have backticks after it, or ```this``` would start one.
+func isFence(line string) bool {
+	match := mdFence.FindStringSubmatch(line)
+	if match == nil {
+		return false
+	}
+	rest := line[len(match[0]):]
+	return match[1][0] != '`' || !strings.Contains(rest, "`")
+}
+
+// codeBlock renders the fenced code block starting at lines[start], and
+// returns the index of the line after it. An unclosed fence runs to the end.
+func (m *markdownRenderer) codeBlock(lines []string, start int) int {
+	match := mdFence.FindStringSubmatch(lines[start])
+	fence, lang := match[1], match[2]
+
+	m.b.WriteString("<pre><code")
+	if mdLanguage.MatchString(lang) {
+		m.b.WriteString(` class="language-` + html.EscapeString(lang) + `"`)
+	}
+	m.b.WriteString(">")
+
+	i := start + 1
+	for ; i < len(lines); i++ {
+		if trimmed := strings.TrimSpace(lines[i]); strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			i++
+			break
+		}
+		m.b.WriteString(html.EscapeString(lines[i]) + "\n")
+	}
+	m.b.WriteString("</code></pre>\n")
+	return i
+}
+
+// A marker is the start of a list item: its kind ("-", "*", "+", ".", ")"),
+// its number in an ordered list, and how far in the item's text starts.
+type marker struct {
+	kind   string
+	number int
+	indent int
+}
+
+func listMarker(line string) *marker {
+	if match := mdBullet.FindStringSubmatch(line); match != nil && !mdRule.MatchString(line) {
+		return &marker{kind: match[2], indent: len(match[0])}
+	}
+	if match := mdOrdered.FindStringSubmatch(line); match != nil {
+		n, _ := strconv.Atoi(match[2])
+		return &marker{kind: match[3], number: n, indent: len(match[0])}
+	}
+	return nil
+}
+
+// list renders the list starting at lines[start], and returns the index of
+// the line after it. A list is tight unless its items are separated by blank
+// lines.
+func (m *markdownRenderer) list(lines []string, start int) int {
+	first := listMarker(lines[start])
+
+	var items [][]string
+	loose := false
+	i := start
+	for i < len(lines) {
+		mk := listMarker(lines[i])
+		if mk == nil || mk.kind != first.kind {
+			break
+		}
+		item := []string{lines[i][mk.indent:]}
+		i++
+
+		for i < len(lines) {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				// a blank line continues the item only if what follows is
+				// indented to the item's text
+				j := i
+				for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+					j++
+				}
+				if j == len(lines) || indentOf(lines[j]) < mk.indent {
+					break
+				}
+				item = append(item, lines[i:j]...)
+				loose = true
+				i = j
+				continue
+			}
+			if indentOf(line) >= mk.indent {
+				item = append(item, line[mk.indent:])
+			} else if !startsBlock(line) && strings.TrimSpace(item[len(item)-1]) != "" {
+				item = append(item, line) // lazy continuation of the item's text
+			} else {
+				break
+			}
+			i++
+		}
+		items = append(items, item)
+
+		if i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			j := i
+			for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+				j++
+			}
+			if j < len(lines) {
+				if next := listMarker(lines[j]); next != nil && next.kind == first.kind {
+					loose = true
+					i = j
+				}
+			}
+		}
+	}
+
+	tag := "ul"
+	if first.kind == "." || first.kind == ")" {
+		tag = "ol"
+	}
+	m.b.WriteString("<" + tag)
+	if tag == "ol" && first.number != 1 {
+		m.b.WriteString(` start="` + strconv.Itoa(first.number) + `"`)
+	}
+	m.b.WriteString(">\n")
+	for _, item := range items {
+		m.b.WriteString("<li>")
+		m.blocks(item, !loose)
+		m.b.WriteString("</li>\n")
+	}
+	m.b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// inline renders a run of text: code spans, emphasis, strikethrough, and
+// links. Newlines become line breaks, since that is what people mean when
+// they press return in a card. Inside a link's text, links is false.
+func (m *markdownRenderer) inline(s string, links bool) {
+	var text strings.Builder
+	flush := func() {
+		m.b.WriteString(html.EscapeString(text.String()))
+		text.Reset()
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '\n':
+			flush()
+			m.b.WriteString("<br>\n")
+			i++
+			continue
+
+		case c == '`':
+			if end, code, ok := codeSpan(s, i); ok {
+				flush()
+				m.b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i = end
+				continue
+			}
+			n := runLength(s, i, '`')
+			text.WriteString(s[i : i+n])
+			i += n
+			continue
+
+		case c == '*' || c == '_' || c == '~':
+			if end, tag, inner, ok := emphasis(s, i); ok {
+				flush()
+				m.b.WriteString("<" + tag + ">")
+				m.inline(inner, links)
+				m.b.WriteString("</" + tag + ">")
+				i = end
+				continue
+			}
+			n := runLength(s, i, c)
+			text.WriteString(s[i : i+n])
+			i += n
+			continue
+
+		case c == '[' && links:
+			if end, label, target, ok := inlineLink(s, i); ok {
+				flush()
+				m.link(target, func() { m.inline(label, false) })
+				i = end
+				continue
+			}
+
+		case c == '<' && links:
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				target := s[i+1 : i+end]
+				if !strings.ContainsAny(target, " \n<") && mdSchemeSep.MatchString(target) && safeLink(target) {
+					flush()
+					m.link(target, func() { m.b.WriteString(html.EscapeString(target)) })
+					i += end + 1
+					continue
+				}
+			}
+
+		case (c == 'h' || c == 'H') && links && (i == 0 || !isWordByte(s[i-1])):
+			if target := bareURL(s[i:]); target != "" {
+				flush()
+				m.link(target, func() { m.b.WriteString(html.EscapeString(target)) })
+				i += len(target)
+				continue
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(s[i:])
+		text.WriteString(s[i : i+size])
+		i += size
+	}
+	flush()
+}
+
+// link writes a link to target with the text label writes, or just the text
+// when target isn't a URL a card may link to.
+func (m *markdownRenderer) link(target string, label func()) {
+	if !safeLink(target) {
+		label()
+		return
+	}
+	m.links++
+	m.b.WriteString(`<a href="` + html.EscapeString(target) + `" rel="nofollow noopener noreferrer" target="_blank">`)
+	label()
+	m.b.WriteString("</a>")
+}
+
+// safeLink reports whether a link target is an absolute http, https, or
+// mailto URL.
+func safeLink(target string) bool {
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
+
+// codeSpan finds the code span opening at s[start], which closes with a
+// backtick run of the same length.
+func codeSpan(s string, start int) (end int, code string, ok bool) {
+	n := runLength(s, start, '`')
+	for j := start + n; j < len(s); {
+		k := strings.IndexByte(s[j:], '`')
+		if k < 0 {
+			return 0, "", false
+		}
+		j += k
+		if m := runLength(s, j, '`'); m != n {
+			j += m
+			continue
+		}
+		code = strings.ReplaceAll(s[start+n:j], "\n", " ")
+		if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+			code = code[1 : len(code)-1]
+		}
+		return j + n, code, true
+	}
+	return 0, "", false
+}
+
+// emphasis finds the emphasis opening at s[start]: *em* or _em_,
+// **strong** or __strong__, or ~~struck~~. The text inside must not start or
+// end with a space, and underscores only count at the edges of words, so
+// snake_case_names stay as they are.
+func emphasis(s string, start int) (end int, tag, inner string, ok bool) {
+	c := s[start]
+	n := runLength(s, start, c)
+	switch {
+	case c == '~' && n == 2:
+		tag = "del"
+	case c != '~' && n == 2:
+		tag = "strong"
+	case c != '~' && n == 1:
+		tag = "em"
+	default:
+		return 0, "", "", false
+	}
+	if c == '_' && start > 0 && isWordByte(s[start-1]) {
+		return 0, "", "", false
+	}
+
+	open := start + n
+	if open >= len(s) || s[open] == ' ' || s[open] == '\n' {
+		return 0, "", "", false
+	}
+	for j := open; j < len(s); {
+		switch s[j] {
+		case '`':
+			if e, _, ok := codeSpan(s, j); ok {
+				j = e
+				continue
+			}
+		case '\\':
+			j += 2
+			continue
+		case c:
+			m := runLength(s, j, c)
+			closes := m == n && s[j-1] != ' ' && s[j-1] != '\n'
+			if c == '_' && j+m < len(s) && isWordByte(s[j+m]) {
+				closes = false
+			}
+			if closes {
+				return j + n, tag, s[open:j], true
+			}
+			j += m
+			continue
+		}
+		j++
+	}
+	return 0, "", "", false
+}
+
+// inlineLink finds the link [label](target) opening at s[start].
+func inlineLink(s string, start int) (end int, label, target string, ok bool) {
+	depth := 0
+	j := start
+	for ; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+			continue
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	if j >= len(s)-1 || s[j+1] != '(' {
+		return 0, "", "", false
+	}
+	label = s[start+1 : j]
+
+	depth = 0
+	k := j + 2
+	for ; k < len(s); k++ {
+		switch s[k] {
+		case ' ', '\n':
+			if end := linkTitleEnd(s, k); end > 0 {
+				return end, label, s[j+2 : k], true
+			}
+			return 0, "", "", false
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return k + 1, label, s[j+2 : k], true
+			}
+			depth--
+		}
+	}
+	return 0, "", "", false
+}
+
+// linkTitleEnd returns the index after the closing parenthesis when a link's
+// target, which ended at s[start], is followed by a quoted title. Titles are
+// allowed but not shown.
+func linkTitleEnd(s string, start int) int {
+	i := start
+	for i < len(s) && (s[i] == ' ' || s[i] == '\n') {
+		i++
+	}
+	if i == len(s) || (s[i] != '"' && s[i] != '\'') {
+		return 0
+	}
+	closing := strings.IndexByte(s[i+1:], s[i])
+	if closing < 0 {
+		return 0
+	}
+	i += closing + 2
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	if i == len(s) || s[i] != ')' {
+		return 0
+	}
+	return i + 1
+}
+
+// bareURL returns the http or https URL s starts with, if it does, without
+// the punctuation that ends the sentence around it.
+func bareURL(s string) string {
+	lower := strings.ToLower(s[:min(len(s), 8)])
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return ""
+	}
+	end := strings.IndexFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == '<' })
+	if end < 0 {
+		end = len(s)
+	}
+	target := s[:end]
+	for target != "" {
+		last := target[len(target)-1]
+		if strings.IndexByte(".,:;!?'\"*_~", last) >= 0 ||
+			(last == ')' && strings.Count(target, "(") < strings.Count(target, ")")) {
+			target = target[:len(target)-1]
+			continue
+		}
+		break
+	}
+	if !safeLink(target) {
+		return ""
+	}
+	return target
+}
+
+func runLength(s string, start int, c byte) int {
+	n := 0
+	for start+n < len(s) && s[start+n] == c {
+		n++
+	}
+	return n
+}
+
+func isASCIIPunct(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsPunct(rune(c)) || strings.IndexByte("$+<=>^`|~", c) >= 0
+}
+
+func isWordByte(c byte) bool {
+	return c >= utf8.RuneSelf || c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
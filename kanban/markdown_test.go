@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	t.Parallel()
+
+	const rel = ` rel="nofollow noopener noreferrer" target="_blank"`
+	for name, tc := range map[string]struct {
+		src, want string
+		links     int
+	}{
+		"empty": {"", "", 0},
+		"inline": {
+			"**bold**, *em*, _em_, ~~gone~~, `code`, and snake_case_names",
+			"<p><strong>bold</strong>, <em>em</em>, <em>em</em>, <del>gone</del>, <code>code</code>, and snake_case_names</p>\n", 0,
+		},
+		"line breaks and paragraphs": {"one\ntwo\n\nthree", "<p>one<br>\ntwo</p>\n<p>three</p>\n", 0},
+		"heading":                    {"## Steps ##", "<h2>Steps</h2>\n", 0},
+		"tight list": {
+			"- a\n- b\n  1. nested",
+			"<ul>\n<li>a\n</li>\n<li>b\n<ol>\n<li>nested\n</li>\n</ol>\n</li>\n</ul>\n", 0,
+		},
+		"loose list":        {"3. x\n\n4. y", "<ol start=\"3\">\n<li><p>x</p>\n</li>\n<li><p>y</p>\n</li>\n</ol>\n", 0},
+		"quote":             {"> quoted\n> on", "<blockquote>\n<p>quoted<br>\non</p>\n</blockquote>\n", 0},
+		"fenced code":       {"```go\nif a < b {\n```\nafter", "<pre><code class=\"language-go\">if a &lt; b {\n</code></pre>\n<p>after</p>\n", 0},
+		"code isn't markup": {"`<b>*x*</b>`", "<p><code>&lt;b&gt;*x*&lt;/b&gt;</code></p>\n", 0},
+		"link": {
+			`[the docs](https://go.dev/doc "Go docs")`,
+			`<p><a href="https://go.dev/doc"` + rel + ">the docs</a></p>\n", 1,
+		},
+		"autolinks": {
+			"<mailto:team@example.com> or https://example.com/a_(b).",
+			`<p><a href="mailto:team@example.com"` + rel + ">mailto:team@example.com</a> or " +
+				`<a href="https://example.com/a_(b)"` + rel + ">https://example.com/a_(b)</a>.</p>\n", 2,
+		},
+
+		// sanitizing
+		"raw HTML":        {`<script>alert(1)</script><img src=x onerror=alert(1)>`, "<p>&lt;script&gt;alert(1)&lt;/script&gt;&lt;img src=x onerror=alert(1)&gt;</p>\n", 0},
+		"javascript link": {"[click](javascript:alert(1))", "<p>click</p>\n", 0},
+		"relative link":   {"[up](../secret)", "<p>up</p>\n", 0},
+		"quote in href":   {`[x](https://e.com/"onmouseover="alert(1))`, `<p><a href="https://e.com/&#34;onmouseover=&#34;alert(1)"` + rel + ">x</a></p>\n", 1},
+		"fence language":  {"```\"><script>\nx\n```", "<pre><code>x\n</code></pre>\n", 0},
+		"no nested links": {"[https://a.com](https://b.com)", `<p><a href="https://b.com"` + rel + ">https://a.com</a></p>\n", 1},
+	} {
+		got, links := renderMarkdown(tc.src)
+		if got != tc.want || links != tc.links {
+			t.Errorf("%s: renderMarkdown(%q) =\n%s(%d links), want\n%s(%d links)", name, tc.src, got, links, tc.want, tc.links)
+		}
+	}
+}
+
+func TestRequireDescription(t *testing.T) {
+	t.Parallel()
+
+	if got, err := requireDescription("  *hi*\n"); err != nil || got != "*hi*" {
+		t.Errorf(`requireDescription("  *hi*\n") = %q, %v; want "*hi*"`, got, err)
+	}
+	if _, err := requireDescription(strings.Repeat("x", maxDescriptionLength+1)); err == nil {
+		t.Error("a description over the size limit was accepted")
+	}
+	links := strings.Repeat("https://example.com ", maxDescriptionLinks)
+	if _, err := requireDescription(links); err != nil {
+		t.Errorf("%d links: %v", maxDescriptionLinks, err)
+	}
+	if _, err := requireDescription(links + "[one more](https://example.com)"); err == nil {
+		t.Error("a description over the link limit was accepted")
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-estoria/estoria"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/gofrs/uuid/v5"
+)
+
+// A stale baseVersion usually means someone else changed a different part of
+// the board. In merge mode (?merge=true on any board command), a version
+// conflict isn't the end: the events saved since the base are read back, and
+// if none of them touched what the command touches, the command's event is
+// rebased onto the latest version and saved there. Only a real overlap — the
+// same card, or a column one side restructured while the other used it — is
+// answered with a 409, and that response lists the events in the way.
+
+// maxRebases bounds how many times one command is rebased when the board
+// keeps moving under it.
+const maxRebases = 3
+
+// A footprint is what an event touches.
+type footprint struct {
+	board   bool            // the board's name
+	order   bool            // the order of the columns
+	cards   map[string]bool // cards it adds, changes, moves, or removes
+	changed map[string]bool // columns it renames, moves, limits, or removes
+	used    map[string]bool // columns it puts cards into or takes them out of
+}
+
+// footprintOf returns what e touches when applied to before.
+func footprintOf(e estoria.EntityEvent[Board], before Board) footprint {
+	fp := footprint{cards: map[string]bool{}, changed: map[string]bool{}, used: map[string]bool{}}
+	if cardID := touchedCard(e); cardID != "" {
+		fp.cards[cardID] = true
+		if colIdx, _ := before.findCard(cardID); colIdx >= 0 {
+			fp.used[before.Columns[colIdx].ID] = true
+		}
+	}
+
+	switch e := e.(type) {
+	case BoardRenamed:
+		fp.board = true
+	case ColumnAdded:
+		fp.changed[e.ColumnID] = true
+	case ColumnRenamed:
+		fp.changed[e.ColumnID] = true
+	case ColumnMoved:
+		// moving one column shifts the others, so reorders conflict with
+		// each other whichever columns they move
+		fp.changed[e.ColumnID] = true
+		fp.order = true
+	case ColumnWIPLimitSet:
+		fp.changed[e.ColumnID] = true
+	case ColumnRemoved:
+		fp.changed[e.ColumnID] = true
+		if e.MoveCardsTo != "" {
+			fp.used[e.MoveCardsTo] = true
+		}
+		if col := before.column(e.ColumnID); col != nil {
+			for _, card := range col.Cards {
+				fp.cards[card.ID] = true
+			}
+		}
+	case CardAdded:
+		fp.used[e.ColumnID] = true
+	case CardMoved:
+		fp.used[e.ToColumn] = true
+	case CardRestored:
+		fp.used[e.ColumnID] = true
+	}
+	return fp
+}
+
+// overlaps reports whether two events touch the same thing in a way that
+// makes their order matter: the same card, a column that either of them
+// restructured, or both renaming the board or reordering its columns. Two
+// events that only put cards into the same column don't overlap; if that
+// breaks the column's WIP limit, the rebased event's ApplyTo says so.
+func (f footprint) overlaps(g footprint) bool {
+	if (f.board && g.board) || (f.order && g.order) {
+		return true
+	}
+	for id := range f.cards {
+		if g.cards[id] {
+			return true
+		}
+	}
+	for id := range f.changed {
+		if g.changed[id] || g.used[id] {
+			return true
+		}
+	}
+	for id := range g.changed {
+		if f.used[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// shares reports whether two events touch any card or column in common at
+// all. It is the looser test used to explain a rebase that didn't apply.
+func (f footprint) shares(g footprint) bool {
+	if f.overlaps(g) {
+		return true
+	}
+	for id := range f.used {
+		if g.used[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeCommand saves event, derived from the board at version base, onto the
+// board's latest version — unless something saved since then overlaps it.
+func (s *server) mergeCommand(w http.ResponseWriter, r *http.Request, boardID uuid.UUID, base int64, before Board, event estoria.EntityEvent[Board]) {
+	ctx := r.Context()
+	mine := footprintOf(event, before)
+
+	for range maxRebases {
+		latest, err := s.live.Load(ctx, boardID, nil)
+		if err != nil {
+			s.writeLoadError(w, err)
+			return
+		}
+
+		theirs, err := readBoardEvents(ctx, s.events, boardID, eventstore.ReadStreamOptions{
+			AfterVersion: base,
+			Count:        latest.Version() - base,
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// replay what was saved since the base, noting what each event touched
+		conflicts, related := map[int64]bool{}, map[int64]bool{}
+		board := before
+		for _, e := range theirs {
+			fp := footprintOf(e.event, board)
+			conflicts[e.version] = fp.overlaps(mine)
+			related[e.version] = fp.shares(mine)
+			if board, err = e.event.ApplyTo(ctx, board); err != nil {
+				writeError(w, http.StatusInternalServerError, fmt.Sprintf("replaying v%d: %v", e.version, err))
+				return
+			}
+		}
+
+		if anyMarked(conflicts) {
+			writeMergeConflict(w, base, latest.Version(), before, theirs, conflicts,
+				"someone else changed the same card or column since you last saw the board")
+			return
+		}
+
+		// no overlap, but the event must still make sense on the new board
+		if _, err := event.ApplyTo(ctx, latest.Entity()); err != nil {
+			writeMergeConflict(w, base, latest.Version(), before, theirs, related, err.Error())
+			return
+		}
+
+		if err := latest.Append(event); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		err = s.live.Save(ctx, latest, nil)
+		var mismatch eventstore.StreamVersionMismatchError
+		if errors.As(err, &mismatch) {
+			continue // moved again while we were merging; go around
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"version": latest.Version(),
+			"merged":  len(theirs),
+		})
+		return
+	}
+
+	writeError(w, http.StatusServiceUnavailable, "the board is changing too fast to merge into; try again")
+}
+
+// writeMergeConflict answers a merge that can't be made with a 409 listing the
+// events saved since the base that stand in the way (all of them, if none is
+// marked), described as the activity feed would.
+func writeMergeConflict(w http.ResponseWriter, base, actual int64, before Board, events []versionedEvent, inTheWay map[int64]bool, message string) {
+	// start from the titles things had at the base, so descriptions name them
+	titles := map[string]string{}
+	for _, col := range before.Columns {
+		titles[col.ID] = col.Title
+		for _, card := range col.Cards {
+			titles[card.ID] = card.Title
+			for _, item := range card.Checklist {
+				titles[item.ID] = item.Text
+			}
+		}
+	}
+
+	none := !anyMarked(inTheWay)
+	conflicts := []activityEntry{}
+	for _, e := range events {
+		// every event is described, so the titles follow along
+		desc := describeEvent(e.raw, titles)
+		if !inTheWay[e.version] && !none {
+			continue
+		}
+		conflicts = append(conflicts, activityEntry{
+			Version:     e.version,
+			Type:        e.raw.ID.Type,
+			Timestamp:   e.timestamp,
+			Description: desc,
+			Actor:       e.actor,
+		})
+	}
+
+	writeJSON(w, http.StatusConflict, map[string]any{
+		"error":           "version_conflict",
+		"expectedVersion": base,
+		"actualVersion":   actual,
+		"message":         message,
+		"conflicts":       conflicts,
+	})
+}
+
+func anyMarked(versions map[int64]bool) bool {
+	for _, marked := range versions {
+		if marked {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeRequested reports whether a command asked for merge mode.
+func mergeRequested(r *http.Request) bool {
+	return r.URL.Query().Get("merge") == "true"
+}
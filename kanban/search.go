@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-estoria/estoria"
+	"github.com/go-estoria/estoria/aggregatestore"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/gofrs/uuid/v5"
+)
+
+// The search index is a read model: tables derived entirely from the board
+// streams, kept in the same SQLite file, and safe to throw away. It holds two
+// FTS5 tables — the cards as they are now, and every title a card has ever
+// had with the version that gave it that title — plus the stream version each
+// board has been indexed up to, so updates only read the events they missed.
+const searchSchema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS card_search USING fts5(
+	board_id UNINDEXED, card_id UNINDEXED, column_id UNINDEXED, title, description
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS card_title_history USING fts5(
+	board_id UNINDEXED, card_id UNINDEXED, version UNINDEXED, title
+);
+CREATE TABLE IF NOT EXISTS card_search_position (
+	board_id TEXT PRIMARY KEY,
+	version  INTEGER NOT NULL
+);`
+
+// maxSearchResults caps each list in a search response.
+const maxSearchResults = 50
+
+// A searchIndex maintains the card search read model. It is updated from the
+// AfterSave hook as boards change, and caught up from the streams on startup,
+// which also covers any update a failed hook missed.
+type searchIndex struct {
+	db     *sql.DB
+	events *upcastingStore
+
+	// boards loads the current board when catching up. It is set after the
+	// store stack is built, since the stack's hook feeds this index.
+	boards aggregatestore.Store[Board]
+
+	// mu serializes updates, so two saves racing on one board can't index
+	// the same events twice.
+	mu sync.Mutex
+}
+
+func newSearchIndex(ctx context.Context, db *sql.DB, events *upcastingStore) (*searchIndex, error) {
+	if _, err := db.ExecContext(ctx, searchSchema); err != nil {
+		return nil, fmt.Errorf("creating search schema: %w", err)
+	}
+	return &searchIndex{db: db, events: events}, nil
+}
+
+// update brings the index for one board up to version: it records the titles
+// set by events it hasn't seen, and replaces the board's current cards.
+func (ix *searchIndex) update(ctx context.Context, board Board, version int64) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	var indexed int64
+	err := ix.db.QueryRowContext(ctx,
+		`SELECT version FROM card_search_position WHERE board_id = ?`, board.ID.String()).Scan(&indexed)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if version <= indexed {
+		return nil // a later save already indexed this version
+	}
+
+	missed, err := readBoardEvents(ctx, ix.events, board.ID, eventstore.ReadStreamOptions{
+		AfterVersion: indexed,
+		Count:        version - indexed,
+	})
+	if err != nil {
+		return fmt.Errorf("reading events %d-%d: %w", indexed+1, version, err)
+	}
+
+	tx, err := ix.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, e := range missed {
+		if cardID, title := titleSetBy(e.event); cardID != "" {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO card_title_history (board_id, card_id, version, title) VALUES (?, ?, ?, ?)`,
+				board.ID.String(), cardID, e.version, title); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM card_search WHERE board_id = ?`, board.ID.String()); err != nil {
+		return err
+	}
+	for _, col := range board.Columns {
+		for _, card := range col.Cards {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO card_search (board_id, card_id, column_id, title, description) VALUES (?, ?, ?, ?, ?)`,
+				board.ID.String(), card.ID, col.ID, card.Title, card.Description); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO card_search_position (board_id, version) VALUES (?, ?)
+		 ON CONFLICT (board_id) DO UPDATE SET version = excluded.version`,
+		board.ID.String(), version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// catchUp indexes every board stream up to its latest version.
+func (ix *searchIndex) catchUp(ctx context.Context) error {
+	streams, err := ix.events.ListStreams(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, stream := range streams {
+		if stream.StreamID.Type != "board" {
+			continue
+		}
+
+		agg, err := ix.boards.Load(ctx, stream.StreamID.UUID, nil)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", stream.StreamID, err)
+		}
+		if err := ix.update(ctx, agg.Entity(), agg.Version()); err != nil {
+			return fmt.Errorf("indexing %s: %w", stream.StreamID, err)
+		}
+	}
+
+	return nil
+}
+
+// clear empties the index. Rebuilding it from scratch is clear followed by
+// catchUp: nothing is in the read model that the streams can't reproduce.
+func (ix *searchIndex) clear(ctx context.Context) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	for _, table := range []string{"card_search", "card_title_history", "card_search_position"} {
+		if _, err := ix.db.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+			return fmt.Errorf("clearing table %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// titleSetBy returns the card whose title an event sets, and that title.
+func titleSetBy(e estoria.EntityEvent[Board]) (cardID, title string) {
+	switch e := e.(type) {
+	case CardAdded:
+		return e.CardID, e.Title
+	case CardEdited:
+		return e.CardID, e.Title
+	case CardRestored:
+		return e.Card.ID, e.Card.Title
+	}
+	return "", ""
+}
+
+// A searchHit is a card that matches now.
+type searchHit struct {
+	CardID      string `json:"cardId"`
+	ColumnID    string `json:"columnId"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+// A pastTitleHit is a card whose title matched at some version, but doesn't
+// any more. CurrentTitle is empty if the card has since been removed.
+type pastTitleHit struct {
+	CardID       string `json:"cardId"`
+	Title        string `json:"title"`
+	Version      int64  `json:"version"`
+	CurrentTitle string `json:"currentTitle,omitempty"`
+}
+
+// handleSearch answers GET /api/boards/{id}/search?q=… with the cards that
+// match now, and with history=true, the cards whose past titles matched.
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	query := ftsQuery(r.URL.Query().Get("q"))
+	results := struct {
+		Cards      []searchHit    `json:"cards"`
+		PastTitles []pastTitleHit `json:"pastTitles,omitempty"`
+	}{Cards: []searchHit{}}
+
+	if query == "" {
+		writeJSON(w, http.StatusOK, results)
+		return
+	}
+
+	var err error
+	if results.Cards, err = s.search.current(ctx, boardID, query); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("history") == "true" {
+		if results.PastTitles, err = s.search.pastTitles(ctx, boardID, query); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (ix *searchIndex) current(ctx context.Context, boardID uuid.UUID, query string) ([]searchHit, error) {
+	rows, err := ix.db.QueryContext(ctx,
+		`SELECT card_id, column_id, title, description FROM card_search
+		 WHERE card_search MATCH ? AND board_id = ?
+		 ORDER BY rank LIMIT ?`,
+		query, boardID.String(), maxSearchResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := []searchHit{}
+	for rows.Next() {
+		var hit searchHit
+		if err := rows.Scan(&hit.CardID, &hit.ColumnID, &hit.Title, &hit.Description); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// pastTitles finds titles that matched at some version but are no longer the
+// card's title, earliest version first for each.
+func (ix *searchIndex) pastTitles(ctx context.Context, boardID uuid.UUID, query string) ([]pastTitleHit, error) {
+	rows, err := ix.db.QueryContext(ctx,
+		`SELECT card_title_history.card_id, card_title_history.title,
+		        MIN(CAST(card_title_history.version AS INTEGER)) AS first_version,
+		        COALESCE(c.title, '')
+		 FROM card_title_history
+		 LEFT JOIN card_search c
+		   ON c.board_id = card_title_history.board_id AND c.card_id = card_title_history.card_id
+		 WHERE card_title_history MATCH ? AND card_title_history.board_id = ?
+		   AND (c.title IS NULL OR c.title != card_title_history.title)
+		 GROUP BY card_title_history.card_id, card_title_history.title
+		 ORDER BY first_version LIMIT ?`,
+		query, boardID.String(), maxSearchResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := []pastTitleHit{}
+	for rows.Next() {
+		var hit pastTitleHit
+		if err := rows.Scan(&hit.CardID, &hit.Title, &hit.Version, &hit.CurrentTitle); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// ftsQuery turns what someone typed into an FTS5 query: each word is quoted,
+// so punctuation can't be read as query syntax, and the last one matches as a
+// prefix, so results appear while the word is still being typed.
+func ftsQuery(q string) string {
+	words := strings.Fields(q)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	if len(words) > 0 {
+		words[len(words)-1] += "*"
+	}
+	return strings.Join(words, " ")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"embed"
@@ -10,16 +11,17 @@ import (
 	"io"
 	"io/fs"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-estoria/estoria"
-	sqlstore "github.com/go-estoria/estoria-contrib/sqlite/eventstore"
 	"github.com/go-estoria/estoria/aggregatestore"
 	"github.com/go-estoria/estoria/eventstore"
 	"github.com/go-estoria/estoria/eventstore/projection"
+	"github.com/go-estoria/estoria/snapshotstore"
 	"github.com/go-estoria/estoria/typeid"
 	"github.com/gofrs/uuid/v5"
 )
@@ -28,8 +30,6 @@ import (
 var webFiles embed.FS
 
 type server struct {
-	boardID uuid.UUID
-
 	// live is the fully-decorated store (hooks -> snapshotting -> event-sourced)
 	// used for latest-state reads and for saving commands.
 	live aggregatestore.Store[Board]
@@ -40,12 +40,26 @@ type server struct {
 	// snapshot and therefore cannot serve reads pinned to an older version.
 	history aggregatestore.Store[Board]
 
-	// events is the raw event store, used for stream-level reads (activity
-	// feed, stats) that don't need an aggregate.
-	events *sqlstore.EventStore
+	// threads stores card comment threads, each in its own stream alongside
+	// the boards in the same event store (see CardThread).
+	threads aggregatestore.Store[CardThread]
+
+	// search is the card search read model (see search.go).
+	search *searchIndex
+
+	// webhooks stores webhook subscriptions, and webhookWorker delivers
+	// board events to them (see webhook_delivery.go).
+	webhooks      aggregatestore.Store[Webhook]
+	webhookWorker *webhookWorker
+
+	// events is the event store below the aggregate stores, used for
+	// stream-level reads (activity feed, stats) that don't need an aggregate.
+	// It upcasts what it reads to the current event schemas (see upcast.go).
+	events *upcastingStore
 
-	// db is the underlying database handle, used only by the demo reset
-	// (see demo.go) to clear storage directly.
+	// db is the underlying database handle, for the few writes that go
+	// around the event store: the demo reset clearing storage (see demo.go),
+	// and pruning old snapshots (see handlePruneSnapshots).
 	db *sql.DB
 
 	// resetMu is held for writing while the demo reset clears and reseeds the
@@ -53,24 +67,70 @@ type server struct {
 	// normal operation: without -hourly-reset nothing ever takes the write side.
 	resetMu sync.RWMutex
 
-	hub           *hub
-	snapshotEvery int64
+	// snapshots is the store the snapshotting store writes to, used directly
+	// to take snapshots on demand (see snapshots.go).
+	snapshots snapshotstore.SnapshotStore
+
+	// snapshotPolicy is the policy the snapshotting store was built with.
+	snapshotPolicy snapshotPolicy
+
+	hub *hub
 }
 
 func (s *server) routes() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("GET /api/board", s.handleGetBoard)
-	mux.HandleFunc("POST /api/board/rename", s.handleRenameBoard)
-	mux.HandleFunc("POST /api/columns", s.handleAddColumn)
-	mux.HandleFunc("POST /api/columns/{id}/rename", s.handleRenameColumn)
-	mux.HandleFunc("POST /api/cards", s.handleAddCard)
-	mux.HandleFunc("POST /api/cards/{id}/edit", s.handleEditCard)
-	mux.HandleFunc("POST /api/cards/{id}/move", s.handleMoveCard)
-	mux.HandleFunc("POST /api/cards/{id}/delete", s.handleDeleteCard)
-	mux.HandleFunc("GET /api/activity", s.handleActivity)
-	mux.HandleFunc("GET /api/stats", s.handleStats)
-	mux.HandleFunc("GET /api/watch", s.handleWatch)
+	mux.HandleFunc("GET /api/identity", s.handleGetIdentity)
+	mux.HandleFunc("POST /api/identity", s.handleSetIdentity)
+	mux.HandleFunc("GET /api/templates", s.handleListTemplates)
+	mux.HandleFunc("GET /api/boards", s.handleListBoards)
+	mux.HandleFunc("POST /api/boards", s.handleCreateBoard)
+	mux.HandleFunc("POST /api/boards/import", s.handleImport)
+	mux.HandleFunc("GET /api/boards/{id}", s.handleGetBoard)
+	mux.HandleFunc("POST /api/boards/{id}/rename", s.handleRenameBoard)
+	mux.HandleFunc("POST /api/boards/{id}/columns", s.handleAddColumn)
+	mux.HandleFunc("POST /api/boards/{id}/columns/{columnId}/rename", s.handleRenameColumn)
+	mux.HandleFunc("POST /api/boards/{id}/columns/{columnId}/move", s.handleMoveColumn)
+	mux.HandleFunc("POST /api/boards/{id}/columns/{columnId}/wip-limit", s.handleSetWIPLimit)
+	mux.HandleFunc("POST /api/boards/{id}/columns/{columnId}/delete", s.handleRemoveColumn)
+	mux.HandleFunc("POST /api/boards/{id}/cards", s.handleAddCard)
+	mux.HandleFunc("POST /api/boards/{id}/cards/{cardId}/edit", s.handleEditCard)
+	mux.HandleFunc("POST /api/boards/{id}/cards/{cardId}/move", s.handleMoveCard)
+	mux.HandleFunc("POST /api/boards/{id}/cards/{cardId}/archive", s.handleArchiveCard)
+	mux.HandleFunc("POST /api/boards/{id}/cards/{cardId}/restore", s.handleRestoreCard)
+	mux.HandleFunc("POST /api/boards/{id}/cards/{cardId}/delete", s.handleDeleteCard)
+	mux.HandleFunc("POST /api/boards/{id}/cards/{cardId}/assign", s.handleAssignCard)
+	mux.HandleFunc("POST /api/boards/{id}/cards/{cardId}/unassign", s.handleUnassignCard)
+	mux.HandleFunc("POST /api/boards/{id}/cards/{cardId}/labels", s.handleLabelCard)
+	mux.HandleFunc("POST /api/boards/{id}/cards/{cardId}/due-date", s.handleSetDueDate)
+	mux.HandleFunc("POST /api/boards/{id}/cards/{cardId}/checklist", s.handleAddChecklistItem)
+	mux.HandleFunc("POST /api/boards/{id}/cards/{cardId}/checklist/{itemId}/toggle", s.handleToggleChecklistItem)
+	mux.HandleFunc("GET /api/boards/{id}/cards/{cardId}/comments", s.handleListComments)
+	mux.HandleFunc("POST /api/boards/{id}/cards/{cardId}/comments", s.handlePostComment)
+	mux.HandleFunc("POST /api/boards/{id}/cards/{cardId}/comments/{commentId}/edit", s.handleEditComment)
+	mux.HandleFunc("POST /api/boards/{id}/cards/{cardId}/comments/{commentId}/delete", s.handleDeleteComment)
+	mux.HandleFunc("POST /api/boards/{id}/undo", s.handleUndo)
+	mux.HandleFunc("POST /api/boards/{id}/redo", s.handleRedo)
+	mux.HandleFunc("POST /api/boards/{id}/clone", s.handleClone)
+	mux.HandleFunc("GET /api/boards/{id}/search", s.handleSearch)
+	mux.HandleFunc("GET /api/boards/{id}/analytics/flow", s.handleFlow)
+	mux.HandleFunc("GET /api/boards/{id}/analytics/cycle-time", s.handleCycleTime)
+	mux.HandleFunc("GET /api/boards/{id}/export", s.handleExport)
+	mux.HandleFunc("GET /api/boards/{id}/diff", s.handleDiff)
+	mux.HandleFunc("GET /api/boards/{id}/activity", s.handleActivity)
+	mux.HandleFunc("GET /api/boards/{id}/stats", s.handleStats)
+	mux.HandleFunc("GET /api/boards/{id}/watch", s.handleWatch)
+	mux.HandleFunc("GET /api/boards/{id}/archive", s.handleListArchive)
+	mux.HandleFunc("GET /api/boards/{id}/snapshots", s.handleListSnapshots)
+	mux.HandleFunc("POST /api/boards/{id}/snapshots", s.handleTakeSnapshot)
+	mux.HandleFunc("DELETE /api/boards/{id}/snapshots", s.handlePruneSnapshots)
+	mux.HandleFunc("GET /api/boards/{id}/webhooks", s.handleListWebhooks)
+	mux.HandleFunc("POST /api/boards/{id}/webhooks", s.handleCreateWebhook)
+	mux.HandleFunc("GET /api/webhooks/{id}", s.handleGetWebhook)
+	mux.HandleFunc("POST /api/webhooks/{id}/enable", s.handleEnableWebhook)
+	mux.HandleFunc("POST /api/webhooks/{id}/disable", s.handleDisableWebhook)
+	mux.HandleFunc("POST /api/webhooks/{id}/delete", s.handleDeleteWebhook)
+	mux.HandleFunc("GET /api/webhooks/{id}/deliveries", s.handleListDeliveries)
 
 	web, err := fs.Sub(webFiles, "web")
 	if err != nil {
@@ -78,21 +138,128 @@ func (s *server) routes() http.Handler {
 	}
 	mux.Handle("GET /", http.FileServerFS(web))
 
-	return mux
+	return withIdentity(mux)
 }
 
-// boardMessage is the payload for board reads and SSE updates.
+// boardMessage is the payload for board reads, and the full-board SSE message
+// (with Type "board"; see watch.go).
 type boardMessage struct {
-	Version int64 `json:"version"`
-	Live    bool  `json:"live"`
-	Board   Board `json:"board"`
+	Type    string `json:"type,omitempty"`
+	Version int64  `json:"version"`
+	Live    bool   `json:"live"`
+	Board   Board  `json:"board"`
 }
 
-// handleGetBoard returns the board at its latest version, or, when the
-// "version" query parameter is provided, at that historical version.
+// boardSummary is one row in the board lobby.
+type boardSummary struct {
+	BoardID string `json:"boardId"`
+	Name    string `json:"name"`
+	Columns int    `json:"columns"`
+	Cards   int    `json:"cards"`
+	Version int64  `json:"version"`
+}
+
+// handleListBoards builds the lobby by listing every "board" stream in the
+// event store and loading each aggregate. The snapshotting store makes each
+// load cheap; a lobby over thousands of boards would want a read model
+// projected from the streams instead.
+func (s *server) handleListBoards(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	s.resetMu.RLock()
+	defer s.resetMu.RUnlock()
+
+	streams, err := s.events.ListStreams(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	summaries := []boardSummary{}
+	for _, stream := range streams {
+		if stream.StreamID.Type != "board" {
+			continue
+		}
+
+		agg, err := s.live.Load(ctx, stream.StreamID.UUID, nil)
+		if err != nil {
+			estoria.GetLogger().Error("loading board for lobby", "stream_id", stream.StreamID, "error", err)
+			continue
+		}
+
+		board := agg.Entity()
+		summary := boardSummary{
+			BoardID: board.ID.String(),
+			Name:    board.Name,
+			Columns: len(board.Columns),
+			Version: agg.Version(),
+		}
+		for _, col := range board.Columns {
+			summary.Cards += len(col.Cards)
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return strings.ToLower(summaries[i].Name) < strings.ToLower(summaries[j].Name)
+	})
+
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+// handleCreateBoard starts a new board stream: an empty board, which begins
+// with nothing but its BoardCreated event, or one from a template in the
+// catalog (see clone.go). A board from a template is named after it unless
+// the request names it.
+func (s *server) handleCreateBoard(w http.ResponseWriter, r *http.Request) {
+	s.resetMu.RLock()
+	defer s.resetMu.RUnlock()
+
+	req, err := readJSON[struct {
+		Name     string `json:"name"`
+		Template string `json:"template"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var template boardTemplate
+	if req.Template != "" {
+		var ok bool
+		if template, ok = templateByID(req.Template); !ok {
+			writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("no template %q", req.Template))
+			return
+		}
+		req.Name = cmp.Or(strings.TrimSpace(req.Name), template.Name)
+	}
+
+	name, err := requireTitle(req.Name, "board name")
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	agg, err := s.createBoard(r.Context(), rebuildEvents(template.Board, name))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, boardMessage{Version: agg.Version(), Live: true, Board: agg.Entity().rendered()})
+}
+
+// handleGetBoard returns the board at its latest version, or at a historical
+// one: the "version" query parameter names it directly, and "at" (an RFC 3339
+// timestamp) names the last version at or before that instant.
 func (s *server) handleGetBoard(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
 	s.resetMu.RLock()
 	defer s.resetMu.RUnlock()
 
@@ -100,18 +267,35 @@ func (s *server) handleGetBoard(w http.ResponseWriter, r *http.Request) {
 	var err error
 	live := true
 
-	if v := r.URL.Query().Get("version"); v != "" {
-		version, parseErr := strconv.ParseInt(v, 10, 64)
-		if parseErr != nil || version < 1 {
-			writeError(w, http.StatusBadRequest, "version must be a positive integer")
-			return
+	v, at := r.URL.Query().Get("version"), r.URL.Query().Get("at")
+	if v != "" && at != "" {
+		writeError(w, http.StatusBadRequest, "give version or at, not both")
+		return
+	}
+
+	if v != "" || at != "" {
+		var version int64
+		if v != "" {
+			var parseErr error
+			if version, parseErr = strconv.ParseInt(v, 10, 64); parseErr != nil || version < 1 {
+				writeError(w, http.StatusBadRequest, "version must be a positive integer")
+				return
+			}
+		} else {
+			if _, parseErr := time.Parse(time.RFC3339, at); parseErr != nil {
+				writeError(w, http.StatusBadRequest, "at must be a timestamp like 2006-01-02T15:04:05Z")
+				return
+			}
+			if version, ok = s.boardPoint(w, r, boardID, "at", at); !ok {
+				return
+			}
 		}
 
 		// time travel: hydrate the aggregate only up to the requested version
 		live = false
-		agg, err = s.history.Load(ctx, s.boardID, &aggregatestore.LoadOptions{ToVersion: version})
+		agg, err = s.history.Load(ctx, boardID, &aggregatestore.LoadOptions{ToVersion: version})
 	} else {
-		agg, err = s.live.Load(ctx, s.boardID, nil)
+		agg, err = s.live.Load(ctx, boardID, nil)
 	}
 
 	if err != nil {
@@ -119,7 +303,7 @@ func (s *server) handleGetBoard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusOK, boardMessage{Version: agg.Version(), Live: live, Board: agg.Entity()})
+	writeJSON(w, http.StatusOK, boardMessage{Version: agg.Version(), Live: live, Board: agg.Entity().rendered()})
 }
 
 // A commandFunc validates a command against the board state it is based on
@@ -131,10 +315,13 @@ type commandFunc func(board Board) (estoria.EntityEvent[Board], error)
 //  1. Load the board at the version the client last saw (baseVersion). When
 //     the stream has advanced past it, saving will fail the ExpectVersion
 //     check — real optimistic concurrency, not a simulated check.
-//  2. Validate the command against that state and derive an event.
+//  2. Derive the event and pre-flight it through its own ApplyTo against that
+//     state. Board rules such as WIP limits live in ApplyTo, so a command that
+//     breaks one is rejected here with a 422 — before anything is written.
 //  3. Append the event and save. On a version conflict, respond 409 so the
-//     client can refresh and retry.
-func (s *server) runCommand(w http.ResponseWriter, r *http.Request, baseVersion int64, cmd commandFunc) {
+//     client can refresh and retry — or, in merge mode, try to rebase the
+//     event onto the latest version first (see merge.go).
+func (s *server) runCommand(w http.ResponseWriter, r *http.Request, boardID uuid.UUID, baseVersion int64, cmd commandFunc) {
 	ctx := r.Context()
 
 	// Held for the whole load-validate-save cycle so a demo reset can't clear
@@ -145,9 +332,9 @@ func (s *server) runCommand(w http.ResponseWriter, r *http.Request, baseVersion
 	var agg *aggregatestore.Aggregate[Board]
 	var err error
 	if baseVersion > 0 {
-		agg, err = s.history.Load(ctx, s.boardID, &aggregatestore.LoadOptions{ToVersion: baseVersion})
+		agg, err = s.history.Load(ctx, boardID, &aggregatestore.LoadOptions{ToVersion: baseVersion})
 	} else {
-		agg, err = s.live.Load(ctx, s.boardID, nil)
+		agg, err = s.live.Load(ctx, boardID, nil)
 	}
 	if err != nil {
 		s.writeLoadError(w, err)
@@ -160,6 +347,14 @@ func (s *server) runCommand(w http.ResponseWriter, r *http.Request, baseVersion
 		return
 	}
 
+	// pre-flight: estoria applies events on save, after they are written, so
+	// an event the domain rejects must never reach the stream
+	if _, err := event.ApplyTo(ctx, agg.Entity()); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	base, before := agg.Version(), agg.Entity()
 	if err := agg.Append(event); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -167,7 +362,10 @@ func (s *server) runCommand(w http.ResponseWriter, r *http.Request, baseVersion
 
 	if err := s.live.Save(ctx, agg, nil); err != nil {
 		var mismatch eventstore.StreamVersionMismatchError
-		if errors.As(err, &mismatch) {
+		if errors.As(err, &mismatch) && mergeRequested(r) {
+			s.mergeCommand(w, r, boardID, base, before, event)
+			return
+		} else if errors.As(err, &mismatch) {
 			writeJSON(w, http.StatusConflict, map[string]any{
 				"error":           "version_conflict",
 				"expectedVersion": mismatch.ExpectedVersion,
@@ -187,6 +385,11 @@ func (s *server) runCommand(w http.ResponseWriter, r *http.Request, baseVersion
 }
 
 func (s *server) handleRenameBoard(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
 	req, err := readJSON[struct {
 		BaseVersion int64  `json:"baseVersion"`
 		Name        string `json:"name"`
@@ -196,7 +399,7 @@ func (s *server) handleRenameBoard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.runCommand(w, r, req.BaseVersion, func(Board) (estoria.EntityEvent[Board], error) {
+	s.runCommand(w, r, boardID, req.BaseVersion, func(Board) (estoria.EntityEvent[Board], error) {
 		name, err := requireTitle(req.Name, "board name")
 		if err != nil {
 			return nil, err
@@ -206,6 +409,11 @@ func (s *server) handleRenameBoard(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *server) handleAddColumn(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
 	req, err := readJSON[struct {
 		BaseVersion int64  `json:"baseVersion"`
 		Title       string `json:"title"`
@@ -215,7 +423,7 @@ func (s *server) handleAddColumn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.runCommand(w, r, req.BaseVersion, func(Board) (estoria.EntityEvent[Board], error) {
+	s.runCommand(w, r, boardID, req.BaseVersion, func(Board) (estoria.EntityEvent[Board], error) {
 		title, err := requireTitle(req.Title, "column title")
 		if err != nil {
 			return nil, err
@@ -225,7 +433,12 @@ func (s *server) handleAddColumn(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *server) handleRenameColumn(w http.ResponseWriter, r *http.Request) {
-	columnID := r.PathValue("id")
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	columnID := r.PathValue("columnId")
 	req, err := readJSON[struct {
 		BaseVersion int64  `json:"baseVersion"`
 		Title       string `json:"title"`
@@ -235,7 +448,7 @@ func (s *server) handleRenameColumn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.runCommand(w, r, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
 		title, err := requireTitle(req.Title, "column title")
 		if err != nil {
 			return nil, err
@@ -247,24 +460,113 @@ func (s *server) handleRenameColumn(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *server) handleMoveColumn(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	columnID := r.PathValue("columnId")
+	req, err := readJSON[struct {
+		BaseVersion int64 `json:"baseVersion"`
+		ToIndex     int   `json:"toIndex"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+		if !board.HasColumn(columnID) {
+			return nil, fmt.Errorf("column %s does not exist", columnID)
+		}
+		return ColumnMoved{ColumnID: columnID, ToIndex: req.ToIndex}, nil
+	})
+}
+
+func (s *server) handleSetWIPLimit(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	columnID := r.PathValue("columnId")
+	req, err := readJSON[struct {
+		BaseVersion int64 `json:"baseVersion"`
+		Limit       int   `json:"limit"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+		if !board.HasColumn(columnID) {
+			return nil, fmt.Errorf("column %s does not exist", columnID)
+		}
+		return ColumnWIPLimitSet{ColumnID: columnID, Limit: req.Limit}, nil
+	})
+}
+
+// handleRemoveColumn deletes a column. When the column still holds cards the
+// request must name a column to receive them ("moveCardsTo"); the event itself
+// enforces that, so a board replayed from its stream can never lose a card.
+func (s *server) handleRemoveColumn(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	columnID := r.PathValue("columnId")
+	req, err := readJSON[struct {
+		BaseVersion int64  `json:"baseVersion"`
+		MoveCardsTo string `json:"moveCardsTo"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+		if !board.HasColumn(columnID) {
+			return nil, fmt.Errorf("column %s does not exist", columnID)
+		}
+		return ColumnRemoved{ColumnID: columnID, MoveCardsTo: req.MoveCardsTo}, nil
+	})
+}
+
 func (s *server) handleAddCard(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
 	req, err := readJSON[struct {
 		BaseVersion int64  `json:"baseVersion"`
 		ColumnID    string `json:"columnId"`
 		Title       string `json:"title"`
 		Description string `json:"description"`
 		Color       string `json:"color"`
+		ColorLabel  string `json:"colorLabel"`
 	}](r)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	s.runCommand(w, r, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
 		title, err := requireTitle(req.Title, "card title")
 		if err != nil {
 			return nil, err
 		}
+		description, err := requireDescription(req.Description)
+		if err != nil {
+			return nil, err
+		}
+		color, err := cardColor(req.Color, req.ColorLabel)
+		if err != nil {
+			return nil, err
+		}
 		if !board.HasColumn(req.ColumnID) {
 			return nil, fmt.Errorf("column %s does not exist", req.ColumnID)
 		}
@@ -272,44 +574,63 @@ func (s *server) handleAddCard(w http.ResponseWriter, r *http.Request) {
 			CardID:      typeid.NewV7("card").String(),
 			ColumnID:    req.ColumnID,
 			Title:       title,
-			Description: strings.TrimSpace(req.Description),
-			Color:       req.Color,
+			Description: description,
+			Color:       color,
 		}, nil
 	})
 }
 
 func (s *server) handleEditCard(w http.ResponseWriter, r *http.Request) {
-	cardID := r.PathValue("id")
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	cardID := r.PathValue("cardId")
 	req, err := readJSON[struct {
 		BaseVersion int64  `json:"baseVersion"`
 		Title       string `json:"title"`
 		Description string `json:"description"`
 		Color       string `json:"color"`
+		ColorLabel  string `json:"colorLabel"`
 	}](r)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	s.runCommand(w, r, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
 		title, err := requireTitle(req.Title, "card title")
 		if err != nil {
 			return nil, err
 		}
+		description, err := requireDescription(req.Description)
+		if err != nil {
+			return nil, err
+		}
+		color, err := cardColor(req.Color, req.ColorLabel)
+		if err != nil {
+			return nil, err
+		}
 		if !board.HasCard(cardID) {
 			return nil, fmt.Errorf("card %s does not exist", cardID)
 		}
 		return CardEdited{
 			CardID:      cardID,
 			Title:       title,
-			Description: strings.TrimSpace(req.Description),
-			Color:       req.Color,
+			Description: description,
+			Color:       color,
 		}, nil
 	})
 }
 
 func (s *server) handleMoveCard(w http.ResponseWriter, r *http.Request) {
-	cardID := r.PathValue("id")
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	cardID := r.PathValue("cardId")
 	req, err := readJSON[struct {
 		BaseVersion int64  `json:"baseVersion"`
 		ToColumnID  string `json:"toColumnId"`
@@ -320,7 +641,7 @@ func (s *server) handleMoveCard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.runCommand(w, r, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
 		if !board.HasCard(cardID) {
 			return nil, fmt.Errorf("card %s does not exist", cardID)
 		}
@@ -331,8 +652,13 @@ func (s *server) handleMoveCard(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (s *server) handleDeleteCard(w http.ResponseWriter, r *http.Request) {
-	cardID := r.PathValue("id")
+func (s *server) handleArchiveCard(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	cardID := r.PathValue("cardId")
 	req, err := readJSON[struct {
 		BaseVersion int64 `json:"baseVersion"`
 	}](r)
@@ -341,29 +667,241 @@ func (s *server) handleDeleteCard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.runCommand(w, r, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
 		if !board.HasCard(cardID) {
 			return nil, fmt.Errorf("card %s does not exist", cardID)
 		}
+		return CardArchived{CardID: cardID}, nil
+	})
+}
+
+// handleDeleteCard purges a card from the archive. A card on the board has to
+// be archived first.
+func (s *server) handleDeleteCard(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	cardID := r.PathValue("cardId")
+	req, err := readJSON[struct {
+		BaseVersion int64 `json:"baseVersion"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+		if board.HasCard(cardID) {
+			return nil, fmt.Errorf("card %s must be archived before it is deleted", cardID)
+		}
+		if !board.IsArchived(cardID) {
+			return nil, fmt.Errorf("card %s is not in the archive", cardID)
+		}
 		return CardRemoved{CardID: cardID}, nil
 	})
 }
 
+func (s *server) handleAssignCard(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	cardID := r.PathValue("cardId")
+	req, err := readJSON[struct {
+		BaseVersion int64  `json:"baseVersion"`
+		Assignee    string `json:"assignee"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+		assignee, err := requireTitle(req.Assignee, "assignee")
+		if err != nil {
+			return nil, err
+		}
+		if !board.HasCard(cardID) {
+			return nil, fmt.Errorf("card %s does not exist", cardID)
+		}
+		return CardAssigned{CardID: cardID, Assignee: assignee}, nil
+	})
+}
+
+func (s *server) handleUnassignCard(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	cardID := r.PathValue("cardId")
+	req, err := readJSON[struct {
+		BaseVersion int64  `json:"baseVersion"`
+		Assignee    string `json:"assignee"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+		if !board.HasCard(cardID) {
+			return nil, fmt.Errorf("card %s does not exist", cardID)
+		}
+		return CardUnassigned{CardID: cardID, Assignee: strings.TrimSpace(req.Assignee)}, nil
+	})
+}
+
+// handleLabelCard replaces a card's labels. Labels are trimmed and
+// de-duplicated (case-insensitively, keeping the first spelling) before they
+// are recorded, so the event holds exactly what the card will show.
+func (s *server) handleLabelCard(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	cardID := r.PathValue("cardId")
+	req, err := readJSON[struct {
+		BaseVersion int64    `json:"baseVersion"`
+		Labels      []string `json:"labels"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+		if !board.HasCard(cardID) {
+			return nil, fmt.Errorf("card %s does not exist", cardID)
+		}
+
+		labels := []string{}
+		seen := map[string]bool{}
+		for _, raw := range req.Labels {
+			if strings.TrimSpace(raw) == "" {
+				continue
+			}
+			label, err := requireTitle(raw, "label")
+			if err != nil {
+				return nil, err
+			}
+			if key := strings.ToLower(label); !seen[key] {
+				seen[key] = true
+				labels = append(labels, label)
+			}
+		}
+		if len(labels) > maxLabels {
+			return nil, fmt.Errorf("a card can have at most %d labels", maxLabels)
+		}
+
+		return CardLabeled{CardID: cardID, Labels: labels}, nil
+	})
+}
+
+func (s *server) handleSetDueDate(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	cardID := r.PathValue("cardId")
+	req, err := readJSON[struct {
+		BaseVersion int64  `json:"baseVersion"`
+		DueDate     string `json:"dueDate"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+		if !board.HasCard(cardID) {
+			return nil, fmt.Errorf("card %s does not exist", cardID)
+		}
+		return CardDueDateSet{CardID: cardID, DueDate: strings.TrimSpace(req.DueDate)}, nil
+	})
+}
+
+func (s *server) handleAddChecklistItem(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	cardID := r.PathValue("cardId")
+	req, err := readJSON[struct {
+		BaseVersion int64  `json:"baseVersion"`
+		Text        string `json:"text"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+		text, err := requireTitle(req.Text, "checklist item")
+		if err != nil {
+			return nil, err
+		}
+		if !board.HasCard(cardID) {
+			return nil, fmt.Errorf("card %s does not exist", cardID)
+		}
+		return ChecklistItemAdded{CardID: cardID, ItemID: typeid.NewV7("item").String(), Text: text}, nil
+	})
+}
+
+func (s *server) handleToggleChecklistItem(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	cardID, itemID := r.PathValue("cardId"), r.PathValue("itemId")
+	req, err := readJSON[struct {
+		BaseVersion int64 `json:"baseVersion"`
+		Done        bool  `json:"done"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.runCommand(w, r, boardID, req.BaseVersion, func(board Board) (estoria.EntityEvent[Board], error) {
+		if !board.HasCard(cardID) {
+			return nil, fmt.Errorf("card %s does not exist", cardID)
+		}
+		return ChecklistItemToggled{CardID: cardID, ItemID: itemID, Done: req.Done}, nil
+	})
+}
+
 // activityEntry is one row in the activity feed: a stream event rendered as a
-// human-readable description.
+// human-readable description, with who appended it when that was recorded.
 type activityEntry struct {
 	Version     int64     `json:"version"`
 	Type        string    `json:"type"`
 	Timestamp   time.Time `json:"timestamp"`
 	Description string    `json:"description"`
+	Actor       string    `json:"actor,omitempty"`
+	RequestID   string    `json:"requestId,omitempty"`
 }
 
 // handleActivity projects the board's event stream into a human-readable
 // history. Titles are tracked as the projection advances so that each entry
-// describes cards and columns by the names they had at that moment.
+// describes cards and columns by the names they had at that moment. The
+// "actor" query parameter keeps only that actor's entries; the titles still
+// follow every event, so the names stay right.
 func (s *server) handleActivity(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	streamID := typeid.New("board", s.boardID)
+
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+	streamID := typeid.New("board", boardID)
 
 	iter, err := s.events.ReadStream(ctx, streamID, eventstore.ReadStreamOptions{})
 	if errors.Is(err, eventstore.ErrStreamNotFound) {
@@ -383,14 +921,20 @@ func (s *server) handleActivity(w http.ResponseWriter, r *http.Request) {
 
 	titles := map[string]string{} // card/column ID -> title as of the current event
 	entries := []activityEntry{}
+	actor := normalizeActor(r.URL.Query().Get("actor"))
 
 	if _, err := proj.Project(ctx, projection.EventHandlerFunc(func(_ context.Context, evt *eventstore.Event) error {
-		entries = append(entries, activityEntry{
+		entry := activityEntry{
 			Version:     evt.StreamVersion,
 			Type:        evt.ID.Type,
 			Timestamp:   evt.Timestamp,
 			Description: describeEvent(evt, titles),
-		})
+			Actor:       evt.Metadata[actorMetadataKey],
+			RequestID:   evt.Metadata[requestIDMetadataKey],
+		}
+		if actor == "" || strings.EqualFold(entry.Actor, actor) {
+			entries = append(entries, entry)
+		}
 		return nil
 	})); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
@@ -402,7 +946,20 @@ func (s *server) handleActivity(w http.ResponseWriter, r *http.Request) {
 
 // describeEvent renders a stream event as prose, using (and updating) the
 // running ID->title map so descriptions use historically-correct names.
+// Compensating events appended by undo and redo say which version they revert.
 func describeEvent(evt *eventstore.Event, titles map[string]string) string {
+	desc := describeChange(evt, titles)
+
+	var compensating struct {
+		Reverts int64 `json:"reverts"`
+	}
+	if json.Unmarshal(evt.Data, &compensating) == nil && compensating.Reverts > 0 {
+		return fmt.Sprintf("reverted v%d: %s", compensating.Reverts, desc)
+	}
+	return desc
+}
+
+func describeChange(evt *eventstore.Event, titles map[string]string) string {
 	unmarshal := func(dst any) bool { return json.Unmarshal(evt.Data, dst) == nil }
 
 	switch evt.ID.Type {
@@ -429,6 +986,28 @@ func describeEvent(evt *eventstore.Event, titles map[string]string) string {
 			titles[e.ColumnID] = e.Title
 			return fmt.Sprintf("renamed column %q to %q", old, e.Title)
 		}
+	case ColumnRemoved{}.EventType():
+		var e ColumnRemoved
+		if unmarshal(&e) {
+			if e.MoveCardsTo != "" {
+				return fmt.Sprintf("removed column %q, moving its cards to %q",
+					titleOr(titles, e.ColumnID, "a column"), titleOr(titles, e.MoveCardsTo, "a column"))
+			}
+			return fmt.Sprintf("removed column %q", titleOr(titles, e.ColumnID, "a column"))
+		}
+	case ColumnMoved{}.EventType():
+		var e ColumnMoved
+		if unmarshal(&e) {
+			return fmt.Sprintf("moved column %q to position %d", titleOr(titles, e.ColumnID, "a column"), e.ToIndex+1)
+		}
+	case ColumnWIPLimitSet{}.EventType():
+		var e ColumnWIPLimitSet
+		if unmarshal(&e) {
+			if e.Limit == 0 {
+				return fmt.Sprintf("removed the WIP limit from %q", titleOr(titles, e.ColumnID, "a column"))
+			}
+			return fmt.Sprintf("set a WIP limit of %d on %q", e.Limit, titleOr(titles, e.ColumnID, "a column"))
+		}
 	case CardAdded{}.EventType():
 		var e CardAdded
 		if unmarshal(&e) {
@@ -451,10 +1030,66 @@ func describeEvent(evt *eventstore.Event, titles map[string]string) string {
 			return fmt.Sprintf("moved %q to %q",
 				titleOr(titles, e.CardID, "a card"), titleOr(titles, e.ToColumn, "a column"))
 		}
+	case CardArchived{}.EventType():
+		var e CardArchived
+		if unmarshal(&e) {
+			return fmt.Sprintf("archived %q", titleOr(titles, e.CardID, "a card"))
+		}
 	case CardRemoved{}.EventType():
 		var e CardRemoved
 		if unmarshal(&e) {
-			return fmt.Sprintf("removed %q", titleOr(titles, e.CardID, "a card"))
+			if e.FromBoard {
+				return fmt.Sprintf("removed %q", titleOr(titles, e.CardID, "a card"))
+			}
+			return fmt.Sprintf("deleted %q for good", titleOr(titles, e.CardID, "a card"))
+		}
+	case CardRestored{}.EventType():
+		var e CardRestored
+		if unmarshal(&e) {
+			titles[e.Card.ID] = e.Card.Title
+			return fmt.Sprintf("restored %q to %q", e.Card.Title, titleOr(titles, e.ColumnID, "a column"))
+		}
+	case CardAssigned{}.EventType():
+		var e CardAssigned
+		if unmarshal(&e) {
+			return fmt.Sprintf("assigned %s to %q", e.Assignee, titleOr(titles, e.CardID, "a card"))
+		}
+	case CardUnassigned{}.EventType():
+		var e CardUnassigned
+		if unmarshal(&e) {
+			return fmt.Sprintf("unassigned %s from %q", e.Assignee, titleOr(titles, e.CardID, "a card"))
+		}
+	case CardLabeled{}.EventType():
+		var e CardLabeled
+		if unmarshal(&e) {
+			if len(e.Labels) == 0 {
+				return fmt.Sprintf("cleared the labels on %q", titleOr(titles, e.CardID, "a card"))
+			}
+			return fmt.Sprintf("labeled %q %s", titleOr(titles, e.CardID, "a card"), strings.Join(e.Labels, ", "))
+		}
+	case CardDueDateSet{}.EventType():
+		var e CardDueDateSet
+		if unmarshal(&e) {
+			if e.DueDate == "" {
+				return fmt.Sprintf("cleared the due date on %q", titleOr(titles, e.CardID, "a card"))
+			}
+			return fmt.Sprintf("set %q due on %s", titleOr(titles, e.CardID, "a card"), e.DueDate)
+		}
+	case ChecklistItemAdded{}.EventType():
+		var e ChecklistItemAdded
+		if unmarshal(&e) {
+			titles[e.ItemID] = e.Text
+			return fmt.Sprintf("added %q to the checklist on %q", e.Text, titleOr(titles, e.CardID, "a card"))
+		}
+	case ChecklistItemToggled{}.EventType():
+		var e ChecklistItemToggled
+		if unmarshal(&e) {
+			verb := "unchecked"
+			if e.Done {
+				verb = "checked off"
+			}
+			return fmt.Sprintf("%s %q on %q", verb,
+				titleOr(titles, e.ItemID, "a checklist item"), titleOr(titles, e.CardID, "a card"))
 		}
 	}
 
@@ -474,6 +1109,11 @@ func titleOr(titles map[string]string, id, fallback string) string {
 func (s *server) handleStats(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
 	type streamInfo struct {
 		ID      string `json:"id"`
 		Version int64  `json:"version"`
@@ -485,20 +1125,22 @@ func (s *server) handleStats(w http.ResponseWriter, r *http.Request) {
 		SnapshotCount       int64        `json:"snapshotCount"`
 		LastSnapshotVersion int64        `json:"lastSnapshotVersion"`
 		SnapshotEvery       int64        `json:"snapshotEvery"`
+		SnapshotPolicy      string       `json:"snapshotPolicy"`
 		StoreStack          []string     `json:"storeStack"`
 	}{
-		Streams:       []streamInfo{},
-		SnapshotEvery: s.snapshotEvery,
+		Streams:        []streamInfo{},
+		SnapshotEvery:  snapshotEveryOf(s.snapshotPolicy),
+		SnapshotPolicy: s.snapshotPolicy.String(),
 		StoreStack: []string{
 			"HookableStore (SSE broadcast on AfterSave)",
-			"SnapshottingStore (snapshot every " + strconv.FormatInt(s.snapshotEvery, 10) + " events)",
+			"SnapshottingStore (snapshot " + s.snapshotPolicy.String() + ")",
 			"EventSourcedStore (optimistic concurrency)",
 			"SQLite event store",
 		},
 	}
 
-	boardStreamID := typeid.New("board", s.boardID)
-	snapshotStreamID := typeid.New("boardsnapshot", s.boardID)
+	boardStreamID := typeid.New("board", boardID)
+	snapshotStreamID := typeid.New(snapshotStreamType, boardID)
 
 	streams, err := s.events.ListStreams(ctx)
 	if err != nil {
@@ -538,44 +1180,19 @@ func (s *server) handleStats(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, stats)
 }
 
-// handleWatch streams board updates to the client over server-sent events.
-func (s *server) handleWatch(w http.ResponseWriter, r *http.Request) {
-	ch, ok := s.hub.subscribe()
-	if !ok {
-		writeError(w, http.StatusServiceUnavailable, "too many live connections right now — try again shortly")
-		return
-	}
-	defer s.hub.unsubscribe(ch)
-
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	rc := http.NewResponseController(w)
-
-	// send the current state immediately so a reconnecting client resyncs
-	if agg, err := s.live.Load(r.Context(), s.boardID, nil); err == nil {
-		msg, _ := json.Marshal(boardMessage{Version: agg.Version(), Live: true, Board: agg.Entity()})
-		fmt.Fprintf(w, "data: %s\n\n", msg)
-	}
-	if err := rc.Flush(); err != nil {
-		return
-	}
-
-	keepalive := time.NewTicker(15 * time.Second)
-	defer keepalive.Stop()
-
-	for {
-		select {
-		case <-r.Context().Done():
-			return
-		case msg := <-ch:
-			fmt.Fprintf(w, "data: %s\n\n", msg)
-		case <-keepalive.C:
-			fmt.Fprint(w, ": keepalive\n\n")
-		}
-		if err := rc.Flush(); err != nil {
-			return
-		}
+// pathBoardID parses the {id} path segment as a board UUID, writing a 400 when
+// it is malformed or nil.
+//
+// The nil UUID parses fine but is not a usable aggregate ID — estoria rejects
+// it downstream with "aggregate ID is nil", which would surface to the caller
+// as a 500 for what is plainly bad input.
+func pathBoardID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.FromString(r.PathValue("id"))
+	if err != nil || id.IsNil() {
+		writeError(w, http.StatusBadRequest, "invalid board ID")
+		return uuid.Nil, false
 	}
+	return id, true
 }
 
 func (s *server) writeLoadError(w http.ResponseWriter, err error) {
@@ -586,17 +1203,76 @@ func (s *server) writeLoadError(w http.ResponseWriter, err error) {
 	writeError(w, http.StatusInternalServerError, err.Error())
 }
 
+// maxLabels caps how many labels one card can carry.
+const maxLabels = 10
+
+// maxTitleLength caps titles and names, in bytes.
+const maxTitleLength = 200
+
 func requireTitle(s, what string) (string, error) {
 	s = strings.TrimSpace(s)
 	if s == "" {
 		return "", errors.New(what + " is required")
 	}
-	if len(s) > 200 {
+	if len(s) > maxTitleLength {
 		return "", errors.New(what + " is too long")
 	}
 	return s, nil
 }
 
+// Card descriptions are Markdown, and limited in size and in how many links
+// they may carry, so a card stays a card.
+const (
+	maxDescriptionLength = 5000
+	maxDescriptionLinks  = 20
+)
+
+// requireDescription is requireTitle for card descriptions, which are
+// optional.
+func requireDescription(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > maxDescriptionLength {
+		return "", fmt.Errorf("card description is too long (at most %d bytes)", maxDescriptionLength)
+	}
+	if _, links := renderMarkdown(s); links > maxDescriptionLinks {
+		return "", fmt.Errorf("card description has %d links (at most %d)", links, maxDescriptionLinks)
+	}
+	return s, nil
+}
+
+// checkDescription runs the description a card event carries through
+// requireDescription. Commands check theirs as they come in; this is for
+// events made any other way, such as an imported log or a clone of a board
+// from before the limits.
+func checkDescription(e estoria.EntityEvent[Board]) error {
+	var description string
+	switch e := e.(type) {
+	case CardAdded:
+		description = e.Description
+	case CardEdited:
+		description = e.Description
+	case CardRestored:
+		description = e.Card.Description
+	default:
+		return nil
+	}
+	_, err := requireDescription(description)
+	return err
+}
+
+// cardColor builds a card's color from a command's color name and label. A
+// label names what a color means, so it needs a color to go with.
+func cardColor(name, label string) (CardColor, error) {
+	color := CardColor{Name: strings.TrimSpace(name), Label: strings.TrimSpace(label)}
+	if color.Name == "" && color.Label != "" {
+		return CardColor{}, errors.New("a color label needs a color")
+	}
+	if len(color.Label) > 40 {
+		return CardColor{}, errors.New("color label is too long")
+	}
+	return color, nil
+}
+
 func readJSON[T any](r *http.Request) (T, error) {
 	var v T
 	err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&v)
@@ -0,0 +1,1521 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/go-estoria/estoria/typeid"
+	"github.com/gofrs/uuid/v5"
+)
+
+// do sends a request through the server's routes and decodes the JSON
+// response into out (when out is non-nil), returning the status code.
+func do(t *testing.T, h http.Handler, method, path string, body, out any) int {
+	t.Helper()
+	return doAs(t, h, "", method, path, body, out)
+}
+
+// doAs is do with a display name, or anonymously for "".
+func doAs(t *testing.T, h http.Handler, actor, method, path string, body, out any) int {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &buf)
+	if actor != "" {
+		req.Header.Set(actorHeader, actor)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if out != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return rec.Code
+}
+
+// TestBoardLobby covers multiple boards in one database: each board is its own
+// stream, listed from ListStreams, and commands on one never touch another.
+func TestBoardLobby(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var first, second boardMessage
+	if code := do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Roadmap"}, &first); code != http.StatusCreated {
+		t.Fatalf("creating a board = %d, want 201", code)
+	}
+	if code := do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Bugs"}, &second); code != http.StatusCreated {
+		t.Fatalf("creating a board = %d, want 201", code)
+	}
+	if first.Version != 1 || first.Board.Name != "Roadmap" {
+		t.Errorf("created board = %+v at v%d, want 'Roadmap' at v1", first.Board, first.Version)
+	}
+
+	base := "/api/boards/" + first.Board.ID.String()
+	if code := do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "Next"}, nil); code != http.StatusOK {
+		t.Fatalf("adding a column = %d, want 200", code)
+	}
+
+	var lobby []boardSummary
+	if code := do(t, h, http.MethodGet, "/api/boards", nil, &lobby); code != http.StatusOK {
+		t.Fatalf("listing boards = %d, want 200", code)
+	}
+	if len(lobby) != 2 || lobby[0].Name != "Bugs" || lobby[1].Name != "Roadmap" {
+		t.Fatalf("lobby = %+v, want Bugs and Roadmap", lobby)
+	}
+	if lobby[1].Columns != 1 || lobby[1].Version != 2 {
+		t.Errorf("Roadmap summary = %+v, want 1 column at v2", lobby[1])
+	}
+	if lobby[0].Columns != 0 || lobby[0].Version != 1 {
+		t.Errorf("Bugs summary = %+v, want an untouched board at v1", lobby[0])
+	}
+
+	// time travel and the activity feed are per board
+	var past boardMessage
+	if code := do(t, h, http.MethodGet, base+"?version=1", nil, &past); code != http.StatusOK {
+		t.Fatalf("loading v1 = %d, want 200", code)
+	}
+	if len(past.Board.Columns) != 0 {
+		t.Errorf("board at v1 = %+v, want no columns yet", past.Board)
+	}
+
+	var activity []activityEntry
+	if code := do(t, h, http.MethodGet, base+"/activity", nil, &activity); code != http.StatusOK {
+		t.Fatalf("loading activity = %d, want 200", code)
+	}
+	if len(activity) != 2 {
+		t.Errorf("activity = %+v, want the board's 2 events only", activity)
+	}
+
+	for path, want := range map[string]int{
+		"/api/boards/not-a-uuid":                           http.StatusBadRequest,
+		"/api/boards/00000000-0000-0000-0000-000000000000": http.StatusBadRequest,
+		"/api/boards/0195d3c4-0000-7000-8000-000000000000": http.StatusNotFound,
+	} {
+		if code := do(t, h, http.MethodGet, path, nil, nil); code != want {
+			t.Errorf("GET %s = %d, want %d", path, code, want)
+		}
+	}
+}
+
+// TestCommandPreflight checks that a command the domain rejects in ApplyTo is
+// answered with a 422 and never reaches the stream. Without the pre-flight the
+// event would be written first and fail to apply after, breaking every later
+// load of the board.
+func TestCommandPreflight(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var created boardMessage
+	if code := do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Limits"}, &created); code != http.StatusCreated {
+		t.Fatalf("creating a board = %d, want 201", code)
+	}
+	base := "/api/boards/" + created.Board.ID.String()
+
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "Doing"}, nil)
+
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	column := board.Board.Columns[0].ID
+
+	if code := do(t, h, http.MethodPost, base+"/columns/"+column+"/wip-limit", map[string]any{"limit": 1}, nil); code != http.StatusOK {
+		t.Fatalf("setting a WIP limit = %d, want 200", code)
+	}
+	if code := do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": column, "title": "one"}, nil); code != http.StatusOK {
+		t.Fatalf("adding a card under the limit = %d, want 200", code)
+	}
+
+	var before boardMessage
+	do(t, h, http.MethodGet, base, nil, &before)
+
+	if code := do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": column, "title": "two"}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("adding a card past the limit = %d, want 422", code)
+	}
+
+	var after boardMessage
+	if code := do(t, h, http.MethodGet, base, nil, &after); code != http.StatusOK {
+		t.Fatalf("loading the board after a rejected command = %d, want 200", code)
+	}
+	if after.Version != before.Version {
+		t.Errorf("version after a rejected command = %d, want %d (nothing written)", after.Version, before.Version)
+	}
+}
+
+// TestCardComments covers the card thread: a second aggregate type in the same
+// event store, written without touching the board stream and broadcast to the
+// board's watchers tagged with the card ID.
+func TestCardComments(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Threads"}, &created)
+	boardID := created.Board.ID.String()
+	base := "/api/boards/" + boardID
+
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "To Do"}, nil)
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": board.Board.Columns[0].ID, "title": "Discuss me"}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+	cardID := board.Board.Columns[0].Cards[0].ID
+	thread := base + "/cards/" + cardID + "/comments"
+
+	var empty threadMessage
+	if code := do(t, h, http.MethodGet, thread, nil, &empty); code != http.StatusOK {
+		t.Fatalf("listing an empty thread = %d, want 200", code)
+	}
+	if empty.Version != 0 || len(empty.Comments) != 0 {
+		t.Errorf("empty thread = %+v, want no comments at v0", empty)
+	}
+
+	watcher, ok := srv.hub.subscribe(created.Board.ID)
+	if !ok {
+		t.Fatal("subscribing to the hub failed")
+	}
+	defer srv.hub.unsubscribe(watcher)
+
+	var posted threadMessage
+	// the author is the caller's display name, whatever the request says
+	if code := doAs(t, h, "ada", http.MethodPost, thread, map[string]string{"author": "grace", "body": "First!"}, &posted); code != http.StatusOK {
+		t.Fatalf("posting a comment = %d, want 200", code)
+	}
+	if len(posted.Comments) != 1 || posted.Comments[0].Author != "ada" || posted.Comments[0].Body != "First!" {
+		t.Fatalf("thread after posting = %+v, want ada's comment", posted)
+	}
+
+	select {
+	case raw := <-watcher:
+		var msg threadMessage
+		if err := json.Unmarshal(raw.Data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != "comments" || msg.CardID != cardID || len(msg.Comments) != 1 {
+			t.Errorf("broadcast = %+v, want the thread tagged with card %s", msg, cardID)
+		}
+	default:
+		t.Error("posting a comment was not broadcast to the board's watchers")
+	}
+
+	commentPath := thread + "/" + posted.Comments[0].ID
+	for _, actor := range []string{"grace", ""} {
+		if code := doAs(t, h, actor, http.MethodPost, commentPath+"/edit", map[string]string{"body": "not yours"}, nil); code != http.StatusForbidden {
+			t.Errorf("%q editing ada's comment = %d, want 403", actor, code)
+		}
+		if code := doAs(t, h, actor, http.MethodPost, commentPath+"/delete", nil, nil); code != http.StatusForbidden {
+			t.Errorf("%q deleting ada's comment = %d, want 403", actor, code)
+		}
+	}
+
+	var edited threadMessage
+	if code := doAs(t, h, "ada", http.MethodPost, commentPath+"/edit", map[string]string{"body": "First, edited"}, &edited); code != http.StatusOK {
+		t.Fatalf("editing a comment = %d, want 200", code)
+	}
+	if edited.Comments[0].Body != "First, edited" || edited.Comments[0].EditedAt.IsZero() {
+		t.Errorf("comment after editing = %+v, want the new body and an edit time", edited.Comments[0])
+	}
+
+	if code := doAs(t, h, "ada", http.MethodPost, commentPath+"/delete", nil, nil); code != http.StatusOK {
+		t.Fatalf("deleting a comment = %d, want 200", code)
+	}
+	if code := doAs(t, h, "ada", http.MethodPost, commentPath+"/delete", nil, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("deleting a comment twice = %d, want 422", code)
+	}
+
+	var after threadMessage
+	do(t, h, http.MethodGet, thread, nil, &after)
+	if after.Version != 3 || len(after.Comments) != 0 {
+		t.Errorf("thread = %+v, want no comments at v3", after)
+	}
+
+	// the discussion lives in its own stream: the board never moved
+	var unchanged boardMessage
+	do(t, h, http.MethodGet, base, nil, &unchanged)
+	if unchanged.Version != board.Version {
+		t.Errorf("board version = %d after commenting, want %d", unchanged.Version, board.Version)
+	}
+
+	for name, tc := range map[string]struct {
+		path string
+		body map[string]string
+		want int
+	}{
+		"malformed card ID": {base + "/cards/not-a-card/comments", map[string]string{"body": "hi"}, http.StatusBadRequest},
+		"card not on board": {base + "/cards/card_0195d3c4-0000-7000-8000-000000000000/comments", map[string]string{"body": "hi"}, http.StatusNotFound},
+		"unknown board":     {"/api/boards/" + uuid.Must(uuid.NewV4()).String() + "/cards/" + cardID + "/comments", map[string]string{"body": "hi"}, http.StatusNotFound},
+		"empty comment":     {thread, map[string]string{"body": "  "}, http.StatusUnprocessableEntity},
+	} {
+		if code := do(t, h, http.MethodPost, tc.path, tc.body, nil); code != tc.want {
+			t.Errorf("%s: POST = %d, want %d", name, code, tc.want)
+		}
+	}
+}
+
+// TestUndoRedo walks a stack of changes back and forward again through
+// compensating events, and checks that undo refuses once someone else has
+// changed the card since.
+func TestUndoRedo(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Undo"}, &created)
+	base := "/api/boards/" + created.Board.ID.String()
+
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "To Do"}, nil)
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "Done"}, nil)
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	todo, done := board.Board.Columns[0].ID, board.Board.Columns[1].ID
+
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "first"}, nil)
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "second"}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+	card := board.Board.Columns[0].Cards[0].ID
+
+	type result struct {
+		Version int64 `json:"version"`
+	}
+	var moved, edited, undoEdit, undoMove result
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/move", map[string]any{"toColumnId": done, "toIndex": 0}, &moved)
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/edit", map[string]any{"title": "renamed", "color": "red"}, &edited)
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/labels", map[string]any{"labels": []string{"keep"}}, nil)
+
+	// the label change came after the edit and still stands, so the edit is stuck
+	var latest boardMessage
+	do(t, h, http.MethodGet, base, nil, &latest)
+	if code := do(t, h, http.MethodPost, base+"/undo", map[string]any{"baseVersion": latest.Version, "version": edited.Version}, nil); code != http.StatusConflict {
+		t.Fatalf("undoing an edit the card has moved on from = %d, want 409", code)
+	}
+
+	// clearing the labels by hand doesn't help: only compensating events cancel out
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/labels", map[string]any{"labels": []string{}}, nil)
+	do(t, h, http.MethodGet, base, nil, &latest)
+	if code := do(t, h, http.MethodPost, base+"/undo", map[string]any{"baseVersion": latest.Version, "version": edited.Version}, nil); code != http.StatusConflict {
+		t.Errorf("undo after a later manual change = %d, want 409", code)
+	}
+
+	// a fresh card: move, edit, then unwind both
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "fresh"}, nil)
+	do(t, h, http.MethodGet, base, nil, &latest)
+	fresh := latest.Board.Columns[0].Cards[1].ID
+
+	do(t, h, http.MethodPost, base+"/cards/"+fresh+"/move", map[string]any{"toColumnId": done, "toIndex": 0}, &moved)
+	do(t, h, http.MethodPost, base+"/cards/"+fresh+"/edit", map[string]any{"title": "fresher"}, &edited)
+
+	if code := do(t, h, http.MethodPost, base+"/undo", map[string]any{"baseVersion": edited.Version, "version": edited.Version}, &undoEdit); code != http.StatusOK {
+		t.Fatalf("undoing the edit = %d, want 200", code)
+	}
+	if code := do(t, h, http.MethodPost, base+"/undo", map[string]any{"baseVersion": undoEdit.Version, "version": moved.Version}, &undoMove); code != http.StatusOK {
+		t.Fatalf("undoing the move past an undone edit = %d, want 200", code)
+	}
+
+	do(t, h, http.MethodGet, base, nil, &latest)
+	restored := latest.Board.Columns[0].Cards
+	if len(restored) != 2 || restored[1].ID != fresh || restored[1].Title != "fresh" {
+		t.Fatalf("To Do after undoing = %+v, want 'fresh' back in its old place with its old title", restored)
+	}
+
+	// undoing the same change twice is refused: its own undo changed the card
+	if code := do(t, h, http.MethodPost, base+"/undo", map[string]any{"baseVersion": undoMove.Version, "version": moved.Version}, nil); code != http.StatusConflict {
+		t.Errorf("undoing a move twice = %d, want 409", code)
+	}
+
+	// redo in reverse order of the undos
+	var redoMove result
+	if code := do(t, h, http.MethodPost, base+"/redo", map[string]any{"baseVersion": undoMove.Version, "version": undoMove.Version}, &redoMove); code != http.StatusOK {
+		t.Fatalf("redoing the move = %d, want 200", code)
+	}
+	if code := do(t, h, http.MethodPost, base+"/redo", map[string]any{"baseVersion": redoMove.Version, "version": undoEdit.Version}, nil); code != http.StatusOK {
+		t.Fatalf("redoing the edit = %d, want 200", code)
+	}
+
+	do(t, h, http.MethodGet, base, nil, &latest)
+	if got := latest.Board.Columns[1].Cards[0]; got.ID != fresh || got.Title != "fresher" {
+		t.Errorf("Done after redoing = %+v, want 'fresher' back on top", got)
+	}
+
+	// archiving and undoing brings the whole card back
+	var removed result
+	do(t, h, http.MethodPost, base+"/cards/"+fresh+"/archive", map[string]any{}, &removed)
+	if code := do(t, h, http.MethodPost, base+"/undo", map[string]any{"baseVersion": removed.Version, "version": removed.Version}, nil); code != http.StatusOK {
+		t.Fatalf("undoing an archive = %d, want 200", code)
+	}
+	do(t, h, http.MethodGet, base, nil, &latest)
+	if got := latest.Board.Columns[1].Cards[0]; got.ID != fresh || got.Title != "fresher" {
+		t.Errorf("Done after undoing the archive = %+v, want 'fresher' restored", got)
+	}
+
+	for name, tc := range map[string]struct {
+		path string
+		body map[string]any
+		want int
+	}{
+		"not invertible":   {"/undo", map[string]any{"baseVersion": latest.Version, "version": 2}, http.StatusUnprocessableEntity},
+		"redo a non-undo":  {"/redo", map[string]any{"baseVersion": latest.Version, "version": moved.Version}, http.StatusUnprocessableEntity},
+		"stale base":       {"/undo", map[string]any{"baseVersion": removed.Version, "version": removed.Version}, http.StatusConflict},
+		"version too late": {"/undo", map[string]any{"baseVersion": 3, "version": 4}, http.StatusBadRequest},
+	} {
+		if code := do(t, h, http.MethodPost, base+tc.path, tc.body, nil); code != tc.want {
+			t.Errorf("%s: POST %s = %d, want %d", name, tc.path, code, tc.want)
+		}
+	}
+}
+
+// TestUndoOnlyOwnEvents checks that a change can only be undone, and an undo
+// only redone, by whoever made it.
+func TestUndoOnlyOwnEvents(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var created boardMessage
+	doAs(t, h, "ada", http.MethodPost, "/api/boards", map[string]string{"name": "Mine"}, &created)
+	base := "/api/boards/" + created.Board.ID.String()
+	doAs(t, h, "ada", http.MethodPost, base+"/columns", map[string]any{"title": "To Do"}, nil)
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	doAs(t, h, "ada", http.MethodPost, base+"/cards", map[string]any{"columnId": board.Board.Columns[0].ID, "title": "ada's"}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+	card := board.Board.Columns[0].Cards[0].ID
+
+	var edited, undone struct {
+		Version int64 `json:"version"`
+	}
+	doAs(t, h, "ada", http.MethodPost, base+"/cards/"+card+"/edit", map[string]any{"title": "renamed"}, &edited)
+
+	undo := map[string]any{"baseVersion": edited.Version, "version": edited.Version}
+	for _, actor := range []string{"grace", ""} {
+		if code := doAs(t, h, actor, http.MethodPost, base+"/undo", undo, nil); code != http.StatusForbidden {
+			t.Errorf("%q undoing ada's edit = %d, want 403", actor, code)
+		}
+	}
+	if code := doAs(t, h, "ada", http.MethodPost, base+"/undo", undo, &undone); code != http.StatusOK {
+		t.Fatalf("ada undoing her own edit = %d, want 200", code)
+	}
+
+	redo := map[string]any{"baseVersion": undone.Version, "version": undone.Version}
+	if code := doAs(t, h, "grace", http.MethodPost, base+"/redo", redo, nil); code != http.StatusForbidden {
+		t.Errorf("grace redoing ada's undo = %d, want 403", code)
+	}
+	if code := doAs(t, h, "ada", http.MethodPost, base+"/redo", redo, nil); code != http.StatusOK {
+		t.Errorf("ada redoing her own undo = %d, want 200", code)
+	}
+}
+
+// TestExportImport round-trips a board through its NDJSON event log and checks
+// that logs which don't apply cleanly are turned away.
+func TestExportImport(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Portable"}, &created)
+	base := "/api/boards/" + created.Board.ID.String()
+
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "To Do"}, nil)
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": board.Board.Columns[0].ID, "title": "pack"}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+	card := board.Board.Columns[0].Cards[0].ID
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/checklist", map[string]any{"text": "socks"}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base+"/export", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("exporting = %d, want 200", rec.Code)
+	}
+	log := rec.Body.String()
+	if lines := strings.Count(log, "\n"); lines != int(board.Version) {
+		t.Fatalf("export has %d lines, want one per event (%d)", lines, board.Version)
+	}
+
+	importLog := func(body string) (int, boardMessage) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/boards/import", strings.NewReader(body)))
+		var msg boardMessage
+		if rec.Code == http.StatusCreated {
+			if err := json.Unmarshal(rec.Body.Bytes(), &msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, msg
+	}
+
+	code, imported := importLog(log)
+	if code != http.StatusCreated {
+		t.Fatalf("importing the export = %d, want 201", code)
+	}
+	if imported.Board.ID == created.Board.ID {
+		t.Error("the import reused the original board ID, want a new board")
+	}
+	if imported.Version != board.Version {
+		t.Errorf("imported board is at v%d, want v%d", imported.Version, board.Version)
+	}
+
+	// everything but the board ID survives, down to the checklist item IDs
+	original, copied := board.Board, imported.Board
+	original.ID, copied.ID = uuid.Nil, uuid.Nil
+	if !reflect.DeepEqual(original, copied) {
+		t.Errorf("imported board = %+v\nwant %+v", copied, original)
+	}
+
+	// the copy's card has the original's ID, but a discussion of its own
+	originalThread := base + "/cards/" + card + "/comments"
+	copyThread := "/api/boards/" + imported.Board.ID.String() + "/cards/" + card + "/comments"
+	if code := do(t, h, http.MethodPost, originalThread, map[string]string{"body": "on the original"}, nil); code != http.StatusOK {
+		t.Fatalf("commenting on the original = %d, want 200", code)
+	}
+	var copyComments threadMessage
+	do(t, h, http.MethodGet, copyThread, nil, &copyComments)
+	if len(copyComments.Comments) != 0 {
+		t.Errorf("the copy's thread = %+v, want it empty", copyComments.Comments)
+	}
+	if code := do(t, h, http.MethodPost, copyThread, map[string]string{"body": "on the copy"}, &copyComments); code != http.StatusOK {
+		t.Fatalf("commenting on the copy = %d, want 200", code)
+	}
+	var originalComments threadMessage
+	do(t, h, http.MethodGet, originalThread, nil, &originalComments)
+	if len(originalComments.Comments) != 1 || originalComments.Comments[0].Body != "on the original" ||
+		len(copyComments.Comments) != 1 || copyComments.Comments[0].Body != "on the copy" {
+		t.Errorf("threads are %+v on the original and %+v on the copy, want one comment each", originalComments.Comments, copyComments.Comments)
+	}
+
+	lines := strings.SplitAfter(log, "\n")
+	for name, body := range map[string]string{
+		"empty":           "",
+		"not JSON":        "{nope\n",
+		"missing events":  lines[0] + lines[2],
+		"no BoardCreated": strings.Join(lines[1:], ""),
+		"unknown type":    `{"type":"boardexploded","version":1,"data":{}}` + "\n",
+		"does not apply":  lines[0] + strings.Replace(lines[2], `"version":3`, `"version":2`, 1),
+	} {
+		if code, _ := importLog(body); code < 400 {
+			t.Errorf("%s: import = %d, want a rejection", name, code)
+		}
+	}
+
+	// descriptions are held to the limits commands enforce
+	var added map[string]any
+	if err := json.Unmarshal([]byte(lines[2]), &added); err != nil {
+		t.Fatal(err)
+	}
+	added["data"].(map[string]any)["description"] = strings.Repeat("x", maxDescriptionLength+1)
+	tooLong, err := json.Marshal(added)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := importLog(lines[0] + lines[1] + string(tooLong) + "\n"); code != http.StatusUnprocessableEntity {
+		t.Errorf("importing a card with a %d-byte description = %d, want 422", maxDescriptionLength+1, code)
+	}
+
+	// rejected imports write nothing: only the original and the copy exist
+	var lobby []boardSummary
+	do(t, h, http.MethodGet, "/api/boards", nil, &lobby)
+	if len(lobby) != 2 {
+		t.Errorf("lobby has %d boards after rejected imports, want 2", len(lobby))
+	}
+}
+
+// TestSearch covers the search read model: kept current by the AfterSave hook,
+// finding past titles with the version they were set at, and rebuilt from the
+// streams alone after being thrown away.
+func TestSearch(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Findable"}, &created)
+	base := "/api/boards/" + created.Board.ID.String()
+
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "To Do"}, nil)
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	column := board.Board.Columns[0].ID
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": column, "title": "Fix the login page"}, nil)
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": column, "title": "Write docs", "description": "mention the login flow"}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+	first := board.Board.Columns[0].Cards[0].ID
+
+	var renamed struct {
+		Version int64 `json:"version"`
+	}
+	do(t, h, http.MethodPost, base+"/cards/"+first+"/edit", map[string]any{"title": "Fix the signup page"}, &renamed)
+
+	// a second board with a matching card stays out of this board's results
+	var other boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Elsewhere"}, &other)
+	do(t, h, http.MethodPost, "/api/boards/"+other.Board.ID.String()+"/columns", map[string]any{"title": "x"}, nil)
+
+	type results struct {
+		Cards      []searchHit    `json:"cards"`
+		PastTitles []pastTitleHit `json:"pastTitles"`
+	}
+	search := func(query string) results {
+		t.Helper()
+		var res results
+		if code := do(t, h, http.MethodGet, base+"/search?"+query, nil, &res); code != http.StatusOK {
+			t.Fatalf("searching %q = %d, want 200", query, code)
+		}
+		return res
+	}
+
+	check := func(t *testing.T) {
+		t.Helper()
+
+		if res := search("q=login"); len(res.Cards) != 1 || res.Cards[0].Title != "Write docs" {
+			t.Errorf("current matches for 'login' = %+v, want only the card describing it", res.Cards)
+		}
+		if res := search("q=sign"); len(res.Cards) != 1 || res.Cards[0].CardID != first {
+			t.Errorf("prefix matches for 'sign' = %+v, want the renamed card", res.Cards)
+		}
+
+		res := search("q=login+page&history=true")
+		if len(res.Cards) != 0 {
+			t.Errorf("current matches for 'login page' = %+v, want none", res.Cards)
+		}
+		if len(res.PastTitles) != 1 {
+			t.Fatalf("past titles for 'login page' = %+v, want the card's old title", res.PastTitles)
+		}
+		past := res.PastTitles[0]
+		if past.CardID != first || past.Title != "Fix the login page" || past.CurrentTitle != "Fix the signup page" {
+			t.Errorf("past title = %+v, want the old title of %s", past, first)
+		}
+		if past.Version >= renamed.Version {
+			t.Errorf("past title version = %d, want one before the rename at v%d", past.Version, renamed.Version)
+		}
+	}
+
+	t.Run("kept current by the hook", check)
+
+	if res := search(`q="%29+OR+*`); res.Cards == nil {
+		t.Error("query syntax in the search text was not neutralized")
+	}
+
+	if err := srv.search.clear(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if res := search("q=login"); len(res.Cards) != 0 {
+		t.Fatalf("cleared index still matched %+v", res.Cards)
+	}
+	if err := srv.search.catchUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("rebuilt from the streams", check)
+}
+
+// TestAnalyticsRoutes checks the analytics endpoints end to end over a real
+// stream; the projections themselves are covered in analytics_test.go.
+func TestAnalyticsRoutes(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Metrics"}, &created)
+	base := "/api/boards/" + created.Board.ID.String()
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "To Do"}, nil)
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "Done"}, nil)
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": board.Board.Columns[0].ID, "title": "ship"}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+	do(t, h, http.MethodPost, base+"/cards/"+board.Board.Columns[0].Cards[0].ID+"/move",
+		map[string]any{"toColumnId": board.Board.Columns[1].ID}, nil)
+
+	var flow []flowDay
+	if code := do(t, h, http.MethodGet, base+"/analytics/flow", nil, &flow); code != http.StatusOK {
+		t.Fatalf("flow = %d, want 200", code)
+	}
+	if len(flow) == 0 || flow[len(flow)-1].Columns[1].Cards != 1 {
+		t.Errorf("flow = %+v, want today ending with the card done", flow)
+	}
+
+	var cycle struct {
+		Cards       []cardCycle        `json:"cards"`
+		Percentiles map[string]float64 `json:"percentiles"`
+	}
+	if code := do(t, h, http.MethodGet, base+"/analytics/cycle-time", nil, &cycle); code != http.StatusOK {
+		t.Fatalf("cycle time = %d, want 200", code)
+	}
+	if len(cycle.Cards) != 1 || cycle.Cards[0].Title != "ship" {
+		t.Errorf("cycle times = %+v, want the one finished card", cycle.Cards)
+	}
+	if _, ok := cycle.Percentiles["p85"]; !ok {
+		t.Errorf("percentiles = %v, want p50/p85/p95", cycle.Percentiles)
+	}
+
+	for path, want := range map[string]int{
+		base + "/analytics/flow?from=yesterday":                           http.StatusBadRequest,
+		base + "/analytics/flow?from=2026-02-01&to=2026-01-01":            http.StatusBadRequest,
+		base + "/analytics/cycle-time?from=2020-01-01&to=2026-01-01":      http.StatusBadRequest,
+		"/api/boards/0195d3c4-0000-7000-8000-000000000000/analytics/flow": http.StatusNotFound,
+	} {
+		if code := do(t, h, http.MethodGet, path, nil, nil); code != want {
+			t.Errorf("GET %s = %d, want %d", path, code, want)
+		}
+	}
+}
+
+// TestTimeTravelAndDiff covers loading a board as of a timestamp and
+// comparing two points in its history.
+func TestTimeTravelAndDiff(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Diff"}, &created)
+	base := "/api/boards/" + created.Board.ID.String()
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "To Do"}, nil)
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "Done"}, nil)
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	todo, done := board.Board.Columns[0].ID, board.Board.Columns[1].ID
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "stays"}, nil)
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "goes"}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+	from := board.Version
+	stays, goes := board.Board.Columns[0].Cards[0].ID, board.Board.Columns[0].Cards[1].ID
+
+	do(t, h, http.MethodPost, base+"/cards/"+stays+"/move", map[string]any{"toColumnId": done}, nil)
+	do(t, h, http.MethodPost, base+"/cards/"+stays+"/edit", map[string]any{"title": "stayed"}, nil)
+	do(t, h, http.MethodPost, base+"/cards/"+goes+"/archive", map[string]any{}, nil)
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "new"}, nil)
+	do(t, h, http.MethodPost, base+"/columns/"+done+"/rename", map[string]any{"title": "Shipped"}, nil)
+
+	t.Run("at loads the last version at or before the instant", func(t *testing.T) {
+		events, err := readBoardEvents(context.Background(), srv.events, created.Board.ID, eventstore.ReadStreamOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		at := events[from-1].timestamp
+		want := from
+		for _, e := range events[from:] {
+			if !e.timestamp.After(at) {
+				want = e.version // saved within the same tick
+			}
+		}
+
+		var past boardMessage
+		if code := do(t, h, http.MethodGet, base+"?at="+at.Format(time.RFC3339Nano), nil, &past); code != http.StatusOK {
+			t.Fatalf("GET ?at= = %d, want 200", code)
+		}
+		if past.Version != want || past.Live {
+			t.Errorf("at %s: got v%d (live %v), want v%d, not live", at, past.Version, past.Live, want)
+		}
+
+		before := events[0].timestamp.Add(-time.Hour).Format(time.RFC3339)
+		for path, want := range map[string]int{
+			base + "?at=" + before:           http.StatusNotFound,
+			base + "?at=yesterday":           http.StatusBadRequest,
+			base + "?version=2&at=" + before: http.StatusBadRequest,
+			base + "/diff":                   http.StatusBadRequest,
+			base + "/diff?from=0":            http.StatusBadRequest,
+			base + "/diff?from=" + before:    http.StatusNotFound,
+		} {
+			if code := do(t, h, http.MethodGet, path, nil, nil); code != want {
+				t.Errorf("GET %s = %d, want %d", path, code, want)
+			}
+		}
+	})
+
+	t.Run("diff reports what changed between two versions", func(t *testing.T) {
+		var diff boardDiff
+		path := base + "/diff?from=" + strconv.FormatInt(from, 10)
+		if code := do(t, h, http.MethodGet, path, nil, &diff); code != http.StatusOK {
+			t.Fatalf("GET %s = %d, want 200", path, code)
+		}
+
+		if diff.From != from || diff.To != from+5 {
+			t.Errorf("diff covers v%d to v%d, want v%d to v%d", diff.From, diff.To, from, from+5)
+		}
+		if len(diff.Cards.Added) != 1 || diff.Cards.Added[0].Title != "new" {
+			t.Errorf("added = %+v, want the new card", diff.Cards.Added)
+		}
+		if len(diff.Cards.Removed) != 0 || len(diff.Cards.Archived) != 1 || diff.Cards.Archived[0].CardID != goes {
+			t.Errorf("removed = %+v and archived = %+v, want only the archived card", diff.Cards.Removed, diff.Cards.Archived)
+		}
+		if len(diff.Cards.Moved) != 1 || diff.Cards.Moved[0].CardID != stays || diff.Cards.Moved[0].ToColumnID != done {
+			t.Errorf("moved = %+v, want the card moved to done", diff.Cards.Moved)
+		}
+		if len(diff.Cards.Edited) != 1 || len(diff.Cards.Edited[0].Changes) != 1 ||
+			diff.Cards.Edited[0].Changes["title"] != (valueDiff{From: "stays", To: "stayed"}) {
+			t.Errorf("edited = %+v, want only the title change", diff.Cards.Edited)
+		}
+		if len(diff.Columns.Changed) != 1 || diff.Columns.Changed[0].Changes["title"] != (valueDiff{From: "Done", To: "Shipped"}) {
+			t.Errorf("columns changed = %+v, want the rename", diff.Columns.Changed)
+		}
+
+		// the same range backwards is the inverse
+		var back boardDiff
+		do(t, h, http.MethodGet, base+"/diff?from="+strconv.FormatInt(diff.To, 10)+"&to="+strconv.FormatInt(from, 10), nil, &back)
+		if len(back.Cards.Restored) != 1 || back.Cards.Restored[0].CardID != goes || len(back.Cards.Removed) != 1 || len(back.Cards.Added) != 0 {
+			t.Errorf("reverse diff = %+v, want the archived card restored and the added one removed", back.Cards)
+		}
+	})
+}
+
+// TestActorMetadata covers the identity layer: the caller's display name and
+// request ID are stamped on the events they append and show up in the
+// activity feed, which can be filtered by actor.
+func TestActorMetadata(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	// as handled by do, plus a display name header
+	as := func(actor, method, path string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		if actor != "" {
+			req.Header.Set(actorHeader, actor)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code >= 300 {
+			t.Fatalf("%s %s as %q = %d: %s", method, path, actor, rec.Code, rec.Body)
+		}
+		return rec
+	}
+
+	var created boardMessage
+	json.Unmarshal(as("ada", http.MethodPost, "/api/boards", map[string]string{"name": "Who"}).Body.Bytes(), &created)
+	base := "/api/boards/" + created.Board.ID.String()
+	as("grace", http.MethodPost, base+"/columns", map[string]any{"title": "To Do"})
+	rec := as("", http.MethodPost, base+"/rename", map[string]any{"name": "Who did it"})
+	requestID := rec.Header().Get(requestIDHeader)
+	if requestID == "" {
+		t.Errorf("no %s in the response", requestIDHeader)
+	}
+
+	var activity []activityEntry
+	do(t, h, http.MethodGet, base+"/activity", nil, &activity)
+	got := make([]string, len(activity))
+	for i, entry := range activity {
+		got[i] = entry.Actor
+	}
+	if want := []string{"ada", "grace", anonymousActor}; !reflect.DeepEqual(got, want) {
+		t.Errorf("actors = %q, want %q", got, want)
+	}
+	if activity[2].RequestID != requestID {
+		t.Errorf("request ID = %q, want %q from the response", activity[2].RequestID, requestID)
+	}
+
+	do(t, h, http.MethodGet, base+"/activity?actor=Grace", nil, &activity)
+	if len(activity) != 1 || activity[0].Description != `added column "To Do"` {
+		t.Errorf("activity by grace = %+v, want just the column", activity)
+	}
+
+	t.Run("the display name can be set in a cookie", func(t *testing.T) {
+		rec := as("", http.MethodPost, "/api/identity", map[string]string{"name": "  Linus Åberg \n"})
+		cookies := rec.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != actorCookie {
+			t.Fatalf("cookies = %v, want %s", cookies, actorCookie)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/identity", nil)
+		req.AddCookie(cookies[0])
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		var me struct {
+			Actor string `json:"actor"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &me)
+		if me.Actor != "Linus Åberg" {
+			t.Errorf("actor = %q, want the trimmed name from the cookie", me.Actor)
+		}
+	})
+}
+
+// TestWatchDeltas covers the watch stream: a full board to start, then one
+// message per event, and on reconnect, the events after Last-Event-ID — or the
+// full board again when too many were missed.
+func TestWatchDeltas(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Live"}, &created)
+	base := "/api/boards/" + created.Board.ID.String()
+
+	// watch connects to the board's stream and returns a function that reads
+	// the next SSE message's id and data, skipping keepalives.
+	watch := func(lastEventID string) (next func() (id string, msg map[string]any), stop func()) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+base+"/watch", nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := bufio.NewReader(res.Body)
+
+		next = func() (id string, msg map[string]any) {
+			t.Helper()
+			for {
+				line, err := lines.ReadString('\n')
+				if err != nil {
+					t.Fatalf("reading the watch stream: %v", err)
+				}
+				line = strings.TrimSuffix(line, "\n")
+				if v, ok := strings.CutPrefix(line, "id: "); ok {
+					id = v
+				} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+					if err := json.Unmarshal([]byte(v), &msg); err != nil {
+						t.Fatal(err)
+					}
+				} else if line == "" && msg != nil {
+					return id, msg
+				}
+			}
+		}
+		return next, func() { cancel(); res.Body.Close() }
+	}
+
+	next, stop := watch("")
+	if id, msg := next(); msg["type"] != "board" || id != "1" {
+		t.Fatalf("first message = id %s %v, want the whole board at v1", id, msg)
+	}
+
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "To Do"}, nil)
+	id, msg := next()
+	if msg["type"] != "event" || msg["eventType"] != "columnadded" || id != "2" || msg["version"] != float64(2) {
+		t.Errorf("after adding a column = id %s %v, want the columnadded event at v2", id, msg)
+	}
+	if data, _ := msg["data"].(map[string]any); data["title"] != "To Do" {
+		t.Errorf("event data = %v, want the column", msg["data"])
+	}
+	stop()
+
+	// missed while disconnected, then replayed on reconnect
+	do(t, h, http.MethodPost, base+"/rename", map[string]any{"name": "Live 2"}, nil)
+	do(t, h, http.MethodPost, base+"/rename", map[string]any{"name": "Live 3"}, nil)
+
+	next, stop = watch("2")
+	for _, want := range []string{"3", "4"} {
+		if id, msg := next(); id != want || msg["eventType"] != "boardrenamed" {
+			t.Errorf("replayed id %s %v, want the rename at v%s", id, msg, want)
+		}
+	}
+	stop()
+
+	// too far behind: the board, not a hundred events
+	for i := range maxReplayEvents + 1 {
+		do(t, h, http.MethodPost, base+"/rename", map[string]any{"name": fmt.Sprintf("Live %d", i+4)}, nil)
+	}
+	next, stop = watch("4")
+	defer stop()
+	if id, msg := next(); msg["type"] != "board" || id != strconv.Itoa(5+maxReplayEvents) {
+		t.Errorf("after a long gap = id %s %v, want the whole board at v%d", id, msg, 5+maxReplayEvents)
+	}
+}
+
+// TestWatchResyncSendsThreads overflows a watcher's buffer with comments and
+// checks that the resync brings the client every comment it missed, not just
+// the board.
+func TestWatchResyncSendsThreads(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Chatty"}, &created)
+	base := "/api/boards/" + created.Board.ID.String()
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "To Do"}, nil)
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": board.Board.Columns[0].ID, "title": "busy"}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+	card := board.Board.Columns[0].Cards[0].ID
+
+	ch, ok := srv.hub.subscribe(created.Board.ID)
+	if !ok {
+		t.Fatal("subscribing to the hub failed")
+	}
+	defer srv.hub.unsubscribe(ch)
+
+	// more comments than the buffer holds, so the last ones are never queued
+	posted := cap(ch) + 3
+	for i := range posted {
+		do(t, h, http.MethodPost, base+"/cards/"+card+"/comments", map[string]any{"body": fmt.Sprintf("comment %d", i)}, nil)
+	}
+
+	var out bytes.Buffer
+	sent := board.Version
+	for len(ch) > 0 {
+		var err error
+		if sent, err = srv.relay(ctx, &out, ch, created.Board.ID, <-ch, sent); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var gotBoard bool
+	var latest threadMessage
+	for _, line := range strings.Split(out.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var msg threadMessage
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatal(err)
+		}
+		switch msg.Type {
+		case "board":
+			gotBoard = true
+		case "comments":
+			if msg.Version > latest.Version {
+				latest = msg
+			}
+		}
+	}
+	if !gotBoard {
+		t.Error("the overflowed client wasn't sent the whole board")
+	}
+	if len(latest.Comments) != posted {
+		t.Errorf("the client's newest thread has %d comments, want all %d posted", len(latest.Comments), posted)
+	}
+}
+
+// TestMergeMode covers rebasing stale commands: changes to different cards go
+// through, and only overlapping ones are refused, with the events in the way.
+func TestMergeMode(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Merge"}, &created)
+	base := "/api/boards/" + created.Board.ID.String()
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "To Do"}, nil)
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "Done"}, nil)
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	todo, done := board.Board.Columns[0].ID, board.Board.Columns[1].ID
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "mine"}, nil)
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "theirs"}, nil)
+	do(t, h, http.MethodPost, base+"/columns/"+done+"/wip-limit", map[string]any{"limit": 1}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+	stale := board.Version
+	mine, theirs := board.Board.Columns[0].Cards[0].ID, board.Board.Columns[0].Cards[1].ID
+
+	// someone else edits their card
+	do(t, h, http.MethodPost, base+"/cards/"+theirs+"/edit", map[string]any{"title": "theirs, edited"}, nil)
+
+	type conflict struct {
+		Error     string          `json:"error"`
+		Message   string          `json:"message"`
+		Conflicts []activityEntry `json:"conflicts"`
+	}
+	post := func(path string, body map[string]any, out any) int {
+		body["baseVersion"] = stale
+		return do(t, h, http.MethodPost, base+path, body, out)
+	}
+
+	if code := post("/cards/"+mine+"/edit", map[string]any{"title": "mine, edited"}, nil); code != http.StatusConflict {
+		t.Errorf("a stale command without merge mode = %d, want 409", code)
+	}
+
+	var merged struct {
+		Version int64 `json:"version"`
+		Merged  int   `json:"merged"`
+	}
+	if code := post("/cards/"+mine+"/edit?merge=true", map[string]any{"title": "mine, edited"}, &merged); code != http.StatusOK {
+		t.Fatalf("editing a different card in merge mode = %d, want 200", code)
+	}
+	if merged.Version != stale+2 || merged.Merged != 1 {
+		t.Errorf("merge = %+v, want v%d rebased over 1 event", merged, stale+2)
+	}
+	do(t, h, http.MethodGet, base, nil, &board)
+	if cards := board.Board.Columns[0].Cards; cards[0].Title != "mine, edited" || cards[1].Title != "theirs, edited" {
+		t.Errorf("cards = %+v, want both edits kept", cards)
+	}
+
+	t.Run("the same card conflicts", func(t *testing.T) {
+		var got conflict
+		rec := httptest.NewRecorder()
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(map[string]any{"baseVersion": stale, "title": "mine instead"})
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, base+"/cards/"+theirs+"/edit?merge=true", &buf))
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("editing the same card = %d, want 409", rec.Code)
+		}
+		json.Unmarshal(rec.Body.Bytes(), &got)
+		if got.Error != "version_conflict" || len(got.Conflicts) != 1 || got.Conflicts[0].Version != stale+1 ||
+			got.Conflicts[0].Description != `renamed "theirs" to "theirs, edited"` {
+			t.Errorf("conflict = %+v, want just the other edit", got)
+		}
+	})
+
+	t.Run("a column restructured under a card conflicts", func(t *testing.T) {
+		do(t, h, http.MethodPost, base+"/columns/"+todo+"/rename", map[string]any{"title": "Backlog"}, nil)
+		if code := post("/cards?merge=true", map[string]any{"columnId": todo, "title": "new"}, nil); code != http.StatusConflict {
+			t.Errorf("adding a card to a renamed column = %d, want 409", code)
+		}
+	})
+
+	t.Run("a rebased event that no longer applies conflicts", func(t *testing.T) {
+		do(t, h, http.MethodGet, base, nil, &board)
+		stale = board.Version
+		do(t, h, http.MethodPost, base+"/cards/"+theirs+"/move", map[string]any{"toColumnId": done}, nil)
+
+		var got conflict
+		rec := httptest.NewRecorder()
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(map[string]any{"baseVersion": stale, "toColumnId": done})
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, base+"/cards/"+mine+"/move?merge=true", &buf))
+		json.Unmarshal(rec.Body.Bytes(), &got)
+		if rec.Code != http.StatusConflict || !strings.Contains(got.Message, "WIP limit") || len(got.Conflicts) != 1 {
+			t.Errorf("moving into a column the other move filled = %d %+v, want 409 over the WIP limit", rec.Code, got)
+		}
+	})
+}
+
+func TestSnapshotPolicies(t *testing.T) {
+	t.Parallel()
+
+	board := typeid.New("board", uuid.Must(uuid.NewV4()))
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	timed := newTimeSnapshotPolicy(time.Hour)
+	if timed.ShouldSnapshot(board, 1, start) {
+		t.Error("time policy snapshotted a board it had never seen")
+	}
+	if timed.ShouldSnapshot(board, 2, start.Add(59*time.Minute)) {
+		t.Error("time policy snapshotted before the interval passed")
+	}
+	if !timed.ShouldSnapshot(board, 3, start.Add(time.Hour)) {
+		t.Error("time policy didn't snapshot once the interval passed")
+	}
+	if timed.ShouldSnapshot(board, 4, start.Add(time.Hour)) {
+		t.Error("time policy snapshotted twice in one save")
+	}
+	timed.snapshotTaken(board, start.Add(90*time.Minute))
+	if timed.ShouldSnapshot(board, 5, start.Add(2*time.Hour)) {
+		t.Error("time policy ignored a snapshot taken on demand")
+	}
+
+	policy, err := newSnapshotPolicy(countOrTimePolicyName, 3, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var taken []int64
+	for v, at := range []time.Time{start, start, start, start.Add(30 * time.Minute), start.Add(70 * time.Minute), start.Add(2 * time.Hour)} {
+		if policy.ShouldSnapshot(board, int64(v+1), at) {
+			taken = append(taken, int64(v+1))
+		}
+	}
+	// v3 by count, which restarts the clock; v5 by time, over an hour
+	// after that; v6 by count again
+	if !slices.Equal(taken, []int64{3, 5, 6}) {
+		t.Errorf("count-or-time snapshots at %v, want [3 5 6]", taken)
+	}
+	if got := policy.String(); got != "every 3 events or 1h0m0s" {
+		t.Errorf("count-or-time policy describes itself as %q", got)
+	}
+
+	if _, err := newSnapshotPolicy("sometimes", 10, time.Hour); err == nil {
+		t.Error("an unknown policy name was accepted")
+	}
+	if _, err := newSnapshotPolicy(timePolicyName, 10, 0); err == nil {
+		t.Error("the time policy was accepted without an interval")
+	}
+}
+
+func TestSnapshotsAPI(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Snapshots"}, &created)
+	boardID := created.Board.ID.String()
+	base := "/api/boards/" + boardID
+	snapshots := base + "/snapshots"
+	for i := range 12 {
+		do(t, h, http.MethodPost, base+"/rename", map[string]any{"name": fmt.Sprint("rename ", i)}, nil)
+	}
+
+	type listing struct {
+		Policy    string         `json:"policy"`
+		Snapshots []snapshotInfo `json:"snapshots"`
+	}
+	var list listing
+	if code := do(t, h, http.MethodGet, snapshots, nil, &list); code != http.StatusOK {
+		t.Fatalf("list = %d", code)
+	}
+	if list.Policy != "every 10 events" || len(list.Snapshots) != 1 || list.Snapshots[0].AggregateVersion != 10 {
+		t.Fatalf("list = %+v, want the count policy's snapshot at v10", list)
+	}
+
+	var snap snapshotInfo
+	if code := do(t, h, http.MethodPost, snapshots, nil, &snap); code != http.StatusCreated {
+		t.Fatalf("take = %d, want 201", code)
+	}
+	if snap.Version != 2 || snap.AggregateVersion != 13 || snap.Size == 0 {
+		t.Errorf("taken snapshot = %+v, want stream v2 of board v13", snap)
+	}
+	if code := do(t, h, http.MethodPost, snapshots, nil, &snap); code != http.StatusOK || snap.Version != 2 {
+		t.Errorf("taking a snapshot of an unchanged board = %d %+v, want 200 with the existing one", code, snap)
+	}
+
+	do(t, h, http.MethodPost, base+"/rename", map[string]any{"name": "last"}, nil)
+	do(t, h, http.MethodPost, snapshots, nil, &snap)
+
+	var pruned struct {
+		Pruned    int64          `json:"pruned"`
+		Snapshots []snapshotInfo `json:"snapshots"`
+	}
+	if code := do(t, h, http.MethodDelete, snapshots+"?keep=1", nil, &pruned); code != http.StatusOK {
+		t.Fatalf("prune = %d", code)
+	}
+	if pruned.Pruned != 2 || len(pruned.Snapshots) != 1 || pruned.Snapshots[0].AggregateVersion != 14 {
+		t.Errorf("prune = %+v, want 2 pruned and the v14 snapshot kept", pruned)
+	}
+	do(t, h, http.MethodGet, snapshots, nil, &list)
+	if len(list.Snapshots) != 1 || list.Snapshots[0].Version != 3 {
+		t.Errorf("after pruning, list = %+v, want only stream v3", list.Snapshots)
+	}
+
+	// loads still start from the snapshot kept, and new ones carry on after it
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	if board.Version != 14 || board.Board.Name != "last" {
+		t.Errorf("after pruning, board = v%d %q, want v14 \"last\"", board.Version, board.Board.Name)
+	}
+	do(t, h, http.MethodPost, base+"/rename", map[string]any{"name": "after"}, nil)
+	if do(t, h, http.MethodPost, snapshots, nil, &snap); snap.Version != 4 {
+		t.Errorf("snapshot after pruning = %+v, want stream v4", snap)
+	}
+
+	var stats struct {
+		SnapshotPolicy string   `json:"snapshotPolicy"`
+		StoreStack     []string `json:"storeStack"`
+	}
+	do(t, h, http.MethodGet, base+"/stats", nil, &stats)
+	if stats.SnapshotPolicy != "every 10 events" || !slices.Contains(stats.StoreStack, "SnapshottingStore (snapshot every 10 events)") {
+		t.Errorf("stats = %+v, want the count policy reported", stats)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/boards/not-a-board/snapshots", http.StatusBadRequest},
+		{http.MethodDelete, snapshots + "?keep=-1", http.StatusBadRequest},
+		{http.MethodPost, "/api/boards/" + uuid.Must(uuid.NewV4()).String() + "/snapshots", http.StatusNotFound},
+	} {
+		if code := do(t, h, tc.method, tc.path, nil, nil); code != tc.want {
+			t.Errorf("%s %s = %d, want %d", tc.method, tc.path, code, tc.want)
+		}
+	}
+}
+
+func TestCloneAndTemplates(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Original"}, &created)
+	base := "/api/boards/" + created.Board.ID.String()
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "To Do"}, nil)
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "Doing"}, nil)
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	todo, doing := board.Board.Columns[0].ID, board.Board.Columns[1].ID
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "detailed", "color": "red", "colorLabel": "urgent"}, nil)
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": doing, "title": "plain"}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+	card := board.Board.Columns[0].Cards[0].ID
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/assign", map[string]any{"assignee": "ada"}, nil)
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/labels", map[string]any{"labels": []string{"bug"}}, nil)
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/due-date", map[string]any{"dueDate": "2026-12-01"}, nil)
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/checklist", map[string]any{"text": "one"}, nil)
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/checklist", map[string]any{"text": "two"}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+	item := board.Board.Columns[0].Cards[0].Checklist[0].ID
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/checklist/"+item+"/toggle", map[string]any{"done": true}, nil)
+	do(t, h, http.MethodPost, base+"/columns/"+doing+"/wip-limit", map[string]any{"limit": 1}, nil)
+	var then boardMessage
+	do(t, h, http.MethodGet, base, nil, &then)
+
+	// later changes stay out of a clone of the earlier version
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/edit", map[string]any{"title": "edited"}, nil)
+	do(t, h, http.MethodPost, base+"/rename", map[string]any{"name": "Renamed"}, nil)
+
+	withoutIDs := func(b Board) Board {
+		b = b.clone()
+		b.ID, b.Name = uuid.Nil, ""
+		for i := range b.Columns {
+			b.Columns[i].ID = ""
+			for j := range b.Columns[i].Cards {
+				b.Columns[i].Cards[j].ID = ""
+				for k := range b.Columns[i].Cards[j].Checklist {
+					b.Columns[i].Cards[j].Checklist[k].ID = ""
+				}
+			}
+		}
+		return b
+	}
+
+	var clone boardMessage
+	if code := do(t, h, http.MethodPost, fmt.Sprintf("%s/clone?version=%d", base, then.Version), nil, &clone); code != http.StatusCreated {
+		t.Fatalf("cloning v%d = %d, want 201", then.Version, code)
+	}
+	if clone.Board.Name != fmt.Sprintf("Original (copy of v%d)", then.Version) {
+		t.Errorf("clone is named %q", clone.Board.Name)
+	}
+	if !reflect.DeepEqual(withoutIDs(clone.Board), withoutIDs(then.Board)) {
+		t.Errorf("clone = %+v\nwant %+v", clone.Board, then.Board)
+	}
+	// the board, two columns, two cards, an assignee, labels, a due date, two
+	// checklist items, one checked, and a WIP limit
+	if clone.Version != 12 {
+		t.Errorf("clone took %d events, want 12", clone.Version)
+	}
+	if clone.Board.ID == created.Board.ID || clone.Board.Columns[0].ID == todo || clone.Board.Columns[0].Cards[0].ID == card {
+		t.Error("the clone reused IDs from the original")
+	}
+	var activity []activityEntry
+	do(t, h, http.MethodGet, "/api/boards/"+clone.Board.ID.String()+"/activity", nil, &activity)
+	if len(activity) != 12 {
+		t.Errorf("clone's stream has %d events, want 12", len(activity))
+	}
+
+	do(t, h, http.MethodPost, base+"/clone", map[string]string{"name": "Latest"}, &clone)
+	if clone.Board.Name != "Latest" || clone.Board.Columns[0].Cards[0].Title != "edited" {
+		t.Errorf("clone of the latest version = %+v", clone.Board)
+	}
+	if code := do(t, h, http.MethodPost, base+"/clone?version=soon", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("cloning version \"soon\" = %d, want 400", code)
+	}
+
+	// a name at the limit is cut short so the default suffix still fits
+	long := strings.Repeat("é", maxTitleLength/2)
+	do(t, h, http.MethodPost, base+"/rename", map[string]any{"name": long}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+	if code := do(t, h, http.MethodPost, base+"/clone", nil, &clone); code != http.StatusCreated {
+		t.Fatalf("cloning a board with a %d-byte name = %d, want 201", len(long), code)
+	}
+	suffix := fmt.Sprintf(" (copy of v%d)", board.Version)
+	if name := clone.Board.Name; len(name) > maxTitleLength || !strings.HasSuffix(name, suffix) || !utf8.ValidString(name) {
+		t.Errorf("clone of a long-named board is named %q", name)
+	}
+
+	var templates []struct {
+		ID      string   `json:"id"`
+		Name    string   `json:"name"`
+		Columns []string `json:"columns"`
+	}
+	do(t, h, http.MethodGet, "/api/templates", nil, &templates)
+	if len(templates) != len(boardTemplates) {
+		t.Fatalf("catalog lists %d templates, want %d", len(templates), len(boardTemplates))
+	}
+	for _, tmpl := range templates {
+		var fromTemplate boardMessage
+		if code := do(t, h, http.MethodPost, "/api/boards", map[string]string{"template": tmpl.ID}, &fromTemplate); code != http.StatusCreated {
+			t.Errorf("creating a board from %q = %d, want 201", tmpl.ID, code)
+			continue
+		}
+		if fromTemplate.Board.Name != tmpl.Name || len(fromTemplate.Board.Columns) != len(tmpl.Columns) {
+			t.Errorf("board from %q = %+v, want %q with columns %v", tmpl.ID, fromTemplate.Board, tmpl.Name, tmpl.Columns)
+		}
+	}
+	if code := do(t, h, http.MethodPost, "/api/boards", map[string]string{"template": "waterfall"}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("an unknown template = %d, want 422", code)
+	}
+}
+
+func TestArchiveAndRestore(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Archive"}, &created)
+	boardID := created.Board.ID.String()
+	base := "/api/boards/" + boardID
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "To Do"}, nil)
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "Later"}, nil)
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	todo, later := board.Board.Columns[0].ID, board.Board.Columns[1].ID
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "keep me"}, nil)
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": later, "title": "someday"}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+	keep, someday := board.Board.Columns[0].Cards[0].ID, board.Board.Columns[1].Cards[0].ID
+	do(t, h, http.MethodPost, base+"/cards/"+keep+"/labels", map[string]any{"labels": []string{"kept"}}, nil)
+
+	type archive struct {
+		Cards []archiveEntry `json:"cards"`
+	}
+	restore := func(cardID string, body map[string]any) int {
+		return do(t, h, http.MethodPost, base+"/cards/"+cardID+"/restore", body, nil)
+	}
+
+	// a card on the board can't be deleted outright
+	if code := do(t, h, http.MethodPost, base+"/cards/"+keep+"/delete", map[string]any{}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("deleting an unarchived card = %d, want 422", code)
+	}
+
+	do(t, h, http.MethodPost, base+"/cards/"+keep+"/archive", map[string]any{}, nil)
+	do(t, h, http.MethodPost, base+"/cards/"+someday+"/archive", map[string]any{}, nil)
+	var listed archive
+	if code := do(t, h, http.MethodGet, base+"/archive", nil, &listed); code != http.StatusOK {
+		t.Fatalf("GET archive = %d", code)
+	}
+	if len(listed.Cards) != 2 || listed.Cards[0].Card.ID != keep || listed.Cards[0].ColumnTitle != "To Do" || !listed.Cards[0].ColumnExists {
+		t.Fatalf("archive = %+v, want both cards, 'keep me' first from To Do", listed.Cards)
+	}
+
+	// restore puts a card back in its column, whatever column is asked for
+	if code := restore(keep, map[string]any{"columnId": later}); code != http.StatusOK {
+		t.Fatalf("restoring = %d, want 200", code)
+	}
+	do(t, h, http.MethodGet, base, nil, &board)
+	if cards := board.Board.Columns[0].Cards; len(cards) != 1 || cards[0].ID != keep || cards[0].Labels[0] != "kept" {
+		t.Errorf("To Do after restoring = %+v, want 'keep me' back with its labels", cards)
+	}
+	if code := restore(keep, map[string]any{}); code != http.StatusUnprocessableEntity {
+		t.Errorf("restoring a card on the board = %d, want 422", code)
+	}
+
+	// with its column gone, the card needs somewhere else to go
+	do(t, h, http.MethodPost, base+"/columns/"+later+"/delete", map[string]any{}, nil)
+	do(t, h, http.MethodGet, base+"/archive", nil, &listed)
+	if len(listed.Cards) != 1 || listed.Cards[0].ColumnExists {
+		t.Fatalf("archive = %+v, want 'someday' with its column gone", listed.Cards)
+	}
+	if code := restore(someday, map[string]any{}); code != http.StatusUnprocessableEntity {
+		t.Errorf("restoring into a removed column = %d, want 422", code)
+	}
+	if code := restore(someday, map[string]any{"columnId": todo}); code != http.StatusOK {
+		t.Fatalf("restoring into a chosen column = %d, want 200", code)
+	}
+	do(t, h, http.MethodGet, base, nil, &board)
+	if cards := board.Board.Columns[0].Cards; len(cards) != 2 || cards[1].ID != someday {
+		t.Errorf("To Do after restoring = %+v, want 'someday' at the bottom", cards)
+	}
+
+	// a purge is for good
+	do(t, h, http.MethodPost, base+"/cards/"+someday+"/archive", map[string]any{}, nil)
+	var purged struct {
+		Version int64 `json:"version"`
+	}
+	if code := do(t, h, http.MethodPost, base+"/cards/"+someday+"/delete", map[string]any{}, &purged); code != http.StatusOK {
+		t.Fatalf("deleting an archived card = %d, want 200", code)
+	}
+	do(t, h, http.MethodGet, base+"/archive", nil, &listed)
+	if len(listed.Cards) != 0 {
+		t.Errorf("archive after deleting = %+v, want it empty", listed.Cards)
+	}
+	if code := restore(someday, map[string]any{}); code != http.StatusUnprocessableEntity {
+		t.Errorf("restoring a deleted card = %d, want 422", code)
+	}
+	if code := do(t, h, http.MethodPost, base+"/undo", map[string]any{"baseVersion": purged.Version, "version": purged.Version}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("undoing a delete = %d, want 422", code)
+	}
+}
+
+// TestCardDescriptions covers Markdown descriptions: validated on the way in,
+// stored as written, and rendered in what the API sends.
+func TestCardDescriptions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Described"}, &created)
+	base := "/api/boards/" + created.Board.ID.String()
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "To Do"}, nil)
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	todo := board.Board.Columns[0].ID
+
+	tooManyLinks := strings.Repeat("<https://example.com> ", maxDescriptionLinks+1)
+	if code := do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "spam", "description": tooManyLinks}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("adding a card with %d links = %d, want 422", maxDescriptionLinks+1, code)
+	}
+
+	const source = "Fix **this** <script>alert(1)</script>"
+	const rendered = "<p>Fix <strong>this</strong> &lt;script&gt;alert(1)&lt;/script&gt;</p>\n"
+	if code := do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "bug", "description": source}, nil); code != http.StatusOK {
+		t.Fatalf("adding a described card = %d, want 200", code)
+	}
+	do(t, h, http.MethodGet, base, nil, &board)
+	card := board.Board.Columns[0].Cards[0]
+	if card.Description != source || card.DescriptionHTML != rendered {
+		t.Errorf("card = %q rendered as %q, want %q rendered as %q", card.Description, card.DescriptionHTML, source, rendered)
+	}
+
+	// the event holds the Markdown only, and the watch stream renders it
+	deltas, err := srv.readDeltas(ctx, created.Board.ID, eventstore.ReadStreamOptions{Direction: eventstore.Reverse, Count: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delta := deltas[0]; delta.DescriptionHTML != rendered || bytes.Contains(delta.Data, []byte("descriptionHtml")) {
+		t.Errorf("delta = %s with %q, want the event's data and the rendered description", delta.Data, delta.DescriptionHTML)
+	}
+}
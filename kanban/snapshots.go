@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-estoria/estoria"
+	"github.com/go-estoria/estoria/aggregatestore"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/go-estoria/estoria/snapshotstore"
+	"github.com/go-estoria/estoria/typeid"
+	"github.com/gofrs/uuid/v5"
+)
+
+// Snapshots are an optimization, never the source of truth: every one of them
+// can be rebuilt from the board's stream. That is what makes it safe to take
+// them whenever it suits (on a count, on a clock, or on request) and to prune
+// old ones, which is the one place this app deletes events it didn't seed.
+
+// A snapshotPolicy decides when the snapshotting store takes a snapshot, and
+// describes itself for the stats panel.
+type snapshotPolicy interface {
+	aggregatestore.SnapshotPolicy
+	fmt.Stringer
+
+	// snapshotTaken tells the policy a snapshot was written outside of it,
+	// so a clock-based policy can start counting again from there.
+	snapshotTaken(aggregateID typeid.ID, at time.Time)
+}
+
+// The names accepted by -snapshot-policy.
+const (
+	countPolicyName       = "count"
+	timePolicyName        = "time"
+	countOrTimePolicyName = "count-or-time"
+	onDemandPolicyName    = "on-demand"
+)
+
+// newSnapshotPolicy builds the policy named by -snapshot-policy from the
+// count and interval flags; a policy ignores whichever of the two it doesn't
+// use.
+func newSnapshotPolicy(name string, every int64, interval time.Duration) (snapshotPolicy, error) {
+	switch name {
+	case countPolicyName:
+		if every < 1 {
+			return nil, errors.New("-snapshot-every must be at least 1 for the count policy")
+		}
+		return countSnapshotPolicy{snapshotstore.EventCountSnapshotPolicy{N: every}}, nil
+	case timePolicyName:
+		if interval <= 0 {
+			return nil, errors.New("-snapshot-interval must be positive for the time policy")
+		}
+		return newTimeSnapshotPolicy(interval), nil
+	case countOrTimePolicyName:
+		if every < 1 || interval <= 0 {
+			return nil, errors.New("the count-or-time policy needs -snapshot-every of at least 1 and a positive -snapshot-interval")
+		}
+		return &countOrTimeSnapshotPolicy{
+			count: snapshotstore.EventCountSnapshotPolicy{N: every},
+			time:  newTimeSnapshotPolicy(interval),
+		}, nil
+	case onDemandPolicyName:
+		return onDemandSnapshotPolicy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown snapshot policy %q (want %s, %s, %s, or %s)", name,
+			countPolicyName, timePolicyName, countOrTimePolicyName, onDemandPolicyName)
+	}
+}
+
+// snapshotEveryOf returns how many events apart policy takes snapshots, or 0
+// when it doesn't count events.
+func snapshotEveryOf(policy snapshotPolicy) int64 {
+	switch p := policy.(type) {
+	case countSnapshotPolicy:
+		return p.N
+	case *countOrTimeSnapshotPolicy:
+		return p.count.N
+	}
+	return 0
+}
+
+// A countSnapshotPolicy is estoria's event count policy: a snapshot every N
+// events.
+type countSnapshotPolicy struct {
+	snapshotstore.EventCountSnapshotPolicy
+}
+
+func (p countSnapshotPolicy) String() string {
+	return "every " + strconv.FormatInt(p.N, 10) + " events"
+}
+
+func (countSnapshotPolicy) snapshotTaken(typeid.ID, time.Time) {}
+
+// A timeSnapshotPolicy takes a snapshot once a board's latest snapshot is
+// older than the interval, however few events that covers.
+//
+// It only knows about snapshots taken since the server started. A board it
+// hasn't seen yet starts its clock at its first save rather than being
+// snapshotted straight away, so a restart doesn't snapshot every board that
+// is touched. The snapshotting store asks once per saved event, all with the
+// same time, so the snapshot lands on the first event of the save that finds
+// the interval passed.
+type timeSnapshotPolicy struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	last map[typeid.ID]time.Time
+}
+
+func newTimeSnapshotPolicy(interval time.Duration) *timeSnapshotPolicy {
+	return &timeSnapshotPolicy{interval: interval, last: map[typeid.ID]time.Time{}}
+}
+
+func (p *timeSnapshotPolicy) ShouldSnapshot(aggregateID typeid.ID, _ int64, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	last, seen := p.last[aggregateID]
+	if seen && now.Sub(last) < p.interval {
+		return false
+	}
+	p.last[aggregateID] = now
+	return seen
+}
+
+func (p *timeSnapshotPolicy) snapshotTaken(aggregateID typeid.ID, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.last[aggregateID] = at
+}
+
+func (p *timeSnapshotPolicy) String() string {
+	return "every " + p.interval.String()
+}
+
+// A countOrTimeSnapshotPolicy takes a snapshot every N events, and also when
+// a board's latest snapshot is older than the interval — so a busy board is
+// snapshotted by count and a quiet one still gets one now and then. A
+// snapshot taken for either reason restarts the clock.
+type countOrTimeSnapshotPolicy struct {
+	count snapshotstore.EventCountSnapshotPolicy
+	time  *timeSnapshotPolicy
+}
+
+func (p *countOrTimeSnapshotPolicy) ShouldSnapshot(aggregateID typeid.ID, aggregateVersion int64, now time.Time) bool {
+	if p.count.ShouldSnapshot(aggregateID, aggregateVersion, now) {
+		p.time.snapshotTaken(aggregateID, now)
+		return true
+	}
+	return p.time.ShouldSnapshot(aggregateID, aggregateVersion, now)
+}
+
+func (p *countOrTimeSnapshotPolicy) snapshotTaken(aggregateID typeid.ID, at time.Time) {
+	p.time.snapshotTaken(aggregateID, at)
+}
+
+func (p *countOrTimeSnapshotPolicy) String() string {
+	return "every " + strconv.FormatInt(p.count.N, 10) + " events or " + p.time.interval.String()
+}
+
+// An onDemandSnapshotPolicy never takes a snapshot by itself; they are taken
+// only through POST /api/boards/{id}/snapshots.
+type onDemandSnapshotPolicy struct{}
+
+func (onDemandSnapshotPolicy) ShouldSnapshot(typeid.ID, int64, time.Time) bool { return false }
+
+func (onDemandSnapshotPolicy) snapshotTaken(typeid.ID, time.Time) {}
+
+func (onDemandSnapshotPolicy) String() string { return "on demand only" }
+
+// snapshotInfo describes one snapshot in a board's snapshot stream. The board
+// itself is left out; it is what the board looked like at AggregateVersion.
+type snapshotInfo struct {
+	Version          int64     `json:"version"` // position in the snapshot stream
+	AggregateVersion int64     `json:"aggregateVersion"`
+	Timestamp        time.Time `json:"timestamp"`
+	Size             int       `json:"size"` // bytes of board JSON
+}
+
+// handleListSnapshots answers GET /api/boards/{id}/snapshots, oldest first.
+func (s *server) handleListSnapshots(w http.ResponseWriter, r *http.Request) {
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	s.resetMu.RLock()
+	defer s.resetMu.RUnlock()
+
+	snapshots, err := s.readSnapshots(r.Context(), boardID, eventstore.ReadStreamOptions{})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"boardId":   boardID.String(),
+		"policy":    s.snapshotPolicy.String(),
+		"snapshots": snapshots,
+	})
+}
+
+// handleTakeSnapshot answers POST /api/boards/{id}/snapshots by snapshotting the
+// board at its latest version, whatever the policy. A board whose latest
+// snapshot is already current isn't snapshotted twice: that one is returned
+// with a 200 instead of a 201.
+func (s *server) handleTakeSnapshot(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	s.resetMu.RLock()
+	defer s.resetMu.RUnlock()
+
+	agg, err := s.live.Load(ctx, boardID, nil)
+	if err != nil {
+		s.writeLoadError(w, err)
+		return
+	}
+
+	latest, err := s.readSnapshots(ctx, boardID, eventstore.ReadStreamOptions{
+		Direction: eventstore.Reverse,
+		Count:     1,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(latest) > 0 && latest[0].AggregateVersion == agg.Version() {
+		writeJSON(w, http.StatusOK, latest[0])
+		return
+	}
+
+	data, err := estoria.JSONMarshaler[Board]{}.MarshalEntity(agg.Entity())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	now := time.Now()
+	if err := s.snapshots.WriteSnapshot(ctx, &snapshotstore.AggregateSnapshot{
+		AggregateID:      agg.ID(),
+		AggregateVersion: agg.Version(),
+		Timestamp:        now,
+		Data:             data,
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.snapshotPolicy.snapshotTaken(agg.ID(), now)
+
+	// read it back, so the response says where in the stream it landed
+	latest, err = s.readSnapshots(ctx, boardID, eventstore.ReadStreamOptions{
+		Direction: eventstore.Reverse,
+		Count:     1,
+	})
+	if err != nil || len(latest) == 0 {
+		writeError(w, http.StatusInternalServerError, "reading back the snapshot: "+fmt.Sprint(err))
+		return
+	}
+	writeJSON(w, http.StatusCreated, latest[0])
+}
+
+// handlePruneSnapshots answers DELETE /api/boards/{id}/snapshots?keep=N by
+// deleting all but the newest N snapshots (1 if keep is left out). Keeping 0
+// is allowed: loads then replay the board from its first event until the
+// policy takes another.
+//
+// This is the one delete outside the demo reset, and it is allowed because
+// a snapshot is not history: it is a copy of the board the events already
+// describe, read only by loads, which replay the events when there isn't
+// one. Nothing in a board's own stream is ever deleted.
+//
+// estoria's event stores are append-only, so the rows are deleted from the
+// events table directly, the way the demo reset clears it. The snapshot stream
+// keeps its version counter, so the snapshots left keep their versions and
+// the next one continues from there; only older ones go, so the latest
+// snapshot, which is all a load ever reads, stays where it was.
+func (s *server) handlePruneSnapshots(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	keep := 1
+	if value := r.URL.Query().Get("keep"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "keep must be a number of snapshots, 0 or more")
+			return
+		}
+		keep = n
+	}
+
+	s.resetMu.RLock()
+	defer s.resetMu.RUnlock()
+
+	snapshots, err := s.readSnapshots(ctx, boardID, eventstore.ReadStreamOptions{})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var pruned int64
+	if len(snapshots) > keep {
+		// Snapshots are only ever appended, so everything up to the last one
+		// pruned is older than the ones kept, including any written meanwhile.
+		cutoff := snapshots[len(snapshots)-keep-1].Version
+		result, err := s.db.ExecContext(ctx,
+			"DELETE FROM "+eventsTable+" WHERE stream_type = ? AND stream_id = ? AND stream_offset <= ?",
+			snapshotStreamType, boardID.String(), cutoff)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if pruned, err = result.RowsAffected(); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		snapshots = snapshots[len(snapshots)-keep:]
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"pruned":    pruned,
+		"snapshots": snapshots,
+	})
+}
+
+// snapshotStreamType is the stream type estoria's event stream snapshot store
+// writes a board's snapshots under: the aggregate type plus "snapshot".
+const snapshotStreamType = "boardsnapshot"
+
+// readSnapshots reads a board's snapshot stream. A board with no snapshots
+// yet has no snapshot stream, which reads as none.
+func (s *server) readSnapshots(ctx context.Context, boardID uuid.UUID, opts eventstore.ReadStreamOptions) ([]snapshotInfo, error) {
+	snapshots := []snapshotInfo{}
+	err := readStream(ctx, s.events, typeid.New(snapshotStreamType, boardID), opts, func(evt *eventstore.Event) error {
+		var snap snapshotstore.AggregateSnapshot
+		if err := json.Unmarshal(evt.Data, &snap); err != nil {
+			return fmt.Errorf("decoding snapshot v%d: %w", evt.StreamVersion, err)
+		}
+		snapshots = append(snapshots, snapshotInfo{
+			Version:          evt.StreamVersion,
+			AggregateVersion: snap.AggregateVersion,
+			Timestamp:        evt.Timestamp,
+			Size:             len(snap.Data),
+		})
+		return nil
+	})
+	if errors.Is(err, eventstore.ErrStreamNotFound) {
+		return []snapshotInfo{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/go-estoria/estoria"
+	"github.com/go-estoria/estoria/aggregatestore"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/go-estoria/estoria/eventstore/projection"
+	"github.com/go-estoria/estoria/typeid"
+	"github.com/gofrs/uuid/v5"
+)
+
+// Undo and redo never rewrite history. Undoing the event at version N appends
+// a compensating event — its inverse, computed from the board as it was just
+// before N — that records N in its Reverts field. Redo is the same operation
+// aimed at a compensating event: it reverts the revert.
+//
+// The client keeps its own undo and redo stacks of the versions its commands
+// produced, and names the version to revert. Every event is stamped with the
+// display name of whoever appended it (see identity.go), and only that caller
+// can revert it; events from before the stamping, which name nobody, can be
+// reverted by anyone. The server also refuses when the card that event
+// touched has been changed again since, unless the later changes cancel out
+// (a change and its own undo).
+
+func (s *server) handleUndo(w http.ResponseWriter, r *http.Request) {
+	s.revert(w, r, false)
+}
+
+func (s *server) handleRedo(w http.ResponseWriter, r *http.Request) {
+	s.revert(w, r, true)
+}
+
+// revert appends the compensating event for the event at req.Version. The
+// event is read and checked against the stream as of req.BaseVersion, and
+// runCommand saves the inverse expecting that same version — so if anything
+// lands in between, the undo fails with a 409 like any other stale command.
+func (s *server) revert(w http.ResponseWriter, r *http.Request, redo bool) {
+	ctx := r.Context()
+
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	req, err := readJSON[struct {
+		BaseVersion int64 `json:"baseVersion"`
+		Version     int64 `json:"version"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.BaseVersion < 1 || req.Version < 1 || req.Version > req.BaseVersion {
+		writeError(w, http.StatusBadRequest, "version must name an event at or before baseVersion")
+		return
+	}
+
+	events, err := readBoardEvents(ctx, s.events, boardID, eventstore.ReadStreamOptions{
+		AfterVersion: req.Version - 1,
+		Count:        req.BaseVersion - req.Version + 1,
+	})
+	if errors.Is(err, eventstore.ErrStreamNotFound) {
+		writeError(w, http.StatusNotFound, "board not found")
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(events) == 0 || events[0].version != req.Version {
+		writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("there is no event at version %d", req.Version))
+		return
+	}
+
+	target := events[0]
+	if redo && revertedVersion(target.event) == 0 {
+		writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("version %d is not an undo, so there is nothing to redo", req.Version))
+		return
+	}
+
+	if caller := identityFrom(ctx).Actor; target.actor != "" && target.actor != caller {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("version %d was made by %s, so only they can revert it", req.Version, target.actor))
+		return
+	}
+
+	if later := changedSince(events); later > 0 {
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"error":   "undo_conflict",
+			"version": later,
+			"message": fmt.Sprintf("the card was changed again at version %d, so version %d can no longer be reverted", later, req.Version),
+		})
+		return
+	}
+
+	before := NewBoard(boardID)
+	if req.Version > 1 {
+		agg, err := s.history.Load(ctx, boardID, &aggregatestore.LoadOptions{ToVersion: req.Version - 1})
+		if err != nil {
+			s.writeLoadError(w, err)
+			return
+		}
+		before = agg.Entity()
+	}
+
+	inverse, err := inverseOf(target.event, target.version, before)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	s.runCommand(w, r, boardID, req.BaseVersion, func(Board) (estoria.EntityEvent[Board], error) {
+		return inverse, nil
+	})
+}
+
+// A versionedEvent is a decoded board event with the version and time it was
+// stored at, and the actor who appended it, if it was stamped with one. Raw is
+// the event as read, for callers that describe or pass it on as stored.
+type versionedEvent struct {
+	version   int64
+	timestamp time.Time
+	actor     string
+	event     estoria.EntityEvent[Board]
+	raw       *eventstore.Event
+}
+
+// readBoardEvents reads events from a board's stream and decodes each one.
+// Every read of a board's events goes through here, so they are upcast and
+// decoded the one way.
+func readBoardEvents(ctx context.Context, events eventstore.StreamReader, boardID uuid.UUID, opts eventstore.ReadStreamOptions) ([]versionedEvent, error) {
+	var decoded []versionedEvent
+	err := readStream(ctx, events, typeid.New("board", boardID), opts, func(evt *eventstore.Event) error {
+		event, err := decodeBoardEvent(evt.ID.Type, evt.Data)
+		if err != nil {
+			return err
+		}
+		decoded = append(decoded, versionedEvent{
+			version:   evt.StreamVersion,
+			timestamp: evt.Timestamp,
+			actor:     evt.Metadata[actorMetadataKey],
+			event:     event,
+			raw:       evt,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded, nil
+}
+
+// readStream hands each event read from a stream to handle, in order.
+func readStream(ctx context.Context, events eventstore.StreamReader, streamID typeid.ID, opts eventstore.ReadStreamOptions, handle func(*eventstore.Event) error) error {
+	iter, err := events.ReadStream(ctx, streamID, opts)
+	if err != nil {
+		return err
+	}
+	defer iter.Close(ctx)
+
+	proj, err := projection.New(iter)
+	if err != nil {
+		return err
+	}
+
+	_, err = proj.Project(ctx, projection.EventHandlerFunc(func(_ context.Context, evt *eventstore.Event) error {
+		return handle(evt)
+	}))
+	return err
+}
+
+// decodeBoardEvent turns raw event data back into its typed board event,
+// using the same prototypes the aggregate store is registered with.
+func decodeBoardEvent(eventType string, data []byte) (estoria.EntityEvent[Board], error) {
+	for _, proto := range boardEventPrototypes() {
+		if proto.EventType() != eventType {
+			continue
+		}
+
+		// prototypes are values; unmarshal into a fresh pointer to one
+		ptr := reflect.New(reflect.TypeOf(proto))
+		if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+			return nil, fmt.Errorf("decoding %s event: %w", eventType, err)
+		}
+		return ptr.Elem().Interface().(estoria.EntityEvent[Board]), nil
+	}
+
+	return nil, fmt.Errorf("unknown event type %q", eventType)
+}
+
+// inverseOf returns the compensating event for e, which was stored at version
+// and applied to before. Only card changes are invertible.
+func inverseOf(e estoria.EntityEvent[Board], version int64, before Board) (estoria.EntityEvent[Board], error) {
+	switch e := e.(type) {
+	case CardAdded:
+		return CardArchived{CardID: e.CardID, Reverts: version}, nil
+
+	case CardRestored:
+		return CardArchived{CardID: e.Card.ID, Reverts: version}, nil
+
+	case CardArchived:
+		return restoreAsBefore(e.CardID, version, before)
+
+	case CardRemoved:
+		// a purge is for good; only a removal from before the archive, which
+		// took the card off the board, can be put back
+		if !e.FromBoard {
+			return nil, fmt.Errorf("card %s was deleted for good", e.CardID)
+		}
+		return restoreAsBefore(e.CardID, version, before)
+
+	case CardMoved:
+		colIdx, cardIdx := before.findCard(e.CardID)
+		if colIdx < 0 {
+			return nil, fmt.Errorf("card %s was not on the board before version %d", e.CardID, version)
+		}
+		return CardMoved{
+			CardID:   e.CardID,
+			ToColumn: before.Columns[colIdx].ID,
+			ToIndex:  cardIdx,
+			Reverts:  version,
+		}, nil
+
+	case CardEdited:
+		card := before.card(e.CardID)
+		if card == nil {
+			return nil, fmt.Errorf("card %s was not on the board before version %d", e.CardID, version)
+		}
+		return CardEdited{
+			CardID:      e.CardID,
+			Title:       card.Title,
+			Description: card.Description,
+			Color:       card.Color,
+			Reverts:     version,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%s events can't be undone", e.EventType())
+}
+
+// restoreAsBefore returns the CardRestored that puts a card back where it was
+// in before, undoing the event stored at version.
+func restoreAsBefore(cardID string, version int64, before Board) (CardRestored, error) {
+	colIdx, cardIdx := before.findCard(cardID)
+	if colIdx < 0 {
+		return CardRestored{}, fmt.Errorf("card %s was not on the board before version %d", cardID, version)
+	}
+	return CardRestored{
+		Card:     before.Columns[colIdx].Cards[cardIdx],
+		ColumnID: before.Columns[colIdx].ID,
+		Index:    cardIdx,
+		Reverts:  version,
+	}, nil
+}
+
+// revertedVersion returns the version a compensating event reverts, or 0 for
+// any other event.
+func revertedVersion(e estoria.EntityEvent[Board]) int64 {
+	switch e := e.(type) {
+	case CardEdited:
+		return e.Reverts
+	case CardMoved:
+		return e.Reverts
+	case CardArchived:
+		return e.Reverts
+	case CardRemoved:
+		return e.Reverts
+	case CardRestored:
+		return e.Reverts
+	}
+	return 0
+}
+
+// touchedCard returns the ID of the card an event changes, or "" for events
+// that change no single card.
+func touchedCard(e estoria.EntityEvent[Board]) string {
+	switch e := e.(type) {
+	case CardAdded:
+		return e.CardID
+	case CardEdited:
+		return e.CardID
+	case CardMoved:
+		return e.CardID
+	case CardArchived:
+		return e.CardID
+	case CardRemoved:
+		return e.CardID
+	case CardRestored:
+		return e.Card.ID
+	case CardAssigned:
+		return e.CardID
+	case CardUnassigned:
+		return e.CardID
+	case CardLabeled:
+		return e.CardID
+	case CardDueDateSet:
+		return e.CardID
+	case ChecklistItemAdded:
+		return e.CardID
+	case ChecklistItemToggled:
+		return e.CardID
+	}
+	return ""
+}
+
+// changedSince returns the version of the first event after events[0] that
+// changed the same card, or 0 if there is none. A later event and the
+// compensating event that reverts it cancel out, so undoing a stack of changes
+// one at a time works: each undo only sees changes that are still in effect.
+func changedSince(events []versionedEvent) int64 {
+	target := events[0]
+	card := touchedCard(target.event)
+	if card == "" {
+		return 0
+	}
+
+	cancelled := map[int64]bool{}
+	for _, e := range events[1:] {
+		if reverted := revertedVersion(e.event); reverted > target.version {
+			cancelled[reverted], cancelled[e.version] = true, true
+		}
+	}
+
+	for _, e := range events[1:] {
+		if !cancelled[e.version] && touchedCard(e.event) == card {
+			return e.version
+		}
+	}
+	return 0
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	sqlstore "github.com/go-estoria/estoria-contrib/sqlite/eventstore"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/go-estoria/estoria/typeid"
+)
+
+// Events are never rewritten, so an event type's JSON can only change if
+// every old shape of it can still be read. (Old snapshots can be deleted, but
+// they are a cache of what the events say rather than history; see
+// handlePruneSnapshots.) Each event is stamped with the
+// schema version of its type when it is appended, and upcasters — one per
+// event type and version — turn old data into the current shape as it is
+// read back. Everything above the event store (the aggregate, the activity
+// feed, exports, the watch stream) only ever sees the current shape.
+//
+// Events stored before versioning existed carry no schema version; they are
+// version 1.
+
+// schemaVersionMetadataKey is the event metadata key holding the schema
+// version of the event's data.
+const schemaVersionMetadataKey = "schema_version"
+
+// An upcastFunc rewrites event data from one schema version of its type to
+// the next.
+type upcastFunc func(data []byte) ([]byte, error)
+
+// An upcasterRegistry holds the upcasters for each event type, keyed by the
+// schema version they read.
+type upcasterRegistry map[string]map[int]upcastFunc
+
+// boardUpcasters returns the upcasters for board events. A change to an
+// event's JSON adds one here, from the version it replaces.
+func boardUpcasters() upcasterRegistry {
+	r := upcasterRegistry{}
+	r.register(CardAdded{}.EventType(), 1, upcastCardColorV1)
+	r.register(CardEdited{}.EventType(), 1, upcastCardColorV1)
+	r.register(CardRestored{}.EventType(), 1, upcastCardRestoredV1)
+	r.register(CardRemoved{}.EventType(), 1, upcastCardRemovedV1)
+	return r
+}
+
+func (r upcasterRegistry) register(eventType string, from int, fn upcastFunc) {
+	if r[eventType] == nil {
+		r[eventType] = map[int]upcastFunc{}
+	}
+	r[eventType][from] = fn
+}
+
+// currentVersion returns the schema version events of the type are written
+// at: one past the last upcaster.
+func (r upcasterRegistry) currentVersion(eventType string) int {
+	version := 1
+	for r[eventType][version] != nil {
+		version++
+	}
+	return version
+}
+
+// upcast brings data stored at the given schema version up to the current
+// one, returning the data and the version it is now at.
+func (r upcasterRegistry) upcast(eventType string, version int, data []byte) ([]byte, int, error) {
+	if current := r.currentVersion(eventType); version < 1 || version > current {
+		return nil, 0, fmt.Errorf("%s event has schema version %d; this build reads 1 to %d", eventType, version, current)
+	}
+
+	for fn := r[eventType][version]; fn != nil; fn = r[eventType][version] {
+		var err error
+		if data, err = fn(data); err != nil {
+			return nil, 0, fmt.Errorf("upcasting %s event from schema version %d: %w", eventType, version, err)
+		}
+		version++
+	}
+	return data, version, nil
+}
+
+// upcastCardColorV1 reads the v1 color of CardAdded and CardEdited, a bare
+// palette name, into the v2 CardColor, which can also carry a label.
+func upcastCardColorV1(data []byte) ([]byte, error) {
+	return rewriteFields(data, upgradeColorV1)
+}
+
+// upcastCardRestoredV1 does the same for the whole card CardRestored carries.
+func upcastCardRestoredV1(data []byte) ([]byte, error) {
+	return rewriteFields(data, func(fields map[string]json.RawMessage) error {
+		card, ok := fields["card"]
+		if !ok {
+			return nil
+		}
+		card, err := rewriteFields(card, upgradeColorV1)
+		if err != nil {
+			return fmt.Errorf("card: %w", err)
+		}
+		fields["card"] = card
+		return nil
+	})
+}
+
+// upcastCardRemovedV1 marks a v1 CardRemoved, from before the archive, as
+// taking its card straight off the board. Its JSON is unchanged; what changed
+// is what a CardRemoved without the mark means.
+func upcastCardRemovedV1(data []byte) ([]byte, error) {
+	return rewriteFields(data, func(fields map[string]json.RawMessage) error {
+		fields["fromBoard"] = json.RawMessage("true")
+		return nil
+	})
+}
+
+// upgradeColorV1 replaces a v1 color field with its v2 form.
+func upgradeColorV1(fields map[string]json.RawMessage) error {
+	raw, ok := fields["color"]
+	if !ok {
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(raw, &name); err != nil {
+		return fmt.Errorf("v1 color: %w", err)
+	}
+	delete(fields, "color")
+	if name == "" {
+		return nil
+	}
+	color, err := json.Marshal(CardColor{Name: name})
+	if err != nil {
+		return err
+	}
+	fields["color"] = color
+	return nil
+}
+
+// rewriteFields decodes a JSON object, lets rewrite change its fields, and
+// encodes it again.
+func rewriteFields(data []byte, rewrite func(map[string]json.RawMessage) error) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if err := rewrite(fields); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// An upcastingStore is an event store decorator that stamps each appended
+// event with its schema version and upcasts each event read. It sits directly
+// on the SQLite store, below everything else, so no reader can see an old
+// shape by accident.
+type upcastingStore struct {
+	*sqlstore.EventStore
+	upcasters upcasterRegistry
+}
+
+func newUpcastingStore(events *sqlstore.EventStore, upcasters upcasterRegistry) *upcastingStore {
+	return &upcastingStore{EventStore: events, upcasters: upcasters}
+}
+
+// AppendStream stamps each event with its type's current schema version,
+// leaving a version the event already has alone.
+func (s *upcastingStore) AppendStream(ctx context.Context, streamID typeid.ID, events []*eventstore.WritableEvent, opts eventstore.AppendStreamOptions) error {
+	for _, event := range events {
+		if event.Metadata == nil {
+			event.Metadata = map[string]string{}
+		}
+		if _, ok := event.Metadata[schemaVersionMetadataKey]; !ok {
+			event.Metadata[schemaVersionMetadataKey] = strconv.Itoa(s.upcasters.currentVersion(event.Type))
+		}
+	}
+	return s.EventStore.AppendStream(ctx, streamID, events, opts)
+}
+
+func (s *upcastingStore) ReadStream(ctx context.Context, streamID typeid.ID, opts eventstore.ReadStreamOptions) (eventstore.StreamIterator, error) {
+	iter, err := s.EventStore.ReadStream(ctx, streamID, opts)
+	if err != nil {
+		return nil, err
+	}
+	return upcastingIterator{StreamIterator: iter, upcasters: s.upcasters}, nil
+}
+
+func (s *upcastingStore) ReadAll(ctx context.Context, opts eventstore.ReadStreamOptions) (eventstore.StreamIterator, error) {
+	iter, err := s.EventStore.ReadAll(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return upcastingIterator{StreamIterator: iter, upcasters: s.upcasters}, nil
+}
+
+// An upcastingIterator upcasts each event as it is read, and records the
+// version it was brought to in the event's metadata.
+type upcastingIterator struct {
+	eventstore.StreamIterator
+	upcasters upcasterRegistry
+}
+
+func (it upcastingIterator) Next(ctx context.Context) (*eventstore.Event, error) {
+	evt, err := it.StreamIterator.Next(ctx)
+	if err != nil {
+		return evt, err
+	}
+
+	version, err := schemaVersionOf(evt.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("%s event v%d: %w", evt.StreamID, evt.StreamVersion, err)
+	}
+	data, version, err := it.upcasters.upcast(evt.ID.Type, version, evt.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%s event v%d: %w", evt.StreamID, evt.StreamVersion, err)
+	}
+
+	evt.Data = data
+	if evt.Metadata == nil {
+		evt.Metadata = map[string]string{}
+	}
+	evt.Metadata[schemaVersionMetadataKey] = strconv.Itoa(version)
+	return evt, nil
+}
+
+// schemaVersionOf returns the schema version recorded in an event's metadata,
+// or 1 for an event stored before versioning.
+func schemaVersionOf(metadata map[string]string) (int, error) {
+	value, ok := metadata[schemaVersionMetadataKey]
+	if !ok {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("malformed schema version %q", value)
+	}
+	return version, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/go-estoria/estoria/typeid"
+	"github.com/gofrs/uuid/v5"
+)
+
+// testdata/v1-board.ndjson is a board's stream as a kanban.db from before
+// schema versioning held it: card colors are bare names, and no event carries
+// a schema version. It is in the export format, so it doubles as an old
+// export.
+const v1Fixture = "testdata/v1-board.ndjson"
+
+// seedV1Stream writes the fixture into a fresh board stream straight through
+// the SQLite store, underneath the upcasting layer, the way the old app wrote
+// it.
+func seedV1Stream(t *testing.T, srv *server) uuid.UUID {
+	t.Helper()
+
+	f, err := os.Open(v1Fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var events []*eventstore.WritableEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line exportedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, &eventstore.WritableEvent{Type: line.Type, Data: line.Data})
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	boardID := uuid.Must(uuid.NewV4())
+	if err := srv.events.EventStore.AppendStream(context.Background(), typeid.New("board", boardID), events, eventstore.AppendStreamOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return boardID
+}
+
+func TestReplayV1Stream(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+	boardID := seedV1Stream(t, srv)
+	base := "/api/boards/" + boardID.String()
+
+	colors := func(board Board) map[string]CardColor {
+		colors := map[string]CardColor{}
+		for _, col := range board.Columns {
+			for _, card := range col.Cards {
+				colors[card.Title] = card.Color
+			}
+		}
+		return colors
+	}
+	want := map[string]CardColor{
+		"Blue card, now red": {Name: "red"},
+		"Teal card":          {Name: "teal"},
+		"Plain card":         {Name: "amber"},
+	}
+
+	var board boardMessage
+	if code := do(t, h, http.MethodGet, base, nil, &board); code != http.StatusOK {
+		t.Fatalf("loading the v1 board = %d", code)
+	}
+	if board.Version != 11 {
+		t.Errorf("v1 board is at v%d, want v11", board.Version)
+	}
+	for title, color := range colors(board.Board) {
+		if color != want[title] {
+			t.Errorf("%q replayed with color %+v, want %+v", title, color, want[title])
+		}
+	}
+
+	// the history store upcasts too
+	do(t, h, http.MethodGet, base+"?version=5", nil, &board)
+	if got := colors(board.Board)["Blue card"]; got != (CardColor{Name: "blue"}) {
+		t.Errorf("at v5, the first card's color = %+v, want blue", got)
+	}
+
+	// an export is in the current schema, and says so
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base+"/export", nil))
+	var exported []exportedEvent
+	for line := range bytes.Lines(rec.Body.Bytes()) {
+		var e exportedEvent
+		if err := json.Unmarshal(line, &e); err != nil {
+			t.Fatal(err)
+		}
+		exported = append(exported, e)
+	}
+	if e := exported[6]; e.Type != "cardedited" || e.SchemaVersion != 2 || !bytes.Contains(e.Data, []byte(`"color":{"name":"red"}`)) {
+		t.Errorf("exported CardEdited = schema v%d %s, want v2 with a structured color", e.SchemaVersion, e.Data)
+	}
+	if e := exported[0]; e.SchemaVersion != 1 {
+		t.Errorf("exported BoardCreated is schema v%d, want 1", e.SchemaVersion)
+	}
+
+	// an old export, with no schema versions, imports the same board
+	log, err := os.ReadFile(v1Fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/boards/import", bytes.NewReader(log)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("importing the v1 log = %d: %s", rec.Code, rec.Body)
+	}
+	var imported boardMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &imported); err != nil {
+		t.Fatal(err)
+	}
+	for title, color := range colors(imported.Board) {
+		if color != want[title] {
+			t.Errorf("imported %q with color %+v, want %+v", title, color, want[title])
+		}
+	}
+
+	// new events are stored in the current schema, stamped with its version
+	card := imported.Board.Columns[0].Cards[0].ID
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/edit",
+		map[string]any{"title": "Teal card", "color": "teal", "colorLabel": "restored"}, nil)
+	stored, err := readBoardEvents(context.Background(), srv.events.EventStore, boardID, eventstore.ReadStreamOptions{AfterVersion: 11})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].raw.Metadata[schemaVersionMetadataKey] != "2" ||
+		!bytes.Contains(stored[0].raw.Data, []byte(`"color":{"name":"teal","label":"restored"}`)) {
+		t.Errorf("new CardEdited stored as %s %v, want schema v2", stored[0].raw.Data, stored[0].raw.Metadata)
+	}
+}
+
+func TestUpcasterRegistry(t *testing.T) {
+	t.Parallel()
+
+	r := boardUpcasters()
+	if v := r.currentVersion("cardedited"); v != 2 {
+		t.Errorf("cardedited is at schema v%d, want 2", v)
+	}
+	if v := r.currentVersion("boardrenamed"); v != 1 {
+		t.Errorf("boardrenamed is at schema v%d, want 1", v)
+	}
+
+	data, version, err := r.upcast("cardedited", 2, []byte(`{"cardId":"c","title":"t","color":{"name":"red"}}`))
+	if err != nil || version != 2 || !bytes.Contains(data, []byte(`{"name":"red"}`)) {
+		t.Errorf("upcasting current data = %s v%d %v, want it unchanged", data, version, err)
+	}
+
+	// a removal from before the archive took the card off the board
+	data, version, err = r.upcast("cardremoved", 1, []byte(`{"cardId":"c"}`))
+	if err != nil || version != 2 || !bytes.Contains(data, []byte(`"fromBoard":true`)) {
+		t.Errorf("upcasting a v1 removal = %s v%d %v, want it marked fromBoard", data, version, err)
+	}
+
+	// an event written by a newer build can't be read safely
+	if _, _, err := r.upcast("cardedited", 3, []byte(`{}`)); err == nil {
+		t.Error("upcasting from a future schema version succeeded")
+	}
+	if _, _, err := r.upcast("cardedited", 1, []byte(`{"color":7}`)); err == nil {
+		t.Error("upcasting a malformed v1 color succeeded")
+	}
+}
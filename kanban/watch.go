@@ -0,0 +1,266 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-estoria/estoria/aggregatestore"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/gofrs/uuid/v5"
+)
+
+// The watch stream sends a board's changes one event at a time, each tagged
+// with its stream version as the SSE id. The browser keeps the last id it saw
+// and sends it back as Last-Event-ID when it reconnects, so the server can
+// replay exactly the events the client missed — they are all in the stream.
+// A full board is sent only to a client starting from nothing, one so far
+// behind that replaying would cost more than starting over, or one the hub
+// couldn't keep up with (see hub).
+
+// maxReplayEvents is the largest gap the watch stream fills with events; a
+// client further behind gets the whole board instead.
+const maxReplayEvents = 100
+
+// A boardDelta is one board event as pushed to watchers. Data is the event as
+// stored, so the client applies the same change the aggregate did.
+type boardDelta struct {
+	Type      string          `json:"type"` // always "event"
+	Version   int64           `json:"version"`
+	EventType string          `json:"eventType"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+	Actor     string          `json:"actor,omitempty"`
+
+	// DescriptionHTML is the rendered description of a card the event adds,
+	// edits, or restores, which the client can't render itself.
+	DescriptionHTML string `json:"descriptionHtml,omitempty"`
+}
+
+// handleWatch streams one board's updates to the client over server-sent
+// events. The hub filters by board, so a client only hears about the board it
+// has open.
+func (s *server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	// a malformed Last-Event-ID is treated as none: the client gets the board
+	var sent int64
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		if v, err := strconv.ParseInt(id, 10, 64); err == nil && v > 0 {
+			sent = v
+		}
+	}
+
+	ch, ok := s.hub.subscribe(boardID)
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, "too many live connections right now — try again shortly")
+		return
+	}
+	defer s.hub.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	rc := http.NewResponseController(w)
+
+	// Subscribed first, then caught up: a save between the two is both read
+	// here and announced on ch, and the second read finds nothing new.
+	sent, err := s.sendBoardUpdates(ctx, w, boardID, sent)
+	if err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-ch:
+			if sent, err = s.relay(ctx, w, ch, boardID, msg, sent); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// relay writes what one hub message means to a client watching boardID that
+// has seen the board up to version sent, and returns the version it is now at.
+// A client that missed messages starts over from the whole board, then gets
+// every comment thread on it: the messages it missed may have been comments,
+// which the board doesn't carry.
+func (s *server) relay(ctx context.Context, w io.Writer, ch chan hubMessage, boardID uuid.UUID, msg hubMessage, sent int64) (int64, error) {
+	resync := s.hub.resynced(ch)
+	if msg.Data != nil && !resync {
+		_, err := fmt.Fprintf(w, "data: %s\n\n", msg.Data)
+		return sent, err
+	}
+	if msg.Reset || resync {
+		// whatever the client has is gone, or it missed messages the
+		// stream can't replay: start it over
+		sent = 0
+	}
+	sent, err := s.sendBoardUpdates(ctx, w, boardID, sent)
+	if err != nil || !resync {
+		return sent, err
+	}
+	return sent, s.sendThreads(ctx, w, boardID)
+}
+
+// sendThreads writes the comment thread of every card on the board, live or
+// archived, that anyone has commented on.
+func (s *server) sendThreads(ctx context.Context, w io.Writer, boardID uuid.UUID) error {
+	agg, err := s.live.Load(ctx, boardID, nil)
+	if err != nil {
+		// no board, no cards to have threads
+		return nil
+	}
+	board := agg.Entity()
+
+	var cards []Card
+	for _, col := range board.Columns {
+		cards = append(cards, col.Cards...)
+	}
+	for _, archived := range board.Archived {
+		cards = append(cards, archived.Card)
+	}
+
+	for _, card := range cards {
+		raw, _ := strings.CutPrefix(card.ID, "card_")
+		cardID, err := uuid.FromString(raw)
+		if err != nil {
+			continue
+		}
+
+		thread, err := s.threads.Load(ctx, threadID(boardID, cardID), nil)
+		if errors.Is(err, aggregatestore.ErrAggregateNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(newThreadMessage(cardID, thread))
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendBoardUpdates writes what a client that has seen the board up to version
+// sent needs to be current: the events since, or the whole board. It returns
+// the version the client is now at.
+func (s *server) sendBoardUpdates(ctx context.Context, w io.Writer, boardID uuid.UUID, sent int64) (int64, error) {
+	if sent > 0 {
+		missed, err := s.readDeltas(ctx, boardID, eventstore.ReadStreamOptions{
+			AfterVersion: sent,
+			Count:        maxReplayEvents + 1,
+		})
+		if err != nil && !errors.Is(err, eventstore.ErrStreamNotFound) {
+			return sent, err
+		}
+
+		if len(missed) > 0 && len(missed) <= maxReplayEvents {
+			for _, delta := range missed {
+				if err := writeSSE(w, delta.Version, delta); err != nil {
+					return sent, err
+				}
+			}
+			return missed[len(missed)-1].Version, nil
+		}
+
+		// Nothing new is the usual case. The exception is a stream that is
+		// now shorter than what the client has seen, which happens when the
+		// demo reset reseeds it: the client's board is from another life.
+		if len(missed) == 0 {
+			latest, err := s.readDeltas(ctx, boardID, eventstore.ReadStreamOptions{
+				Direction: eventstore.Reverse,
+				Count:     1,
+			})
+			if err != nil && !errors.Is(err, eventstore.ErrStreamNotFound) {
+				return sent, err
+			}
+			if len(latest) == 0 || latest[0].Version >= sent {
+				return sent, nil
+			}
+		}
+	}
+
+	agg, err := s.live.Load(ctx, boardID, nil)
+	if err != nil {
+		// the board doesn't exist (yet, or any more); the next save wakes us
+		return sent, nil
+	}
+	msg := boardMessage{Type: "board", Version: agg.Version(), Live: true, Board: agg.Entity().rendered()}
+	if err := writeSSE(w, msg.Version, msg); err != nil {
+		return sent, err
+	}
+	return msg.Version, nil
+}
+
+// readDeltas reads events from a board's stream as watch stream messages.
+func (s *server) readDeltas(ctx context.Context, boardID uuid.UUID, opts eventstore.ReadStreamOptions) ([]boardDelta, error) {
+	events, err := readBoardEvents(ctx, s.events, boardID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := make([]boardDelta, len(events))
+	for i, e := range events {
+		evt := e.raw
+		deltas[i] = boardDelta{
+			Type:      "event",
+			Version:   evt.StreamVersion,
+			EventType: evt.ID.Type,
+			Timestamp: evt.Timestamp,
+			Data:      evt.Data,
+			Actor:     evt.Metadata[actorMetadataKey],
+		}
+
+		switch evt.ID.Type {
+		case CardAdded{}.EventType(), CardEdited{}.EventType(), CardRestored{}.EventType():
+			var described struct {
+				Description string `json:"description"`
+				Card        Card   `json:"card"`
+			}
+			if err := json.Unmarshal(evt.Data, &described); err != nil {
+				return nil, err
+			}
+			deltas[i].DescriptionHTML, _ = renderMarkdown(cmp.Or(described.Description, described.Card.Description))
+		}
+	}
+	return deltas, nil
+}
+
+// writeSSE writes v as one server-sent event with the given id.
+func writeSSE(w io.Writer, id int64, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", id, data)
+	return err
+}
@@ -2,7 +2,8 @@
  *
  * The client is deliberately thin: all state lives in the event stream on the
  * server. The browser holds only the latest board (pushed over SSE) and an
- * optional "viewing" version when time-traveling.
+ * optional "viewing" version when time-traveling. Which board is open lives in
+ * the URL hash, so a board can be bookmarked and shared.
  */
 
 "use strict";
@@ -16,13 +17,21 @@ const SWATCH_HEX = {
 };
 
 const state = {
+  boardId: null,     // the open board's ID (from the URL hash)
   live: null,        // {version, board} — latest known state
   viewing: null,     // number | null — version being viewed in time travel
-  activity: [],      // ascending [{version, type, timestamp, description}]
+  activity: [],      // ascending [{version, type, timestamp, description, actor}]
+  activityActor: "", // only show this actor's activity ("" for everyone)
+  actors: new Set(), // every actor seen in the activity feed
+  me: null,          // this browser's display name, as the server sees it
+  templates: [],     // the server's board template catalog
   stats: null,
   dragging: null,    // card ID being dragged (suppresses re-render)
   pendingRender: false,
   editingCard: null, // card ID open in the modal
+  thread: null,      // {cardId, version} of the comment thread in the modal
+  undo: [],          // versions this tab wrote that it can undo, newest last
+  redo: [],          // versions of this tab's undos that it can redo
 };
 
 /* ============ bootstrap ============ */
@@ -30,12 +39,28 @@ const state = {
 async function init() {
   buildSwatches();
   wireChrome();
+  loadIdentity();
 
-  const res = await fetch("/api/board");
+  const boards = await loadBoards();
+  state.boardId = location.hash.slice(1) || (boards[0] && boards[0].boardId);
+  if (!state.boardId) {
+    toast("No boards yet — create one from the board menu", "error");
+    return;
+  }
+
+  let res = await fetch(boardPath(""));
+  if (res.status === 404 && boards.length) {
+    // a stale link (or a board cleared by a demo reset): open the first board
+    state.boardId = boards[0].boardId;
+    res = await fetch(boardPath(""));
+  }
   if (!res.ok) {
     toast("Failed to load board", "error");
     return;
   }
+  history.replaceState(null, "", "#" + state.boardId);
+  $("#board-picker").value = state.boardId;
+
   state.live = await res.json();
   renderBoard();
   updateTimebar();
@@ -43,23 +68,104 @@ async function init() {
   connect();
 }
 
+// boardPath prefixes an API path with the open board's route.
+function boardPath(path) {
+  return `/api/boards/${state.boardId}${path}`;
+}
+
+/* ============ board lobby ============ */
+
+async function loadBoards() {
+  const [res, templatesRes] = await Promise.all([fetch("/api/boards"), fetch("/api/templates")]);
+  const boards = res.ok ? await res.json() : [];
+  state.templates = templatesRes.ok ? await templatesRes.json() : [];
+
+  const picker = $("#board-picker");
+  picker.innerHTML = "";
+  for (const b of boards) {
+    const opt = document.createElement("option");
+    opt.value = b.boardId;
+    opt.textContent = `${b.name} (${b.cards} card${b.cards === 1 ? "" : "s"})`;
+    picker.appendChild(opt);
+  }
+  const create = document.createElement("option");
+  create.value = "new";
+  create.textContent = "+ New board…";
+  picker.appendChild(create);
+  for (const t of state.templates) {
+    const opt = document.createElement("option");
+    opt.value = "template:" + t.id;
+    opt.textContent = `+ New ${t.name} board…`;
+    opt.title = t.description;
+    picker.appendChild(opt);
+  }
+  if (state.boardId) picker.value = state.boardId;
+
+  return boards;
+}
+
+// createBoard creates an empty board, or one from a template in the catalog.
+async function createBoard(template = "") {
+  const from = state.templates.find((t) => t.id === template);
+  const name = prompt("Name the new board", from ? from.name : "");
+  if (!name || !name.trim()) {
+    $("#board-picker").value = state.boardId;
+    return;
+  }
+
+  const res = await fetch("/api/boards", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ name, template }),
+  });
+  const body = await res.json().catch(() => ({}));
+  if (!res.ok) {
+    toast(body.error || "Failed to create board", "error");
+    $("#board-picker").value = state.boardId;
+    return;
+  }
+  location.hash = body.board.id;
+}
+
 /* ============ live updates (SSE) ============ */
 
 function connect() {
-  const es = new EventSource("/api/watch");
+  const es = new EventSource(boardPath("/watch"));
 
   es.onopen = () => setPill("● live", "live");
 
   es.onmessage = (e) => {
     const msg = JSON.parse(e.data);
-    if (state.live && msg.version < state.live.version) return; // stale
-    state.live = msg;
+    if (msg.type === "comments") {
+      // a card's thread changed; only the open card's thread is on screen
+      if ($("#card-modal").open && msg.cardId === state.editingCard) renderComments(msg);
+      return;
+    }
+
+    if (msg.type === "event") {
+      if (state.live && msg.version <= state.live.version) return; // already have it
+      if (msg.actor && msg.actor !== state.me) flashPill(msg.actor);
+      const board = state.live && msg.version === state.live.version + 1
+        ? applyEvent(state.live.board, msg.eventType, msg.data, msg.descriptionHtml)
+        : null;
+      if (!board) {
+        // a gap, or an event this client can't apply: ask for the whole board
+        refreshLive().then(refreshMeta);
+        return;
+      }
+      state.live = { version: msg.version, live: true, board };
+    } else {
+      state.live = msg; // the whole board: on connecting, or after a long gap
+      // or after missed messages; comments made while disconnected weren't sent
+      if ($("#card-modal").open) loadComments(state.editingCard);
+    }
 
     if (state.viewing === null) {
       renderBoard();
     } else {
       showBanner(); // refresh "live is now at vN" hint
     }
+    if ($("#card-modal").open) renderCardDetails();
     updateTimebar();
     refreshMeta();
   };
@@ -67,28 +173,211 @@ function connect() {
   es.onerror = () => setPill("reconnecting…", "warn"); // EventSource retries itself
 }
 
+// applyEvent returns the board after one event, mirroring the event's ApplyTo
+// on the server (board_events.go). The server has already accepted the event,
+// so there is nothing to validate here; an event that can't be applied — an
+// unknown type, or a card this client doesn't have — returns null, and the
+// caller falls back to fetching the board. Descriptions are rendered on the
+// server, which sends the HTML alongside events that set one.
+function applyEvent(board, type, e, descriptionHtml) {
+  const next = structuredClone(board);
+  const column = (id) => next.columns.find((c) => c.id === id);
+  const place = (id) => {
+    for (const col of next.columns) {
+      const i = col.cards.findIndex((c) => c.id === id);
+      if (i >= 0) return { col, i, card: col.cards[i] };
+    }
+    return null;
+  };
+  const clamp = (i, len) => Math.min(Math.max(i || 0, 0), len);
+
+  switch (type) {
+    case "boardcreated":
+    case "boardrenamed":
+      next.name = e.name;
+      return next;
+    case "columnadded":
+      next.columns.push({ id: e.columnId, title: e.title, cards: [] });
+      return next;
+    case "columnrenamed": {
+      const col = column(e.columnId);
+      if (!col) return null;
+      col.title = e.title;
+      return next;
+    }
+    case "columnremoved": {
+      const i = next.columns.findIndex((c) => c.id === e.columnId);
+      if (i < 0) return null;
+      const [removed] = next.columns.splice(i, 1);
+      if (removed.cards.length) {
+        const dest = column(e.moveCardsToColumnId);
+        if (!dest) return null;
+        dest.cards.push(...removed.cards);
+      }
+      return next;
+    }
+    case "columnmoved": {
+      const i = next.columns.findIndex((c) => c.id === e.columnId);
+      if (i < 0) return null;
+      const [col] = next.columns.splice(i, 1);
+      next.columns.splice(clamp(e.toIndex, next.columns.length), 0, col);
+      return next;
+    }
+    case "columnwiplimitset": {
+      const col = column(e.columnId);
+      if (!col) return null;
+      col.wipLimit = e.limit || undefined;
+      return next;
+    }
+    case "cardadded": {
+      const col = column(e.columnId);
+      if (!col) return null;
+      col.cards.push({ id: e.cardId, title: e.title, description: e.description, descriptionHtml, color: e.color });
+      return next;
+    }
+    case "cardarchived": {
+      const at = place(e.cardId);
+      if (!at) return null;
+      at.col.cards.splice(at.i, 1);
+      next.archived = [...(next.archived || []), { card: at.card, columnId: at.col.id, columnTitle: at.col.title }];
+      return next;
+    }
+    case "cardrestored": {
+      const col = column(e.columnId);
+      if (!col) return null;
+      next.archived = (next.archived || []).filter((a) => a.card.id !== e.card.id);
+      col.cards.splice(clamp(e.index, col.cards.length), 0, { ...e.card, descriptionHtml });
+      return next;
+    }
+    case "cardmoved": {
+      const at = place(e.cardId);
+      const dest = column(e.toColumnId);
+      if (!at || !dest) return null;
+      at.col.cards.splice(at.i, 1);
+      dest.cards.splice(clamp(e.toIndex, dest.cards.length), 0, at.card);
+      return next;
+    }
+    case "cardremoved": {
+      if (!e.fromBoard) {
+        next.archived = (next.archived || []).filter((a) => a.card.id !== e.cardId);
+        return next;
+      }
+      const at = place(e.cardId); // a removal from before the archive
+      if (!at) return null;
+      at.col.cards.splice(at.i, 1);
+      return next;
+    }
+  }
+
+  // the rest change one card's details
+  const card = place(e.cardId)?.card;
+  if (!card) return null;
+  switch (type) {
+    case "cardedited":
+      Object.assign(card, { title: e.title, description: e.description, descriptionHtml, color: e.color });
+      return next;
+    case "cardassigned":
+      card.assignees = [...(card.assignees || []), e.assignee];
+      return next;
+    case "cardunassigned":
+      card.assignees = (card.assignees || []).filter((a) => a !== e.assignee);
+      return next;
+    case "cardlabeled":
+      card.labels = e.labels || [];
+      return next;
+    case "cardduedateset":
+      card.dueDate = e.dueDate || undefined;
+      return next;
+    case "checklistitemadded":
+      card.checklist = [...(card.checklist || []), { id: e.itemId, text: e.text, done: false }];
+      return next;
+    case "checklistitemtoggled": {
+      const item = (card.checklist || []).find((i) => i.id === e.itemId);
+      if (!item) return null;
+      item.done = e.done;
+      return next;
+    }
+  }
+  return null;
+}
+
 function setPill(text, cls) {
   const pill = $("#conn-pill");
   pill.textContent = text;
   pill.className = "pill" + (cls ? " " + cls : "");
 }
 
+// flashPill briefly names whoever made the change that just arrived.
+const restorePill = debounce(() => setPill("● live", "live"), 2500);
+function flashPill(actor) {
+  setPill(`● ${actor}`, "live");
+  restorePill();
+}
+
+/* ============ identity ============ */
+
+async function loadIdentity() {
+  const res = await fetch("/api/identity");
+  if (res.ok) showIdentity((await res.json()).actor);
+}
+
+function showIdentity(actor) {
+  state.me = actor;
+  $("#me-btn").textContent = "👤 " + actor;
+  $("#comment-as").textContent = "commenting as " + actor;
+}
+
+// setIdentity stores a display name in a cookie, so every later request —
+// and the events it appends — carries it.
+async function setIdentity() {
+  const name = prompt("Your display name (shown in the activity feed)", state.me === "anonymous" ? "" : state.me);
+  if (name === null) return;
+  const res = await fetch("/api/identity", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ name }),
+  });
+  if (res.ok) showIdentity((await res.json()).actor);
+}
+
 /* ============ commands ============ */
 
-// Send a command. baseVersion defaults to the latest version we know about;
-// on a 409 conflict the command is retried once against the winning version.
-async function command(path, body, { retry = true } = {}) {
+// Send a command. baseVersion defaults to the latest version we know about.
+// Commands go in merge mode, so the server rebases them over changes to other
+// cards itself; a 409 then means someone changed the same thing, and the
+// command is dropped. Without merge mode, a 409 is retried once against the
+// winning version.
+async function command(path, body, { retry = true, merge = true } = {}) {
   if (body.baseVersion === undefined) body.baseVersion = state.live.version;
 
-  const res = await fetch(path, {
+  const res = await fetch(boardPath(path + (merge ? "?merge=true" : "")), {
     method: "POST",
     headers: { "Content-Type": "application/json" },
     body: JSON.stringify(body),
   });
-  if (res.ok) return res.json();
+  if (res.ok) {
+    const out = await res.json();
+    if (UNDOABLE.test(path)) {
+      state.undo.push(out.version);
+      state.redo = [];
+      updateUndoButtons();
+    }
+    return out;
+  }
 
   const err = await res.json().catch(() => ({}));
 
+  if (err.error === "undo_conflict") {
+    toast("Can't revert that change", "error", escapeHTML(err.message));
+    throw err;
+  }
+
+  if (res.status === 409 && err.conflicts) {
+    await refreshLive();
+    mergeConflictToast(err);
+    throw err;
+  }
+
   if (res.status === 409) {
     await refreshLive(); // resync to the version that won
     if (retry) {
@@ -104,8 +393,37 @@ async function command(path, body, { retry = true } = {}) {
   throw err;
 }
 
+/* ============ undo / redo ============ */
+
+// Commands whose events the server knows how to invert (see undo.go).
+const UNDOABLE = /^\/cards(\/[^/]+\/(edit|move|archive|restore))?$/;
+
+// Each tab keeps its own stacks of the versions its commands produced and
+// asks for those to be reverted; the server refuses to revert another
+// actor's event. A revert that is refused (someone changed the card since, or
+// the event isn't ours) drops the entry rather than blocking everything
+// beneath it.
+async function revert(kind) {
+  const from = kind === "undo" ? state.undo : state.redo;
+  const to = kind === "undo" ? state.redo : state.undo;
+  const version = from.at(-1);
+  if (version === undefined || state.viewing !== null) return;
+
+  try {
+    const out = await command("/" + kind, { version });
+    to.push(out.version);
+  } catch { /* handled */ }
+  from.pop();
+  updateUndoButtons();
+}
+
+function updateUndoButtons() {
+  $("#undo-btn").disabled = state.undo.length === 0;
+  $("#redo-btn").disabled = state.redo.length === 0;
+}
+
 async function refreshLive() {
-  const res = await fetch("/api/board");
+  const res = await fetch(boardPath(""));
   if (res.ok) {
     state.live = await res.json();
     if (state.viewing === null) renderBoard();
@@ -134,18 +452,81 @@ function renderBoard() {
   const root = $("#board");
   root.innerHTML = "";
 
-  for (const col of board.columns || []) {
-    root.appendChild(renderColumn(col));
-  }
+  const columns = board.columns || [];
+  columns.forEach((col, i) => root.appendChild(renderColumn(col, i, columns)));
 
   if (state.viewing === null) {
     root.appendChild(renderAddColumn());
   }
 
+  renderArchive(board);
   highlightActivity();
 }
 
-function renderColumn(col) {
+// renderArchive lists the archived cards of the board on screen. Restoring
+// and deleting only work on the live board; a card whose column is gone gets
+// a picker for where to put it instead.
+function renderArchive(board) {
+  const list = $("#archive");
+  list.innerHTML = "";
+  const archived = board.archived || [];
+  $("#archive-empty").hidden = archived.length > 0;
+
+  for (const entry of [...archived].reverse()) {
+    const li = document.createElement("li");
+
+    const title = document.createElement("span");
+    title.className = "archive-title";
+    title.textContent = entry.card.title;
+    const from = document.createElement("span");
+    from.className = "when";
+    from.textContent = "from " + entry.columnTitle;
+    li.append(title, from);
+
+    if (state.viewing === null) {
+      const actions = document.createElement("div");
+      actions.className = "row-actions";
+
+      let picker = null;
+      if (!board.columns.some((c) => c.id === entry.columnId)) {
+        picker = document.createElement("select");
+        picker.setAttribute("aria-label", "column to restore to");
+        for (const col of board.columns) {
+          const opt = document.createElement("option");
+          opt.value = col.id;
+          opt.textContent = col.title;
+          picker.appendChild(opt);
+        }
+        actions.appendChild(picker);
+      }
+
+      const restore = document.createElement("button");
+      restore.className = "btn";
+      restore.textContent = "↩ Restore";
+      restore.disabled = picker !== null && board.columns.length === 0;
+      restore.addEventListener("click", () => restoreCard(entry.card.id, picker ? picker.value : ""));
+
+      const purge = document.createElement("button");
+      purge.className = "btn danger";
+      purge.textContent = "Delete";
+      purge.addEventListener("click", async () => {
+        if (!confirm(`Delete "${entry.card.title}" for good? Only the time slider will show it again.`)) return;
+        try { await command(`/cards/${entry.card.id}/delete`, {}); } catch { /* handled */ }
+      });
+
+      actions.append(restore, purge);
+      li.appendChild(actions);
+    }
+    list.appendChild(li);
+  }
+}
+
+// restoreCard puts an archived card back, undoably.
+async function restoreCard(cardId, columnId) {
+  try { await command(`/cards/${cardId}/restore`, { columnId }); } catch { /* handled */ }
+}
+
+function renderColumn(col, index, columns) {
   const el = document.createElement("div");
   el.className = "column";
   el.dataset.id = col.id;
@@ -160,14 +541,17 @@ function renderColumn(col) {
   title.addEventListener("dblclick", () => {
     if (state.viewing !== null) return;
     inlineRename(title, col.title, (name) =>
-      command(`/api/columns/${col.id}/rename`, { title: name }));
+      command(`/columns/${col.id}/rename`, { title: name }));
   });
 
   const count = document.createElement("span");
-  count.className = "column-count";
-  count.textContent = (col.cards || []).length;
+  const cardCount = (col.cards || []).length;
+  count.className = "column-count" + (col.wipLimit && cardCount >= col.wipLimit ? " at-limit" : "");
+  count.textContent = col.wipLimit ? `${cardCount}/${col.wipLimit}` : cardCount;
+  if (col.wipLimit) count.title = `WIP limit: ${col.wipLimit}`;
 
   header.append(title, count);
+  if (state.viewing === null) header.appendChild(renderColumnActions(col, index, columns));
   el.appendChild(header);
 
   const cards = document.createElement("div");
@@ -191,9 +575,57 @@ function renderColumn(col) {
   return el;
 }
 
+function renderColumnActions(col, index, columns) {
+  const actions = document.createElement("span");
+  actions.className = "column-actions";
+
+  const button = (label, title, onClick) => {
+    const b = document.createElement("button");
+    b.textContent = label;
+    b.title = title;
+    b.addEventListener("click", async () => {
+      try { await onClick(); } catch { /* handled */ }
+    });
+    actions.appendChild(b);
+  };
+
+  if (index > 0) {
+    button("◀", "Move column left", () =>
+      command(`/columns/${col.id}/move`, { toIndex: index - 1 }));
+  }
+  if (index < columns.length - 1) {
+    button("▶", "Move column right", () =>
+      command(`/columns/${col.id}/move`, { toIndex: index + 1 }));
+  }
+
+  button("WIP", "Set a work-in-progress limit", () => {
+    const answer = prompt(`WIP limit for "${col.title}" (0 for none)`, col.wipLimit || 0);
+    if (answer === null) return;
+    const limit = parseInt(answer, 10);
+    if (Number.isNaN(limit)) return toast("The limit must be a number", "error");
+    return command(`/columns/${col.id}/wip-limit`, { limit });
+  });
+
+  button("✕", "Remove column", () => {
+    const cards = (col.cards || []).length;
+    if (cards === 0) {
+      if (!confirm(`Remove the column "${col.title}"?`)) return;
+      return command(`/columns/${col.id}/delete`, {});
+    }
+
+    // cards never vanish with their column: they go to a neighbour
+    const target = columns[index + 1] || columns[index - 1];
+    if (!target) return toast("Add another column to move its cards to first", "error");
+    if (!confirm(`Remove "${col.title}"? Its ${cards} card${cards === 1 ? "" : "s"} will move to "${target.title}".`)) return;
+    return command(`/columns/${col.id}/delete`, { moveCardsTo: target.id });
+  });
+
+  return actions;
+}
+
 function renderCard(card) {
   const el = document.createElement("div");
-  el.className = "card" + (card.color ? " c-" + card.color : "");
+  el.className = "card" + (card.color ? " c-" + card.color.name : "");
   el.dataset.id = card.id;
   el.draggable = state.viewing === null;
 
@@ -205,10 +637,20 @@ function renderCard(card) {
   if (card.description) {
     const desc = document.createElement("div");
     desc.className = "card-desc";
-    desc.textContent = card.description;
+    if (card.descriptionHtml) {
+      desc.innerHTML = card.descriptionHtml; // rendered and sanitized by the server
+      desc.addEventListener("click", (e) => {
+        if (e.target.closest("a")) e.stopPropagation(); // follow the link, don't open the card
+      });
+    } else {
+      desc.textContent = card.description;
+    }
     el.appendChild(desc);
   }
 
+  const badges = renderCardBadges(card);
+  if (badges.childElementCount) el.appendChild(badges);
+
   el.addEventListener("click", () => {
     if (state.viewing === null && !state.dragging) openCardModal(card);
   });
@@ -233,6 +675,50 @@ function renderCard(card) {
   return el;
 }
 
+// renderCardBadges summarizes a card's details on its face: labels, due date,
+// checklist progress, and who it is assigned to.
+function renderCardBadges(card) {
+  const badges = document.createElement("div");
+  badges.className = "card-badges";
+
+  const badge = (text, cls = "", title = "") => {
+    const b = document.createElement("span");
+    b.className = "badge" + (cls ? " " + cls : "");
+    b.textContent = text;
+    if (title) b.title = title;
+    badges.appendChild(b);
+    return b;
+  };
+
+  // what the card's color means on this board, in the color itself
+  if (card.color && card.color.label) {
+    badge(card.color.label, "color-label", "Color label")
+      .style.setProperty("--sw", SWATCH_HEX[card.color.name] || "var(--muted)");
+  }
+  for (const label of card.labels || []) badge(label, "label");
+
+  if (card.dueDate) {
+    const overdue = card.dueDate < new Date().toISOString().slice(0, 10);
+    badge("⏰ " + card.dueDate, overdue ? "overdue" : "", overdue ? "Overdue" : "Due date");
+  }
+
+  const checklist = card.checklist || [];
+  if (checklist.length) {
+    const done = checklist.filter((i) => i.done).length;
+    badge(`☑ ${done}/${checklist.length}`, done === checklist.length ? "complete" : "", "Checklist");
+  }
+
+  for (const person of card.assignees || []) {
+    badge(initials(person), "avatar", person);
+  }
+
+  return badges;
+}
+
+function initials(name) {
+  return name.split(/\s+/).map((w) => w[0]).join("").slice(0, 2).toUpperCase();
+}
+
 function wireDropZone(cards) {
   cards.addEventListener("dragover", (e) => {
     if (!state.dragging) return;
@@ -261,7 +747,7 @@ function wireDropZone(cards) {
     const toIndex = [...cards.children].indexOf(dragged);
 
     try {
-      await command(`/api/cards/${cardID}/move`, { toColumnId, toIndex });
+      await command(`/cards/${cardID}/move`, { toColumnId, toIndex });
     } catch {
       /* command() already re-rendered / toasted */
     }
@@ -310,7 +796,7 @@ function renderComposer(columnId) {
       if (!title) return cancelIt();
       add.disabled = true;
       try {
-        await command("/api/cards", { columnId, title });
+        await command("/cards", { columnId, title });
       } catch { /* handled */ }
     };
     const cancelIt = () => composer.replaceWith(btn);
@@ -348,7 +834,7 @@ function renderAddColumn() {
       if (e.key === "Enter") {
         const title = input.value.trim();
         if (!title) return done();
-        try { await command("/api/columns", { title }); } catch { /* handled */ }
+        try { await command("/columns", { title }); } catch { /* handled */ }
       }
       if (e.key === "Escape") done();
     });
@@ -419,9 +905,150 @@ function openCardModal(card) {
   $("#card-title").value = card.title;
   $("#card-desc").value = card.description || "";
   $("#swatches").querySelectorAll(".swatch").forEach((s) => {
-    s.classList.toggle("selected", (card.color || "") === s.dataset.color);
+    s.classList.toggle("selected", (card.color ? card.color.name : "") === s.dataset.color);
   });
+  $("#card-color-label").value = card.color ? card.color.label || "" : "";
+  $("#card-labels").value = (card.labels || []).join(", ");
+  $("#card-due").value = card.dueDate || "";
+  renderCardDetails();
+  $("#comment-list").innerHTML = "";
+  state.thread = null;
   $("#card-modal").showModal();
+  loadComments(card.id);
+}
+
+/* ============ comments ============ */
+
+// Comments live in a separate "cardthread" stream per card on the board, so
+// they carry no board baseVersion.
+
+async function loadComments(cardId) {
+  const res = await fetch(boardPath(`/cards/${cardId}/comments`));
+  if (res.ok && state.editingCard === cardId) renderComments(await res.json());
+}
+
+function renderComments(thread) {
+  const shown = state.thread;
+  if (shown && shown.cardId === thread.cardId && thread.version < shown.version) return; // stale
+  state.thread = { cardId: thread.cardId, version: thread.version };
+
+  const list = $("#comment-list");
+  list.innerHTML = "";
+  for (const c of thread.comments) {
+    const li = document.createElement("li");
+
+    const meta = document.createElement("div");
+    meta.className = "comment-meta";
+    const when = new Date(c.postedAt).toLocaleString();
+    meta.textContent = `${c.author} · ${when}${c.editedAt ? " (edited)" : ""}`;
+
+    const actions = document.createElement("span");
+    actions.className = "comment-actions";
+    const edit = document.createElement("button");
+    edit.type = "button";
+    edit.textContent = "edit";
+    edit.addEventListener("click", () => {
+      const body = prompt("Edit comment", c.body);
+      if (body === null || body.trim() === "" || body === c.body) return;
+      commentCommand(`/${c.id}/edit`, { body }).catch(() => {});
+    });
+    const del = document.createElement("button");
+    del.type = "button";
+    del.textContent = "delete";
+    del.addEventListener("click", () => {
+      if (confirm("Delete this comment?")) commentCommand(`/${c.id}/delete`, {}).catch(() => {});
+    });
+    actions.append(edit, del);
+    if (c.author === state.me) meta.appendChild(actions); // only the author can change it
+
+    const body = document.createElement("div");
+    body.className = "comment-body";
+    body.textContent = c.body;
+
+    li.append(meta, body);
+    list.appendChild(li);
+  }
+}
+
+async function commentCommand(path, body) {
+  const res = await fetch(boardPath(`/cards/${state.editingCard}/comments${path}`), {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(body),
+  });
+  const out = await res.json().catch(() => ({}));
+  if (!res.ok) {
+    toast(out.message || out.error || "Request failed", "error");
+    throw out;
+  }
+  renderComments(out);
+  return out;
+}
+
+async function postComment() {
+  const body = $("#comment-input").value.trim();
+  if (!body) return;
+  try {
+    await commentCommand("", { body });
+    $("#comment-input").value = "";
+  } catch { /* handled */ }
+}
+
+// editingCard finds the card open in the modal on the live board, so details
+// changed by this tab or any other are shown as they are now.
+function editingCard() {
+  return editingCardById(state.editingCard);
+}
+
+function editingCardById(id) {
+  for (const col of state.live.board.columns || []) {
+    const card = (col.cards || []).find((c) => c.id === id);
+    if (card) return card;
+  }
+  return null;
+}
+
+// renderCardDetails redraws the modal's assignees and checklist. Each change
+// there is its own command (and its own event), sent as soon as it is made.
+function renderCardDetails() {
+  const card = editingCard();
+  if (!card) return;
+
+  const chips = $("#card-assignees");
+  chips.innerHTML = "";
+  for (const person of card.assignees || []) {
+    const chip = document.createElement("span");
+    chip.className = "chip";
+    chip.textContent = person;
+    const remove = document.createElement("button");
+    remove.type = "button";
+    remove.textContent = "×";
+    remove.title = "Unassign";
+    remove.addEventListener("click", async () => {
+      try { await command(`/cards/${card.id}/unassign`, { assignee: person }); } catch { /* handled */ }
+    });
+    chip.appendChild(remove);
+    chips.appendChild(chip);
+  }
+
+  const list = $("#card-checklist");
+  list.innerHTML = "";
+  for (const item of card.checklist || []) {
+    const li = document.createElement("li");
+    const box = document.createElement("input");
+    box.type = "checkbox";
+    box.checked = item.done;
+    box.addEventListener("change", async () => {
+      try {
+        await command(`/cards/${card.id}/checklist/${item.id}/toggle`, { done: box.checked });
+      } catch { box.checked = !box.checked; }
+    });
+    const text = document.createElement("span");
+    text.textContent = item.text;
+    li.classList.toggle("done", item.done);
+    li.append(box, text);
+    list.appendChild(li);
+  }
 }
 
 function wireModal() {
@@ -432,20 +1059,62 @@ function wireModal() {
     const selected = $("#swatches .swatch.selected");
     modal.close();
     try {
-      await command(`/api/cards/${state.editingCard}/edit`, {
+      await command(`/cards/${state.editingCard}/edit`, {
         title: $("#card-title").value,
         description: $("#card-desc").value,
         color: selected ? selected.dataset.color : "",
+        colorLabel: selected && selected.dataset.color ? $("#card-color-label").value : "",
       });
     } catch { /* handled */ }
   });
 
-  $("#card-delete").addEventListener("click", async () => {
+  $("#card-archive").addEventListener("click", async () => {
     modal.close();
-    try { await command(`/api/cards/${state.editingCard}/delete`, {}); } catch { /* handled */ }
+    try { await command(`/cards/${state.editingCard}/archive`, {}); } catch { /* handled */ }
   });
 
   $("#card-cancel").addEventListener("click", () => modal.close());
+
+  // Enter in a detail field sends that detail instead of submitting the form
+  const onEnter = (el, fn) => el.addEventListener("keydown", async (e) => {
+    if (e.key !== "Enter") return;
+    e.preventDefault();
+    try { await fn(); } catch { /* handled */ }
+  });
+
+  onEnter($("#assignee-input"), async () => {
+    const assignee = $("#assignee-input").value.trim();
+    if (!assignee) return;
+    await command(`/cards/${state.editingCard}/assign`, { assignee });
+    $("#assignee-input").value = "";
+  });
+
+  onEnter($("#checklist-input"), async () => {
+    const text = $("#checklist-input").value.trim();
+    if (!text) return;
+    await command(`/cards/${state.editingCard}/checklist`, { text });
+    $("#checklist-input").value = "";
+  });
+
+  const saveLabels = async () => {
+    const card = editingCard();
+    const labels = $("#card-labels").value.split(",").map((l) => l.trim()).filter(Boolean);
+    if (card && labels.join(",") === (card.labels || []).join(",")) return;
+    await command(`/cards/${state.editingCard}/labels`, { labels });
+  };
+  onEnter($("#card-labels"), saveLabels);
+  $("#card-labels").addEventListener("change", () => saveLabels().catch(() => {}));
+
+  $("#comment-post").addEventListener("click", postComment);
+  $("#comment-input").addEventListener("keydown", (e) => {
+    if (e.key === "Enter" && (e.metaKey || e.ctrlKey)) postComment();
+  });
+
+  $("#card-due").addEventListener("change", async () => {
+    try {
+      await command(`/cards/${state.editingCard}/due-date`, { dueDate: $("#card-due").value });
+    } catch { /* handled */ }
+  });
 }
 
 /* ============ time travel ============ */
@@ -465,15 +1134,39 @@ function updateTimeLabel() {
 }
 
 const debouncedTravel = debounce(async (v) => {
-  const res = await fetch("/api/board?version=" + v);
+  const res = await fetch(boardPath("?version=" + v));
   if (!res.ok) return;
   const msg = await res.json();
   state.viewingBoard = msg.board;
   renderBoard();
   showBanner();
   highlightActivity();
+  showChangesSince(v);
 }, 120);
 
+// showChangesSince adds to the banner what has changed from v to live.
+async function showChangesSince(v) {
+  const res = await fetch(boardPath("/diff?from=" + v));
+  if (!res.ok || state.viewing !== v) return;
+  const { cards, columns } = await res.json();
+
+  const parts = [];
+  const count = (n, what) => n && parts.push(`${n} ${what}`);
+  count(cards.added.length, "cards added");
+  count(cards.removed.length, "removed");
+  count(cards.archived.length, "archived");
+  count(cards.restored.length, "restored");
+  count(cards.moved.length, "moved");
+  count(cards.edited.length, "edited");
+  count(columns.added.length + columns.removed.length + columns.changed.length, "column changes");
+
+  const summary = document.createElement("span");
+  summary.className = "banner-diff";
+  summary.textContent = parts.length ? "since then: " + parts.join(", ") : "nothing has changed since";
+  $("#banner .banner-diff")?.remove();
+  $("#banner button").before(summary);
+}
+
 function wireTimebar() {
   const slider = $("#time-slider");
 
@@ -522,13 +1215,87 @@ function showBanner() {
 
 /* ============ activity & stats ============ */
 
+/* ============ analytics ============ */
+
+const FLOW_DAYS = 14;
+const FLOW_COLORS = ["#6366f1", "#34d399", "#fbbf24", "#f472b6", "#60a5fa", "#a78bfa", "#2dd4bf", "#f87171"];
+
+// Both metrics are projections the server replays from the whole stream, so
+// they are only fetched while the panel showing them is open.
+async function refreshAnalytics() {
+  if ($("#panel").classList.contains("hidden")) return;
+
+  const from = new Date(Date.now() - (FLOW_DAYS - 1) * 86400000).toISOString().slice(0, 10);
+  const [flowRes, cycleRes] = await Promise.all([
+    fetch(boardPath(`/analytics/flow?from=${from}`)),
+    fetch(boardPath(`/analytics/cycle-time?from=${from}`)),
+  ]);
+  if (flowRes.ok) renderFlow(await flowRes.json());
+  if (cycleRes.ok) {
+    const { cards, percentiles: p } = await cycleRes.json();
+    const hours = (h) => (h < 48 ? `${h.toFixed(1)}h` : `${(h / 24).toFixed(1)}d`);
+    $("#cycle-summary").textContent = cards.length
+      ? `Cycle time for ${cards.length} finished card${cards.length === 1 ? "" : "s"}: ` +
+        `p50 ${hours(p.p50)} · p85 ${hours(p.p85)} · p95 ${hours(p.p95)}`
+      : "No cards reached the last column in this period.";
+  }
+}
+
+// renderFlow draws a cumulative flow diagram as stacked bars, one per day,
+// with the last column at the bottom.
+function renderFlow(days) {
+  const chart = $("#flow-chart");
+  chart.innerHTML = "";
+  if (!days.length) return;
+
+  const w = 280, h = 90, gap = 2;
+  const barW = w / days.length - gap;
+  const peak = Math.max(1, ...days.map((d) => d.columns.reduce((n, c) => n + c.cards, 0)));
+
+  const svg = document.createElementNS("http://www.w3.org/2000/svg", "svg");
+  svg.setAttribute("viewBox", `0 0 ${w} ${h}`);
+
+  days.forEach((day, i) => {
+    let y = h;
+    [...day.columns].reverse().forEach((col, j) => {
+      const height = (col.cards / peak) * h;
+      if (!height) return;
+      y -= height;
+      const rect = document.createElementNS(svg.namespaceURI, "rect");
+      rect.setAttribute("x", i * (barW + gap));
+      rect.setAttribute("y", y);
+      rect.setAttribute("width", barW);
+      rect.setAttribute("height", height);
+      rect.setAttribute("fill", FLOW_COLORS[(day.columns.length - 1 - j) % FLOW_COLORS.length]);
+      const title = document.createElementNS(svg.namespaceURI, "title");
+      title.textContent = `${day.date} · ${col.title}: ${col.cards}`;
+      rect.appendChild(title);
+      svg.appendChild(rect);
+    });
+  });
+  chart.appendChild(svg);
+
+  const legend = document.createElement("div");
+  legend.className = "flow-legend";
+  days[days.length - 1].columns.forEach((col, i) => {
+    const item = document.createElement("span");
+    item.style.setProperty("--sw", FLOW_COLORS[i % FLOW_COLORS.length]);
+    item.textContent = col.title;
+    legend.appendChild(item);
+  });
+  chart.appendChild(legend);
+}
+
 const refreshMeta = debounce(async () => {
+  refreshAnalytics();
   const [activityRes, statsRes] = await Promise.all([
-    fetch("/api/activity"),
-    fetch("/api/stats"),
+    fetch(boardPath("/activity" + (state.activityActor ? "?actor=" + encodeURIComponent(state.activityActor) : ""))),
+    fetch(boardPath("/stats")),
   ]);
   if (activityRes.ok) {
     state.activity = await activityRes.json();
+    state.activity.forEach((a) => a.actor && state.actors.add(a.actor));
+    renderActivityActors();
     renderActivity();
     updateTimeLabel();
   }
@@ -560,6 +1327,12 @@ function renderActivity() {
 
     const desc = document.createElement("span");
     desc.textContent = entry.description;
+    if (entry.actor) {
+      const who = document.createElement("strong");
+      who.className = "who";
+      who.textContent = entry.actor + " ";
+      desc.prepend(who);
+    }
 
     const when = document.createElement("span");
     when.className = "when";
@@ -573,6 +1346,18 @@ function renderActivity() {
   highlightActivity();
 }
 
+// renderActivityActors lists everyone seen so far in the actor filter.
+function renderActivityActors() {
+  const select = $("#activity-actor");
+  const known = new Set([...select.options].map((o) => o.value));
+  for (const actor of [...state.actors].sort()) {
+    if (known.has(actor)) continue;
+    const opt = document.createElement("option");
+    opt.value = opt.textContent = actor;
+    select.appendChild(opt);
+  }
+}
+
 function highlightActivity() {
   const v = state.viewing === null ? -1 : state.viewing;
   $("#activity").querySelectorAll("li").forEach((li) => {
@@ -611,30 +1396,179 @@ function renderStats() {
   if (s.snapshotCount > 0) {
     info.innerHTML =
       `Latest snapshot: <strong>v${s.lastSnapshotVersion}</strong> ` +
-      `(${s.snapshotCount} total, every ${s.snapshotEvery} events).<br>` +
+      `(${s.snapshotCount} taken, ${escapeHTML(s.snapshotPolicy)}).<br>` +
       `Loading the board replays only events after <code>v${s.lastSnapshotVersion}</code>.`;
-  } else {
+  } else if (s.snapshotEvery > 0) {
     const remaining = s.snapshotEvery - (s.boardVersion % s.snapshotEvery);
     info.innerHTML =
       `No snapshots yet — the next one lands in <strong>${remaining}</strong> ` +
       `event${remaining === 1 ? "" : "s"}.`;
+  } else {
+    info.innerHTML = `No snapshots yet (policy: ${escapeHTML(s.snapshotPolicy)}).`;
   }
 }
 
 /* ============ chrome ============ */
 
+/* ============ search ============ */
+
+// Search is served by a read model projected from the board stream (see
+// search.go). Past titles come with the version they were set at, which the
+// timeline can jump straight to.
+function wireSearch() {
+  const input = $("#search-input");
+  const results = $("#search-results");
+
+  const run = debounce(async () => {
+    const q = input.value.trim();
+    if (!q) return results.classList.add("hidden");
+
+    const res = await fetch(boardPath(`/search?q=${encodeURIComponent(q)}&history=true`));
+    if (!res.ok) return;
+    renderSearchResults(await res.json());
+  }, 150);
+
+  input.addEventListener("input", run);
+  input.addEventListener("focus", run);
+  input.addEventListener("keydown", (e) => {
+    if (e.key === "Escape") input.blur();
+  });
+  // let a click on a result land before the list disappears
+  input.addEventListener("blur", () => setTimeout(() => results.classList.add("hidden"), 150));
+}
+
+function renderSearchResults({ cards, pastTitles = [] }) {
+  const results = $("#search-results");
+  results.innerHTML = "";
+
+  const item = (title, detail, onClick) => {
+    const el = document.createElement("button");
+    el.type = "button";
+    el.className = "search-hit";
+    const t = document.createElement("span");
+    t.textContent = title;
+    const d = document.createElement("span");
+    d.className = "search-detail";
+    d.textContent = detail;
+    el.append(t, d);
+    el.addEventListener("mousedown", onClick);
+    results.appendChild(el);
+  };
+
+  const columnTitle = (id) => (state.live.board.columns.find((c) => c.id === id) || {}).title || "";
+
+  for (const hit of cards) {
+    item(hit.title, columnTitle(hit.columnId), () => {
+      goLive();
+      const card = editingCardById(hit.cardId);
+      if (card) openCardModal(card);
+    });
+  }
+  for (const hit of pastTitles) {
+    const now = hit.currentTitle ? `now “${hit.currentTitle}”` : "since removed";
+    item(hit.title, `v${hit.version} · ${now}`, () => travelTo(hit.version));
+  }
+  if (!results.childElementCount) {
+    const empty = document.createElement("div");
+    empty.className = "search-empty";
+    empty.textContent = "No matching cards";
+    results.appendChild(empty);
+  }
+
+  results.classList.remove("hidden");
+}
+
 function wireChrome() {
   wireModal();
   wireTimebar();
+  wireSearch();
+
+  $("#board-picker").addEventListener("change", (e) => {
+    if (e.target.value === "new") return createBoard();
+    if (e.target.value.startsWith("template:")) return createBoard(e.target.value.slice("template:".length));
+    location.hash = e.target.value;
+  });
+  // switching boards is a fresh start: new SSE stream, new history
+  window.addEventListener("hashchange", () => location.reload());
+
+  $("#me-btn").addEventListener("click", setIdentity);
+  $("#activity-actor").addEventListener("change", (e) => {
+    state.activityActor = e.target.value;
+    refreshMeta();
+  });
+
+  $("#undo-btn").addEventListener("click", () => revert("undo"));
+  $("#redo-btn").addEventListener("click", () => revert("redo"));
+  document.addEventListener("keydown", (e) => {
+    if (!(e.ctrlKey || e.metaKey) || e.target.closest("input, textarea, dialog")) return;
+    const key = e.key.toLowerCase();
+    if (key === "z" && !e.shiftKey) {
+      e.preventDefault();
+      revert("undo");
+    } else if (key === "y" || (key === "z" && e.shiftKey)) {
+      e.preventDefault();
+      revert("redo");
+    }
+  });
+  updateUndoButtons();
 
   $("#panel-toggle").addEventListener("click", () => {
     $("#panel").classList.toggle("hidden");
+    refreshAnalytics();
   });
 
   $("#board-name").addEventListener("click", () => {
     if (state.viewing !== null) return;
     inlineRename($("#board-name"), state.live.board.name, (name) =>
-      command("/api/board/rename", { name }));
+      command("/rename", { name }));
+  });
+
+  $("#export-link").href = boardPath("/export");
+  $("#import-file").addEventListener("change", async (e) => {
+    const file = e.target.files[0];
+    e.target.value = "";
+    if (!file) return;
+    const res = await fetch("/api/boards/import", { method: "POST", body: file });
+    const body = await res.json().catch(() => ({}));
+    if (!res.ok) {
+      toast("Import failed", "error", escapeHTML(body.error || res.statusText));
+      return;
+    }
+    location.hash = body.board.id;
+  });
+
+  // clones whatever version is on screen, so scrubbing back first copies the
+  // board as it was then
+  $("#clone-btn").addEventListener("click", async () => {
+    const version = state.viewing ?? state.live.version;
+    const name = prompt("Name the copy", `${state.live.board.name} (copy of v${version})`);
+    if (!name || !name.trim()) return;
+    const res = await fetch(boardPath("/clone?version=" + version), {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ name }),
+    });
+    const body = await res.json().catch(() => ({}));
+    if (!res.ok) {
+      toast("Clone failed", "error", escapeHTML(body.error || res.statusText));
+      return;
+    }
+    location.hash = body.board.id;
+  });
+
+  // snapshots are normally the policy's call; this takes one regardless, and
+  // the stats refresh announces it like any other
+  $("#snapshot-btn").addEventListener("click", async () => {
+    const res = await fetch(boardPath("/snapshots"), { method: "POST" });
+    const body = await res.json().catch(() => ({}));
+    if (!res.ok) {
+      toast("Snapshot failed", "error", escapeHTML(body.error || res.statusText));
+      return;
+    }
+    if (res.status === 200) {
+      toast(`Already snapshotted at v${body.aggregateVersion}`, "snapshot", "Nothing has changed since.");
+    }
+    refreshMeta();
   });
 
   // deliberately send a command based on a stale version to demonstrate
@@ -645,10 +1579,10 @@ function wireChrome() {
       return;
     }
     try {
-      await command("/api/board/rename", {
+      await command("/rename", {
         name: state.live.board.name,
         baseVersion: state.live.version - 1,
-      }, { retry: false });
+      }, { retry: false, merge: false });
       toast("Unexpectedly succeeded — try again", "error");
     } catch { /* the 409 toast is the point */ }
   });
@@ -656,6 +1590,13 @@ function wireChrome() {
 
 /* ============ toasts & helpers ============ */
 
+// escapeHTML makes text safe to pass as a toast detail, which is HTML.
+function escapeHTML(text) {
+  const d = document.createElement("div");
+  d.textContent = text;
+  return d.innerHTML;
+}
+
 function toast(title, cls = "", detail = "") {
   const el = document.createElement("div");
   el.className = "toast" + (cls ? " " + cls : "");
@@ -684,6 +1625,13 @@ function conflictToast(err) {
     `The board has been refreshed.`);
 }
 
+function mergeConflictToast(err) {
+  const items = err.conflicts.map((c) =>
+    `<li><code>v${c.version}</code> ${c.actor ? escapeHTML(c.actor) + " " : ""}${escapeHTML(c.description)}</li>`);
+  toast("Your change wasn't saved", "conflict",
+    `${escapeHTML(err.message)}:<ul>${items.join("")}</ul>The board has been refreshed.`);
+}
+
 function relativeTime(ts) {
   const seconds = Math.round((Date.now() - new Date(ts).getTime()) / 1000);
   if (seconds < 5) return "just now";
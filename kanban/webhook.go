@@ -0,0 +1,58 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/go-estoria/estoria/typeid"
+	"github.com/gofrs/uuid/v5"
+)
+
+// A Webhook is a subscription to one board's events, delivered by HTTP POST
+// to a URL outside the app. It is an aggregate of its own, stored in a
+// "webhook" stream, and holds only what the subscriber asked for and whether
+// deliveries are switched on. How far delivery has got is kept by the
+// delivery worker (see webhook_delivery.go), since it changes with every
+// board event and is derived from the board stream anyway.
+type Webhook struct {
+	ID      uuid.UUID `json:"id"`
+	BoardID uuid.UUID `json:"boardId"`
+	URL     string    `json:"url"`
+
+	// EventTypes limits deliveries to these board event types; empty means
+	// every event.
+	EventTypes []string `json:"eventTypes,omitempty"`
+
+	// Secret is the key each delivery is signed with. It is only ever shown
+	// to the caller that creates the webhook.
+	Secret string `json:"-"`
+
+	// FromVersion is the board's version when the webhook was created.
+	// Deliveries start with the event after it.
+	FromVersion int64 `json:"fromVersion"`
+
+	Disabled       bool   `json:"disabled"`
+	DisabledReason string `json:"disabledReason,omitempty"`
+	Deleted        bool   `json:"-"`
+}
+
+// NewWebhook is the estoria.EntityFactory for Webhook aggregates.
+func NewWebhook(id uuid.UUID) Webhook {
+	return Webhook{ID: id}
+}
+
+// EntityID implements estoria.Entity.
+func (h Webhook) EntityID() typeid.ID {
+	return typeid.New("webhook", h.ID)
+}
+
+// clone returns a copy of the webhook that shares no slices with the
+// original.
+func (h Webhook) clone() Webhook {
+	h.EventTypes = slices.Clone(h.EventTypes)
+	return h
+}
+
+// wants reports whether the webhook delivers events of the given type.
+func (h Webhook) wants(eventType string) bool {
+	return len(h.EventTypes) == 0 || slices.Contains(h.EventTypes, eventType)
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-estoria/estoria"
+	"github.com/go-estoria/estoria/aggregatestore"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/gofrs/uuid/v5"
+)
+
+// Webhook delivery is a subscriber to the board streams, like the search
+// index: it reads each subscribed board's events in order from a checkpoint
+// kept in the same SQLite file, POSTs them one at a time, and only moves the
+// checkpoint once the receiver has answered 2xx. An event that fails is
+// retried, with a growing delay, before anything after it is sent; after
+// maxDeliveryAttempts failures in a row the webhook is disabled, and enabling
+// it again resumes from the event that failed. Receivers see each event at
+// least once, in order.
+const webhookSchema = `
+CREATE TABLE IF NOT EXISTS webhook_position (
+	webhook_id      TEXT PRIMARY KEY,
+	version         INTEGER NOT NULL,
+	attempts        INTEGER NOT NULL,
+	next_attempt_at INTEGER NOT NULL,
+	failures        INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS webhook_delivery (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	webhook_id    TEXT NOT NULL,
+	board_version INTEGER NOT NULL,
+	event_type    TEXT NOT NULL,
+	attempt       INTEGER NOT NULL,
+	status        INTEGER NOT NULL,
+	error         TEXT NOT NULL,
+	attempted_at  INTEGER NOT NULL,
+	duration_ms   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhook_delivery_by_webhook ON webhook_delivery (webhook_id, id);`
+
+const (
+	// maxDeliveryAttempts is how many times one event is tried before the
+	// webhook is disabled.
+	maxDeliveryAttempts = 8
+
+	// The delay before a retry doubles from webhookRetryBase with each
+	// failure, up to webhookRetryMax: 8 attempts span about ten minutes.
+	webhookRetryBase = 5 * time.Second
+	webhookRetryMax  = 5 * time.Minute
+
+	// webhookBatchSize caps the events read for one webhook in one pass.
+	webhookBatchSize = 50
+
+	// webhookTimeout bounds one delivery, from dialing the receiver to
+	// reading its answer.
+	webhookTimeout = 5 * time.Second
+
+	// webhookPollInterval is how long the worker sleeps when nothing wakes
+	// it: a backstop for a missed wake-up, not how deliveries are normally
+	// triggered.
+	webhookPollInterval = time.Minute
+
+	// webhookSignatureHeader carries the HMAC-SHA256 of the request body,
+	// keyed with the webhook's secret, as "sha256=<hex>".
+	webhookSignatureHeader = "X-Kanban-Signature"
+
+	// webhookActor is who the worker appends events as.
+	webhookActor = "webhook delivery"
+)
+
+// A webhookPayload is the body of one delivery: one board event, in its
+// current schema.
+type webhookPayload struct {
+	WebhookID     uuid.UUID       `json:"webhookId"`
+	BoardID       uuid.UUID       `json:"boardId"`
+	Version       int64           `json:"version"`
+	Type          string          `json:"type"`
+	Timestamp     time.Time       `json:"timestamp"`
+	Actor         string          `json:"actor,omitempty"`
+	SchemaVersion int             `json:"schemaVersion"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// A webhookPosition is how far delivery to one webhook has got.
+type webhookPosition struct {
+	// Version is the last board version delivered, or skipped because the
+	// webhook doesn't want its event type.
+	Version int64 `json:"version"`
+
+	// Attempts counts the failed attempts at the event after Version, and
+	// NextAttemptAt is when the next may be made.
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"nextAttemptAt,omitzero"`
+
+	// Failures counts every failed attempt since the webhook was created.
+	Failures int64 `json:"failures"`
+}
+
+// A webhookDelivery is one attempt to deliver an event.
+type webhookDelivery struct {
+	Version     int64     `json:"version"`
+	EventType   string    `json:"eventType"`
+	Attempt     int       `json:"attempt"`
+	OK          bool      `json:"ok"`
+	Status      int       `json:"status,omitempty"` // the receiver's HTTP status; 0 if it never answered
+	Error       string    `json:"error,omitempty"`
+	AttemptedAt time.Time `json:"attemptedAt"`
+	DurationMs  int64     `json:"durationMs"`
+}
+
+// A webhookWorker delivers board events to webhooks. Saves wake it through
+// notify; run is its loop, and deliverDue one pass of it.
+type webhookWorker struct {
+	db       *sql.DB
+	events   *upcastingStore
+	webhooks aggregatestore.Store[Webhook]
+	client   *http.Client
+
+	// now is the clock retries are scheduled by; tests replace it.
+	now func() time.Time
+
+	wake chan struct{}
+
+	// mu guards delivering, the webhooks a pass is sending to, so an event
+	// is never sent twice at once. It is not held while sending.
+	mu         sync.Mutex
+	delivering map[uuid.UUID]bool
+
+	// passes is held for reading by every pass and for writing by clear, so
+	// the tables are never emptied under a delivery about to record itself.
+	passes sync.RWMutex
+}
+
+// newWebhookWorker returns a worker delivering to any address, or with
+// publicOnly, only to public ones (see publicDialControl).
+func newWebhookWorker(ctx context.Context, db *sql.DB, events *upcastingStore, webhooks aggregatestore.Store[Webhook], publicOnly bool) (*webhookWorker, error) {
+	if _, err := db.ExecContext(ctx, webhookSchema); err != nil {
+		return nil, fmt.Errorf("creating webhook schema: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if publicOnly {
+		// a proxy would be the address dialed, not the receiver
+		transport.Proxy = nil
+		transport.DialContext = (&net.Dialer{Timeout: webhookTimeout, Control: publicDialControl}).DialContext
+	}
+
+	return &webhookWorker{
+		db:         db,
+		events:     events,
+		webhooks:   webhooks,
+		client:     &http.Client{Transport: transport, Timeout: webhookTimeout},
+		now:        time.Now,
+		wake:       make(chan struct{}, 1),
+		delivering: map[uuid.UUID]bool{},
+	}, nil
+}
+
+// nonPublicPrefixes are the ranges publicDialControl refuses beyond what
+// netip.Addr reports as loopback, private, link-local (which holds the cloud
+// metadata address, 169.254.169.254), multicast, or unspecified.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT, and some clouds' metadata
+}
+
+// publicDialControl refuses to connect to anything but a public address. It
+// runs on the address being dialed, after DNS, so a public name that
+// resolves to a private address is refused too, as is a redirect to one.
+// It keeps a public deployment's webhooks from reaching into the network the
+// server runs in.
+func publicDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+
+	public := ip.IsGlobalUnicast() && !ip.IsPrivate()
+	for _, prefix := range nonPublicPrefixes {
+		public = public && !prefix.Contains(ip)
+	}
+	if !public {
+		return fmt.Errorf("webhooks may only be delivered to public addresses, not %s", ip)
+	}
+	return nil
+}
+
+// notify wakes the worker if it is waiting. It never blocks: a wake-up
+// already pending covers this one.
+func (wk *webhookWorker) notify() {
+	select {
+	case wk.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers until ctx is done, sleeping between passes until a save wakes
+// it or a retry falls due.
+func (wk *webhookWorker) run(ctx context.Context) {
+	for {
+		wait := webhookPollInterval
+		next, err := wk.deliverDue(ctx)
+		if err != nil {
+			estoria.GetLogger().Error("delivering webhooks", "error", err)
+		} else if !next.IsZero() {
+			wait = min(wait, max(next.Sub(wk.now()), 0))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-wk.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// deliverDue makes one pass over every enabled webhook, sending what each has
+// pending unless it is waiting to retry. Webhooks are sent to side by side, so
+// a slow receiver holds up only its own; one another pass is already sending
+// to is skipped. It returns when the worker next has something to do — a
+// retry, or more than one pass could send — or the zero time if it is caught
+// up. It only fails if it can't list the webhooks.
+func (wk *webhookWorker) deliverDue(ctx context.Context) (time.Time, error) {
+	wk.passes.RLock()
+	defer wk.passes.RUnlock()
+
+	streams, err := wk.events.ListStreams(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var (
+		wg     sync.WaitGroup
+		nextMu sync.Mutex
+		next   time.Time
+	)
+	for _, stream := range streams {
+		if stream.StreamID.Type != "webhook" {
+			continue
+		}
+
+		// one webhook's trouble is logged, and doesn't hold up the others
+		agg, err := wk.webhooks.Load(ctx, stream.StreamID.UUID, nil)
+		if err != nil {
+			estoria.GetLogger().Error("loading webhook", "webhook_id", stream.StreamID.UUID, "error", err)
+			continue
+		}
+		hook := agg.Entity()
+		if hook.Disabled || hook.Deleted || !wk.claim(hook.ID) {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer wk.release(hook.ID)
+
+			due, err := wk.deliverPending(ctx, hook)
+			if err != nil {
+				estoria.GetLogger().Error("delivering to webhook", "webhook_id", hook.ID, "error", err)
+				return
+			}
+			nextMu.Lock()
+			defer nextMu.Unlock()
+			if !due.IsZero() && (next.IsZero() || due.Before(next)) {
+				next = due
+			}
+		}()
+	}
+	wg.Wait()
+	return next, nil
+}
+
+// claim marks a webhook as being sent to, and reports false if it already
+// was. release undoes it.
+func (wk *webhookWorker) claim(id uuid.UUID) bool {
+	wk.mu.Lock()
+	defer wk.mu.Unlock()
+	if wk.delivering[id] {
+		return false
+	}
+	wk.delivering[id] = true
+	return true
+}
+
+func (wk *webhookWorker) release(id uuid.UUID) {
+	wk.mu.Lock()
+	defer wk.mu.Unlock()
+	delete(wk.delivering, id)
+}
+
+// deliverPending sends a webhook the events after its position, stopping at
+// the first failure. It returns when it should next be called, as deliverDue
+// does.
+func (wk *webhookWorker) deliverPending(ctx context.Context, hook Webhook) (time.Time, error) {
+	pos, err := wk.position(ctx, hook)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if wk.now().Before(pos.NextAttemptAt) {
+		return pos.NextAttemptAt, nil
+	}
+
+	events, err := readBoardEvents(ctx, wk.events, hook.BoardID, eventstore.ReadStreamOptions{
+		AfterVersion: pos.Version,
+		Count:        webhookBatchSize,
+	})
+	if errors.Is(err, eventstore.ErrStreamNotFound) {
+		return time.Time{}, nil // the board is gone; there will be nothing to send
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, e := range events {
+		evt := e.raw
+		if !hook.wants(evt.ID.Type) {
+			pos.Version = evt.StreamVersion
+			if err := wk.record(ctx, hook.ID, pos, nil); err != nil {
+				return time.Time{}, err
+			}
+			continue
+		}
+
+		delivery := wk.post(ctx, hook, evt)
+		delivery.Attempt = pos.Attempts + 1
+		if delivery.OK {
+			pos = webhookPosition{Version: evt.StreamVersion, Failures: pos.Failures}
+			if err := wk.record(ctx, hook.ID, pos, &delivery); err != nil {
+				return time.Time{}, err
+			}
+			continue
+		}
+
+		pos.Attempts++
+		pos.Failures++
+		pos.NextAttemptAt = delivery.AttemptedAt.Add(retryDelay(pos.Attempts))
+		exhausted := pos.Attempts >= maxDeliveryAttempts
+		if exhausted {
+			// enabling the webhook again starts this event's attempts over
+			pos.Attempts, pos.NextAttemptAt = 0, time.Time{}
+		}
+		if err := wk.record(ctx, hook.ID, pos, &delivery); err != nil {
+			return time.Time{}, err
+		}
+		if exhausted {
+			return time.Time{}, wk.disable(ctx, hook.ID, fmt.Sprintf(
+				"%d attempts to deliver v%d failed; the last: %s", maxDeliveryAttempts, evt.StreamVersion, delivery.Error))
+		}
+		return pos.NextAttemptAt, nil
+	}
+
+	if len(events) == webhookBatchSize {
+		return wk.now(), nil // there may be more
+	}
+	return time.Time{}, nil
+}
+
+// post sends one event to a webhook and reports how it went. The result is
+// named so the deferred timing lands in what is returned.
+func (wk *webhookWorker) post(ctx context.Context, hook Webhook, evt *eventstore.Event) (delivery webhookDelivery) {
+	delivery = webhookDelivery{Version: evt.StreamVersion, EventType: evt.ID.Type, AttemptedAt: wk.now()}
+	started := time.Now()
+	defer func() { delivery.DurationMs = time.Since(started).Milliseconds() }()
+
+	schemaVersion, _ := strconv.Atoi(evt.Metadata[schemaVersionMetadataKey])
+	body, err := json.Marshal(webhookPayload{
+		WebhookID:     hook.ID,
+		BoardID:       hook.BoardID,
+		Version:       evt.StreamVersion,
+		Type:          evt.ID.Type,
+		Timestamp:     evt.Timestamp,
+		Actor:         evt.Metadata[actorMetadataKey],
+		SchemaVersion: schemaVersion,
+		Data:          evt.Data,
+	})
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "estoria-kanban-webhooks")
+	req.Header.Set("X-Kanban-Event", evt.ID.Type)
+	req.Header.Set("X-Kanban-Delivery", fmt.Sprintf("%s/%d", hook.ID, evt.StreamVersion))
+	req.Header.Set(webhookSignatureHeader, signWebhookBody(hook.Secret, body))
+
+	res, err := wk.client.Do(req)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	delivery.Status = res.StatusCode
+	delivery.OK = res.StatusCode >= 200 && res.StatusCode <= 299
+	if !delivery.OK {
+		delivery.Error = "receiver answered " + res.Status
+	}
+	return delivery
+}
+
+// signWebhookBody returns the signature header value for a delivery body.
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryDelay returns how long to wait after the given number of failed
+// attempts at one event.
+func retryDelay(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for range attempts - 1 {
+		if delay *= 2; delay >= webhookRetryMax {
+			return webhookRetryMax
+		}
+	}
+	return delay
+}
+
+// disable appends WebhookDisabled to a webhook whose deliveries keep failing.
+func (wk *webhookWorker) disable(ctx context.Context, id uuid.UUID, reason string) error {
+	ctx = context.WithValue(ctx, identityKey{}, identity{Actor: webhookActor})
+
+	agg, err := wk.webhooks.Load(ctx, id, nil)
+	if err != nil {
+		return err
+	}
+	if err := agg.Append(WebhookDisabled{Reason: reason}); err != nil {
+		return err
+	}
+	estoria.GetLogger().Warn("disabled webhook", "webhook_id", id, "reason", reason)
+	return wk.webhooks.Save(ctx, agg, nil)
+}
+
+// position returns how far delivery to a webhook has got. A webhook nothing
+// has been delivered to yet starts where it was created.
+func (wk *webhookWorker) position(ctx context.Context, hook Webhook) (webhookPosition, error) {
+	pos := webhookPosition{Version: hook.FromVersion}
+	var nextAttemptAt int64
+	err := wk.db.QueryRowContext(ctx,
+		`SELECT version, attempts, next_attempt_at, failures FROM webhook_position WHERE webhook_id = ?`,
+		hook.ID.String()).Scan(&pos.Version, &pos.Attempts, &nextAttemptAt, &pos.Failures)
+	if errors.Is(err, sql.ErrNoRows) {
+		return pos, nil
+	} else if err != nil {
+		return pos, err
+	}
+	if nextAttemptAt > 0 {
+		pos.NextAttemptAt = time.UnixMilli(nextAttemptAt)
+	}
+	return pos, nil
+}
+
+// record saves a webhook's position and, if there was one, the delivery
+// attempt that moved it, together.
+func (wk *webhookWorker) record(ctx context.Context, id uuid.UUID, pos webhookPosition, delivery *webhookDelivery) error {
+	tx, err := wk.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var nextAttemptAt int64
+	if !pos.NextAttemptAt.IsZero() {
+		nextAttemptAt = pos.NextAttemptAt.UnixMilli()
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO webhook_position (webhook_id, version, attempts, next_attempt_at, failures) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (webhook_id) DO UPDATE SET
+			version = excluded.version, attempts = excluded.attempts,
+			next_attempt_at = excluded.next_attempt_at, failures = excluded.failures`,
+		id.String(), pos.Version, pos.Attempts, nextAttemptAt, pos.Failures); err != nil {
+		return err
+	}
+
+	if delivery != nil {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO webhook_delivery (webhook_id, board_version, event_type, attempt, status, error, attempted_at, duration_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			id.String(), delivery.Version, delivery.EventType, delivery.Attempt, delivery.Status, delivery.Error,
+			delivery.AttemptedAt.UnixMilli(), delivery.DurationMs); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// deliveries returns a webhook's most recent delivery attempts, newest first.
+func (wk *webhookWorker) deliveries(ctx context.Context, id uuid.UUID, limit int) ([]webhookDelivery, error) {
+	rows, err := wk.db.QueryContext(ctx, `
+		SELECT board_version, event_type, attempt, status, error, attempted_at, duration_ms
+		FROM webhook_delivery WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`, id.String(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []webhookDelivery{}
+	for rows.Next() {
+		var d webhookDelivery
+		var attemptedAt int64
+		if err := rows.Scan(&d.Version, &d.EventType, &d.Attempt, &d.Status, &d.Error, &attemptedAt, &d.DurationMs); err != nil {
+			return nil, err
+		}
+		d.OK = d.Error == ""
+		d.AttemptedAt = time.UnixMilli(attemptedAt).UTC()
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// clear empties the worker's tables, for the demo reset, which deletes the
+// streams they describe.
+func (wk *webhookWorker) clear(ctx context.Context) error {
+	wk.passes.Lock()
+	defer wk.passes.Unlock()
+
+	for _, table := range []string{"webhook_position", "webhook_delivery"} {
+		if _, err := wk.db.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+			return fmt.Errorf("clearing table %s: %w", table, err)
+		}
+	}
+	return nil
+}
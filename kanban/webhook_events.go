@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-estoria/estoria"
+	"github.com/gofrs/uuid/v5"
+)
+
+// Each event below implements estoria.EntityEvent[Webhook], following the
+// same conventions as the board events. A deleted webhook accepts no further
+// events; its stream stays, like every other.
+
+var errWebhookDeleted = errors.New("webhook has been deleted")
+
+// WebhookCreated subscribes a URL to a board's events from FromVersion on.
+type WebhookCreated struct {
+	BoardID     uuid.UUID `json:"boardId"`
+	URL         string    `json:"url"`
+	EventTypes  []string  `json:"eventTypes,omitempty"`
+	Secret      string    `json:"secret"`
+	FromVersion int64     `json:"fromVersion"`
+}
+
+func (WebhookCreated) EventType() string                 { return "webhookcreated" }
+func (WebhookCreated) New() estoria.EntityEvent[Webhook] { return WebhookCreated{} }
+func (e WebhookCreated) ApplyTo(_ context.Context, h Webhook) (Webhook, error) {
+	if !h.BoardID.IsNil() {
+		return h, fmt.Errorf("webhook %s already exists", h.ID)
+	}
+
+	next := h.clone()
+	next.BoardID = e.BoardID
+	next.URL = e.URL
+	next.EventTypes = e.EventTypes
+	next.Secret = e.Secret
+	next.FromVersion = e.FromVersion
+	return next, nil
+}
+
+// WebhookDisabled stops deliveries, by request or because they kept failing.
+// Delivery picks up where it stopped once the webhook is enabled again.
+type WebhookDisabled struct {
+	Reason string `json:"reason"`
+}
+
+func (WebhookDisabled) EventType() string                 { return "webhookdisabled" }
+func (WebhookDisabled) New() estoria.EntityEvent[Webhook] { return WebhookDisabled{} }
+func (e WebhookDisabled) ApplyTo(_ context.Context, h Webhook) (Webhook, error) {
+	if h.Deleted {
+		return h, errWebhookDeleted
+	}
+	if h.Disabled {
+		return h, errors.New("webhook is already disabled")
+	}
+
+	next := h.clone()
+	next.Disabled = true
+	next.DisabledReason = e.Reason
+	return next, nil
+}
+
+// WebhookEnabled resumes deliveries.
+type WebhookEnabled struct{}
+
+func (WebhookEnabled) EventType() string                 { return "webhookenabled" }
+func (WebhookEnabled) New() estoria.EntityEvent[Webhook] { return WebhookEnabled{} }
+func (e WebhookEnabled) ApplyTo(_ context.Context, h Webhook) (Webhook, error) {
+	if h.Deleted {
+		return h, errWebhookDeleted
+	}
+	if !h.Disabled {
+		return h, errors.New("webhook is already enabled")
+	}
+
+	next := h.clone()
+	next.Disabled = false
+	next.DisabledReason = ""
+	return next, nil
+}
+
+// WebhookDeleted ends the subscription for good.
+type WebhookDeleted struct{}
+
+func (WebhookDeleted) EventType() string                 { return "webhookdeleted" }
+func (WebhookDeleted) New() estoria.EntityEvent[Webhook] { return WebhookDeleted{} }
+func (e WebhookDeleted) ApplyTo(_ context.Context, h Webhook) (Webhook, error) {
+	if h.Deleted {
+		return h, errWebhookDeleted
+	}
+
+	next := h.clone()
+	next.Deleted = true
+	return next, nil
+}
+
+// webhookEventPrototypes lists every webhook event type for registration with
+// the aggregate store.
+func webhookEventPrototypes() []estoria.EntityEvent[Webhook] {
+	return []estoria.EntityEvent[Webhook]{
+		WebhookCreated{},
+		WebhookDisabled{},
+		WebhookEnabled{},
+		WebhookDeleted{},
+	}
+}
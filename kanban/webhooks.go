@@ -0,0 +1,326 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/go-estoria/estoria"
+	"github.com/go-estoria/estoria/aggregatestore"
+	"github.com/go-estoria/estoria/eventstore"
+	"github.com/gofrs/uuid/v5"
+)
+
+// maxDeliveriesListed caps GET /api/webhooks/{id}/deliveries.
+const maxDeliveriesListed = 200
+
+func newWebhookStore(events eventstore.Store) (aggregatestore.Store[Webhook], error) {
+	store, err := aggregatestore.New(events, NewWebhook,
+		aggregatestore.WithEventTypes(webhookEventPrototypes()...))
+	if err != nil {
+		return nil, fmt.Errorf("creating aggregate store: %w", err)
+	}
+	return store, nil
+}
+
+// A webhookMessage is a webhook and how far delivery to it has got. The
+// secret is only filled in for the response that creates the webhook.
+type webhookMessage struct {
+	Webhook
+	Secret   string          `json:"secret,omitempty"`
+	Delivery webhookPosition `json:"delivery"`
+}
+
+func (s *server) newWebhookMessage(ctx context.Context, hook Webhook) (webhookMessage, error) {
+	pos, err := s.webhookWorker.position(ctx, hook)
+	return webhookMessage{Webhook: hook, Delivery: pos}, err
+}
+
+// handleListWebhooks answers GET /api/boards/{id}/webhooks with the board's
+// webhooks, oldest first. Like the lobby, it lists the streams and loads each
+// one.
+func (s *server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	streams, err := s.events.ListStreams(ctx)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	hooks := []webhookMessage{}
+	for _, stream := range streams {
+		if stream.StreamID.Type != "webhook" {
+			continue
+		}
+
+		agg, err := s.webhooks.Load(ctx, stream.StreamID.UUID, nil)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if hook := agg.Entity(); hook.BoardID == boardID && !hook.Deleted {
+			msg, err := s.newWebhookMessage(ctx, hook)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			hooks = append(hooks, msg)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, hooks)
+}
+
+// handleCreateWebhook subscribes a URL to a board's events from now on. The
+// response is the only place the webhook's signing secret is shown.
+func (s *server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	boardID, ok := pathBoardID(w, r)
+	if !ok {
+		return
+	}
+
+	req, err := readJSON[struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	target, err := webhookURL(req.URL)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	eventTypes, err := webhookEventTypes(req.Events)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	s.resetMu.RLock()
+	defer s.resetMu.RUnlock()
+
+	board, err := s.live.Load(ctx, boardID, nil)
+	if err != nil {
+		s.writeLoadError(w, err)
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	agg := s.webhooks.New(id)
+	if err := agg.Append(WebhookCreated{
+		BoardID:     boardID,
+		URL:         target,
+		EventTypes:  eventTypes,
+		Secret:      hex.EncodeToString(secret),
+		FromVersion: board.Version(),
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := s.webhooks.Save(ctx, agg, nil); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	hook := agg.Entity()
+	writeJSON(w, http.StatusCreated, webhookMessage{
+		Webhook:  hook,
+		Secret:   hook.Secret,
+		Delivery: webhookPosition{Version: hook.FromVersion},
+	})
+}
+
+func (s *server) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	agg, ok := s.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	msg, err := s.newWebhookMessage(r.Context(), agg.Entity())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, msg)
+}
+
+func (s *server) handleEnableWebhook(w http.ResponseWriter, r *http.Request) {
+	s.runWebhookCommand(w, r, func(Webhook) (estoria.EntityEvent[Webhook], error) {
+		return WebhookEnabled{}, nil
+	})
+}
+
+func (s *server) handleDisableWebhook(w http.ResponseWriter, r *http.Request) {
+	s.runWebhookCommand(w, r, func(Webhook) (estoria.EntityEvent[Webhook], error) {
+		return WebhookDisabled{Reason: "disabled by " + cmp.Or(identityFrom(r.Context()).Actor, anonymousActor)}, nil
+	})
+}
+
+func (s *server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	s.runWebhookCommand(w, r, func(Webhook) (estoria.EntityEvent[Webhook], error) {
+		return WebhookDeleted{}, nil
+	})
+}
+
+// handleListDeliveries answers GET /api/webhooks/{id}/deliveries with the
+// webhook's delivery attempts, newest first (?limit=N, 50 by default), and
+// where delivery stands.
+func (s *server) handleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = min(n, maxDeliveriesListed)
+	}
+
+	agg, ok := s.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	hook := agg.Entity()
+	pos, err := s.webhookWorker.position(ctx, hook)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	deliveries, err := s.webhookWorker.deliveries(ctx, hook.ID, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"webhookId":  hook.ID,
+		"disabled":   hook.Disabled,
+		"delivery":   pos,
+		"deliveries": deliveries,
+	})
+}
+
+// runWebhookCommand is runCommand for webhooks: load, decide, check the event
+// applies, save. A successful change wakes the delivery worker, which may
+// have something new to send.
+func (s *server) runWebhookCommand(w http.ResponseWriter, r *http.Request, cmd func(Webhook) (estoria.EntityEvent[Webhook], error)) {
+	ctx := r.Context()
+
+	s.resetMu.RLock()
+	defer s.resetMu.RUnlock()
+
+	agg, ok := s.loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	event, err := cmd(agg.Entity())
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if _, err := event.ApplyTo(ctx, agg.Entity()); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if err := agg.Append(event); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := s.webhooks.Save(ctx, agg, nil); err != nil {
+		var mismatch eventstore.StreamVersionMismatchError
+		if errors.As(err, &mismatch) {
+			writeError(w, http.StatusConflict, "the webhook changed while this was being saved; try again")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.webhookWorker.notify()
+
+	msg, err := s.newWebhookMessage(ctx, agg.Entity())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, msg)
+}
+
+// loadWebhook loads the webhook named in the path. A deleted webhook is not
+// found.
+func (s *server) loadWebhook(w http.ResponseWriter, r *http.Request) (*aggregatestore.Aggregate[Webhook], bool) {
+	id, err := uuid.FromString(r.PathValue("id"))
+	if err != nil || id.IsNil() {
+		writeError(w, http.StatusBadRequest, "invalid webhook ID")
+		return nil, false
+	}
+
+	agg, err := s.webhooks.Load(r.Context(), id, nil)
+	if errors.Is(err, aggregatestore.ErrAggregateNotFound) || (err == nil && agg.Entity().Deleted) {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return nil, false
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return agg, true
+}
+
+// webhookURL checks that a webhook URL is an absolute http or https URL.
+func webhookURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("url must be an absolute http or https URL, not %q", raw)
+	}
+	return u.String(), nil
+}
+
+// webhookEventTypes checks that each name is a board event type, and returns
+// them sorted without duplicates.
+func webhookEventTypes(names []string) ([]string, error) {
+	var known []string
+	for _, proto := range boardEventPrototypes() {
+		known = append(known, proto.EventType())
+	}
+
+	types := slices.Clone(names)
+	for _, name := range types {
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("%q is not a board event type", name)
+		}
+	}
+	slices.Sort(types)
+	return slices.Compact(types), nil
+}
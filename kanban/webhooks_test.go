@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A receiver is a webhook endpoint that records what it is sent, and fails
+// while told to. It takes delay to answer.
+type receiver struct {
+	delay time.Duration
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	failing  bool
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	time.Sleep(rc.delay)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	if rc.failing {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}
+}
+
+func (rc *receiver) fail(failing bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.failing = failing
+}
+
+// received returns the payloads sent so far.
+func (rc *receiver) received(t *testing.T) []webhookPayload {
+	t.Helper()
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	payloads := make([]webhookPayload, len(rc.bodies))
+	for i, body := range rc.bodies {
+		if err := json.Unmarshal(body, &payloads[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return payloads
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+	clock := time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC)
+	srv.webhookWorker.now = func() time.Time { return clock }
+
+	rc := &receiver{delay: 20 * time.Millisecond}
+	endpoint := httptest.NewServer(rc)
+	t.Cleanup(endpoint.Close)
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Hooked"}, &created)
+	boardID := created.Board.ID.String()
+	base := "/api/boards/" + boardID
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "To Do"}, nil)
+	do(t, h, http.MethodPost, base+"/columns", map[string]any{"title": "Done"}, nil)
+	var board boardMessage
+	do(t, h, http.MethodGet, base, nil, &board)
+	todo, done := board.Board.Columns[0].ID, board.Board.Columns[1].ID
+
+	for name, tc := range map[string]struct {
+		board string
+		body  map[string]any
+		want  int
+	}{
+		"relative URL":  {boardID, map[string]any{"url": "/hook"}, http.StatusUnprocessableEntity},
+		"ftp URL":       {boardID, map[string]any{"url": "ftp://example.com/hook"}, http.StatusUnprocessableEntity},
+		"unknown event": {boardID, map[string]any{"url": endpoint.URL, "events": []string{"cardzapped"}}, http.StatusUnprocessableEntity},
+		"unknown board": {"0195d3c4-0000-7000-8000-00000000dead", map[string]any{"url": endpoint.URL}, http.StatusNotFound},
+	} {
+		if code := do(t, h, http.MethodPost, "/api/boards/"+tc.board+"/webhooks", tc.body, nil); code != tc.want {
+			t.Errorf("%s: POST /api/boards/{id}/webhooks = %d, want %d", name, code, tc.want)
+		}
+	}
+
+	var hook webhookMessage
+	if code := do(t, h, http.MethodPost, base+"/webhooks", map[string]any{
+		"url": endpoint.URL, "events": []string{"cardmoved", "cardadded"},
+	}, &hook); code != http.StatusCreated {
+		t.Fatalf("creating a webhook = %d, want 201", code)
+	}
+	if hook.Secret == "" || hook.FromVersion != board.Version {
+		t.Fatalf("created webhook = %+v, want a secret and delivery from v%d", hook, board.Version)
+	}
+	hookPath := "/api/webhooks/" + hook.ID.String()
+
+	// the secret is shown once
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, hookPath, nil))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), hook.Secret) {
+		t.Errorf("GET %s = %d %s, want the webhook without its secret", hookPath, rec.Code, rec.Body)
+	}
+
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "first"}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+	card := board.Board.Columns[0].Cards[0].ID
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/edit", map[string]any{"title": "renamed"}, nil) // not subscribed
+	do(t, h, http.MethodPost, base+"/cards/"+card+"/move", map[string]any{"toColumnId": done}, nil)
+	do(t, h, http.MethodGet, base, nil, &board)
+
+	if _, err := srv.webhookWorker.deliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got := rc.received(t)
+	if len(got) != 2 || got[0].Type != "cardadded" || got[1].Type != "cardmoved" || got[1].Version != board.Version {
+		t.Fatalf("received %+v, want the add and the move, in order", got)
+	}
+	if got[0].BoardID != created.Board.ID || got[0].WebhookID != hook.ID || !bytes.Contains(got[0].Data, []byte(`"title":"first"`)) {
+		t.Errorf("first delivery = %+v, want the card added to this board", got[0])
+	}
+
+	// each body is signed with the secret
+	for i, body := range rc.bodies {
+		mac := hmac.New(sha256.New, []byte(hook.Secret))
+		mac.Write(body)
+		if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); rc.requests[i].Header.Get(webhookSignatureHeader) != want {
+			t.Errorf("delivery %d signed %q, want %q", i, rc.requests[i].Header.Get(webhookSignatureHeader), want)
+		}
+	}
+
+	// the checkpoint is persisted: a new worker on the same database sends
+	// nothing again
+	again, err := newWebhookWorker(ctx, srv.db, srv.events, srv.webhooks, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.now = srv.webhookWorker.now
+	if _, err := again.deliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(rc.received(t)); n != 2 {
+		t.Fatalf("a restarted worker sent %d more deliveries, want none", n-2)
+	}
+
+	// a failing receiver is retried with backoff, then the webhook is disabled
+	rc.fail(true)
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "second"}, nil)
+	for attempt := 1; attempt <= maxDeliveryAttempts; attempt++ {
+		next, err := srv.webhookWorker.deliverDue(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(rc.received(t)); n != 2+attempt {
+			t.Fatalf("after attempt %d the receiver has %d requests, want %d", attempt, n, 2+attempt)
+		}
+		if attempt == maxDeliveryAttempts {
+			if !next.IsZero() {
+				t.Errorf("last attempt scheduled another at %v", next)
+			}
+			break
+		}
+		if want := clock.Add(retryDelay(attempt)); !next.Equal(want) {
+			t.Fatalf("after attempt %d the next is at %v, want %v", attempt, next, want)
+		}
+
+		// nothing is sent before the retry is due
+		clock = next.Add(-time.Second)
+		srv.webhookWorker.deliverDue(ctx)
+		if n := len(rc.received(t)); n != 2+attempt {
+			t.Fatalf("retried %s early", time.Second)
+		}
+		clock = next
+	}
+
+	var deliveries struct {
+		Disabled   bool              `json:"disabled"`
+		Delivery   webhookPosition   `json:"delivery"`
+		Deliveries []webhookDelivery `json:"deliveries"`
+	}
+	if code := do(t, h, http.MethodGet, hookPath+"/deliveries?limit=3", nil, &deliveries); code != http.StatusOK {
+		t.Fatalf("GET deliveries = %d", code)
+	}
+	if !deliveries.Disabled || deliveries.Delivery.Failures != maxDeliveryAttempts || len(deliveries.Deliveries) != 3 {
+		t.Fatalf("deliveries = %+v, want a disabled webhook with %d failures", deliveries, maxDeliveryAttempts)
+	}
+	if last := deliveries.Deliveries[0]; last.OK || last.Status != http.StatusServiceUnavailable || last.Attempt != maxDeliveryAttempts {
+		t.Errorf("latest delivery = %+v, want attempt %d failed with a 503", last, maxDeliveryAttempts)
+	}
+	do(t, h, http.MethodGet, hookPath, nil, &hook)
+	if !strings.Contains(hook.DisabledReason, "503") {
+		t.Errorf("disabled because %q, want the last failure named", hook.DisabledReason)
+	}
+
+	// enabling picks up at the event that failed
+	rc.fail(false)
+	if code := do(t, h, http.MethodPost, hookPath+"/enable", map[string]any{}, nil); code != http.StatusOK {
+		t.Fatalf("enabling = %d, want 200", code)
+	}
+	srv.webhookWorker.deliverDue(ctx)
+	got = rc.received(t)
+	if last := got[len(got)-1]; last.Type != "cardadded" || !bytes.Contains(last.Data, []byte(`"title":"second"`)) {
+		t.Errorf("after enabling, received %+v, want the failed add", last)
+	}
+	do(t, h, http.MethodGet, hookPath+"/deliveries", nil, &deliveries)
+	if deliveries.Disabled || !deliveries.Deliveries[0].OK || deliveries.Delivery.Attempts != 0 {
+		t.Errorf("deliveries after enabling = %+v, want the last one delivered", deliveries)
+	}
+	for _, d := range deliveries.Deliveries {
+		if d.DurationMs < rc.delay.Milliseconds() {
+			t.Errorf("delivery of v%d took %dms, want at least the receiver's %v", d.Version, d.DurationMs, rc.delay)
+		}
+	}
+
+	// a deleted webhook is gone and gets nothing more
+	if code := do(t, h, http.MethodPost, hookPath+"/delete", map[string]any{}, nil); code != http.StatusOK {
+		t.Fatalf("deleting = %d, want 200", code)
+	}
+	if code := do(t, h, http.MethodGet, hookPath, nil, nil); code != http.StatusNotFound {
+		t.Errorf("GET a deleted webhook = %d, want 404", code)
+	}
+	var listed []webhookMessage
+	do(t, h, http.MethodGet, base+"/webhooks", nil, &listed)
+	if len(listed) != 0 {
+		t.Errorf("listed %+v, want no webhooks", listed)
+	}
+	sent := len(rc.received(t))
+	do(t, h, http.MethodPost, base+"/cards", map[string]any{"columnId": todo, "title": "third"}, nil)
+	srv.webhookWorker.deliverDue(ctx)
+	if n := len(rc.received(t)); n != sent {
+		t.Errorf("a deleted webhook was sent %d more events", n-sent)
+	}
+}
+
+// TestWebhookPublicOnly checks that a worker limited to public addresses
+// refuses a receiver on loopback, and that the address check sorts public
+// addresses from the rest.
+func TestWebhookPublicOnly(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	srv := newTestServer(t)
+	h := srv.routes()
+	guarded, err := newWebhookWorker(ctx, srv.db, srv.events, srv.webhooks, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc := &receiver{}
+	endpoint := httptest.NewServer(rc)
+	t.Cleanup(endpoint.Close)
+
+	var created boardMessage
+	do(t, h, http.MethodPost, "/api/boards", map[string]string{"name": "Guarded"}, &created)
+	var hook webhookMessage
+	do(t, h, http.MethodPost, "/api/boards/"+created.Board.ID.String()+"/webhooks", map[string]any{"url": endpoint.URL}, &hook)
+	do(t, h, http.MethodPost, "/api/boards/"+created.Board.ID.String()+"/columns", map[string]any{"title": "To Do"}, nil)
+
+	if _, err := guarded.deliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(rc.received(t)); n != 0 {
+		t.Fatalf("the loopback receiver was sent %d deliveries, want none", n)
+	}
+	deliveries, err := guarded.deliveries(ctx, hook.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || !strings.Contains(deliveries[0].Error, "public addresses") {
+		t.Errorf("deliveries = %+v, want one refused for its address", deliveries)
+	}
+
+	for address, public := range map[string]bool{
+		"93.184.215.14:443":      true,
+		"[2606:2800:21f::1]:443": true,
+		"127.0.0.1:80":           false,
+		"[::1]:80":               false,
+		"10.1.2.3:80":            false,
+		"172.16.0.1:80":          false,
+		"192.168.1.1:80":         false,
+		"169.254.169.254:80":     false,
+		"100.100.100.200:80":     false,
+		"0.0.0.0:80":             false,
+		"[fd00:ec2::254]:80":     false,
+		"[::ffff:127.0.0.1]:80":  false,
+		"[fe80::1]:80":           false,
+	} {
+		if err := publicDialControl("tcp", address, nil); (err == nil) != public {
+			t.Errorf("dialing %s: %v, want public %v", address, err, public)
+		}
+	}
+}